@@ -0,0 +1,215 @@
+package channeldb
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"io"
+
+	"github.com/roasbeef/btcd/wire"
+)
+
+const (
+	// backupVersion is the current version of the serialized channel
+	// backup format. It's written before the backups themselves so that
+	// future versions are able to decode older backups.
+	backupVersion uint16 = 0
+)
+
+var (
+	// ErrNoCryptoSystem is returned when a channel backup is exported or
+	// imported before an EncryptorDecryptor has been registered.
+	ErrNoCryptoSystem = fmt.Errorf("no crypto system registered for " +
+		"channel backups")
+
+	// ErrUnknownBackupVersion is returned when a channel backup is
+	// imported which was written with an unknown version.
+	ErrUnknownBackupVersion = fmt.Errorf("unknown channel backup version")
+
+	// ErrCiphertextTooShort is returned when a ciphertext passed to
+	// AESGCMCryptoSystem is too short to hold a nonce.
+	ErrCiphertextTooShort = fmt.Errorf("ciphertext too short")
+)
+
+// EncryptorDecryptor is used to encrypt and decrypt channel backups, as they
+// may be stored outside of the node itself.
+type EncryptorDecryptor interface {
+	// Encrypt encrypts the passed plaintext.
+	Encrypt(plaintext []byte) ([]byte, error)
+
+	// Decrypt decrypts the passed ciphertext, which must have been
+	// produced by Encrypt.
+	Decrypt(ciphertext []byte) ([]byte, error)
+}
+
+// AESGCMCryptoSystem is a reference EncryptorDecryptor which uses AES-256 in
+// GCM mode. A fresh random nonce is generated for each encryption, and is
+// prepended to the returned ciphertext.
+type AESGCMCryptoSystem struct {
+	aead cipher.AEAD
+}
+
+// A compile-time check to ensure AESGCMCryptoSystem implements the
+// EncryptorDecryptor interface.
+var _ EncryptorDecryptor = (*AESGCMCryptoSystem)(nil)
+
+// NewAESGCMCryptoSystem creates a new AESGCMCryptoSystem using the passed
+// 256-bit key.
+func NewAESGCMCryptoSystem(key [32]byte) (*AESGCMCryptoSystem, error) {
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AESGCMCryptoSystem{
+		aead: aead,
+	}, nil
+}
+
+// Encrypt encrypts the passed plaintext under a fresh random nonce.
+//
+// NOTE: This is part of the EncryptorDecryptor interface.
+func (a *AESGCMCryptoSystem) Encrypt(plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, a.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return a.aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// Decrypt authenticates and decrypts the passed ciphertext.
+//
+// NOTE: This is part of the EncryptorDecryptor interface.
+func (a *AESGCMCryptoSystem) Decrypt(ciphertext []byte) ([]byte, error) {
+	nonceSize := a.aead.NonceSize()
+	if len(ciphertext) < nonceSize {
+		return nil, ErrCiphertextTooShort
+	}
+
+	nonce, sealed := ciphertext[:nonceSize], ciphertext[nonceSize:]
+	return a.aead.Open(nil, nonce, sealed, nil)
+}
+
+// RegisterCryptoSystem sets the EncryptorDecryptor that will be used to
+// encrypt exported channel backups, and decrypt imported ones.
+func (d *DB) RegisterCryptoSystem(ed EncryptorDecryptor) {
+	d.cryptoSystem = ed
+}
+
+// ExportChannelBackup returns an encrypted backup of the open channel with the
+// target funding outpoint. The backup holds the minimal information needed to
+// locate the channel after a total loss of data, and to request that the
+// remote party force close it so our funds can be swept.
+func (d *DB) ExportChannelBackup(chanID *wire.OutPoint) ([]byte, error) {
+	channel, err := d.fetchChannelByOutpoint(chanID)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.encryptBackups([]*OpenChannel{channel})
+}
+
+// ExportAllBackups returns a single encrypted backup of all open channels.
+func (d *DB) ExportAllBackups() ([]byte, error) {
+	channels, err := d.FetchAllChannels()
+	if err != nil && err != ErrNoActiveChannels {
+		return nil, err
+	}
+
+	return d.encryptBackups(channels)
+}
+
+// ImportChannelBackups decrypts and decodes a backup previously produced by
+// either ExportChannelBackup or ExportAllBackups.
+//
+// NOTE: Each returned channel is a stub populated solely with the fields
+// stored in the backup. They're intended only to recover funds from the
+// remote party, and MUST NOT be written to the database.
+func (d *DB) ImportChannelBackups(backup []byte) ([]*OpenChannel, error) {
+	if d.cryptoSystem == nil {
+		return nil, ErrNoCryptoSystem
+	}
+
+	plaintext, err := d.cryptoSystem.Decrypt(backup)
+	if err != nil {
+		return nil, err
+	}
+	r := bytes.NewReader(plaintext)
+
+	var (
+		version     uint16
+		numChannels uint32
+	)
+	if err := readElements(r, &version, &numChannels); err != nil {
+		return nil, err
+	}
+	if version != backupVersion {
+		return nil, ErrUnknownBackupVersion
+	}
+
+	channels := make([]*OpenChannel, 0, numChannels)
+	for i := uint32(0); i < numChannels; i++ {
+		channel, err := deserializeChannelBackup(r)
+		if err != nil {
+			return nil, err
+		}
+		channel.Db = d
+
+		channels = append(channels, channel)
+	}
+
+	return channels, nil
+}
+
+// encryptBackups serializes a backup of each of the passed channels, then
+// encrypts the result using the registered EncryptorDecryptor.
+func (d *DB) encryptBackups(channels []*OpenChannel) ([]byte, error) {
+	if d.cryptoSystem == nil {
+		return nil, ErrNoCryptoSystem
+	}
+
+	var b bytes.Buffer
+	err := writeElements(&b, backupVersion, uint32(len(channels)))
+	if err != nil {
+		return nil, err
+	}
+	for _, channel := range channels {
+		if err := serializeChannelBackup(&b, channel); err != nil {
+			return nil, err
+		}
+	}
+
+	return d.cryptoSystem.Encrypt(b.Bytes())
+}
+
+func serializeChannelBackup(w io.Writer, c *OpenChannel) error {
+	return writeElements(w,
+		c.ChainHash, c.FundingOutpoint, c.ShortChanID, c.IdentityPub,
+		c.Capacity, c.IsInitiator, c.LocalChanCfg.MultiSigKey,
+		c.RemoteChanCfg.MultiSigKey, c.LocalChanCfg.CsvDelay,
+		c.RemoteChanCfg.CsvDelay,
+	)
+}
+
+func deserializeChannelBackup(r io.Reader) (*OpenChannel, error) {
+	c := &OpenChannel{}
+
+	err := readElements(r,
+		&c.ChainHash, &c.FundingOutpoint, &c.ShortChanID,
+		&c.IdentityPub, &c.Capacity, &c.IsInitiator,
+		&c.LocalChanCfg.MultiSigKey, &c.RemoteChanCfg.MultiSigKey,
+		&c.LocalChanCfg.CsvDelay, &c.RemoteChanCfg.CsvDelay,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
@@ -0,0 +1,218 @@
+package channeldb
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/davecgh/go-spew/spew"
+)
+
+// mockCryptoSystem is a trivial EncryptorDecryptor that XORs each byte with a
+// fixed key.
+type mockCryptoSystem struct {
+	key byte
+}
+
+func (m *mockCryptoSystem) xor(b []byte) []byte {
+	out := make([]byte, len(b))
+	for i := range b {
+		out[i] = b[i] ^ m.key
+	}
+	return out
+}
+
+func (m *mockCryptoSystem) Encrypt(plaintext []byte) ([]byte, error) {
+	return m.xor(plaintext), nil
+}
+
+func (m *mockCryptoSystem) Decrypt(ciphertext []byte) ([]byte, error) {
+	return m.xor(ciphertext), nil
+}
+
+// assertBackupMatches asserts that a channel recovered from a backup carries
+// the same backed up fields as the original channel.
+func assertBackupMatches(t *testing.T, expected, recovered *OpenChannel) {
+	if recovered.FundingOutpoint != expected.FundingOutpoint {
+		t.Fatalf("funding outpoint mismatch: expected %v, got %v",
+			expected.FundingOutpoint, recovered.FundingOutpoint)
+	}
+	if recovered.ChainHash != expected.ChainHash {
+		t.Fatalf("chain hash mismatch: expected %v, got %v",
+			expected.ChainHash, recovered.ChainHash)
+	}
+	if !recovered.IdentityPub.IsEqual(expected.IdentityPub) {
+		t.Fatalf("remote node key mismatch")
+	}
+	if recovered.Capacity != expected.Capacity {
+		t.Fatalf("capacity mismatch: expected %v, got %v",
+			expected.Capacity, recovered.Capacity)
+	}
+	if !reflect.DeepEqual(recovered.LocalChanCfg.MultiSigKey,
+		expected.LocalChanCfg.MultiSigKey) {
+
+		t.Fatalf("local multisig key mismatch: expected %v, got %v",
+			spew.Sdump(expected.LocalChanCfg.MultiSigKey),
+			spew.Sdump(recovered.LocalChanCfg.MultiSigKey))
+	}
+	if !reflect.DeepEqual(recovered.RemoteChanCfg.MultiSigKey,
+		expected.RemoteChanCfg.MultiSigKey) {
+
+		t.Fatalf("remote multisig key mismatch: expected %v, got %v",
+			spew.Sdump(expected.RemoteChanCfg.MultiSigKey),
+			spew.Sdump(recovered.RemoteChanCfg.MultiSigKey))
+	}
+	if recovered.LocalChanCfg.CsvDelay != expected.LocalChanCfg.CsvDelay ||
+		recovered.RemoteChanCfg.CsvDelay != expected.RemoteChanCfg.CsvDelay {
+
+		t.Fatalf("csv delay mismatch")
+	}
+}
+
+// TestChannelBackupRoundTrip tests that channels exported as an encrypted
+// backup can be imported with their funding outpoints and keys intact.
+func TestChannelBackupRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	defer cleanUp()
+
+	var channels []*OpenChannel
+	for i := 0; i < 2; i++ {
+		state, err := createTestChannelState(cdb)
+		if err != nil {
+			t.Fatalf("unable to create channel state: %v", err)
+		}
+		state.FundingOutpoint.Index = uint32(i)
+
+		if err := syncTestChannel(state); err != nil {
+			t.Fatalf("unable to save and serialize channel "+
+				"state: %v", err)
+		}
+		channels = append(channels, state)
+	}
+
+	// Without a registered crypto system, no backup should be exported.
+	_, err = cdb.ExportAllBackups()
+	if err != ErrNoCryptoSystem {
+		t.Fatalf("expected ErrNoCryptoSystem, got %v", err)
+	}
+
+	cdb.RegisterCryptoSystem(&mockCryptoSystem{key: 0xaa})
+
+	// A backup of a single channel should contain only that channel.
+	backup, err := cdb.ExportChannelBackup(&channels[1].FundingOutpoint)
+	if err != nil {
+		t.Fatalf("unable to export channel backup: %v", err)
+	}
+	recovered, err := cdb.ImportChannelBackups(backup)
+	if err != nil {
+		t.Fatalf("unable to import channel backup: %v", err)
+	}
+	if len(recovered) != 1 {
+		t.Fatalf("expected 1 channel, got %v", len(recovered))
+	}
+	assertBackupMatches(t, channels[1], recovered[0])
+
+	// A backup of all channels should contain every channel.
+	backup, err = cdb.ExportAllBackups()
+	if err != nil {
+		t.Fatalf("unable to export all backups: %v", err)
+	}
+	recovered, err = cdb.ImportChannelBackups(backup)
+	if err != nil {
+		t.Fatalf("unable to import channel backups: %v", err)
+	}
+	if len(recovered) != len(channels) {
+		t.Fatalf("expected %v channels, got %v", len(channels),
+			len(recovered))
+	}
+	for _, channel := range channels {
+		var found bool
+		for _, r := range recovered {
+			if r.FundingOutpoint != channel.FundingOutpoint {
+				continue
+			}
+
+			assertBackupMatches(t, channel, r)
+			found = true
+		}
+		if !found {
+			t.Fatalf("channel %v not found in backup",
+				channel.FundingOutpoint)
+		}
+	}
+
+	// The backup shouldn't contain the serialized channels in plaintext.
+	var plaintext bytes.Buffer
+	if err := serializeChannelBackup(&plaintext, channels[0]); err != nil {
+		t.Fatalf("unable to serialize backup: %v", err)
+	}
+	if bytes.Contains(backup, plaintext.Bytes()) {
+		t.Fatalf("backup wasn't encrypted")
+	}
+
+	// Finally, exporting a channel that doesn't exist should fail.
+	unknown := channels[0].FundingOutpoint
+	unknown.Index = 100
+	if _, err := cdb.ExportChannelBackup(&unknown); err != ErrChannelNotFound {
+		t.Fatalf("expected ErrChannelNotFound, got %v", err)
+	}
+}
+
+// TestAESGCMCryptoSystem tests that the AES-GCM reference EncryptorDecryptor
+// round trips plaintext, and rejects tampered or truncated ciphertext.
+func TestAESGCMCryptoSystem(t *testing.T) {
+	t.Parallel()
+
+	var key [32]byte
+	copy(key[:], bytes.Repeat([]byte{0x42}, 32))
+
+	cryptoSystem, err := NewAESGCMCryptoSystem(key)
+	if err != nil {
+		t.Fatalf("unable to create crypto system: %v", err)
+	}
+
+	plaintext := []byte("channel backup plaintext")
+	ciphertext, err := cryptoSystem.Encrypt(plaintext)
+	if err != nil {
+		t.Fatalf("unable to encrypt: %v", err)
+	}
+	if bytes.Contains(ciphertext, plaintext) {
+		t.Fatalf("ciphertext contains plaintext")
+	}
+
+	// Encrypting the same plaintext twice should yield distinct
+	// ciphertexts, as a fresh nonce is used each time.
+	ciphertext2, err := cryptoSystem.Encrypt(plaintext)
+	if err != nil {
+		t.Fatalf("unable to encrypt: %v", err)
+	}
+	if bytes.Equal(ciphertext, ciphertext2) {
+		t.Fatalf("nonce was reused across encryptions")
+	}
+
+	decrypted, err := cryptoSystem.Decrypt(ciphertext)
+	if err != nil {
+		t.Fatalf("unable to decrypt: %v", err)
+	}
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Fatalf("plaintext mismatch: expected %x, got %x", plaintext,
+			decrypted)
+	}
+
+	// Flipping a bit of the ciphertext should cause authentication to
+	// fail.
+	tampered := append([]byte(nil), ciphertext...)
+	tampered[len(tampered)-1] ^= 0x01
+	if _, err := cryptoSystem.Decrypt(tampered); err == nil {
+		t.Fatalf("tampered ciphertext was decrypted")
+	}
+
+	if _, err := cryptoSystem.Decrypt([]byte{0x01}); err != ErrCiphertextTooShort {
+		t.Fatalf("expected ErrCiphertextTooShort, got %v", err)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"io"
 	"net"
 	"sync"
+	"time"
 
 	"github.com/coreos/bbolt"
 	"github.com/lightningnetwork/lnd/keychain"
@@ -14,15 +15,27 @@ import (
 	"github.com/lightningnetwork/lnd/shachain"
 	"github.com/roasbeef/btcd/btcec"
 	"github.com/roasbeef/btcd/chaincfg/chainhash"
+	"github.com/roasbeef/btcd/txscript"
 	"github.com/roasbeef/btcd/wire"
 	"github.com/roasbeef/btcutil"
 )
 
 var (
 	// closedChannelBucket stores summarization information concerning
-	// previously open, but now closed channels.
+	// previously open, but now closed channels. This bucket has a nested
+	// bucket for each node we formerly had channels with, keyed by the
+	// node's ID, within which each summary is keyed by its channel point.
+	//
+	// closedChan -> nodeID -> chanPoint
 	closedChannelBucket = []byte("closed-chan-bucket")
 
+	// unknownNodeKey is the key of the bucket within the closed channel
+	// bucket which houses the summaries of channels whose remote node is
+	// unknown. Older databases stored only the channel point of some
+	// closed channels, so these channels are moved here when migrating to
+	// the per-node layout.
+	unknownNodeKey = []byte("unknown-node")
+
 	// openChanBucket stores all the currently open channels. This bucket
 	// has a second, nested bucket which is keyed by a node's ID. Within
 	// that node ID bucket, all attributes required to track, update, and
@@ -51,6 +64,15 @@ var (
 	// preimage producer and their preimage store.
 	revocationStateKey = []byte("revocation-state-key")
 
+	// lastUpdateKey stores the time at which the commitment state of
+	// either party was last updated. A value of zero denotes that the time
+	// is unknown, or that the channel hasn't yet been updated.
+	lastUpdateKey = []byte("last-update-key")
+
+	// closeNegotiationKey stores the latest fee negotiation state of an
+	// in-progress cooperative close.
+	closeNegotiationKey = []byte("close-negotiation-key")
+
 	// commitDiffKey stores the current pending commitment state we've
 	// extended to the remote party (if any). Each time we propose a new
 	// state, we store the information necessary to reconstruct this state
@@ -97,8 +119,45 @@ var (
 	// decoded because the byte slice is of an invalid length.
 	ErrInvalidCircuitKeyLen = fmt.Errorf(
 		"length of serialized circuit key must be 16 bytes")
+
+	// ErrDerivedKeyMismatch is returned when a key re-derived from its
+	// KeyLocator doesn't match the public key stored on disk for the same
+	// descriptor.
+	ErrDerivedKeyMismatch = fmt.Errorf("derived key doesn't match " +
+		"stored key")
+
+	// ErrInvalidCommitSig is returned when the signature stored for our
+	// local commitment transaction doesn't verify under the remote
+	// party's multi-sig key.
+	ErrInvalidCommitSig = fmt.Errorf("invalid commitment signature")
 )
 
+// ErrCorruptFundingInfo is returned when the static funding information of a
+// channel, which is written once the funding flow completes, can't be parsed.
+// It identifies both the channel, and the field which failed to be read.
+type ErrCorruptFundingInfo struct {
+	// ChanPoint is the funding outpoint of the channel whose record is
+	// corrupt.
+	ChanPoint wire.OutPoint
+
+	// Field describes the field that we were unable to read.
+	Field string
+
+	// Err is the underlying error encountered while reading the field.
+	Err error
+}
+
+// Error returns a human readable string describing the error.
+func (e ErrCorruptFundingInfo) Error() string {
+	return fmt.Sprintf("corrupt funding info for chan_point=%v: unable "+
+		"to read %v: %v", e.ChanPoint, e.Field, e.Err)
+}
+
+// KeyDeriver is a function closure that's able to re-derive a public key from
+// its KeyLocator. This is typically backed by the KeyRing of the wallet that
+// originally derived the channel keys.
+type KeyDeriver func(keyLoc keychain.KeyLocator) (*btcec.PublicKey, error)
+
 // ChannelType is an enum-like type that describes one of several possible
 // channel types. Each open channel is associated with a particular type as the
 // channel type may determine how higher level operations are conducted such as
@@ -120,6 +179,18 @@ const (
 	DualFunder = 1
 )
 
+// IsSingleFunder returns true if the channel type is one of the known single
+// funder variants.
+func (c ChannelType) IsSingleFunder() bool {
+	return c == SingleFunder
+}
+
+// IsDualFunder returns true if the channel type is one of the known dual
+// funder variants.
+func (c ChannelType) IsDualFunder() bool {
+	return c == DualFunder
+}
+
 // ChannelConstraints represents a set of constraints meant to allow a node to
 // limit their exposure, enact flow control and ensure that all HTLCs are
 // economically relevant This struct will be mirrored for both sides of the
@@ -211,6 +282,39 @@ type ChannelConfig struct {
 	HtlcBasePoint keychain.KeyDescriptor
 }
 
+// DeriveKeys re-derives each of the keys within the channel config from its
+// KeyLocator using the passed KeyDeriver. If a public key for the descriptor
+// was also read from disk, then it's used as a cross-check against the
+// derived key, and ErrDerivedKeyMismatch is returned if they differ.
+// Otherwise, the derived key is populated within the descriptor.
+//
+// NOTE: The locator of every descriptor is persisted, but only those of our
+// own keys locate a key within our wallet, so this should only be called on
+// the local channel config. As the zero KeyLocator is a valid locator for the
+// first multi-sig key, every locator is derived, including the zero value.
+func (c *ChannelConfig) DeriveKeys(derive KeyDeriver) error {
+	keyDescs := []*keychain.KeyDescriptor{
+		&c.MultiSigKey, &c.RevocationBasePoint, &c.PaymentBasePoint,
+		&c.DelayBasePoint, &c.HtlcBasePoint,
+	}
+	for _, keyDesc := range keyDescs {
+		pubKey, err := derive(keyDesc.KeyLocator)
+		if err != nil {
+			return err
+		}
+
+		if keyDesc.PubKey != nil && !keyDesc.PubKey.IsEqual(pubKey) {
+			return fmt.Errorf("%v: family=%v, index=%v",
+				ErrDerivedKeyMismatch, keyDesc.Family,
+				keyDesc.Index)
+		}
+
+		keyDesc.PubKey = pubKey
+	}
+
+	return nil
+}
+
 // ChannelCommitment is a snapshot of the commitment state at a particular
 // point in the commitment chain. With each state transition, a snapshot of the
 // current state along with all non-settled HTLCs are recorded. These snapshots
@@ -285,6 +389,32 @@ type ChannelCommitment struct {
 	//  * lets just walk through
 }
 
+// SettledBalances returns the balance of each party within the commitment
+// that isn't locked up within an outstanding HTLC. As the amount of each HTLC
+// is deducted from the offering party's balance once it has been added to the
+// commitment, these are the commitment balances themselves, rounded down to
+// the nearest satoshi.
+func (c *ChannelCommitment) SettledBalances() (btcutil.Amount, btcutil.Amount) {
+	return c.LocalBalance.ToSatoshis(), c.RemoteBalance.ToSatoshis()
+}
+
+// InFlightBalances returns the total amount each party has committed to
+// outstanding HTLCs within the commitment. Outgoing HTLCs are those offered
+// by the local node, while incoming HTLCs are those offered by the remote
+// node.
+func (c *ChannelCommitment) InFlightBalances() (btcutil.Amount, btcutil.Amount) {
+	var localInFlight, remoteInFlight lnwire.MilliSatoshi
+	for _, htlc := range c.Htlcs {
+		if htlc.Incoming {
+			remoteInFlight += htlc.Amt
+		} else {
+			localInFlight += htlc.Amt
+		}
+	}
+
+	return localInFlight.ToSatoshis(), remoteInFlight.ToSatoshis()
+}
+
 // OpenChannel encapsulates the persistent and dynamic state of an open channel
 // with a remote node. An open channel supports several options for on-disk
 // serialization depending on the exact context. Full (upon channel creation)
@@ -292,6 +422,12 @@ type ChannelCommitment struct {
 // supported. Each partial write due to a state update appends the new update
 // to an on-disk log, which can then subsequently be queried in order to
 // "time-travel" to a prior state.
+//
+// The embedded RWMutex guards the in-memory fields of the channel. Methods
+// that modify these fields, either directly or by reloading them from disk,
+// hold the write lock, while methods that only read them, such as Snapshot,
+// hold the read lock. Callers that access the fields directly while the
+// channel is shared between goroutines must do the same.
 type OpenChannel struct {
 	// ChanType denotes which type of channel this is.
 	ChanType ChannelType
@@ -357,6 +493,12 @@ type OpenChannel struct {
 	// received within this channel.
 	TotalMSatReceived lnwire.MilliSatoshi
 
+	// LastUpdateTime is the time at which the commitment state of either
+	// party was last updated. This will be the zero time if the channel
+	// hasn't been updated since it was created, or was last updated before
+	// the time was recorded.
+	LastUpdateTime time.Time
+
 	// LocalChanCfg is the channel configuration for the local node.
 	LocalChanCfg ChannelConfig
 
@@ -411,6 +553,12 @@ type OpenChannel struct {
 	// for which we are the initiator.
 	FundingTxn *wire.MsgTx
 
+	// revLogTail caches the decoded tail of the revocation log, such that
+	// appending a new entry doesn't require replaying the log in order to
+	// find the state the entry is encoded against. It's nil until an entry
+	// has been appended through this instance.
+	revLogTail *revocationLogTail
+
 	// TODO(roasbeef): eww
 	Db *DB
 
@@ -529,7 +677,21 @@ func (c *OpenChannel) fullSync(tx *bolt.Tx) error {
 		return err
 	}
 
-	return putOpenChannel(chanBucket, c)
+	// If the channel hasn't been written before, then we'll record its
+	// opening within the event log.
+	isNew := chanBucket.Get(chanInfoKey) == nil
+
+	if err := putOpenChannel(chanBucket, c); err != nil {
+		return err
+	}
+
+	if !isNew {
+		return nil
+	}
+	return putLifecycleEvent(tx, &c.FundingOutpoint, LifecycleEvent{
+		Type:      LifecycleOpen,
+		UpdateNum: c.LocalCommitment.CommitHeight,
+	})
 }
 
 // MarkAsOpen marks a channel as fully open given a locator that uniquely
@@ -564,6 +726,30 @@ func (c *OpenChannel) MarkAsOpen(openLoc lnwire.ShortChannelID) error {
 	return nil
 }
 
+// IsFundingConfirmed returns true if the funding transaction of the channel
+// has confirmed within the chain, and the channel marked as open via
+// MarkAsOpen.
+func (c *OpenChannel) IsFundingConfirmed() bool {
+	c.RLock()
+	defer c.RUnlock()
+
+	return !c.IsPending
+}
+
+// FundingConfHeight returns the height at which the funding transaction of
+// the channel confirmed, as recorded within its short channel ID. If the
+// funding transaction hasn't yet confirmed, then zero is returned.
+func (c *OpenChannel) FundingConfHeight() uint32 {
+	c.RLock()
+	defer c.RUnlock()
+
+	if c.IsPending {
+		return 0
+	}
+
+	return c.ShortChanID.BlockHeight
+}
+
 // MarkBorked marks the event when the channel as reached an irreconcilable
 // state, such as a channel breach or state desynchronization. Borked channels
 // should never be added to the switch.
@@ -616,11 +802,21 @@ func putOpenChannel(chanBucket *bolt.Bucket, channel *OpenChannel) error {
 		return fmt.Errorf("unable to store chan revocations: %v", err)
 	}
 
+	err := putChanLastUpdate(chanBucket, channel.LastUpdateTime)
+	if err != nil {
+		return fmt.Errorf("unable to store chan last update: %v", err)
+	}
+
 	return nil
 }
 
-// fetchOpenChannel retrieves, and deserializes (including decrypting
-// sensitive) the complete channel currently active with the passed nodeID.
+// fetchOpenChannel retrieves, and deserializes the complete channel currently
+// active with the passed nodeID.
+//
+// NOTE: No channel state is encrypted at rest, as the channel doesn't store
+// any private key material. Our keys are instead re-derived from the key
+// locators within each ChannelConfig, so there's no encryptor to register
+// before reading or writing a channel.
 func fetchOpenChannel(chanBucket *bolt.Bucket,
 	chanPoint *wire.OutPoint) (*OpenChannel, error) {
 
@@ -646,6 +842,8 @@ func fetchOpenChannel(chanBucket *bolt.Bucket,
 		return nil, fmt.Errorf("unable to fetch chan revocations: %v", err)
 	}
 
+	channel.LastUpdateTime = fetchChanLastUpdate(chanBucket)
+
 	channel.Packager = NewChannelPackager(channel.ShortChanID)
 
 	return channel, nil
@@ -703,10 +901,17 @@ func (c *OpenChannel) SyncPending(addr net.Addr, pendingHeight uint32) error {
 // state at this point in the commitment chain. This method its to be called on
 // two occasions: when we revoke our prior commitment state, and when the
 // remote party revokes their prior commitment state.
+//
+// NOTE: The settled balances of both parties are stored within the
+// commitment, rather than alongside it, as settling an HTLC always results in
+// a new commitment. As a result, there's no lighter method to update the
+// balances alone, as doing so would leave them out of sync with the
+// commitment transaction.
 func (c *OpenChannel) UpdateCommitment(newCommitment *ChannelCommitment) error {
 	c.Lock()
 	defer c.Unlock()
 
+	updateTime := time.Unix(0, time.Now().UnixNano())
 	err := c.Db.Update(func(tx *bolt.Tx) error {
 		chanBucket, err := updateChanBucket(tx, c.IdentityPub,
 			&c.FundingOutpoint, c.ChainHash)
@@ -726,13 +931,14 @@ func (c *OpenChannel) UpdateCommitment(newCommitment *ChannelCommitment) error {
 				"revocations: %v", err)
 		}
 
-		return nil
+		return putChanLastUpdate(chanBucket, updateTime)
 	})
 	if err != nil {
 		return err
 	}
 
 	c.LocalCommitment = *newCommitment
+	c.LastUpdateTime = updateTime
 
 	return nil
 }
@@ -762,7 +968,8 @@ type HTLC struct {
 	RefundTimeout uint32
 
 	// OutputIndex is the output index for this particular HTLC output
-	// within the commitment transaction.
+	// within the commitment transaction. If the HTLC is dust, and so has
+	// no output within the commitment transaction, then this is -1.
 	OutputIndex int32
 
 	// Incoming denotes whether we're the receiver or the sender of this
@@ -796,12 +1003,8 @@ func SerializeHtlcs(b io.Writer, htlcs ...HTLC) error {
 		return err
 	}
 
-	for _, htlc := range htlcs {
-		if err := writeElements(b,
-			htlc.Signature, htlc.RHash, htlc.Amt, htlc.RefundTimeout,
-			htlc.OutputIndex, htlc.Incoming, htlc.OnionBlob[:],
-			htlc.HtlcIndex, htlc.LogIndex,
-		); err != nil {
+	for i := range htlcs {
+		if err := serializeHtlc(b, &htlcs[i]); err != nil {
 			return err
 		}
 	}
@@ -809,6 +1012,22 @@ func SerializeHtlcs(b io.Writer, htlcs ...HTLC) error {
 	return nil
 }
 
+func serializeHtlc(w io.Writer, htlc *HTLC) error {
+	return writeElements(w,
+		htlc.Signature, htlc.RHash, htlc.Amt, htlc.RefundTimeout,
+		htlc.OutputIndex, htlc.Incoming, htlc.OnionBlob[:],
+		htlc.HtlcIndex, htlc.LogIndex,
+	)
+}
+
+func deserializeHtlc(r io.Reader, htlc *HTLC) error {
+	return readElements(r,
+		&htlc.Signature, &htlc.RHash, &htlc.Amt, &htlc.RefundTimeout,
+		&htlc.OutputIndex, &htlc.Incoming, &htlc.OnionBlob,
+		&htlc.HtlcIndex, &htlc.LogIndex,
+	)
+}
+
 // DeserializeHtlcs attempts to read out a slice of HTLC's from the passed
 // io.Reader. The bytes within the passed reader MUST have been previously
 // written to using the SerializeHtlcs function.
@@ -828,12 +1047,7 @@ func DeserializeHtlcs(r io.Reader) ([]HTLC, error) {
 
 	htlcs = make([]HTLC, numHtlcs)
 	for i := uint16(0); i < numHtlcs; i++ {
-		if err := readElements(r,
-			&htlcs[i].Signature, &htlcs[i].RHash, &htlcs[i].Amt,
-			&htlcs[i].RefundTimeout, &htlcs[i].OutputIndex,
-			&htlcs[i].Incoming, &htlcs[i].OnionBlob,
-			&htlcs[i].HtlcIndex, &htlcs[i].LogIndex,
-		); err != nil {
+		if err := deserializeHtlc(r, &htlcs[i]); err != nil {
 			return htlcs, err
 		}
 	}
@@ -1242,8 +1456,12 @@ func (c *OpenChannel) AdvanceCommitChainTail(fwdPkg *FwdPkg) error {
 	c.Lock()
 	defer c.Unlock()
 
-	var newRemoteCommit *ChannelCommitment
+	var (
+		newRemoteCommit *ChannelCommitment
+		newLogTail      *revocationLogTail
+	)
 
+	updateTime := time.Unix(0, time.Now().UnixNano())
 	err := c.Db.Update(func(tx *bolt.Tx) error {
 		chanBucket, err := updateChanBucket(tx, c.IdentityPub,
 			&c.FundingOutpoint, c.ChainHash)
@@ -1261,10 +1479,6 @@ func (c *OpenChannel) AdvanceCommitChainTail(fwdPkg *FwdPkg) error {
 		// With the current preimage producer/store state updated,
 		// append a new log entry recording this the delta of this
 		// state transition.
-		//
-		// TODO(roasbeef): could make the deltas relative, would save
-		// space, but then tradeoff for more disk-seeks to recover the
-		// full state.
 		logKey := revocationLogBucket
 		logBucket, err := chanBucket.CreateBucketIfNotExists(logKey)
 		if err != nil {
@@ -1290,9 +1504,9 @@ func (c *OpenChannel) AdvanceCommitChainTail(fwdPkg *FwdPkg) error {
 
 		// With the commitment pointer swapped, we can now add the
 		// revoked (prior) state to the revocation log.
-		//
-		// TODO(roasbeef): store less
-		err = appendChannelLogEntry(logBucket, &c.RemoteCommitment)
+		newLogTail, err = appendChannelLogEntry(
+			logBucket, &c.RemoteCommitment, c.revLogTail, false,
+		)
 		if err != nil {
 			return err
 		}
@@ -1304,6 +1518,10 @@ func (c *OpenChannel) AdvanceCommitChainTail(fwdPkg *FwdPkg) error {
 			return err
 		}
 
+		if err := putChanLastUpdate(chanBucket, updateTime); err != nil {
+			return err
+		}
+
 		newRemoteCommit = &newCommit.Commitment
 
 		return nil
@@ -1316,6 +1534,48 @@ func (c *OpenChannel) AdvanceCommitChainTail(fwdPkg *FwdPkg) error {
 	// pointer of the new remote commitment, which was previously the tip
 	// of the commit chain.
 	c.RemoteCommitment = *newRemoteCommit
+	c.LastUpdateTime = updateTime
+	c.revLogTail = newLogTail
+
+	return nil
+}
+
+// ReplayRevocationLogEntry writes the passed revoked commitment of the remote
+// party to the revocation log, overwriting any entry already stored at its
+// height. Unlike AdvanceCommitChainTail, which rejects states that don't
+// extend the log with ErrNonMonotonicUpdate, this allows an entry written in
+// error to be corrected. As the entry following the replaced one may have been
+// stored as a diff against it, that entry is rewritten in full.
+func (c *OpenChannel) ReplayRevocationLogEntry(
+	commit *ChannelCommitment) error {
+
+	c.Lock()
+	defer c.Unlock()
+
+	var newLogTail *revocationLogTail
+	err := c.Db.Update(func(tx *bolt.Tx) error {
+		chanBucket, err := updateChanBucket(tx, c.IdentityPub,
+			&c.FundingOutpoint, c.ChainHash)
+		if err != nil {
+			return err
+		}
+
+		logKey := revocationLogBucket
+		logBucket, err := chanBucket.CreateBucketIfNotExists(logKey)
+		if err != nil {
+			return err
+		}
+
+		newLogTail, err = appendChannelLogEntry(
+			logBucket, commit, c.revLogTail, true,
+		)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	c.revLogTail = newLogTail
 
 	return nil
 }
@@ -1387,13 +1647,15 @@ func (c *OpenChannel) RevocationLogTail() (*ChannelCommitment, error) {
 		// store the update number on disk in a big-endian format,
 		// this will retrieve the latest entry.
 		cursor := logBucket.Cursor()
-		_, tailLogEntry := cursor.Last()
-		logEntryReader := bytes.NewReader(tailLogEntry)
+		tailLogKey, _ := cursor.Last()
+		if tailLogKey == nil {
+			return ErrNoPastDeltas
+		}
 
-		// Once we have the entry, we'll decode it into the channel
-		// delta pointer we created above.
+		// Once we have the key of the entry, we'll reconstruct it into
+		// the channel delta pointer we created above.
 		var dbErr error
-		commit, dbErr = deserializeChanCommit(logEntryReader)
+		commit, _, dbErr = replayChannelLog(logBucket, tailLogKey)
 		if dbErr != nil {
 			return dbErr
 		}
@@ -1406,6 +1668,56 @@ func (c *OpenChannel) RevocationLogTail() (*ChannelCommitment, error) {
 	return &commit, nil
 }
 
+// VerifyUpdateCount compares the height of the remote commitment stored on
+// disk against the number of remote states recorded within the revocation
+// log. As each revoked state is appended to the log within the same
+// transaction that stores its successor, the two should always be equal. Both
+// values are returned so callers that detect a mismatch can decide how to
+// repair the channel.
+//
+// NOTE: The logged count is derived from the height of the tail of the log,
+// rather than the number of entries within it, as the log may have been
+// pruned. If the log is empty, the logged count is zero.
+func (c *OpenChannel) VerifyUpdateCount() (uint64, uint64, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	var stored, logged uint64
+	err := c.Db.View(func(tx *bolt.Tx) error {
+		chanBucket, err := readChanBucket(tx, c.IdentityPub,
+			&c.FundingOutpoint, c.ChainHash)
+		if err != nil {
+			return err
+		}
+
+		remoteCommit, err := fetchChanCommitment(chanBucket, false)
+		if err != nil {
+			return err
+		}
+		stored = remoteCommit.CommitHeight
+
+		logBucket := chanBucket.Bucket(revocationLogBucket)
+		if logBucket == nil {
+			return nil
+		}
+
+		// Log entries are keyed by their big-endian commitment
+		// height, so the last key belongs to the most recently
+		// revoked state.
+		tailLogKey, _ := logBucket.Cursor().Last()
+		if tailLogKey != nil {
+			logged = byteOrder.Uint64(tailLogKey) + 1
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return stored, logged, nil
+}
+
 // CommitmentHeight returns the current commitment height. The commitment
 // height represents the number of updates to the commitment state to data.
 // This value is always monotonically increasing. This method is provided in
@@ -1477,6 +1789,187 @@ func (c *OpenChannel) FindPreviousState(updateNum uint64) (*ChannelCommitment, e
 	return &commit, nil
 }
 
+// RevocationLogEntry holds the information needed to remedy a breach of the
+// channel by the remote party at a particular commitment height.
+type RevocationLogEntry struct {
+	// Commitment is the revoked remote commitment at the target height.
+	// The outputs to sweep are those of its commitment transaction,
+	// including any HTLC outputs as indicated by the OutputIndex of each
+	// HTLC.
+	Commitment ChannelCommitment
+
+	// RevocationPreimage is the preimage revealed by the remote party when
+	// revoking the commitment.
+	RevocationPreimage chainhash.Hash
+}
+
+// FetchRevocationLogEntry returns the breach remedy information for the
+// revoked remote commitment at the target height. The commitment is read from
+// the revocation log, which is keyed by the big-endian commitment height,
+// while the preimage is derived from the remote party's revocation store.
+func (c *OpenChannel) FetchRevocationLogEntry(height uint64) (*RevocationLogEntry, error) {
+	commit, err := c.FindPreviousState(height)
+	if err != nil {
+		return nil, err
+	}
+
+	c.RLock()
+	defer c.RUnlock()
+
+	preimage, err := c.RevocationStore.LookUp(height)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RevocationLogEntry{
+		Commitment:         *commit,
+		RevocationPreimage: *preimage,
+	}, nil
+}
+
+// FetchChannelDeltas returns all prior remote commitment states stored within
+// the revocation log whose update numbers fall within the inclusive range
+// [startUpdate, endUpdate]. The states are returned in ascending update
+// order. If no states within the range have been recorded, then an empty
+// slice is returned.
+func (c *OpenChannel) FetchChannelDeltas(startUpdate,
+	endUpdate uint64) ([]*ChannelCommitment, error) {
+
+	c.RLock()
+	defer c.RUnlock()
+
+	commits := make([]*ChannelCommitment, 0)
+	if startUpdate > endUpdate {
+		return commits, nil
+	}
+
+	err := c.Db.View(func(tx *bolt.Tx) error {
+		chanBucket, err := readChanBucket(tx, c.IdentityPub,
+			&c.FundingOutpoint, c.ChainHash)
+		if err != nil {
+			return err
+		}
+
+		logBucket := chanBucket.Bucket(revocationLogBucket)
+		if logBucket == nil {
+			return nil
+		}
+
+		// As the update number is stored on disk in a big-endian
+		// format, we can seek directly to the start of the range and
+		// walk forward until we pass the end of the range. The first
+		// entry is fully reconstructed, after which each subsequent
+		// entry can be decoded relative to the one before it.
+		startKey := makeLogKey(startUpdate)
+		cursor := logBucket.Cursor()
+		for k, v := cursor.Seek(startKey[:]); k != nil; k, v = cursor.Next() {
+			if byteOrder.Uint64(k) > endUpdate {
+				break
+			}
+
+			var (
+				commit ChannelCommitment
+				err    error
+			)
+			if len(commits) == 0 {
+				commit, _, err = replayChannelLog(logBucket, k)
+			} else {
+				prior := commits[len(commits)-1]
+				commit, err = decodeChannelLogEntry(v, prior)
+			}
+			if err != nil {
+				return err
+			}
+
+			commits = append(commits, &commit)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return commits, nil
+}
+
+// PruneChannelLog deletes entries from the revocation log in order to bound
+// its growth. Only the keepLastN most recent states below the current remote
+// commitment height are retained. As the remote party may still broadcast
+// any state at or above minRetainedUpdate, no entry at or above that update
+// number will ever be removed, regardless of keepLastN.
+func (c *OpenChannel) PruneChannelLog(keepLastN, minRetainedUpdate uint64) error {
+	c.Lock()
+	defer c.Unlock()
+
+	numUpdates := c.RemoteCommitment.CommitHeight
+	if keepLastN >= numUpdates {
+		return nil
+	}
+
+	pruneBelow := numUpdates - keepLastN
+	if pruneBelow > minRetainedUpdate {
+		pruneBelow = minRetainedUpdate
+	}
+
+	return c.Db.Update(func(tx *bolt.Tx) error {
+		chanBucket, err := updateChanBucket(tx, c.IdentityPub,
+			&c.FundingOutpoint, c.ChainHash)
+		if err != nil {
+			return err
+		}
+
+		logBucket := chanBucket.Bucket(revocationLogBucket)
+		if logBucket == nil {
+			return nil
+		}
+
+		// We'll first gather the keys of all the entries to be
+		// pruned, as deleting while advancing the cursor may cause
+		// entries to be skipped.
+		var (
+			staleKeys [][]byte
+			firstKey  []byte
+		)
+		cursor := logBucket.Cursor()
+		for k, _ := cursor.First(); k != nil; k, _ = cursor.Next() {
+			if byteOrder.Uint64(k) >= pruneBelow {
+				firstKey = append([]byte(nil), k...)
+				break
+			}
+
+			staleKeys = append(staleKeys, append([]byte(nil), k...))
+		}
+
+		if len(staleKeys) == 0 {
+			return nil
+		}
+
+		// The first retained entry may be a diff against an entry
+		// we're about to prune, so we'll reconstruct it now in order
+		// to rewrite it as a full entry once the pruning is done.
+		var firstCommit ChannelCommitment
+		if firstKey != nil {
+			firstCommit, _, err = replayChannelLog(logBucket, firstKey)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, k := range staleKeys {
+			if err := logBucket.Delete(k); err != nil {
+				return err
+			}
+		}
+
+		if firstKey == nil {
+			return nil
+		}
+
+		return putFullChannelLogEntry(logBucket, firstKey, &firstCommit)
+	})
+}
+
 // ClosureType is an enum like structure that details exactly _how_ a channel
 // was closed. Three closure types are currently possible: cooperative, force,
 // and breach.
@@ -1502,6 +1995,11 @@ const (
 	// we or the remote fail at some point during the opening workflow, or
 	// we timeout waiting for the funding transaction to be confirmed.
 	FundingCanceled
+
+	// UnknownClose indicates that the closed channel summary was written
+	// by an older version of the database which only recorded the channel
+	// point, so the manner in which the channel was closed is unknown.
+	UnknownClose
 )
 
 // ChannelCloseSummary contains the final state of a channel at the point it
@@ -1627,6 +2125,15 @@ func (c *OpenChannel) CloseChannel(summary *ChannelCloseSummary) error {
 			return err
 		}
 
+		// Record the closing of the channel within the event log.
+		err = putLifecycleEvent(tx, &c.FundingOutpoint, LifecycleEvent{
+			Type:      LifecycleClose,
+			UpdateNum: c.LocalCommitment.CommitHeight,
+		})
+		if err != nil {
+			return err
+		}
+
 		// Finally, create a summary of this channel in the closed
 		// channel bucket for this node.
 		return putChannelCloseSummary(tx, chanPointBuf.Bytes(), summary)
@@ -1663,6 +2170,26 @@ type ChannelSnapshot struct {
 	// received within this channel.
 	TotalMSatReceived lnwire.MilliSatoshi
 
+	// LastUpdateTime is the time at which the commitment state of either
+	// party was last updated.
+	LastUpdateTime time.Time
+
+	// LocalSettledBalance is our balance that isn't locked within any
+	// outstanding HTLC.
+	LocalSettledBalance btcutil.Amount
+
+	// RemoteSettledBalance is the remote node's balance that isn't locked
+	// within any outstanding HTLC.
+	RemoteSettledBalance btcutil.Amount
+
+	// LocalInFlightBalance is the sum of all outstanding HTLCs we've
+	// offered to the remote node.
+	LocalInFlightBalance btcutil.Amount
+
+	// RemoteInFlightBalance is the sum of all outstanding HTLCs the remote
+	// node has offered to us.
+	RemoteInFlightBalance btcutil.Amount
+
 	// ChannelCommitment is the current up-to-date commitment for the
 	// target channel.
 	ChannelCommitment
@@ -1682,6 +2209,7 @@ func (c *OpenChannel) Snapshot() *ChannelSnapshot {
 		Capacity:          c.Capacity,
 		TotalMSatSent:     c.TotalMSatSent,
 		TotalMSatReceived: c.TotalMSatReceived,
+		LastUpdateTime:    c.LastUpdateTime,
 		ChainHash:         c.ChainHash,
 		ChannelCommitment: ChannelCommitment{
 			LocalBalance:  localCommit.LocalBalance,
@@ -1698,6 +2226,11 @@ func (c *OpenChannel) Snapshot() *ChannelSnapshot {
 		snapshot.Htlcs[i] = h.Copy()
 	}
 
+	snapshot.LocalSettledBalance, snapshot.RemoteSettledBalance =
+		localCommit.SettledBalances()
+	snapshot.LocalInFlightBalance, snapshot.RemoteInFlightBalance =
+		localCommit.InFlightBalances()
+
 	return snapshot
 }
 
@@ -1706,6 +2239,9 @@ func (c *OpenChannel) Snapshot() *ChannelSnapshot {
 // latest fully committed state is returned. The first commitment returned is
 // the local commitment, and the second returned is the remote commitment.
 func (c *OpenChannel) LatestCommitments() (*ChannelCommitment, *ChannelCommitment, error) {
+	c.Lock()
+	defer c.Unlock()
+
 	err := c.Db.View(func(tx *bolt.Tx) error {
 		chanBucket, err := readChanBucket(tx, c.IdentityPub,
 			&c.FundingOutpoint, c.ChainHash)
@@ -1722,12 +2258,112 @@ func (c *OpenChannel) LatestCommitments() (*ChannelCommitment, *ChannelCommitmen
 	return &c.LocalCommitment, &c.RemoteCommitment, nil
 }
 
-// RemoteRevocationStore returns the most up to date commitment version of the
-// revocation storage tree for the remote party. This method can be used when
-// acting on a possible contract breach to ensure, that the caller has the most
-// up to date information required to deliver justice.
-func (c *OpenChannel) RemoteRevocationStore() (shachain.Store, error) {
-	err := c.Db.View(func(tx *bolt.Tx) error {
+// DustHTLCs partitions the HTLCs on our latest local commitment into those
+// that are dust, and those that aren't. Dust HTLCs are those whose value,
+// after accounting for the fee of their second-level transaction, falls below
+// our DustLimit. Such HTLCs aren't materialized as outputs on the commitment
+// transaction, and are instead absorbed into fees in the case of a force
+// close. This is determined by the output index recorded for each HTLC when
+// the commitment was created, which is negative for trimmed HTLCs.
+func (c *OpenChannel) DustHTLCs() ([]*HTLC, []*HTLC, error) {
+	localCommit, _, err := c.LatestCommitments()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var dust, nonDust []*HTLC
+	for _, htlc := range localCommit.Htlcs {
+		htlc := htlc
+		if htlc.OutputIndex < 0 {
+			dust = append(dust, &htlc)
+			continue
+		}
+
+		nonDust = append(nonDust, &htlc)
+	}
+
+	return dust, nonDust, nil
+}
+
+// VerifyCommitSig verifies that the signature stored for our current local
+// commitment transaction is a valid signature by the remote party's multi-sig
+// key, spending the funding output of the channel. ErrInvalidCommitSig is
+// returned if the signature is found to be invalid. This can be used to
+// detect corruption of the signature before we attempt to broadcast our
+// commitment transaction.
+func (c *OpenChannel) VerifyCommitSig() error {
+	c.RLock()
+	defer c.RUnlock()
+
+	localKey := c.LocalChanCfg.MultiSigKey.PubKey
+	remoteKey := c.RemoteChanCfg.MultiSigKey.PubKey
+	if localKey == nil || remoteKey == nil {
+		return fmt.Errorf("multi-sig keys for channel %v are unknown",
+			c.FundingOutpoint)
+	}
+
+	commitTx := c.LocalCommitment.CommitTx
+	if commitTx == nil || len(commitTx.TxIn) != 1 {
+		return fmt.Errorf("invalid commitment transaction for "+
+			"channel %v", c.FundingOutpoint)
+	}
+
+	// With the keys known, we'll re-create the witness script of the
+	// funding output in order to generate the sighash that the remote
+	// party should have signed.
+	fundingScript, err := fundingWitnessScript(localKey, remoteKey)
+	if err != nil {
+		return err
+	}
+	hashCache := txscript.NewTxSigHashes(commitTx)
+	sigHash, err := txscript.CalcWitnessSigHash(
+		fundingScript, hashCache, txscript.SigHashAll, commitTx, 0,
+		int64(c.Capacity),
+	)
+	if err != nil {
+		return err
+	}
+
+	sig, err := btcec.ParseDERSignature(
+		c.LocalCommitment.CommitSig, btcec.S256(),
+	)
+	if err != nil {
+		return ErrInvalidCommitSig
+	}
+	if !sig.Verify(sigHash, remoteKey) {
+		return ErrInvalidCommitSig
+	}
+
+	return nil
+}
+
+// fundingWitnessScript generates the 2-of-2 multi-sig witness script of the
+// funding output of a channel, with the public keys sorted lexicographically.
+func fundingWitnessScript(aPub, bPub *btcec.PublicKey) ([]byte, error) {
+	aKey := aPub.SerializeCompressed()
+	bKey := bPub.SerializeCompressed()
+	if bytes.Compare(aKey, bKey) == 1 {
+		aKey, bKey = bKey, aKey
+	}
+
+	bldr := txscript.NewScriptBuilder()
+	bldr.AddOp(txscript.OP_2)
+	bldr.AddData(aKey)
+	bldr.AddData(bKey)
+	bldr.AddOp(txscript.OP_2)
+	bldr.AddOp(txscript.OP_CHECKMULTISIG)
+	return bldr.Script()
+}
+
+// RemoteRevocationStore returns the most up to date commitment version of the
+// revocation storage tree for the remote party. This method can be used when
+// acting on a possible contract breach to ensure, that the caller has the most
+// up to date information required to deliver justice.
+func (c *OpenChannel) RemoteRevocationStore() (shachain.Store, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	err := c.Db.View(func(tx *bolt.Tx) error {
 		chanBucket, err := readChanBucket(tx, c.IdentityPub,
 			&c.FundingOutpoint, c.ChainHash)
 		if err != nil {
@@ -1743,6 +2379,89 @@ func (c *OpenChannel) RemoteRevocationStore() (shachain.Store, error) {
 	return c.RevocationStore, nil
 }
 
+// CloseNegotiation is the fee negotiation state of an in-progress cooperative
+// close. It's persisted after each round of negotiation, so that a restart
+// mid-negotiation can resume from the last fees proposed by either party.
+type CloseNegotiation struct {
+	// OurFee is the last fee we proposed for the closing transaction.
+	OurFee btcutil.Amount
+
+	// TheirFee is the last fee the remote party proposed for the closing
+	// transaction.
+	TheirFee btcutil.Amount
+
+	// Round is the number of rounds of fee negotiation that have taken
+	// place so far.
+	Round uint8
+}
+
+// SaveCloseNegotiation persists the latest fee negotiation state of a
+// cooperative close of this channel, overwriting any prior state.
+func (c *OpenChannel) SaveCloseNegotiation(ourFee, theirFee btcutil.Amount,
+	round uint8) error {
+
+	c.Lock()
+	defer c.Unlock()
+
+	return c.Db.Update(func(tx *bolt.Tx) error {
+		chanBucket, err := updateChanBucket(tx, c.IdentityPub,
+			&c.FundingOutpoint, c.ChainHash)
+		if err != nil {
+			return err
+		}
+
+		var b bytes.Buffer
+		if err := writeElements(&b, ourFee, theirFee); err != nil {
+			return err
+		}
+		if err := b.WriteByte(round); err != nil {
+			return err
+		}
+
+		return chanBucket.Put(closeNegotiationKey, b.Bytes())
+	})
+}
+
+// FetchCloseNegotiation returns the latest fee negotiation state saved by
+// SaveCloseNegotiation. If no negotiation has taken place,
+// ErrNoCloseNegotiation is returned.
+func (c *OpenChannel) FetchCloseNegotiation() (*CloseNegotiation, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	var negotiation *CloseNegotiation
+	err := c.Db.View(func(tx *bolt.Tx) error {
+		chanBucket, err := readChanBucket(tx, c.IdentityPub,
+			&c.FundingOutpoint, c.ChainHash)
+		if err != nil {
+			return err
+		}
+
+		negotiationBytes := chanBucket.Get(closeNegotiationKey)
+		if negotiationBytes == nil {
+			return ErrNoCloseNegotiation
+		}
+		r := bytes.NewReader(negotiationBytes)
+
+		var n CloseNegotiation
+		if err := readElements(r, &n.OurFee, &n.TheirFee); err != nil {
+			return err
+		}
+		n.Round, err = r.ReadByte()
+		if err != nil {
+			return err
+		}
+
+		negotiation = &n
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return negotiation, nil
+}
+
 func putChannelCloseSummary(tx *bolt.Tx, chanID []byte,
 	summary *ChannelCloseSummary) error {
 
@@ -1751,12 +2470,55 @@ func putChannelCloseSummary(tx *bolt.Tx, chanID []byte,
 		return err
 	}
 
+	// The summary is stored within the bucket of the node we had the
+	// channel with, which is created if this is our first channel with
+	// the node to be closed.
+	nodePub := summary.RemotePub.SerializeCompressed()
+	nodeBucket, err := closedChanBucket.CreateBucketIfNotExists(nodePub)
+	if err != nil {
+		return err
+	}
+
 	var b bytes.Buffer
 	if err := serializeChannelCloseSummary(&b, summary); err != nil {
 		return err
 	}
 
-	return closedChanBucket.Put(chanID, b.Bytes())
+	return nodeBucket.Put(chanID, b.Bytes())
+}
+
+// findClosedChannel searches each node bucket within the closed channel
+// bucket for the summary of the target channel. The node bucket housing the
+// summary is returned along with the serialized summary itself. If no such
+// summary exists, then a nil bucket is returned.
+//
+// NOTE: As summaries are keyed by the remote node, this is a linear scan over
+// every node we've ever closed a channel with, rather than an index lookup.
+// This is acceptable as the number of distinct peers is small compared to the
+// number of channels, and lookups by channel point are only made when a
+// channel is marked as fully closed or its summary is explicitly requested,
+// neither of which lie on a hot path. Callers that need to iterate over all
+// summaries should use FetchClosedChannels instead.
+func findClosedChannel(closedChanBucket *bolt.Bucket,
+	chanID []byte) (*bolt.Bucket, []byte) {
+
+	cursor := closedChanBucket.Cursor()
+	for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
+		// If there's a value, it's not a node bucket so ignore it.
+		if v != nil {
+			continue
+		}
+
+		nodeBucket := closedChanBucket.Bucket(k)
+		if nodeBucket == nil {
+			continue
+		}
+		if summaryBytes := nodeBucket.Get(chanID); summaryBytes != nil {
+			return nodeBucket, summaryBytes
+		}
+	}
+
+	return nil, nil
 }
 
 func serializeChannelCloseSummary(w io.Writer, cs *ChannelCloseSummary) error {
@@ -1775,13 +2537,34 @@ func fetchChannelCloseSummary(tx *bolt.Tx,
 		return nil, err
 	}
 
-	summaryBytes := closedChanBucket.Get(chanID)
+	_, summaryBytes := findClosedChannel(closedChanBucket, chanID)
 	if summaryBytes == nil {
 		return nil, fmt.Errorf("closed channel summary not found")
 	}
 
-	summaryReader := bytes.NewReader(summaryBytes)
-	return deserializeCloseChannelSummary(summaryReader)
+	return decodeCloseSummaryEntry(chanID, summaryBytes)
+}
+
+// decodeCloseSummaryEntry decodes a key/value pair read from the closed
+// channel bucket. Older databases stored only the channel point as the key
+// with an empty value, so such entries are returned as a summary carrying
+// just the channel point and an UnknownClose close type.
+func decodeCloseSummaryEntry(chanID,
+	summaryBytes []byte) (*ChannelCloseSummary, error) {
+
+	if len(summaryBytes) == 0 {
+		c := &ChannelCloseSummary{
+			CloseType: UnknownClose,
+		}
+		err := readOutpoint(bytes.NewReader(chanID), &c.ChanPoint)
+		if err != nil {
+			return nil, err
+		}
+
+		return c, nil
+	}
+
+	return deserializeCloseChannelSummary(bytes.NewReader(summaryBytes))
 }
 
 func deserializeCloseChannelSummary(r io.Reader) (*ChannelCloseSummary, error) {
@@ -1813,7 +2596,7 @@ func putChanInfo(chanBucket *bolt.Bucket, channel *OpenChannel) error {
 	}
 
 	// For single funder channels that we initiated, write the funding txn.
-	if channel.ChanType == SingleFunder && channel.IsInitiator {
+	if channel.ChanType.IsSingleFunder() && channel.IsInitiator {
 		if err := writeElement(&w, channel.FundingTxn); err != nil {
 			return err
 		}
@@ -1888,6 +2671,9 @@ func putChanRevocationState(chanBucket *bolt.Bucket, channel *OpenChannel) error
 		return err
 	}
 
+	// The revocation producer is only written as its 32-byte root, with
+	// the full producer re-derived from it when the channel is loaded.
+	//
 	// TODO(roasbeef): don't keep producer on disk
 
 	// If the next revocation is present, which is only the case after the
@@ -1902,6 +2688,34 @@ func putChanRevocationState(chanBucket *bolt.Bucket, channel *OpenChannel) error
 	return chanBucket.Put(revocationStateKey, b.Bytes())
 }
 
+func putChanLastUpdate(chanBucket *bolt.Bucket, updateTime time.Time) error {
+	// The zero time can't be represented in nanoseconds since the epoch,
+	// so we'll store it as zero instead.
+	var b [8]byte
+	if !updateTime.IsZero() {
+		byteOrder.PutUint64(b[:], uint64(updateTime.UnixNano()))
+	}
+
+	return chanBucket.Put(lastUpdateKey, b[:])
+}
+
+// fetchChanLastUpdate returns the time the channel's commitment state was last
+// updated. Channels written before this time was recorded, or that haven't
+// yet been updated, will return the zero time.
+func fetchChanLastUpdate(chanBucket *bolt.Bucket) time.Time {
+	updateBytes := chanBucket.Get(lastUpdateKey)
+	if len(updateBytes) != 8 {
+		return time.Time{}
+	}
+
+	updateNano := byteOrder.Uint64(updateBytes)
+	if updateNano == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, int64(updateNano))
+}
+
 func fetchChanInfo(chanBucket *bolt.Bucket, channel *OpenChannel) error {
 	infoBytes := chanBucket.Get(chanInfoKey)
 	if infoBytes == nil {
@@ -1909,6 +2723,18 @@ func fetchChanInfo(chanBucket *bolt.Bucket, channel *OpenChannel) error {
 	}
 	r := bytes.NewReader(infoBytes)
 
+	// The channel point is known from the key of the channel's bucket, so
+	// we'll note it in order to annotate any errors, and cross-check it
+	// against the outpoint stored within the record.
+	chanPoint := channel.FundingOutpoint
+	corruptErr := func(field string, err error) error {
+		return ErrCorruptFundingInfo{
+			ChanPoint: chanPoint,
+			Field:     field,
+			Err:       err,
+		}
+	}
+
 	if err := readElements(r,
 		&channel.ChanType, &channel.ChainHash, &channel.FundingOutpoint,
 		&channel.ShortChanID, &channel.IsPending, &channel.IsInitiator,
@@ -1917,13 +2743,18 @@ func fetchChanInfo(chanBucket *bolt.Bucket, channel *OpenChannel) error {
 		&channel.IdentityPub, &channel.Capacity, &channel.TotalMSatSent,
 		&channel.TotalMSatReceived,
 	); err != nil {
-		return err
+		return corruptErr("channel info", err)
+	}
+
+	if channel.FundingOutpoint != chanPoint {
+		log.Warnf("Funding outpoint %v stored within chan info doesn't "+
+			"match chan_point=%v", channel.FundingOutpoint, chanPoint)
 	}
 
 	// For single funder channels that we initiated, read the funding txn.
-	if channel.ChanType == SingleFunder && channel.IsInitiator {
+	if channel.ChanType.IsSingleFunder() && channel.IsInitiator {
 		if err := readElement(r, &channel.FundingTxn); err != nil {
-			return err
+			return corruptErr("funding txn", err)
 		}
 	}
 
@@ -1937,10 +2768,10 @@ func fetchChanInfo(chanBucket *bolt.Bucket, channel *OpenChannel) error {
 		)
 	}
 	if err := readChanConfig(r, &channel.LocalChanCfg); err != nil {
-		return err
+		return corruptErr("local channel config", err)
 	}
 	if err := readChanConfig(r, &channel.RemoteChanCfg); err != nil {
-		return err
+		return corruptErr("remote channel config", err)
 	}
 
 	channel.Packager = NewChannelPackager(channel.ShortChanID)
@@ -2032,6 +2863,14 @@ func deleteOpenChannel(chanBucket *bolt.Bucket, chanPointBytes []byte) error {
 		return err
 	}
 
+	if err := chanBucket.Delete(lastUpdateKey); err != nil {
+		return err
+	}
+
+	if err := chanBucket.Delete(closeNegotiationKey); err != nil {
+		return err
+	}
+
 	err := chanBucket.Delete(append(chanCommitmentKey, byte(0x00)))
 	if err != nil {
 		return err
@@ -2059,29 +2898,348 @@ func makeLogKey(updateNum uint64) [8]byte {
 	return key
 }
 
-func appendChannelLogEntry(log *bolt.Bucket,
+const (
+	// logEntryLegacy marks a revocation log entry written before entries
+	// were prefixed with their format. Such entries are a bare serialized
+	// ChannelCommitment, whose leading byte is the most significant byte
+	// of the big-endian commitment height, and therefore always zero.
+	logEntryLegacy byte = 0x00
+
+	// logEntryFull marks a revocation log entry that holds a complete
+	// serialized ChannelCommitment.
+	logEntryFull byte = 0x01
+
+	// logEntryDiff marks a revocation log entry that is encoded relative
+	// to the entry immediately preceding it within the log.
+	logEntryDiff byte = 0x02
+
+	// revocationLogSnapshotInterval is the maximum number of consecutive
+	// diff entries within the revocation log. Once reached, a full entry
+	// is written, bounding the number of entries that must be replayed in
+	// order to reconstruct any prior state.
+	revocationLogSnapshotInterval = 64
+)
+
+// revocationLogTail is the decoded tail of the revocation log, along with the
+// number of consecutive diff entries that end with it.
+type revocationLogTail struct {
+	commit   ChannelCommitment
+	numDiffs int
+}
+
+// appendChannelLogEntry adds the passed commitment to the end of the
+// revocation log. Where possible the entry is stored as a diff against the
+// current tail of the log, otherwise a full entry is written. If the passed
+// tail matches the last entry within the log, then it's used as the state to
+// encode the diff against, otherwise the tail is reconstructed by replaying
+// the log. The new tail of the log is returned, such that the caller can pass
+// it to the next append.
+//
+// The commitment must be at a greater height than the tail of the log, or
+// ErrNonMonotonicUpdate is returned. If allowReplay is true, as it is for
+// ReplayRevocationLogEntry, an earlier entry may instead be overwritten, in
+// which case the new entry is written in full and the entry following it is
+// rewritten in full, as it may have been stored as a diff against the replaced
+// entry. As the tail of the log may then have changed, a nil tail is returned.
+func appendChannelLogEntry(log *bolt.Bucket, commit *ChannelCommitment,
+	tail *revocationLogTail, allowReplay bool) (*revocationLogTail, error) {
+
+	logEntrykey := makeLogKey(commit.CommitHeight)
+
+	tailKey, _ := log.Cursor().Last()
+	if tailKey != nil && bytes.Compare(tailKey, logEntrykey[:]) >= 0 {
+		if !allowReplay {
+			return nil, ErrNonMonotonicUpdate
+		}
+
+		err := replayChannelLogEntry(log, logEntrykey[:], commit)
+		return nil, err
+	}
+
+	// A diff can only be written if there's a prior entry to encode it
+	// against, and that entry precedes the new one within the log. We'll
+	// only replay the log to find it if the cached tail is stale.
+	if tailKey == nil {
+		tail = nil
+	} else if tail == nil ||
+		byteOrder.Uint64(tailKey) != tail.commit.CommitHeight {
+
+		tailCommit, numDiffs, err := replayChannelLog(log, tailKey)
+		if err != nil {
+			return nil, err
+		}
+
+		tail = &revocationLogTail{
+			commit:   tailCommit,
+			numDiffs: numDiffs,
+		}
+	}
+
+	// We'll copy the HTLC set of the new tail, as the caller may reuse the
+	// commitment once it's been appended.
+	newTail := &revocationLogTail{
+		commit: *commit,
+	}
+	newTail.commit.Htlcs = append([]HTLC(nil), commit.Htlcs...)
+
+	var b bytes.Buffer
+	if tail == nil || tail.numDiffs+1 >= revocationLogSnapshotInterval {
+		b.WriteByte(logEntryFull)
+		if err := serializeChanCommit(&b, commit); err != nil {
+			return nil, err
+		}
+	} else {
+		b.WriteByte(logEntryDiff)
+		err := serializeChanCommitDiff(&b, commit, &tail.commit)
+		if err != nil {
+			return nil, err
+		}
+
+		newTail.numDiffs = tail.numDiffs + 1
+	}
+
+	if err := log.Put(logEntrykey[:], b.Bytes()); err != nil {
+		return nil, err
+	}
+
+	return newTail, nil
+}
+
+// replayChannelLogEntry overwrites the revocation log entry stored under the
+// given key with a full entry for the passed commitment. If the entry that
+// follows it is a diff, it's first reconstructed against the original entry
+// so that it can be rewritten in full.
+func replayChannelLogEntry(log *bolt.Bucket, logEntryKey []byte,
+	commit *ChannelCommitment) error {
+
+	cursor := log.Cursor()
+	k, _ := cursor.Seek(logEntryKey)
+	if k != nil && bytes.Equal(k, logEntryKey) {
+		k, _ = cursor.Next()
+	}
+
+	var nextKey []byte
+	var nextCommit ChannelCommitment
+	if k != nil {
+		nextKey = append([]byte(nil), k...)
+
+		var err error
+		nextCommit, _, err = replayChannelLog(log, nextKey)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := putFullChannelLogEntry(log, logEntryKey, commit); err != nil {
+		return err
+	}
+	if nextKey == nil {
+		return nil
+	}
+
+	return putFullChannelLogEntry(log, nextKey, &nextCommit)
+}
+
+// putFullChannelLogEntry writes the passed commitment to the revocation log
+// as a full entry under the given key.
+func putFullChannelLogEntry(log *bolt.Bucket, logEntryKey []byte,
 	commit *ChannelCommitment) error {
 
 	var b bytes.Buffer
+	b.WriteByte(logEntryFull)
 	if err := serializeChanCommit(&b, commit); err != nil {
 		return err
 	}
 
-	logEntrykey := makeLogKey(commit.CommitHeight)
-	return log.Put(logEntrykey[:], b.Bytes())
+	return log.Put(logEntryKey, b.Bytes())
 }
 
 func fetchChannelLogEntry(log *bolt.Bucket,
 	updateNum uint64) (ChannelCommitment, error) {
 
 	logEntrykey := makeLogKey(updateNum)
-	commitBytes := log.Get(logEntrykey[:])
-	if commitBytes == nil {
-		return ChannelCommitment{}, fmt.Errorf("log entry not found")
+	commit, _, err := replayChannelLog(log, logEntrykey[:])
+	return commit, err
+}
+
+// replayChannelLog reconstructs the commitment stored under the given key
+// within the revocation log. Starting from the target entry, we walk
+// backwards to the nearest full entry, then re-apply each diff in order. The
+// number of diffs that were applied is also returned.
+func replayChannelLog(log *bolt.Bucket,
+	logEntryKey []byte) (ChannelCommitment, int, error) {
+
+	cursor := log.Cursor()
+	k, v := cursor.Seek(logEntryKey)
+	if k == nil || !bytes.Equal(k, logEntryKey) {
+		return ChannelCommitment{}, 0, fmt.Errorf("log entry not found")
 	}
 
-	commitReader := bytes.NewReader(commitBytes)
-	return deserializeChanCommit(commitReader)
+	var diffs [][]byte
+	for len(v) > 0 && v[0] == logEntryDiff {
+		diffs = append(diffs, v)
+
+		k, v = cursor.Prev()
+		if k == nil {
+			return ChannelCommitment{}, 0, fmt.Errorf("revocation " +
+				"log diff has no prior full entry")
+		}
+	}
+
+	commit, err := decodeChannelLogEntry(v, nil)
+	if err != nil {
+		return ChannelCommitment{}, 0, err
+	}
+	for i := len(diffs) - 1; i >= 0; i-- {
+		commit, err = decodeChannelLogEntry(diffs[i], &commit)
+		if err != nil {
+			return ChannelCommitment{}, 0, err
+		}
+	}
+
+	return commit, len(diffs), nil
+}
+
+// decodeChannelLogEntry decodes a single revocation log entry. If the entry is
+// a diff, then prior must be the commitment of the entry that precedes it.
+func decodeChannelLogEntry(entry []byte,
+	prior *ChannelCommitment) (ChannelCommitment, error) {
+
+	if len(entry) == 0 {
+		return ChannelCommitment{}, fmt.Errorf("empty log entry")
+	}
+
+	switch entry[0] {
+	case logEntryLegacy:
+		return deserializeChanCommit(bytes.NewReader(entry))
+
+	case logEntryFull:
+		return deserializeChanCommit(bytes.NewReader(entry[1:]))
+
+	case logEntryDiff:
+		if prior == nil {
+			return ChannelCommitment{}, fmt.Errorf("log diff " +
+				"entry has no prior state")
+		}
+		return deserializeChanCommitDiff(bytes.NewReader(entry[1:]), prior)
+
+	default:
+		return ChannelCommitment{}, fmt.Errorf("unknown log entry "+
+			"type: %v", entry[0])
+	}
+}
+
+// serializeChanCommitDiff writes the passed commitment relative to the prior
+// commitment. As the commitment transaction and signature change with every
+// state, they're always written in full. Each HTLC that also appears
+// unchanged within the prior commitment is written as a reference to its
+// position within the prior HTLC set, while all others are written in full.
+func serializeChanCommitDiff(w io.Writer, c, prior *ChannelCommitment) error {
+	// An HTLC is uniquely identified within a commitment by its index and
+	// direction, so we'll index the prior HTLC set by both to locate each
+	// HTLC that may be unchanged.
+	type htlcKey struct {
+		htlcIndex uint64
+		incoming  bool
+	}
+	priorIndexes := make(map[htlcKey]int, len(prior.Htlcs))
+	for i, htlc := range prior.Htlcs {
+		priorIndexes[htlcKey{htlc.HtlcIndex, htlc.Incoming}] = i
+	}
+
+	if err := writeElements(w,
+		c.CommitHeight, c.LocalLogIndex, c.LocalHtlcIndex,
+		c.RemoteLogIndex, c.RemoteHtlcIndex, c.LocalBalance,
+		c.RemoteBalance, c.CommitFee, c.FeePerKw, c.CommitTx,
+		c.CommitSig, uint16(len(c.Htlcs)),
+	); err != nil {
+		return err
+	}
+
+	for i := range c.Htlcs {
+		htlc := &c.Htlcs[i]
+		priorIndex, ok := priorIndexes[htlcKey{
+			htlc.HtlcIndex, htlc.Incoming,
+		}]
+		if ok && htlcsEqual(htlc, &prior.Htlcs[priorIndex]) {
+			err := writeElements(w, true, uint16(priorIndex))
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := writeElement(w, false); err != nil {
+			return err
+		}
+		if err := serializeHtlc(w, &c.Htlcs[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deserializeChanCommitDiff reads a commitment previously written by
+// serializeChanCommitDiff relative to the same prior commitment.
+func deserializeChanCommitDiff(r io.Reader,
+	prior *ChannelCommitment) (ChannelCommitment, error) {
+
+	var (
+		c        ChannelCommitment
+		numHtlcs uint16
+	)
+	err := readElements(r,
+		&c.CommitHeight, &c.LocalLogIndex, &c.LocalHtlcIndex,
+		&c.RemoteLogIndex, &c.RemoteHtlcIndex, &c.LocalBalance,
+		&c.RemoteBalance, &c.CommitFee, &c.FeePerKw, &c.CommitTx,
+		&c.CommitSig, &numHtlcs,
+	)
+	if err != nil {
+		return c, err
+	}
+
+	if numHtlcs == 0 {
+		return c, nil
+	}
+
+	c.Htlcs = make([]HTLC, numHtlcs)
+	for i := range c.Htlcs {
+		var isRef bool
+		if err := readElement(r, &isRef); err != nil {
+			return c, err
+		}
+
+		if !isRef {
+			if err := deserializeHtlc(r, &c.Htlcs[i]); err != nil {
+				return c, err
+			}
+			continue
+		}
+
+		var priorIndex uint16
+		if err := readElement(r, &priorIndex); err != nil {
+			return c, err
+		}
+		if int(priorIndex) >= len(prior.Htlcs) {
+			return c, fmt.Errorf("htlc reference %v out of range "+
+				"of prior state with %v htlcs", priorIndex,
+				len(prior.Htlcs))
+		}
+		c.Htlcs[i] = prior.Htlcs[priorIndex]
+	}
+
+	return c, nil
+}
+
+// htlcsEqual returns true if the two HTLCs would be serialized identically.
+func htlcsEqual(a, b *HTLC) bool {
+	return a.HtlcIndex == b.HtlcIndex && a.Incoming == b.Incoming &&
+		a.LogIndex == b.LogIndex && a.RHash == b.RHash &&
+		a.Amt == b.Amt && a.RefundTimeout == b.RefundTimeout &&
+		a.OutputIndex == b.OutputIndex &&
+		bytes.Equal(a.Signature, b.Signature) &&
+		bytes.Equal(a.OnionBlob, b.OnionBlob)
 }
 
 func wipeChannelLogEntries(log *bolt.Bucket) error {
@@ -2,14 +2,19 @@ package channeldb
 
 import (
 	"bytes"
+	"errors"
 	"io/ioutil"
+	"math"
 	"math/rand"
 	"net"
 	"os"
 	"reflect"
 	"runtime"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/coreos/bbolt"
 	"github.com/davecgh/go-spew/spew"
 	"github.com/lightningnetwork/lnd/keychain"
 	"github.com/lightningnetwork/lnd/lnwire"
@@ -17,6 +22,7 @@ import (
 	"github.com/roasbeef/btcd/btcec"
 	"github.com/roasbeef/btcd/chaincfg"
 	"github.com/roasbeef/btcd/chaincfg/chainhash"
+	"github.com/roasbeef/btcd/txscript"
 	"github.com/roasbeef/btcd/wire"
 	"github.com/roasbeef/btcutil"
 	_ "github.com/roasbeef/btcwallet/walletdb/bdb"
@@ -111,6 +117,17 @@ func makeTestDB() (*DB, func(), error) {
 	return cdb, cleanUp, nil
 }
 
+// syncTestChannel writes the channel to the database as a pending channel,
+// along with a link node for its remote peer, such that it's found when
+// iterating over all channels.
+func syncTestChannel(channel *OpenChannel) error {
+	addr := &net.TCPAddr{
+		IP:   net.ParseIP("127.0.0.1"),
+		Port: 18555,
+	}
+	return channel.SyncPending(addr, 99)
+}
+
 func createTestChannelState(cdb *DB) (*OpenChannel, error) {
 	// Simulate 1000 channel updates.
 	producer, err := shachain.NewRevocationProducerFromBytes(key[:])
@@ -336,6 +353,397 @@ func TestOpenChannelPutGetDelete(t *testing.T) {
 	}
 }
 
+// TestOpenChannelKeyDerivation tests that if a KeyDeriver is set on the
+// database, then the local channel keys are re-derived from their locators
+// when read from disk, with any stored public keys acting as a cross-check.
+func TestOpenChannelKeyDerivation(t *testing.T) {
+	t.Parallel()
+
+	cdb, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+
+	state, err := createTestChannelState(cdb)
+	if err != nil {
+		t.Fatalf("unable to create channel state: %v", err)
+	}
+
+	// We'll give our local htlc base point a locator, and omit the public
+	// key of the multi-sig key so it can only be recovered via derivation.
+	// The multi-sig key is left at the zero locator, which locates the
+	// first multi-sig key, so it must still be derived.
+	state.LocalChanCfg.MultiSigKey = keychain.KeyDescriptor{
+		KeyLocator: keychain.KeyLocator{
+			Family: keychain.KeyFamilyMultiSig,
+			Index:  0,
+		},
+	}
+	state.LocalChanCfg.HtlcBasePoint.KeyLocator = keychain.KeyLocator{
+		Family: keychain.KeyFamilyHtlcBase,
+		Index:  1,
+	}
+	if err := state.FullSync(); err != nil {
+		t.Fatalf("unable to save and serialize channel state: %v", err)
+	}
+
+	derivedLocs := make(map[keychain.KeyLocator]struct{})
+	cdb.SetKeyDeriver(func(loc keychain.KeyLocator) (*btcec.PublicKey,
+		error) {
+
+		derivedLocs[loc] = struct{}{}
+		return privKey.PubKey(), nil
+	})
+
+	openChannels, err := cdb.FetchOpenChannels(state.IdentityPub)
+	if err != nil {
+		t.Fatalf("unable to fetch open channel: %v", err)
+	}
+
+	// The multi-sig key should have been re-derived, while the stored
+	// htlc base point should have matched the derived key.
+	multiSigKey := openChannels[0].LocalChanCfg.MultiSigKey.PubKey
+	if multiSigKey == nil || !multiSigKey.IsEqual(privKey.PubKey()) {
+		t.Fatalf("multi-sig key wasn't derived")
+	}
+	if _, ok := derivedLocs[keychain.KeyLocator{}]; !ok {
+		t.Fatalf("zero key locator wasn't derived")
+	}
+
+	// If the deriver instead returns a key that doesn't match the stored
+	// htlc base point, then reading the channel should fail.
+	otherKey, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatalf("unable to create new private key: %v", err)
+	}
+	cdb.SetKeyDeriver(func(keychain.KeyLocator) (*btcec.PublicKey, error) {
+		return otherKey.PubKey(), nil
+	})
+	_, err = cdb.FetchOpenChannels(state.IdentityPub)
+	if err == nil {
+		t.Fatalf("expected key mismatch error")
+	}
+}
+
+// TestOpenChannelDustHTLCs tests that the HTLCs on our local commitment are
+// properly partitioned into dust and non-dust HTLCs.
+func TestOpenChannelDustHTLCs(t *testing.T) {
+	t.Parallel()
+
+	cdb, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+
+	state, err := createTestChannelState(cdb)
+	if err != nil {
+		t.Fatalf("unable to create channel state: %v", err)
+	}
+
+	// We'll add two HTLCs that were trimmed from the commitment, and one
+	// that was materialized as an output.
+	state.LocalCommitment.Htlcs = []HTLC{
+		{
+			Signature:   testSig.Serialize(),
+			Amt:         10,
+			RHash:       key,
+			OutputIndex: -1,
+			HtlcIndex:   0,
+		},
+		{
+			Signature:   testSig.Serialize(),
+			Amt:         lnwire.NewMSatFromSatoshis(btcutil.SatoshiPerBitcoin),
+			RHash:       key,
+			OutputIndex: 1,
+			HtlcIndex:   1,
+		},
+		{
+			Signature:   testSig.Serialize(),
+			Incoming:    true,
+			Amt:         20,
+			RHash:       key,
+			OutputIndex: -1,
+			HtlcIndex:   2,
+		},
+	}
+	if err := state.FullSync(); err != nil {
+		t.Fatalf("unable to save and serialize channel state: %v", err)
+	}
+
+	dust, nonDust, err := state.DustHTLCs()
+	if err != nil {
+		t.Fatalf("unable to fetch dust htlcs: %v", err)
+	}
+	if len(dust) != 2 {
+		t.Fatalf("expected 2 dust htlcs, got %v", len(dust))
+	}
+	if len(nonDust) != 1 {
+		t.Fatalf("expected 1 non-dust htlc, got %v", len(nonDust))
+	}
+	if dust[0].HtlcIndex != 0 || dust[1].HtlcIndex != 2 {
+		t.Fatalf("wrong dust htlcs returned: %v", spew.Sdump(dust))
+	}
+	if nonDust[0].HtlcIndex != 1 {
+		t.Fatalf("wrong non-dust htlc returned: %v",
+			spew.Sdump(nonDust))
+	}
+}
+
+// TestOpenChannelVerifyCommitSig tests that a valid signature for our local
+// commitment transaction is accepted, while a corrupted one is rejected.
+func TestOpenChannelVerifyCommitSig(t *testing.T) {
+	t.Parallel()
+
+	cdb, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+
+	state, err := createTestChannelState(cdb)
+	if err != nil {
+		t.Fatalf("unable to create channel state: %v", err)
+	}
+
+	// We'll use a distinct multi-sig key for ourselves, while the remote
+	// party's multi-sig key is privKey.
+	localKey, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatalf("unable to create new private key: %v", err)
+	}
+	state.LocalChanCfg.MultiSigKey.PubKey = localKey.PubKey()
+
+	// Next, we'll craft a commitment transaction spending the funding
+	// output, and have the remote party sign it.
+	commitTx := wire.NewMsgTx(2)
+	commitTx.AddTxIn(wire.NewTxIn(&state.FundingOutpoint, nil, nil))
+	commitTx.AddTxOut(wire.NewTxOut(int64(state.Capacity), nil))
+
+	fundingScript, err := fundingWitnessScript(
+		localKey.PubKey(), privKey.PubKey(),
+	)
+	if err != nil {
+		t.Fatalf("unable to create funding script: %v", err)
+	}
+	sigHash, err := txscript.CalcWitnessSigHash(
+		fundingScript, txscript.NewTxSigHashes(commitTx),
+		txscript.SigHashAll, commitTx, 0, int64(state.Capacity),
+	)
+	if err != nil {
+		t.Fatalf("unable to generate sighash: %v", err)
+	}
+	sig, err := privKey.Sign(sigHash)
+	if err != nil {
+		t.Fatalf("unable to sign commitment: %v", err)
+	}
+
+	state.LocalCommitment.CommitTx = commitTx
+	state.LocalCommitment.CommitSig = sig.Serialize()
+	if err := state.VerifyCommitSig(); err != nil {
+		t.Fatalf("unable to verify commit sig: %v", err)
+	}
+
+	// If the commitment transaction is modified, then the signature should
+	// no longer be valid.
+	commitTx.TxOut[0].Value--
+	if err := state.VerifyCommitSig(); err != ErrInvalidCommitSig {
+		t.Fatalf("expected ErrInvalidCommitSig, got %v", err)
+	}
+	commitTx.TxOut[0].Value++
+
+	// Similarly, a corrupted signature should be rejected.
+	state.LocalCommitment.CommitSig = bytes.Repeat([]byte{1}, 71)
+	if err := state.VerifyCommitSig(); err != ErrInvalidCommitSig {
+		t.Fatalf("expected ErrInvalidCommitSig, got %v", err)
+	}
+}
+
+// TestFetchChanInfoCorrupt tests that if the stored funding info of a channel
+// is truncated, then an ErrCorruptFundingInfo identifying the channel and the
+// field that failed to parse is returned.
+func TestFetchChanInfoCorrupt(t *testing.T) {
+	t.Parallel()
+
+	cdb, cleanUp, err := makeTestDB()
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+
+	state, err := createTestChannelState(cdb)
+	if err != nil {
+		t.Fatalf("unable to create channel state: %v", err)
+	}
+	if err := state.FullSync(); err != nil {
+		t.Fatalf("unable to save and serialize channel state: %v", err)
+	}
+
+	assertCorrupt := func(truncateTo func(int) int, field string) {
+		err := cdb.Update(func(tx *bolt.Tx) error {
+			chanBucket, err := updateChanBucket(
+				tx, state.IdentityPub, &state.FundingOutpoint,
+				state.ChainHash,
+			)
+			if err != nil {
+				return err
+			}
+
+			infoBytes := chanBucket.Get(chanInfoKey)
+			truncated := make([]byte, truncateTo(len(infoBytes)))
+			copy(truncated, infoBytes)
+			if err := chanBucket.Put(chanInfoKey, truncated); err != nil {
+				return err
+			}
+
+			channel := &OpenChannel{
+				FundingOutpoint: state.FundingOutpoint,
+			}
+			return fetchChanInfo(chanBucket, channel)
+		})
+
+		corruptErr, ok := err.(ErrCorruptFundingInfo)
+		if !ok {
+			t.Fatalf("expected ErrCorruptFundingInfo, got %v", err)
+		}
+		if corruptErr.ChanPoint != state.FundingOutpoint {
+			t.Fatalf("wrong chan point: expected %v, got %v",
+				state.FundingOutpoint, corruptErr.ChanPoint)
+		}
+		if corruptErr.Field != field {
+			t.Fatalf("wrong field: expected %v, got %v", field,
+				corruptErr.Field)
+		}
+	}
+
+	// Truncating the final byte of the record should cause the remote
+	// channel config to fail to parse.
+	assertCorrupt(func(n int) int { return n - 1 }, "remote channel config")
+
+	// While truncating the record to just a few bytes should cause the
+	// initial channel info to fail to parse.
+	assertCorrupt(func(int) int { return 5 }, "channel info")
+}
+
+// TestFetchOpenChannelMissingFields tests that a channel with a missing or
+// truncated record fails to load with an error, rather than a panic.
+func TestFetchOpenChannelMissingFields(t *testing.T) {
+	t.Parallel()
+
+	localCommitKey := append(
+		append([]byte(nil), chanCommitmentKey...), byte(0x00),
+	)
+	remoteCommitKey := append(
+		append([]byte(nil), chanCommitmentKey...), byte(0x01),
+	)
+
+	testCases := []struct {
+		name string
+		key  []byte
+
+		// truncateTo, if non-nil, truncates the record rather than
+		// deleting it.
+		truncateTo func(int) int
+
+		expectedErr error
+	}{
+		{
+			name:        "missing chan info",
+			key:         chanInfoKey,
+			expectedErr: ErrNoChanInfoFound,
+		},
+		{
+			name:        "missing local commitment",
+			key:         localCommitKey,
+			expectedErr: ErrNoCommitmentsFound,
+		},
+		{
+			name:        "missing remote commitment",
+			key:         remoteCommitKey,
+			expectedErr: ErrNoCommitmentsFound,
+		},
+		{
+			name:        "missing revocation state",
+			key:         revocationStateKey,
+			expectedErr: ErrNoRevocationsFound,
+		},
+		{
+			name:       "truncated local commitment",
+			key:        localCommitKey,
+			truncateTo: func(n int) int { return n / 2 },
+		},
+		{
+			name:       "truncated revocation state",
+			key:        revocationStateKey,
+			truncateTo: func(n int) int { return n - 1 },
+		},
+		{
+			name:       "empty revocation state",
+			key:        revocationStateKey,
+			truncateTo: func(int) int { return 0 },
+		},
+	}
+
+	for _, test := range testCases {
+		cdb, cleanUp, err := makeTestDB()
+		if err != nil {
+			t.Fatalf("unable to make test database: %v", err)
+		}
+
+		state, err := createTestChannelState(cdb)
+		if err != nil {
+			cleanUp()
+			t.Fatalf("unable to create channel state: %v", err)
+		}
+		if err := state.FullSync(); err != nil {
+			cleanUp()
+			t.Fatalf("unable to save and serialize channel "+
+				"state: %v", err)
+		}
+
+		err = cdb.Update(func(tx *bolt.Tx) error {
+			chanBucket, err := updateChanBucket(
+				tx, state.IdentityPub, &state.FundingOutpoint,
+				state.ChainHash,
+			)
+			if err != nil {
+				return err
+			}
+
+			if test.truncateTo == nil {
+				if err := chanBucket.Delete(test.key); err != nil {
+					return err
+				}
+			} else {
+				record := chanBucket.Get(test.key)
+				truncated := make(
+					[]byte, test.truncateTo(len(record)),
+				)
+				copy(truncated, record)
+				err := chanBucket.Put(test.key, truncated)
+				if err != nil {
+					return err
+				}
+			}
+
+			_, err = fetchOpenChannel(chanBucket, &state.FundingOutpoint)
+			return err
+		})
+		cleanUp()
+
+		if err == nil {
+			t.Fatalf("%v: expected channel to fail to load", test.name)
+		}
+		if test.expectedErr != nil &&
+			!strings.Contains(err.Error(), test.expectedErr.Error()) {
+
+			t.Fatalf("%v: expected %v, got %v", test.name,
+				test.expectedErr, err)
+		}
+	}
+}
+
 func assertCommitmentEqual(t *testing.T, a, b *ChannelCommitment) {
 	if !reflect.DeepEqual(a, b) {
 		_, _, line, _ := runtime.Caller(1)
@@ -631,7 +1039,9 @@ func TestChannelStateTransition(t *testing.T) {
 	}
 }
 
-func TestFetchPendingChannels(t *testing.T) {
+// TestFetchChannelDeltas tests that a range of prior states can be read back
+// from the revocation log in ascending update order.
+func TestFetchChannelDeltas(t *testing.T) {
 	t.Parallel()
 
 	cdb, cleanUp, err := makeTestDB()
@@ -640,89 +1050,103 @@ func TestFetchPendingChannels(t *testing.T) {
 	}
 	defer cleanUp()
 
-	// Create first test channel state
-	state, err := createTestChannelState(cdb)
+	channel, err := createTestChannelState(cdb)
 	if err != nil {
 		t.Fatalf("unable to create channel state: %v", err)
 	}
-
-	addr := &net.TCPAddr{
-		IP:   net.ParseIP("127.0.0.1"),
-		Port: 18555,
-	}
-
-	const broadcastHeight = 99
-	if err := state.SyncPending(addr, broadcastHeight); err != nil {
+	if err := channel.FullSync(); err != nil {
 		t.Fatalf("unable to save and serialize channel state: %v", err)
 	}
 
-	pendingChannels, err := cdb.FetchPendingChannels()
+	// Before any states have been revoked, querying for a range should
+	// return an empty set rather than an error.
+	deltas, err := channel.FetchChannelDeltas(0, 10)
 	if err != nil {
-		t.Fatalf("unable to list pending channels: %v", err)
-	}
-
-	if len(pendingChannels) != 1 {
-		t.Fatalf("incorrect number of pending channels: expecting %v,"+
-			"got %v", 1, len(pendingChannels))
-	}
-
-	// The broadcast height of the pending channel should have been set
-	// properly.
-	if pendingChannels[0].FundingBroadcastHeight != broadcastHeight {
-		t.Fatalf("broadcast height mismatch: expected %v, got %v",
-			pendingChannels[0].FundingBroadcastHeight,
-			broadcastHeight)
-	}
-
-	chanOpenLoc := lnwire.ShortChannelID{
-		BlockHeight: 5,
-		TxIndex:     10,
-		TxPosition:  15,
+		t.Fatalf("unable to fetch deltas: %v", err)
 	}
-	err = pendingChannels[0].MarkAsOpen(chanOpenLoc)
-	if err != nil {
-		t.Fatalf("unable to mark channel as open: %v", err)
+	if len(deltas) != 0 {
+		t.Fatalf("expected no deltas, got %v", len(deltas))
 	}
 
-	if pendingChannels[0].IsPending {
-		t.Fatalf("channel marked open should no longer be pending")
-	}
+	// Populate the revocation log with states 1 through 5.
+	const numStates = 5
+	err = cdb.Update(func(tx *bolt.Tx) error {
+		chanBucket, err := readChanBucket(tx, channel.IdentityPub,
+			&channel.FundingOutpoint, channel.ChainHash)
+		if err != nil {
+			return err
+		}
 
-	if pendingChannels[0].ShortChanID != chanOpenLoc {
-		t.Fatalf("channel opening height not updated: expected %v, "+
-			"got %v", spew.Sdump(pendingChannels[0].ShortChanID),
-			chanOpenLoc)
-	}
+		logBucket, err := chanBucket.CreateBucketIfNotExists(
+			revocationLogBucket,
+		)
+		if err != nil {
+			return err
+		}
 
-	// Next, we'll re-fetch the channel to ensure that the open height was
-	// properly set.
-	openChans, err := cdb.FetchAllChannels()
-	if err != nil {
-		t.Fatalf("unable to fetch channels: %v", err)
-	}
-	if openChans[0].ShortChanID != chanOpenLoc {
-		t.Fatalf("channel opening heights don't match: expected %v, "+
-			"got %v", spew.Sdump(openChans[0].ShortChanID),
-			chanOpenLoc)
-	}
-	if openChans[0].FundingBroadcastHeight != broadcastHeight {
-		t.Fatalf("broadcast height mismatch: expected %v, got %v",
-			openChans[0].FundingBroadcastHeight,
-			broadcastHeight)
-	}
+		for i := uint64(1); i <= numStates; i++ {
+			commit := channel.RemoteCommitment
+			commit.CommitHeight = i
+			commit.LocalBalance = lnwire.MilliSatoshi(i * 1000)
+			_, err := appendChannelLogEntry(
+				logBucket, &commit, nil, false,
+			)
+			if err != nil {
+				return err
+			}
+		}
 
-	pendingChannels, err = cdb.FetchPendingChannels()
+		return nil
+	})
 	if err != nil {
-		t.Fatalf("unable to list pending channels: %v", err)
-	}
-
-	if len(pendingChannels) != 0 {
-		t.Fatalf("incorrect number of pending channels: expecting %v,"+
-			"got %v", 0, len(pendingChannels))
+		t.Fatalf("unable to populate revocation log: %v", err)
+	}
+
+	testCases := []struct {
+		start, end uint64
+		expected   []uint64
+	}{
+		{start: 2, end: 4, expected: []uint64{2, 3, 4}},
+		{start: 0, end: 2, expected: []uint64{1, 2}},
+		{start: 4, end: 100, expected: []uint64{4, 5}},
+		{start: 3, end: 3, expected: []uint64{3}},
+		{start: 6, end: 10, expected: nil},
+		{start: 4, end: 2, expected: nil},
+	}
+	for _, test := range testCases {
+		deltas, err := channel.FetchChannelDeltas(test.start, test.end)
+		if err != nil {
+			t.Fatalf("unable to fetch deltas [%v, %v]: %v",
+				test.start, test.end, err)
+		}
+		if deltas == nil {
+			t.Fatalf("expected non-nil slice for range [%v, %v]",
+				test.start, test.end)
+		}
+		if len(deltas) != len(test.expected) {
+			t.Fatalf("range [%v, %v]: expected %v deltas, got %v",
+				test.start, test.end, len(test.expected),
+				len(deltas))
+		}
+		for i, height := range test.expected {
+			if deltas[i].CommitHeight != height {
+				t.Fatalf("range [%v, %v]: expected height %v "+
+					"at index %v, got %v", test.start,
+					test.end, height, i,
+					deltas[i].CommitHeight)
+			}
+			if deltas[i].LocalBalance != lnwire.MilliSatoshi(height*1000) {
+				t.Fatalf("range [%v, %v]: wrong balance for "+
+					"height %v", test.start, test.end,
+					height)
+			}
+		}
 	}
 }
 
-func TestFetchClosedChannels(t *testing.T) {
+// TestPruneChannelLog tests that pruning the revocation log removes only the
+// oldest states, and never crosses the minimum retained update number.
+func TestPruneChannelLog(t *testing.T) {
 	t.Parallel()
 
 	cdb, cleanUp, err := makeTestDB()
@@ -731,9 +1155,847 @@ func TestFetchClosedChannels(t *testing.T) {
 	}
 	defer cleanUp()
 
-	// First create a test channel, that we'll be closing within this pull
-	// request.
-	state, err := createTestChannelState(cdb)
+	channel, err := createTestChannelState(cdb)
+	if err != nil {
+		t.Fatalf("unable to create channel state: %v", err)
+	}
+	if err := channel.FullSync(); err != nil {
+		t.Fatalf("unable to save and serialize channel state: %v", err)
+	}
+
+	// Populate the revocation log with states 0 through 9, leaving the
+	// current remote commitment at height 10.
+	const numUpdates = 10
+	err = cdb.Update(func(tx *bolt.Tx) error {
+		chanBucket, err := readChanBucket(tx, channel.IdentityPub,
+			&channel.FundingOutpoint, channel.ChainHash)
+		if err != nil {
+			return err
+		}
+
+		logBucket, err := chanBucket.CreateBucketIfNotExists(
+			revocationLogBucket,
+		)
+		if err != nil {
+			return err
+		}
+
+		for i := uint64(0); i < numUpdates; i++ {
+			commit := channel.RemoteCommitment
+			commit.CommitHeight = i
+			_, err := appendChannelLogEntry(
+				logBucket, &commit, nil, false,
+			)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to populate revocation log: %v", err)
+	}
+	channel.RemoteCommitment.CommitHeight = numUpdates
+
+	assertRetained := func(prunedBelow uint64) {
+		for i := uint64(0); i < numUpdates; i++ {
+			_, err := channel.FindPreviousState(i)
+			switch {
+			case i < prunedBelow && err == nil:
+				t.Fatalf("state %v should have been pruned", i)
+			case i >= prunedBelow && err != nil:
+				t.Fatalf("state %v should have been retained: "+
+					"%v", i, err)
+			}
+		}
+	}
+
+	// Keeping the last three states should prune everything below
+	// update 7.
+	if err := channel.PruneChannelLog(3, numUpdates); err != nil {
+		t.Fatalf("unable to prune log: %v", err)
+	}
+	assertRetained(7)
+
+	// Asking to keep no states should be capped by the minimum retained
+	// update, so only state 7 is removed.
+	if err := channel.PruneChannelLog(0, 8); err != nil {
+		t.Fatalf("unable to prune log: %v", err)
+	}
+	assertRetained(8)
+
+	// Asking to keep more states than exist should be a no-op.
+	if err := channel.PruneChannelLog(numUpdates*2, numUpdates); err != nil {
+		t.Fatalf("unable to prune log: %v", err)
+	}
+	assertRetained(8)
+}
+
+// makeTestLogCommitments returns a series of sequential commitments derived
+// from the passed base commitment. A new HTLC is added at each state, and the
+// oldest HTLC is removed at every third state.
+func makeTestLogCommitments(base ChannelCommitment,
+	numStates int) []ChannelCommitment {
+
+	var (
+		commits []ChannelCommitment
+		htlcs   []HTLC
+	)
+	for i := 0; i < numStates; i++ {
+		htlc := HTLC{
+			Signature:     testSig.Serialize(),
+			Incoming:      i%2 == 0,
+			Amt:           lnwire.MilliSatoshi(1000 + i),
+			RHash:         key,
+			RefundTimeout: uint32(i),
+			OutputIndex:   int32(i),
+			HtlcIndex:     uint64(i),
+			LogIndex:      uint64(i),
+			OnionBlob:     bytes.Repeat([]byte{byte(i)}, 1366),
+		}
+		htlcs = append(htlcs, htlc)
+		if i%3 == 2 {
+			htlcs = htlcs[1:]
+		}
+
+		commit := base
+		commit.CommitHeight = uint64(i)
+		commit.LocalBalance = lnwire.MilliSatoshi(i * 1000)
+		commit.CommitSig = bytes.Repeat([]byte{byte(i)}, 71)
+		commit.Htlcs = append([]HTLC(nil), htlcs...)
+		commits = append(commits, commit)
+	}
+
+	return commits
+}
+
+// TestRevocationLogDiffs tests that states written to the revocation log as
+// diffs against prior entries can be fully reconstructed, including states
+// written in the legacy format and those following a pruned portion of the
+// log, regardless of whether each diff was encoded against the cached tail of
+// the log or a replayed one.
+func TestRevocationLogDiffs(t *testing.T) {
+	t.Parallel()
+
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	defer cleanUp()
+
+	channel, err := createTestChannelState(cdb)
+	if err != nil {
+		t.Fatalf("unable to create channel state: %v", err)
+	}
+	if err := channel.FullSync(); err != nil {
+		t.Fatalf("unable to save and serialize channel state: %v", err)
+	}
+
+	// We'll write enough states to span several full entries. The first
+	// state is written in the legacy format to ensure such entries can
+	// still serve as the base for later diffs.
+	numStates := revocationLogSnapshotInterval*2 + 10
+	commits := makeTestLogCommitments(channel.RemoteCommitment, numStates)
+	err = cdb.Update(func(tx *bolt.Tx) error {
+		chanBucket, err := readChanBucket(tx, channel.IdentityPub,
+			&channel.FundingOutpoint, channel.ChainHash)
+		if err != nil {
+			return err
+		}
+
+		logBucket, err := chanBucket.CreateBucketIfNotExists(
+			revocationLogBucket,
+		)
+		if err != nil {
+			return err
+		}
+
+		var b bytes.Buffer
+		if err := serializeChanCommit(&b, &commits[0]); err != nil {
+			return err
+		}
+		legacyKey := makeLogKey(commits[0].CommitHeight)
+		if err := logBucket.Put(legacyKey[:], b.Bytes()); err != nil {
+			return err
+		}
+
+		// Each append is passed the tail returned by the one before it,
+		// other than every so often, when we'll pass a stale tail,
+		// which should be ignored in favor of replaying the log.
+		var tail, staleTail *revocationLogTail
+		for i := 1; i < len(commits); i++ {
+			priorTail := tail
+			if i%10 == 0 {
+				priorTail = staleTail
+			}
+
+			newTail, err := appendChannelLogEntry(
+				logBucket, &commits[i], priorTail, false,
+			)
+			if err != nil {
+				return err
+			}
+
+			staleTail, tail = tail, newTail
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to populate revocation log: %v", err)
+	}
+
+	for i := range commits {
+		diskCommit, err := channel.FindPreviousState(uint64(i))
+		if err != nil {
+			t.Fatalf("unable to fetch state %v: %v", i, err)
+		}
+		assertCommitmentEqual(t, &commits[i], diskCommit)
+	}
+
+	deltas, err := channel.FetchChannelDeltas(0, uint64(numStates))
+	if err != nil {
+		t.Fatalf("unable to fetch deltas: %v", err)
+	}
+	if len(deltas) != numStates {
+		t.Fatalf("expected %v deltas, got %v", numStates, len(deltas))
+	}
+	for i := range commits {
+		assertCommitmentEqual(t, &commits[i], deltas[i])
+	}
+
+	logTail, err := channel.RevocationLogTail()
+	if err != nil {
+		t.Fatalf("unable to fetch log tail: %v", err)
+	}
+	assertCommitmentEqual(t, &commits[numStates-1], logTail)
+
+	// Pruning to a point in the middle of a run of diffs should leave all
+	// the retained states intact.
+	channel.RemoteCommitment.CommitHeight = uint64(numStates)
+	const keepLastN = 20
+	if err := channel.PruneChannelLog(keepLastN, uint64(numStates)); err != nil {
+		t.Fatalf("unable to prune log: %v", err)
+	}
+	for i := range commits {
+		diskCommit, err := channel.FindPreviousState(uint64(i))
+		if i < numStates-keepLastN {
+			if err == nil {
+				t.Fatalf("state %v should have been pruned", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unable to fetch state %v: %v", i, err)
+		}
+		assertCommitmentEqual(t, &commits[i], diskCommit)
+	}
+}
+
+// BenchmarkRevocationLogSize compares the on-disk size of the revocation log
+// when entries are written in full against when they are written as diffs.
+func BenchmarkRevocationLogSize(b *testing.B) {
+	channel, err := createTestChannelState(nil)
+	if err != nil {
+		b.Fatalf("unable to create channel state: %v", err)
+	}
+	commits := makeTestLogCommitments(channel.RemoteCommitment, 1000)
+
+	b.Run("full", func(b *testing.B) {
+		var size int
+		for i := 0; i < b.N; i++ {
+			size = 0
+			for j := range commits {
+				var w bytes.Buffer
+				w.WriteByte(logEntryFull)
+				err := serializeChanCommit(&w, &commits[j])
+				if err != nil {
+					b.Fatalf("unable to serialize: %v", err)
+				}
+				size += w.Len()
+			}
+		}
+		b.Logf("%v updates: %v bytes", len(commits), size)
+	})
+
+	b.Run("diff", func(b *testing.B) {
+		var size int
+		for i := 0; i < b.N; i++ {
+			size = 0
+			for j := range commits {
+				var w bytes.Buffer
+				if j%revocationLogSnapshotInterval == 0 {
+					w.WriteByte(logEntryFull)
+					err = serializeChanCommit(&w, &commits[j])
+				} else {
+					w.WriteByte(logEntryDiff)
+					err = serializeChanCommitDiff(
+						&w, &commits[j], &commits[j-1],
+					)
+				}
+				if err != nil {
+					b.Fatalf("unable to serialize: %v", err)
+				}
+				size += w.Len()
+			}
+		}
+		b.Logf("%v updates: %v bytes", len(commits), size)
+	})
+}
+
+// TestForEachChannel tests that ForEachChannel visits every open channel, and
+// that an error returned by the callback halts iteration and is returned.
+func TestForEachChannel(t *testing.T) {
+	t.Parallel()
+
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	defer cleanUp()
+
+	const numChannels = 3
+	for i := 0; i < numChannels; i++ {
+		state, err := createTestChannelState(cdb)
+		if err != nil {
+			t.Fatalf("unable to create channel state: %v", err)
+		}
+		state.FundingOutpoint.Index = uint32(i)
+
+		if err := syncTestChannel(state); err != nil {
+			t.Fatalf("unable to save and serialize channel "+
+				"state: %v", err)
+		}
+	}
+
+	seen := make(map[wire.OutPoint]struct{})
+	err = cdb.ForEachChannel(func(c *OpenChannel) error {
+		seen[c.FundingOutpoint] = struct{}{}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to iterate channels: %v", err)
+	}
+	if len(seen) != numChannels {
+		t.Fatalf("expected %v channels, saw %v", numChannels,
+			len(seen))
+	}
+
+	// An error returned from the callback should stop the iteration after
+	// the first channel, and be returned to the caller as is.
+	errStop := errors.New("stop")
+	var numCalls int
+	err = cdb.ForEachChannel(func(c *OpenChannel) error {
+		numCalls++
+		return errStop
+	})
+	if err != errStop {
+		t.Fatalf("expected %v, got %v", errStop, err)
+	}
+	if numCalls != 1 {
+		t.Fatalf("expected iteration to halt after 1 channel, "+
+			"got %v calls", numCalls)
+	}
+}
+
+// TestChannelSnapshotBalances tests that a channel snapshot reports both the
+// settled balances and the amounts each party has locked in outstanding
+// HTLCs.
+func TestChannelSnapshotBalances(t *testing.T) {
+	t.Parallel()
+
+	channel, err := createTestChannelState(nil)
+	if err != nil {
+		t.Fatalf("unable to create channel state: %v", err)
+	}
+
+	// We'll offer two HTLCs to the remote node, and accept a single HTLC
+	// from them. One of the outgoing HTLCs carries a sub-satoshi amount to
+	// ensure the sums are only rounded once.
+	channel.LocalCommitment.LocalBalance = lnwire.NewMSatFromSatoshis(5000)
+	channel.LocalCommitment.RemoteBalance = lnwire.NewMSatFromSatoshis(3000)
+	channel.LocalCommitment.Htlcs = []HTLC{
+		{Amt: 1500500, Incoming: false},
+		{Amt: 500500, Incoming: false},
+		{Amt: lnwire.NewMSatFromSatoshis(700), Incoming: true},
+	}
+
+	snapshot := channel.Snapshot()
+	if snapshot.LocalSettledBalance != 5000 {
+		t.Fatalf("expected local settled balance of %v, got %v",
+			5000, snapshot.LocalSettledBalance)
+	}
+	if snapshot.RemoteSettledBalance != 3000 {
+		t.Fatalf("expected remote settled balance of %v, got %v",
+			3000, snapshot.RemoteSettledBalance)
+	}
+	if snapshot.LocalInFlightBalance != 2001 {
+		t.Fatalf("expected local in-flight balance of %v, got %v",
+			2001, snapshot.LocalInFlightBalance)
+	}
+	if snapshot.RemoteInFlightBalance != 700 {
+		t.Fatalf("expected remote in-flight balance of %v, got %v",
+			700, snapshot.RemoteInFlightBalance)
+	}
+}
+
+// TestChannelLastUpdateTime tests that the last update time of a channel is
+// advanced and persisted each time its commitment state is updated.
+func TestChannelLastUpdateTime(t *testing.T) {
+	t.Parallel()
+
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	defer cleanUp()
+
+	channel, err := createTestChannelState(cdb)
+	if err != nil {
+		t.Fatalf("unable to create channel state: %v", err)
+	}
+	if err := channel.FullSync(); err != nil {
+		t.Fatalf("unable to save and serialize channel state: %v", err)
+	}
+
+	// A channel that has never been updated should have no last update
+	// time.
+	if !channel.Snapshot().LastUpdateTime.IsZero() {
+		t.Fatalf("expected zero last update time, got %v",
+			channel.Snapshot().LastUpdateTime)
+	}
+
+	var lastUpdate time.Time
+	for i := uint64(1); i <= 2; i++ {
+		commitment := channel.LocalCommitment
+		commitment.CommitHeight = i
+		if err := channel.UpdateCommitment(&commitment); err != nil {
+			t.Fatalf("unable to update commitment: %v", err)
+		}
+
+		if !channel.LastUpdateTime.After(lastUpdate) {
+			t.Fatalf("last update time didn't advance: %v vs %v",
+				channel.LastUpdateTime, lastUpdate)
+		}
+		lastUpdate = channel.LastUpdateTime
+
+		// The time should also be persisted, and reflected within the
+		// snapshot of the channel read back from disk.
+		diskChans, err := cdb.FetchOpenChannels(channel.IdentityPub)
+		if err != nil {
+			t.Fatalf("unable to fetch channels: %v", err)
+		}
+		diskUpdate := diskChans[0].Snapshot().LastUpdateTime
+		if !diskUpdate.Equal(lastUpdate) {
+			t.Fatalf("wrong last update time on disk: expected "+
+				"%v, got %v", lastUpdate, diskUpdate)
+		}
+	}
+}
+
+// TestNodeChannelSummary tests that the summary of a node's channels
+// aggregates the state of each, and that a node without channels yields a
+// zero summary.
+func TestNodeChannelSummary(t *testing.T) {
+	t.Parallel()
+
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	defer cleanUp()
+
+	var (
+		expected NodeSummary
+		nodeID   *btcec.PublicKey
+	)
+	for i := 0; i < 2; i++ {
+		state, err := createTestChannelState(cdb)
+		if err != nil {
+			t.Fatalf("unable to create channel state: %v", err)
+		}
+		state.FundingOutpoint.Index = uint32(i)
+		state.Capacity = btcutil.Amount(10000 * (i + 1))
+		state.TotalMSatSent = lnwire.MilliSatoshi(100 * (i + 1))
+		state.TotalMSatReceived = lnwire.MilliSatoshi(200 * (i + 1))
+
+		if err := syncTestChannel(state); err != nil {
+			t.Fatalf("unable to save and serialize channel "+
+				"state: %v", err)
+		}
+
+		nodeID = state.IdentityPub
+		expected.NumChannels++
+		expected.TotalCapacity += state.Capacity
+		expected.LocalBalance += state.LocalCommitment.LocalBalance
+		expected.RemoteBalance += state.LocalCommitment.RemoteBalance
+		expected.TotalMSatSent += state.TotalMSatSent
+		expected.TotalMSatReceived += state.TotalMSatReceived
+	}
+
+	summary, err := cdb.NodeChannelSummary(nodeID)
+	if err != nil {
+		t.Fatalf("unable to fetch node summary: %v", err)
+	}
+	if *summary != expected {
+		t.Fatalf("wrong summary: expected %v, got %v",
+			spew.Sdump(expected), spew.Sdump(summary))
+	}
+
+	// A node that we have no channels with should have an empty summary.
+	priv, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+	summary, err = cdb.NodeChannelSummary(priv.PubKey())
+	if err != nil {
+		t.Fatalf("unable to fetch node summary: %v", err)
+	}
+	if *summary != (NodeSummary{}) {
+		t.Fatalf("expected empty summary, got %v", spew.Sdump(summary))
+	}
+}
+
+// TestOpenChannelConcurrentSnapshot tests that snapshots of a channel taken
+// while its commitment is concurrently updated and reloaded are never torn.
+// This test is most useful when run with the race detector enabled.
+func TestOpenChannelConcurrentSnapshot(t *testing.T) {
+	t.Parallel()
+
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	defer cleanUp()
+
+	channel, err := createTestChannelState(cdb)
+	if err != nil {
+		t.Fatalf("unable to create channel state: %v", err)
+	}
+
+	// Each commitment we write will carry a balance derived from its
+	// height, allowing us to detect a snapshot which mixes the fields of
+	// two different commitments.
+	balanceAtHeight := func(height uint64) lnwire.MilliSatoshi {
+		return lnwire.MilliSatoshi(height * 1000)
+	}
+	channel.LocalCommitment.CommitHeight = 0
+	channel.LocalCommitment.LocalBalance = balanceAtHeight(0)
+	if err := channel.FullSync(); err != nil {
+		t.Fatalf("unable to save and serialize channel state: %v", err)
+	}
+
+	const numUpdates = 50
+	errChan := make(chan error, 2)
+	done := make(chan struct{})
+
+	commitTx := channel.LocalCommitment.CommitTx
+	commitSig := channel.LocalCommitment.CommitSig
+
+	go func() {
+		defer close(done)
+
+		for i := uint64(1); i <= numUpdates; i++ {
+			commitment := ChannelCommitment{
+				CommitHeight: i,
+				LocalBalance: balanceAtHeight(i),
+				CommitTx:     commitTx,
+				CommitSig:    commitSig,
+			}
+			if err := channel.UpdateCommitment(&commitment); err != nil {
+				errChan <- err
+				return
+			}
+		}
+	}()
+
+	go func() {
+		for {
+			select {
+			case <-done:
+				errChan <- nil
+				return
+			default:
+			}
+
+			if _, _, err := channel.LatestCommitments(); err != nil {
+				errChan <- err
+				return
+			}
+		}
+	}()
+
+	for {
+		snapshot := channel.Snapshot()
+		if snapshot.LocalBalance != balanceAtHeight(snapshot.CommitHeight) {
+			t.Fatalf("torn snapshot: balance %v at height %v",
+				snapshot.LocalBalance, snapshot.CommitHeight)
+		}
+
+		select {
+		case err := <-errChan:
+			if err != nil {
+				t.Fatalf("unable to update channel: %v", err)
+			}
+			return
+		default:
+		}
+	}
+}
+
+// TestFetchRevocationLogEntry tests that the breach remedy information for a
+// revoked state combines the logged commitment with the revealed preimage.
+func TestFetchRevocationLogEntry(t *testing.T) {
+	t.Parallel()
+
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	defer cleanUp()
+
+	channel, err := createTestChannelState(cdb)
+	if err != nil {
+		t.Fatalf("unable to create channel state: %v", err)
+	}
+	if err := channel.FullSync(); err != nil {
+		t.Fatalf("unable to save and serialize channel state: %v", err)
+	}
+
+	// The test channel's revocation store holds the preimage for state
+	// zero, so we'll add that state to the revocation log.
+	revokedCommit := channel.RemoteCommitment
+	revokedCommit.CommitHeight = 0
+	err = cdb.Update(func(tx *bolt.Tx) error {
+		chanBucket, err := readChanBucket(tx, channel.IdentityPub,
+			&channel.FundingOutpoint, channel.ChainHash)
+		if err != nil {
+			return err
+		}
+
+		logBucket, err := chanBucket.CreateBucketIfNotExists(
+			revocationLogBucket,
+		)
+		if err != nil {
+			return err
+		}
+
+		_, err = appendChannelLogEntry(
+			logBucket, &revokedCommit, nil, false,
+		)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("unable to populate revocation log: %v", err)
+	}
+
+	entry, err := channel.FetchRevocationLogEntry(0)
+	if err != nil {
+		t.Fatalf("unable to fetch revocation log entry: %v", err)
+	}
+	assertCommitmentEqual(t, &revokedCommit, &entry.Commitment)
+
+	producer, err := shachain.NewRevocationProducerFromBytes(key[:])
+	if err != nil {
+		t.Fatalf("unable to create producer: %v", err)
+	}
+	preimage, err := producer.AtIndex(0)
+	if err != nil {
+		t.Fatalf("unable to derive preimage: %v", err)
+	}
+	if entry.RevocationPreimage != *preimage {
+		t.Fatalf("wrong preimage: expected %v, got %v", preimage,
+			entry.RevocationPreimage)
+	}
+
+	// A state that hasn't been revoked shouldn't be found.
+	if _, err := channel.FetchRevocationLogEntry(1); err == nil {
+		t.Fatalf("expected unrevoked state to not be found")
+	}
+}
+
+// TestPendingHTLCSummary tests that the HTLCs outstanding across all open
+// channels are counted and summed.
+func TestPendingHTLCSummary(t *testing.T) {
+	t.Parallel()
+
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	defer cleanUp()
+
+	// With no channels, the summary should be empty.
+	count, totalValue, err := cdb.PendingHTLCSummary()
+	if err != nil {
+		t.Fatalf("unable to fetch htlc summary: %v", err)
+	}
+	if count != 0 || totalValue != 0 {
+		t.Fatalf("expected empty summary, got %v htlcs worth %v",
+			count, totalValue)
+	}
+
+	// We'll create one channel without any HTLCs, and two others with one
+	// and two HTLCs respectively.
+	for i := 0; i < 3; i++ {
+		state, err := createTestChannelState(cdb)
+		if err != nil {
+			t.Fatalf("unable to create channel state: %v", err)
+		}
+		state.FundingOutpoint.Index = uint32(i)
+
+		state.LocalCommitment.Htlcs = nil
+		for j := 0; j < i; j++ {
+			state.LocalCommitment.Htlcs = append(
+				state.LocalCommitment.Htlcs, HTLC{
+					Signature:   testSig.Serialize(),
+					Amt:         lnwire.NewMSatFromSatoshis(1000),
+					OnionBlob:   []byte{},
+					OutputIndex: int32(j),
+					HtlcIndex:   uint64(j),
+				},
+			)
+		}
+
+		if err := syncTestChannel(state); err != nil {
+			t.Fatalf("unable to save and serialize channel "+
+				"state: %v", err)
+		}
+	}
+
+	count, totalValue, err = cdb.PendingHTLCSummary()
+	if err != nil {
+		t.Fatalf("unable to fetch htlc summary: %v", err)
+	}
+	if count != 3 {
+		t.Fatalf("expected %v htlcs, got %v", 3, count)
+	}
+	if totalValue != 3000 {
+		t.Fatalf("expected total value of %v, got %v", 3000, totalValue)
+	}
+}
+
+func TestFetchPendingChannels(t *testing.T) {
+	t.Parallel()
+
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	defer cleanUp()
+
+	// Create first test channel state
+	state, err := createTestChannelState(cdb)
+	if err != nil {
+		t.Fatalf("unable to create channel state: %v", err)
+	}
+
+	addr := &net.TCPAddr{
+		IP:   net.ParseIP("127.0.0.1"),
+		Port: 18555,
+	}
+
+	const broadcastHeight = 99
+	if err := state.SyncPending(addr, broadcastHeight); err != nil {
+		t.Fatalf("unable to save and serialize channel state: %v", err)
+	}
+
+	pendingChannels, err := cdb.FetchPendingChannels()
+	if err != nil {
+		t.Fatalf("unable to list pending channels: %v", err)
+	}
+
+	if len(pendingChannels) != 1 {
+		t.Fatalf("incorrect number of pending channels: expecting %v,"+
+			"got %v", 1, len(pendingChannels))
+	}
+
+	// The broadcast height of the pending channel should have been set
+	// properly.
+	if pendingChannels[0].FundingBroadcastHeight != broadcastHeight {
+		t.Fatalf("broadcast height mismatch: expected %v, got %v",
+			pendingChannels[0].FundingBroadcastHeight,
+			broadcastHeight)
+	}
+
+	if pendingChannels[0].IsFundingConfirmed() {
+		t.Fatalf("pending channel shouldn't have a confirmed funding " +
+			"transaction")
+	}
+	if pendingChannels[0].FundingConfHeight() != 0 {
+		t.Fatalf("pending channel shouldn't have a funding conf height")
+	}
+
+	chanOpenLoc := lnwire.ShortChannelID{
+		BlockHeight: 5,
+		TxIndex:     10,
+		TxPosition:  15,
+	}
+	err = pendingChannels[0].MarkAsOpen(chanOpenLoc)
+	if err != nil {
+		t.Fatalf("unable to mark channel as open: %v", err)
+	}
+
+	if pendingChannels[0].IsPending {
+		t.Fatalf("channel marked open should no longer be pending")
+	}
+	if !pendingChannels[0].IsFundingConfirmed() {
+		t.Fatalf("channel marked open should have a confirmed " +
+			"funding transaction")
+	}
+	if pendingChannels[0].FundingConfHeight() != chanOpenLoc.BlockHeight {
+		t.Fatalf("funding conf height mismatch: expected %v, got %v",
+			chanOpenLoc.BlockHeight,
+			pendingChannels[0].FundingConfHeight())
+	}
+
+	if pendingChannels[0].ShortChanID != chanOpenLoc {
+		t.Fatalf("channel opening height not updated: expected %v, "+
+			"got %v", spew.Sdump(pendingChannels[0].ShortChanID),
+			chanOpenLoc)
+	}
+
+	// Next, we'll re-fetch the channel to ensure that the open height was
+	// properly set.
+	openChans, err := cdb.FetchAllChannels()
+	if err != nil {
+		t.Fatalf("unable to fetch channels: %v", err)
+	}
+	if openChans[0].ShortChanID != chanOpenLoc {
+		t.Fatalf("channel opening heights don't match: expected %v, "+
+			"got %v", spew.Sdump(openChans[0].ShortChanID),
+			chanOpenLoc)
+	}
+	if openChans[0].FundingBroadcastHeight != broadcastHeight {
+		t.Fatalf("broadcast height mismatch: expected %v, got %v",
+			openChans[0].FundingBroadcastHeight,
+			broadcastHeight)
+	}
+
+	pendingChannels, err = cdb.FetchPendingChannels()
+	if err != nil {
+		t.Fatalf("unable to list pending channels: %v", err)
+	}
+
+	if len(pendingChannels) != 0 {
+		t.Fatalf("incorrect number of pending channels: expecting %v,"+
+			"got %v", 0, len(pendingChannels))
+	}
+}
+
+func TestFetchClosedChannels(t *testing.T) {
+	t.Parallel()
+
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	defer cleanUp()
+
+	// First create a test channel, that we'll be closing within this pull
+	// request.
+	state, err := createTestChannelState(cdb)
 	if err != nil {
 		t.Fatalf("unable to create channel state: %v", err)
 	}
@@ -830,3 +2092,541 @@ func TestFetchClosedChannels(t *testing.T) {
 			"got %v", 0, len(closed))
 	}
 }
+
+// TestFetchClosedChannelsForNode tests that the closed channels of each node
+// are returned only when querying for that node.
+func TestFetchClosedChannelsForNode(t *testing.T) {
+	t.Parallel()
+
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	defer cleanUp()
+
+	// We'll close two channels with a second node, and one with the
+	// default test node.
+	priv, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+	otherNode := priv.PubKey()
+
+	var defaultNode *btcec.PublicKey
+	for i := 0; i < 3; i++ {
+		state, err := createTestChannelState(cdb)
+		if err != nil {
+			t.Fatalf("unable to create channel state: %v", err)
+		}
+		state.FundingOutpoint.Index = uint32(i)
+		if i > 0 {
+			state.IdentityPub = otherNode
+		} else {
+			defaultNode = state.IdentityPub
+		}
+
+		if err := syncTestChannel(state); err != nil {
+			t.Fatalf("unable to save and serialize channel "+
+				"state: %v", err)
+		}
+
+		summary := &ChannelCloseSummary{
+			ChanPoint: state.FundingOutpoint,
+			RemotePub: state.IdentityPub,
+			Capacity:  state.Capacity,
+			CloseType: CooperativeClose,
+		}
+		if err := state.CloseChannel(summary); err != nil {
+			t.Fatalf("unable to close channel: %v", err)
+		}
+	}
+
+	closed, err := cdb.FetchClosedChannelsForNode(otherNode)
+	if err != nil {
+		t.Fatalf("unable to fetch closed channels: %v", err)
+	}
+	if len(closed) != 2 {
+		t.Fatalf("expected %v closed channels, got %v", 2, len(closed))
+	}
+	for _, summary := range closed {
+		if !summary.RemotePub.IsEqual(otherNode) {
+			t.Fatalf("channel %v closed with wrong node",
+				summary.ChanPoint)
+		}
+	}
+
+	closed, err = cdb.FetchClosedChannelsForNode(defaultNode)
+	if err != nil {
+		t.Fatalf("unable to fetch closed channels: %v", err)
+	}
+	if len(closed) != 1 || closed[0].ChanPoint.Index != 0 {
+		t.Fatalf("unexpected closed channels: %v", spew.Sdump(closed))
+	}
+
+	// A node we've never had a channel with has no closed channels.
+	priv, err = btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+	closed, err = cdb.FetchClosedChannelsForNode(priv.PubKey())
+	if err != nil {
+		t.Fatalf("unable to fetch closed channels: %v", err)
+	}
+	if len(closed) != 0 {
+		t.Fatalf("expected no closed channels, got %v", len(closed))
+	}
+
+	// All of the closed channels are still returned when fetching those
+	// of every node.
+	closed, err = cdb.FetchClosedChannels(false)
+	if err != nil {
+		t.Fatalf("unable to fetch closed channels: %v", err)
+	}
+	if len(closed) != 3 {
+		t.Fatalf("expected %v closed channels, got %v", 3, len(closed))
+	}
+}
+
+// TestFetchClosedChannelLegacySummary tests that a closed channel entry
+// written by an older database, which stored only the channel point with an
+// empty value, can still be read back with an unknown close type once it has
+// been migrated into the unknown node bucket.
+func TestFetchClosedChannelLegacySummary(t *testing.T) {
+	t.Parallel()
+
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	defer cleanUp()
+
+	chanPoint := wire.OutPoint{
+		Hash:  rev,
+		Index: 3,
+	}
+
+	// Write the channel point directly into the closed channel bucket
+	// with an empty value, mirroring the legacy on-disk format.
+	err = cdb.Update(func(tx *bolt.Tx) error {
+		closeBucket, err := tx.CreateBucketIfNotExists(
+			closedChannelBucket,
+		)
+		if err != nil {
+			return err
+		}
+
+		var b bytes.Buffer
+		if err := writeOutpoint(&b, &chanPoint); err != nil {
+			return err
+		}
+
+		return closeBucket.Put(b.Bytes(), nil)
+	})
+	if err != nil {
+		t.Fatalf("unable to write legacy summary: %v", err)
+	}
+	if err := cdb.Update(migrateClosedChannelsByNode); err != nil {
+		t.Fatalf("unable to migrate legacy summary: %v", err)
+	}
+
+	summary, err := cdb.FetchClosedChannel(&chanPoint)
+	if err != nil {
+		t.Fatalf("unable to fetch legacy summary: %v", err)
+	}
+	if summary.ChanPoint != chanPoint {
+		t.Fatalf("wrong channel point: expected %v, got %v",
+			chanPoint, summary.ChanPoint)
+	}
+	if summary.CloseType != UnknownClose {
+		t.Fatalf("wrong close type: expected %v, got %v",
+			UnknownClose, summary.CloseType)
+	}
+
+	// The legacy entry should also be returned when fetching all closed
+	// channels, but not when fetching only those pending close.
+	closed, err := cdb.FetchClosedChannels(false)
+	if err != nil {
+		t.Fatalf("failed fetching closed channels: %v", err)
+	}
+	if len(closed) != 1 || closed[0].CloseType != UnknownClose {
+		t.Fatalf("unexpected closed channels: %v", spew.Sdump(closed))
+	}
+	pendingClosed, err := cdb.FetchClosedChannels(true)
+	if err != nil {
+		t.Fatalf("failed fetching pending closed channels: %v", err)
+	}
+	if len(pendingClosed) != 0 {
+		t.Fatalf("incorrect number of pending closed channels: "+
+			"expecting %v, got %v", 0, len(pendingClosed))
+	}
+}
+
+// TestCloseNegotiationRestart tests that the fee negotiation state of a
+// cooperative close survives a restart, and is removed once the channel is
+// closed.
+func TestCloseNegotiationRestart(t *testing.T) {
+	t.Parallel()
+
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	defer cleanUp()
+
+	channel, err := createTestChannelState(cdb)
+	if err != nil {
+		t.Fatalf("unable to create channel state: %v", err)
+	}
+	if err := channel.FullSync(); err != nil {
+		t.Fatalf("unable to save and serialize channel state: %v", err)
+	}
+
+	// Before any negotiation has taken place, there should be no state.
+	_, err = channel.FetchCloseNegotiation()
+	if err != ErrNoCloseNegotiation {
+		t.Fatalf("expected ErrNoCloseNegotiation, got %v", err)
+	}
+
+	// We'll save a couple rounds of negotiation, with each overwriting
+	// the last.
+	if err := channel.SaveCloseNegotiation(1000, 5000, 1); err != nil {
+		t.Fatalf("unable to save close negotiation: %v", err)
+	}
+	if err := channel.SaveCloseNegotiation(2000, 4000, 2); err != nil {
+		t.Fatalf("unable to save close negotiation: %v", err)
+	}
+
+	// Now we'll simulate a restart mid-negotiation by closing the
+	// database, and re-opening it.
+	dbPath := cdb.dbPath
+	if err := cdb.Close(); err != nil {
+		t.Fatalf("unable to close database: %v", err)
+	}
+	cdb, err = Open(dbPath)
+	if err != nil {
+		t.Fatalf("unable to re-open database: %v", err)
+	}
+	defer cdb.Close()
+
+	diskChans, err := cdb.FetchOpenChannels(channel.IdentityPub)
+	if err != nil {
+		t.Fatalf("unable to fetch channels: %v", err)
+	}
+	if len(diskChans) != 1 {
+		t.Fatalf("expected %v channel, got %v", 1, len(diskChans))
+	}
+	channel = diskChans[0]
+
+	// The latest round of negotiation should be returned.
+	negotiation, err := channel.FetchCloseNegotiation()
+	if err != nil {
+		t.Fatalf("unable to fetch close negotiation: %v", err)
+	}
+	expected := &CloseNegotiation{
+		OurFee:   2000,
+		TheirFee: 4000,
+		Round:    2,
+	}
+	if !reflect.DeepEqual(negotiation, expected) {
+		t.Fatalf("close negotiation mismatch: expected %v, got %v",
+			spew.Sdump(expected), spew.Sdump(negotiation))
+	}
+
+	// Once the channel is closed, the negotiation state should be deleted
+	// along with the rest of the channel.
+	summary := &ChannelCloseSummary{
+		ChanPoint:      channel.FundingOutpoint,
+		RemotePub:      channel.IdentityPub,
+		Capacity:       channel.Capacity,
+		SettledBalance: channel.LocalCommitment.LocalBalance.ToSatoshis(),
+		CloseType:      CooperativeClose,
+	}
+	if err := channel.CloseChannel(summary); err != nil {
+		t.Fatalf("unable to close channel: %v", err)
+	}
+	if _, err := channel.FetchCloseNegotiation(); err == nil {
+		t.Fatalf("close negotiation wasn't deleted")
+	}
+}
+
+// TestBalanceHistory tests that the balance history of a channel is returned
+// in ascending update order, and ends with the channel's current balances.
+func TestBalanceHistory(t *testing.T) {
+	t.Parallel()
+
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	defer cleanUp()
+
+	// Querying the history of an unknown channel should fail.
+	var unknown wire.OutPoint
+	if _, err := cdb.BalanceHistory(&unknown); err != ErrChannelNotFound {
+		t.Fatalf("expected ErrChannelNotFound, got %v", err)
+	}
+
+	// We'll create a channel whose current remote commitment follows the
+	// states we'll write to the revocation log below.
+	const numStates = 5
+	channel, err := createTestChannelState(cdb)
+	if err != nil {
+		t.Fatalf("unable to create channel state: %v", err)
+	}
+	channel.RemoteCommitment.CommitHeight = numStates + 1
+
+	// The channel is synced along with a link node for the remote party,
+	// so that it can be found when iterating over all channels.
+	if err := syncTestChannel(channel); err != nil {
+		t.Fatalf("unable to save and serialize channel state: %v", err)
+	}
+
+	err = cdb.Update(func(tx *bolt.Tx) error {
+		chanBucket, err := readChanBucket(tx, channel.IdentityPub,
+			&channel.FundingOutpoint, channel.ChainHash)
+		if err != nil {
+			return err
+		}
+
+		logBucket, err := chanBucket.CreateBucketIfNotExists(
+			revocationLogBucket,
+		)
+		if err != nil {
+			return err
+		}
+
+		for i := uint64(1); i <= numStates; i++ {
+			commit := channel.RemoteCommitment
+			commit.CommitHeight = i
+			commit.LocalBalance = lnwire.MilliSatoshi(i * 1000)
+			commit.RemoteBalance = lnwire.MilliSatoshi(10000 - i*1000)
+			_, err := appendChannelLogEntry(
+				logBucket, &commit, nil, false,
+			)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to populate revocation log: %v", err)
+	}
+
+	history, err := cdb.BalanceHistory(&channel.FundingOutpoint)
+	if err != nil {
+		t.Fatalf("unable to fetch balance history: %v", err)
+	}
+	if len(history) != numStates+1 {
+		t.Fatalf("expected %v points, got %v", numStates+1, len(history))
+	}
+
+	for i, point := range history {
+		if i > 0 && point.UpdateNum <= history[i-1].UpdateNum {
+			t.Fatalf("update numbers not ascending: %v followed "+
+				"by %v", history[i-1].UpdateNum, point.UpdateNum)
+		}
+		if i == len(history)-1 {
+			break
+		}
+
+		expectedLocal := lnwire.MilliSatoshi((i + 1) * 1000)
+		if point.LocalBalance != expectedLocal {
+			t.Fatalf("point %v: expected local balance %v, got %v",
+				i, expectedLocal, point.LocalBalance)
+		}
+	}
+
+	// The final point should reflect the channel's current balances.
+	finalPoint := history[len(history)-1]
+	expectedFinal := BalancePoint{
+		UpdateNum:     channel.RemoteCommitment.CommitHeight,
+		LocalBalance:  channel.RemoteCommitment.LocalBalance,
+		RemoteBalance: channel.RemoteCommitment.RemoteBalance,
+	}
+	if finalPoint != expectedFinal {
+		t.Fatalf("final point mismatch: expected %v, got %v",
+			spew.Sdump(expectedFinal), spew.Sdump(finalPoint))
+	}
+}
+
+// TestVerifyUpdateCount tests that VerifyUpdateCount reports matching counts
+// for a consistent channel, and detects a revocation log which has fallen
+// behind the stored remote commitment.
+func TestVerifyUpdateCount(t *testing.T) {
+	t.Parallel()
+
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	defer cleanUp()
+
+	channel, err := createTestChannelState(cdb)
+	if err != nil {
+		t.Fatalf("unable to create channel state: %v", err)
+	}
+	channel.RemoteCommitment.CommitHeight = 0
+	if err := channel.FullSync(); err != nil {
+		t.Fatalf("unable to save and serialize channel state: %v", err)
+	}
+
+	// A freshly created channel has neither updates nor log entries.
+	stored, logged, err := channel.VerifyUpdateCount()
+	if err != nil {
+		t.Fatalf("unable to verify update count: %v", err)
+	}
+	if stored != 0 || logged != 0 {
+		t.Fatalf("expected counts of 0, got stored=%v, logged=%v",
+			stored, logged)
+	}
+
+	// writeState writes the remote commitment at the given height, along
+	// with the log entries of each prior state up to logHeight.
+	writeState := func(height, logHeight uint64) {
+		err := cdb.Update(func(tx *bolt.Tx) error {
+			chanBucket, err := readChanBucket(tx, channel.IdentityPub,
+				&channel.FundingOutpoint, channel.ChainHash)
+			if err != nil {
+				return err
+			}
+
+			logBucket, err := chanBucket.CreateBucketIfNotExists(
+				revocationLogBucket,
+			)
+			if err != nil {
+				return err
+			}
+
+			commit := channel.RemoteCommitment
+			for i := uint64(0); i < logHeight; i++ {
+				commit.CommitHeight = i
+				_, err := appendChannelLogEntry(
+					logBucket, &commit, nil, false,
+				)
+				if err != nil {
+					return err
+				}
+			}
+
+			commit.CommitHeight = height
+			return putChanCommitment(chanBucket, &commit, false)
+		})
+		if err != nil {
+			t.Fatalf("unable to write channel state: %v", err)
+		}
+	}
+
+	// After three consistent updates, both counts should agree.
+	writeState(3, 3)
+	stored, logged, err = channel.VerifyUpdateCount()
+	if err != nil {
+		t.Fatalf("unable to verify update count: %v", err)
+	}
+	if stored != 3 || logged != 3 {
+		t.Fatalf("expected counts of 3, got stored=%v, logged=%v",
+			stored, logged)
+	}
+
+	// If the remote commitment advances without its predecessor being
+	// logged, the mismatch should be reported.
+	writeState(4, 0)
+	stored, logged, err = channel.VerifyUpdateCount()
+	if err != nil {
+		t.Fatalf("unable to verify update count: %v", err)
+	}
+	if stored != 4 || logged != 3 {
+		t.Fatalf("expected stored=4, logged=3, got stored=%v, "+
+			"logged=%v", stored, logged)
+	}
+}
+
+// TestRevocationLogMonotonic tests that states can only be appended to the
+// revocation log in ascending order, unless a replay is explicitly allowed,
+// and that replaying an entry leaves the states that follow it intact.
+func TestRevocationLogMonotonic(t *testing.T) {
+	t.Parallel()
+
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	defer cleanUp()
+
+	channel, err := createTestChannelState(cdb)
+	if err != nil {
+		t.Fatalf("unable to create channel state: %v", err)
+	}
+	if err := channel.FullSync(); err != nil {
+		t.Fatalf("unable to save and serialize channel state: %v", err)
+	}
+
+	commits := makeTestLogCommitments(channel.RemoteCommitment, 5)
+
+	// appendEntry attempts to append the passed commitment to the
+	// revocation log.
+	appendEntry := func(commit *ChannelCommitment) error {
+		return cdb.Update(func(tx *bolt.Tx) error {
+			chanBucket, err := readChanBucket(tx, channel.IdentityPub,
+				&channel.FundingOutpoint, channel.ChainHash)
+			if err != nil {
+				return err
+			}
+
+			logBucket, err := chanBucket.CreateBucketIfNotExists(
+				revocationLogBucket,
+			)
+			if err != nil {
+				return err
+			}
+
+			_, err = appendChannelLogEntry(
+				logBucket, commit, nil, false,
+			)
+			return err
+		})
+	}
+
+	// Appending each of the states in order should succeed.
+	for i := range commits {
+		if err := appendEntry(&commits[i]); err != nil {
+			t.Fatalf("unable to append state %v: %v", i, err)
+		}
+	}
+
+	// Attempting to append either the current tail, or a state prior to
+	// it, should be rejected.
+	for _, i := range []int{4, 2} {
+		err := appendEntry(&commits[i])
+		if err != ErrNonMonotonicUpdate {
+			t.Fatalf("expected ErrNonMonotonicUpdate for state %v, "+
+				"got %v", i, err)
+		}
+	}
+
+	// If the replay is explicitly requested, then the prior state should
+	// be overwritten.
+	replayed := commits[2]
+	replayed.LocalBalance += 1000
+	replayed.Htlcs = nil
+	if err := channel.ReplayRevocationLogEntry(&replayed); err != nil {
+		t.Fatalf("unable to replay state: %v", err)
+	}
+	commits[2] = replayed
+
+	// All states should be reconstructed as expected, including those
+	// following the replayed state, which may have been stored as diffs
+	// against its original contents.
+	diskCommits, err := channel.FetchChannelDeltas(0, math.MaxUint64)
+	if err != nil {
+		t.Fatalf("unable to fetch deltas: %v", err)
+	}
+	if len(diskCommits) != len(commits) {
+		t.Fatalf("expected %v states, got %v", len(commits),
+			len(diskCommits))
+	}
+	for i := range commits {
+		assertCommitmentEqual(t, &commits[i], diskCommits[i])
+	}
+}
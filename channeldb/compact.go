@@ -0,0 +1,206 @@
+package channeldb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/coreos/bbolt"
+)
+
+const (
+	// compactTxMaxSize is the approximate number of bytes of keys and
+	// values that will be copied within a single transaction while
+	// compacting the database. Larger transactions require more memory, as
+	// all dirty pages are held until they're committed.
+	compactTxMaxSize = 16 * 1024 * 1024
+)
+
+// Compact writes a compacted copy of the database to a new file at destPath.
+// As bolt never returns the pages freed by deleted buckets to the OS, the
+// database file only ever grows. By copying each bucket recursively into a
+// fresh file, the copy occupies only the space required by the live data.
+//
+// NOTE: The copy is read from a single read transaction, so it reflects a
+// consistent snapshot of the database.
+func (d *DB) Compact(destPath string) error {
+	if fileExists(destPath) {
+		return fmt.Errorf("unable to compact database: %v already "+
+			"exists", destPath)
+	}
+
+	dst, err := bolt.Open(destPath, dbFilePermission, nil)
+	if err != nil {
+		return err
+	}
+
+	err = d.View(func(srcTx *bolt.Tx) error {
+		return compactBolt(dst, srcTx)
+	})
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(destPath)
+		return err
+	}
+
+	return nil
+}
+
+// CompactInPlace compacts the database, replacing the existing database file
+// with the compacted copy. The database is compacted into a temporary file,
+// after which the existing handle is closed, the compacted file is swapped in
+// place of the original, and the database is re-opened with the options it
+// was originally opened with. A database opened read-only can't be compacted
+// in place.
+//
+// NOTE: The database MUST NOT be in use by any other goroutine while it's
+// being compacted, as the underlying handle is replaced.
+func (d *DB) CompactInPlace() error {
+	if d.opts.ReadOnly {
+		return ErrDBReadOnly
+	}
+
+	path := filepath.Join(d.dbPath, dbName)
+	tempPath := path + ".compact"
+
+	// Remove any temporary file left behind by a prior failed attempt.
+	if err := os.RemoveAll(tempPath); err != nil {
+		return err
+	}
+	if err := d.Compact(tempPath); err != nil {
+		return err
+	}
+
+	if err := d.DB.Close(); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+
+	// Even if we fail to swap in the compacted file, we'll re-open the
+	// database so the handle remains usable.
+	renameErr := os.Rename(tempPath, path)
+
+	bdb, err := openBoltDB(path, d.opts)
+	if err != nil {
+		return err
+	}
+	d.DB = bdb
+
+	return renameErr
+}
+
+// compactBolt copies every bucket, nested bucket, and key within srcTx into
+// dst, committing the destination transaction each time compactTxMaxSize
+// bytes have been copied.
+func compactBolt(dst *bolt.DB, srcTx *bolt.Tx) error {
+	tx, err := dst.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		tx.Rollback()
+	}()
+
+	var size int64
+	err = srcTx.ForEach(func(name []byte, b *bolt.Bucket) error {
+		return walkBucket(b, nil, name, nil, b.Sequence(),
+			func(keyPath [][]byte, k, v []byte, seq uint64) error {
+				// If the current transaction has grown too
+				// large, we'll commit it and start another.
+				itemSize := int64(len(k) + len(v))
+				if size+itemSize > compactTxMaxSize {
+					if err := tx.Commit(); err != nil {
+						return err
+					}
+
+					tx, err = dst.Begin(true)
+					if err != nil {
+						return err
+					}
+					size = 0
+				}
+				size += itemSize
+
+				return copyBucketItem(tx, keyPath, k, v, seq)
+			},
+		)
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// copyBucketItem writes a single key or bucket into the bucket at keyPath
+// within tx. If v is nil, then k is a bucket, which is created with the given
+// sequence number.
+func copyBucketItem(tx *bolt.Tx, keyPath [][]byte, k, v []byte,
+	seq uint64) error {
+
+	// With an empty key path, the item is a top-level bucket.
+	if len(keyPath) == 0 {
+		bucket, err := tx.CreateBucket(k)
+		if err != nil {
+			return err
+		}
+
+		return bucket.SetSequence(seq)
+	}
+
+	parent := tx.Bucket(keyPath[0])
+	for _, key := range keyPath[1:] {
+		parent = parent.Bucket(key)
+	}
+
+	// As keys are copied in order, we can fill each page entirely.
+	parent.FillPercent = 1.0
+
+	if v == nil {
+		bucket, err := parent.CreateBucket(k)
+		if err != nil {
+			return err
+		}
+
+		return bucket.SetSequence(seq)
+	}
+
+	return parent.Put(k, v)
+}
+
+// walkBucket recursively walks the bucket b, which is stored under the key k
+// at keyPath, calling walkFn for the bucket itself, and then each of its keys
+// and nested buckets.
+func walkBucket(b *bolt.Bucket, keyPath [][]byte, k, v []byte, seq uint64,
+	walkFn func([][]byte, []byte, []byte, uint64) error) error {
+
+	if err := walkFn(keyPath, k, v, seq); err != nil {
+		return err
+	}
+
+	// If this is a regular key, rather than a bucket, then there's
+	// nothing further to walk.
+	if v != nil {
+		return nil
+	}
+
+	// Otherwise, we'll walk each of the items within the bucket. We copy
+	// the key path so that sibling buckets don't share a backing array.
+	childPath := make([][]byte, len(keyPath), len(keyPath)+1)
+	copy(childPath, keyPath)
+	childPath = append(childPath, k)
+
+	return b.ForEach(func(k, v []byte) error {
+		if v == nil {
+			child := b.Bucket(k)
+			return walkBucket(
+				child, childPath, k, nil, child.Sequence(),
+				walkFn,
+			)
+		}
+
+		return walkBucket(b, childPath, k, v, b.Sequence(), walkFn)
+	})
+}
@@ -0,0 +1,177 @@
+package channeldb
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/coreos/bbolt"
+)
+
+// TestCompactInPlace tests that compacting the database after deleting a
+// large bucket shrinks the database file, while preserving the remaining
+// buckets, keys, and sequence numbers.
+func TestCompactInPlace(t *testing.T) {
+	t.Parallel()
+
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	defer cleanUp()
+
+	var (
+		largeBucket  = []byte("large")
+		keptBucket   = []byte("kept")
+		nestedBucket = []byte("nested")
+		keptKey      = []byte("key")
+		keptValue    = []byte("value")
+	)
+
+	// We'll populate a large bucket that we'll later delete, along with a
+	// smaller bucket holding a nested bucket which should survive the
+	// compaction.
+	err = cdb.Update(func(tx *bolt.Tx) error {
+		large, err := tx.CreateBucket(largeBucket)
+		if err != nil {
+			return err
+		}
+		value := bytes.Repeat([]byte{0xaa}, 1024)
+		for i := 0; i < 10000; i++ {
+			key := []byte(fmt.Sprintf("key-%05d", i))
+			if err := large.Put(key, value); err != nil {
+				return err
+			}
+		}
+
+		kept, err := tx.CreateBucket(keptBucket)
+		if err != nil {
+			return err
+		}
+		nested, err := kept.CreateBucket(nestedBucket)
+		if err != nil {
+			return err
+		}
+		if err := nested.SetSequence(42); err != nil {
+			return err
+		}
+
+		return nested.Put(keptKey, keptValue)
+	})
+	if err != nil {
+		t.Fatalf("unable to populate database: %v", err)
+	}
+
+	err = cdb.Update(func(tx *bolt.Tx) error {
+		return tx.DeleteBucket(largeBucket)
+	})
+	if err != nil {
+		t.Fatalf("unable to delete bucket: %v", err)
+	}
+
+	dbFile := filepath.Join(cdb.Path(), dbName)
+	info, err := os.Stat(dbFile)
+	if err != nil {
+		t.Fatalf("unable to stat database: %v", err)
+	}
+	sizeBefore := info.Size()
+
+	if err := cdb.CompactInPlace(); err != nil {
+		t.Fatalf("unable to compact database: %v", err)
+	}
+
+	info, err = os.Stat(dbFile)
+	if err != nil {
+		t.Fatalf("unable to stat database: %v", err)
+	}
+	if info.Size() >= sizeBefore {
+		t.Fatalf("database didn't shrink: %v bytes before, %v after",
+			sizeBefore, info.Size())
+	}
+
+	// The remaining data should be intact within the compacted database.
+	err = cdb.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(largeBucket) != nil {
+			return fmt.Errorf("deleted bucket was restored")
+		}
+
+		kept := tx.Bucket(keptBucket)
+		if kept == nil {
+			return fmt.Errorf("kept bucket not found")
+		}
+		nested := kept.Bucket(nestedBucket)
+		if nested == nil {
+			return fmt.Errorf("nested bucket not found")
+		}
+		if nested.Sequence() != 42 {
+			return fmt.Errorf("expected sequence 42, got %v",
+				nested.Sequence())
+		}
+		if !bytes.Equal(nested.Get(keptKey), keptValue) {
+			return fmt.Errorf("kept value mismatch")
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The version of the database should also have been preserved.
+	if _, err := cdb.FetchMeta(nil); err != nil {
+		t.Fatalf("unable to fetch meta data: %v", err)
+	}
+}
+
+// TestCompactInPlaceOptions tests that compacting the database in place
+// preserves the options it was opened with, and that a database opened
+// read-only is refused.
+func TestCompactInPlaceOptions(t *testing.T) {
+	t.Parallel()
+
+	tempDirName, err := ioutil.TempDir("", "channeldb")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDirName)
+
+	cdb, err := OpenWithOptions(tempDirName, &Options{
+		Timeout: time.Second,
+		NoSync:  true,
+	})
+	if err != nil {
+		t.Fatalf("unable to open database: %v", err)
+	}
+
+	if err := cdb.CompactInPlace(); err != nil {
+		t.Fatalf("unable to compact database: %v", err)
+	}
+	if !cdb.NoSync {
+		t.Fatalf("expected NoSync to be preserved after compaction")
+	}
+	if err := cdb.Close(); err != nil {
+		t.Fatalf("unable to close database: %v", err)
+	}
+
+	// Once re-opened read-only, the database shouldn't be compacted.
+	cdb, err = OpenWithOptions(tempDirName, &Options{
+		Timeout:  time.Second,
+		ReadOnly: true,
+	})
+	if err != nil {
+		t.Fatalf("unable to open database read-only: %v", err)
+	}
+	defer cdb.Close()
+
+	if err := cdb.CompactInPlace(); err != ErrDBReadOnly {
+		t.Fatalf("expected ErrDBReadOnly, got %v", err)
+	}
+	tempPath := filepath.Join(tempDirName, dbName+".compact")
+	if _, err := os.Stat(tempPath); !os.IsNotExist(err) {
+		t.Fatalf("expected no compacted copy to be written")
+	}
+}
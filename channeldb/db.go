@@ -4,19 +4,30 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
 	"os"
 	"path/filepath"
+	"runtime/debug"
 	"sync"
+	"time"
 
 	"github.com/coreos/bbolt"
 	"github.com/go-errors/errors"
+	"github.com/lightningnetwork/lnd/lnwire"
 	"github.com/roasbeef/btcd/btcec"
 	"github.com/roasbeef/btcd/wire"
+	"github.com/roasbeef/btcutil"
 )
 
 const (
 	dbName           = "channel.db"
 	dbFilePermission = 0600
+
+	// defaultDBTimeout is the amount of time Open will wait to obtain the
+	// file lock on the database before giving up.
+	defaultDBTimeout = time.Minute
 )
 
 // migration is a function which takes a prior outdated version of the database
@@ -40,6 +51,18 @@ var (
 			number:    0,
 			migration: nil,
 		},
+		{
+			// The version of the database where the last update
+			// time of each channel is recorded.
+			number:    1,
+			migration: migrateLastUpdateTime,
+		},
+		{
+			// The version of the database where closed channel
+			// summaries are stored by the node they were with.
+			number:    2,
+			migration: migrateClosedChannelsByNode,
+		},
 	}
 
 	// Big endian is the preferred byte order, due to cursor scans over
@@ -57,20 +80,94 @@ var bufPool = &sync.Pool{
 type DB struct {
 	*bolt.DB
 	dbPath string
+
+	// opts are the options the database was opened with, which are reused
+	// whenever the underlying bolt database is re-opened.
+	opts *Options
+
+	// keyDeriver is an optional function closure that, if set, will be
+	// used to re-derive the local channel keys of each channel read from
+	// disk from their key locators.
+	keyDeriver KeyDeriver
+
+	// cryptoSystem is an optional EncryptorDecryptor that, if set, will be
+	// used to encrypt and decrypt channel backups.
+	cryptoSystem EncryptorDecryptor
+
+	// txRetryPolicy is an optional policy that, if set, determines which
+	// failed transactions are retried by UpdateWithRetry and
+	// ViewWithRetry.
+	txRetryPolicy *TxRetryPolicy
 }
 
-// Open opens an existing channeldb. Any necessary schemas migrations due to
-// updates will take place as necessary.
+// TxRetryPolicy determines which failed database transactions are retried,
+// and how many times.
+type TxRetryPolicy struct {
+	// MaxRetries is the maximum number of times a failed transaction will
+	// be retried.
+	MaxRetries uint32
+
+	// IsTransient returns true if a transaction which failed with the
+	// passed error should be retried.
+	IsTransient func(error) bool
+}
+
+// Options holds the parameters used to open the underlying bolt database.
+type Options struct {
+	// Timeout is the amount of time to wait to obtain the file lock on the
+	// database. If zero, we'll wait indefinitely.
+	Timeout time.Duration
+
+	// ReadOnly opens the database in read-only mode, allowing it to be
+	// inspected by multiple processes at once. A read-only database is
+	// never created or migrated.
+	ReadOnly bool
+
+	// NoSync skips fsync after each commit. This is only safe to use for
+	// databases that can be recreated in the case of a crash, such as
+	// those used within tests.
+	NoSync bool
+}
+
+// DefaultOptions returns the Options used by Open.
+func DefaultOptions() *Options {
+	return &Options{
+		Timeout: defaultDBTimeout,
+	}
+}
+
+// Open opens an existing channeldb, creating it if it doesn't yet exist. Any
+// necessary schemas migrations due to updates will take place as necessary.
+//
+// NOTE: The database isn't aware of which network it's used for. Callers
+// operating on several networks at once should use a distinct dbPath for each,
+// as lnd does by opening the database within a network-specific directory.
 func Open(dbPath string) (*DB, error) {
+	return OpenWithOptions(dbPath, DefaultOptions())
+}
+
+// OpenWithOptions opens the channeldb at the target path using the passed
+// options. If opts is nil, then the default options will be used. Unless the
+// database is opened read-only, it will be created if it doesn't yet exist,
+// and any necessary schema migrations will be applied.
+func OpenWithOptions(dbPath string, opts *Options) (*DB, error) {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+
 	path := filepath.Join(dbPath, dbName)
 
 	if !fileExists(path) {
+		if opts.ReadOnly {
+			return nil, ErrNoChanDBFile
+		}
+
 		if err := createChannelDB(dbPath); err != nil {
 			return nil, err
 		}
 	}
 
-	bdb, err := bolt.Open(path, dbFilePermission, nil)
+	bdb, err := openBoltDB(path, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -78,6 +175,19 @@ func Open(dbPath string) (*DB, error) {
 	chanDB := &DB{
 		DB:     bdb,
 		dbPath: dbPath,
+		opts:   opts,
+	}
+
+	// A read-only database can't be migrated, so we'll instead ensure
+	// that it's already up to date, as it would otherwise be
+	// misinterpreted.
+	if opts.ReadOnly {
+		if err := chanDB.checkVersion(dbVersions); err != nil {
+			bdb.Close()
+			return nil, err
+		}
+
+		return chanDB, nil
 	}
 
 	// Synchronize the version of database and apply migrations if needed.
@@ -89,55 +199,228 @@ func Open(dbPath string) (*DB, error) {
 	return chanDB, nil
 }
 
+// openBoltDB opens the bolt database file at path, applying the passed
+// options.
+func openBoltDB(path string, opts *Options) (*bolt.DB, error) {
+	bdb, err := bolt.Open(path, dbFilePermission, &bolt.Options{
+		Timeout:  opts.Timeout,
+		ReadOnly: opts.ReadOnly,
+	})
+	if err != nil {
+		return nil, err
+	}
+	bdb.NoSync = opts.NoSync
+
+	return bdb, nil
+}
+
 // Path returns the file path to the channel database.
 func (d *DB) Path() string {
 	return d.dbPath
 }
 
+// SetKeyDeriver sets the function closure that will be used to re-derive the
+// local keys of each channel from their key locators as channels are read
+// from disk. With a deriver set, channels may be stored without the public
+// keys of their local descriptors, as each carries a locator. If the public key
+// is stored, then it's checked against the derived key.
+func (d *DB) SetKeyDeriver(derive KeyDeriver) {
+	d.keyDeriver = derive
+}
+
+// SetTxRetryPolicy sets the policy used to retry transactions executed via
+// UpdateWithRetry and ViewWithRetry which fail with a transient error. By
+// default, transactions aren't retried. Transactions executed via Update and
+// View are never retried.
+func (d *DB) SetTxRetryPolicy(policy *TxRetryPolicy) {
+	d.txRetryPolicy = policy
+}
+
+// Update executes the passed closure within a read-write transaction, which is
+// committed if the closure returns nil, and rolled back otherwise. If the
+// closure panics, the panic is recovered and returned as an error, and the
+// transaction is rolled back.
+func (d *DB) Update(fn func(*bolt.Tx) error) error {
+	return d.DB.Update(recoverTx(fn))
+}
+
+// View executes the passed closure within a read-only transaction. If the
+// closure panics, the panic is recovered and returned as an error.
+func (d *DB) View(fn func(*bolt.Tx) error) error {
+	return d.DB.View(recoverTx(fn))
+}
+
+// UpdateWithRetry executes the passed closure within a read-write transaction
+// as Update does, retrying the transaction if it fails with an error deemed
+// transient by the registered TxRetryPolicy.
+//
+// NOTE: The closure may be executed multiple times, so it MUST be idempotent,
+// resetting any state captured from outside of the transaction on each
+// execution.
+func (d *DB) UpdateWithRetry(fn func(*bolt.Tx) error) error {
+	return d.retryTx(func() error {
+		return d.Update(fn)
+	})
+}
+
+// ViewWithRetry executes the passed closure within a read-only transaction as
+// View does, retrying the transaction if it fails with an error deemed
+// transient by the registered TxRetryPolicy.
+//
+// NOTE: The closure may be executed multiple times, so it MUST be idempotent,
+// resetting any state captured from outside of the transaction on each
+// execution.
+func (d *DB) ViewWithRetry(fn func(*bolt.Tx) error) error {
+	return d.retryTx(func() error {
+		return d.View(fn)
+	})
+}
+
+// retryTx executes the passed transaction, retrying it as permitted by the
+// registered TxRetryPolicy.
+func (d *DB) retryTx(execTx func() error) error {
+	policy := d.txRetryPolicy
+
+	var attempt uint32
+	for {
+		err := execTx()
+		if err == nil || policy == nil || attempt >= policy.MaxRetries {
+			return err
+		}
+
+		// Panics are never considered transient, as they indicate a
+		// bug within the closure itself.
+		if _, ok := err.(ErrTxPanic); ok || !policy.IsTransient(err) {
+			return err
+		}
+
+		attempt++
+		log.Debugf("Retrying transient database error (attempt "+
+			"#%v): %v", attempt, err)
+	}
+}
+
+// ErrTxPanic is returned by Update and View when the closure executed within
+// the transaction panics.
+type ErrTxPanic struct {
+	// Value is the value the closure panicked with.
+	Value interface{}
+}
+
+// Error returns a human readable string describing the error.
+func (e ErrTxPanic) Error() string {
+	return fmt.Sprintf("database transaction panicked: %v", e.Value)
+}
+
+// recoverTx wraps the passed transaction closure such that any panic within
+// it is recovered and returned as an ErrTxPanic. As bolt sees the closure
+// return an error, the transaction will be rolled back.
+func recoverTx(fn func(*bolt.Tx) error) func(*bolt.Tx) error {
+	return func(tx *bolt.Tx) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Errorf("Recovered from panic within database "+
+					"transaction: %v\n%s", r, debug.Stack())
+				err = ErrTxPanic{Value: r}
+			}
+		}()
+
+		return fn(tx)
+	}
+}
+
+// Backup writes a copy of the entire database to the passed writer. The copy
+// is taken within a single read transaction, so it's a consistent
+// point-in-time snapshot of the database, and writers aren't blocked while
+// it's taken.
+func (d *DB) Backup(w io.Writer) error {
+	return d.View(func(tx *bolt.Tx) error {
+		_, err := tx.WriteTo(w)
+		return err
+	})
+}
+
+// BackupToFile writes a snapshot of the database, as taken by Backup, to the
+// file at destPath. The snapshot is first written to a temporary file within
+// the same directory, which is then renamed into place, so destPath will
+// never hold a partially written backup.
+func (d *DB) BackupToFile(destPath string) error {
+	tempFile, err := ioutil.TempFile(
+		filepath.Dir(destPath), filepath.Base(destPath)+".tmp",
+	)
+	if err != nil {
+		return err
+	}
+	tempPath := tempFile.Name()
+
+	// If we fail to write out the backup, then we'll remove the temporary
+	// file so it isn't left behind.
+	err = d.Backup(tempFile)
+	if err == nil {
+		err = tempFile.Sync()
+	}
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tempPath, dbFilePermission)
+	}
+	if err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+
+	return os.Rename(tempPath, destPath)
+}
+
 // Wipe completely deletes all saved state within all used buckets within the
 // database. The deletion is done in a single transaction, therefore this
 // operation is fully atomic.
 func (d *DB) Wipe() error {
 	return d.Update(func(tx *bolt.Tx) error {
-		err := tx.DeleteBucket(openChannelBucket)
-		if err != nil && err != bolt.ErrBucketNotFound {
-			return err
-		}
+		return wipeBuckets(tx,
+			openChannelBucket, closedChannelBucket, invoiceBucket,
+			nodeInfoBucket, nodeBucket, edgeBucket, edgeIndexBucket,
+			graphMetaBucket,
+		)
+	})
+}
 
-		err = tx.DeleteBucket(closedChannelBucket)
-		if err != nil && err != bolt.ErrBucketNotFound {
-			return err
-		}
+// WipeChannels deletes all saved state related to our channels, namely the
+// open channels, closed channels, and the link nodes of our peers. Unlike
+// Wipe, all other state, such as invoices and the channel graph, is
+// preserved.
+func (d *DB) WipeChannels() error {
+	return d.Update(func(tx *bolt.Tx) error {
+		return wipeBuckets(tx,
+			openChannelBucket, closedChannelBucket, nodeInfoBucket,
+		)
+	})
+}
 
-		err = tx.DeleteBucket(invoiceBucket)
-		if err != nil && err != bolt.ErrBucketNotFound {
-			return err
-		}
+// WipeBucket deletes all saved state within the named top-level bucket,
+// leaving behind an empty bucket in its place.
+func (d *DB) WipeBucket(name []byte) error {
+	return d.Update(func(tx *bolt.Tx) error {
+		return wipeBuckets(tx, name)
+	})
+}
 
-		err = tx.DeleteBucket(nodeInfoBucket)
+// wipeBuckets deletes each of the named top-level buckets, then re-creates
+// them empty. Buckets that don't yet exist are simply created.
+func wipeBuckets(tx *bolt.Tx, names ...[]byte) error {
+	for _, name := range names {
+		err := tx.DeleteBucket(name)
 		if err != nil && err != bolt.ErrBucketNotFound {
 			return err
 		}
 
-		err = tx.DeleteBucket(nodeBucket)
-		if err != nil && err != bolt.ErrBucketNotFound {
-			return err
-		}
-		err = tx.DeleteBucket(edgeBucket)
-		if err != nil && err != bolt.ErrBucketNotFound {
-			return err
-		}
-		err = tx.DeleteBucket(edgeIndexBucket)
-		if err != nil && err != bolt.ErrBucketNotFound {
-			return err
-		}
-		err = tx.DeleteBucket(graphMetaBucket)
-		if err != nil && err != bolt.ErrBucketNotFound {
+		if _, err := tx.CreateBucket(name); err != nil {
 			return err
 		}
+	}
 
-		return nil
-	})
+	return nil
 }
 
 // createChannelDB creates and initializes a fresh version of channeldb. In
@@ -261,7 +544,7 @@ func (d *DB) FetchOpenChannels(nodeID *btcec.PublicKey) ([]*OpenChannel, error)
 					chainHash[:], pub, err)
 			}
 
-			channels = nodeChannels
+			channels = append(channels, nodeChannels...)
 			return nil
 		})
 	})
@@ -269,16 +552,235 @@ func (d *DB) FetchOpenChannels(nodeID *btcec.PublicKey) ([]*OpenChannel, error)
 	return channels, err
 }
 
+// NodeSummary aggregates the state of all open channels with a particular
+// node.
+type NodeSummary struct {
+	// NumChannels is the number of open channels with the node.
+	NumChannels uint32
+
+	// TotalCapacity is the sum of the capacities of all channels with the
+	// node.
+	TotalCapacity btcutil.Amount
+
+	// LocalBalance is the sum of our balances across all channels with the
+	// node, as of each channel's latest local commitment.
+	LocalBalance lnwire.MilliSatoshi
+
+	// RemoteBalance is the sum of the node's balances across all channels
+	// with it, as of each channel's latest local commitment.
+	RemoteBalance lnwire.MilliSatoshi
+
+	// TotalMSatSent is the total number of milli-satoshis we've sent
+	// across all channels with the node.
+	TotalMSatSent lnwire.MilliSatoshi
+
+	// TotalMSatReceived is the total number of milli-satoshis we've
+	// received across all channels with the node.
+	TotalMSatReceived lnwire.MilliSatoshi
+}
+
+// NodeChannelSummary returns a summary of all open channels with the target
+// node. If we have no open channels with the node, then a zero summary is
+// returned.
+func (d *DB) NodeChannelSummary(nodeID *btcec.PublicKey) (*NodeSummary, error) {
+	channels, err := d.FetchOpenChannels(nodeID)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &NodeSummary{}
+	for _, channel := range channels {
+		summary.NumChannels++
+		summary.TotalCapacity += channel.Capacity
+		summary.LocalBalance += channel.LocalCommitment.LocalBalance
+		summary.RemoteBalance += channel.LocalCommitment.RemoteBalance
+		summary.TotalMSatSent += channel.TotalMSatSent
+		summary.TotalMSatReceived += channel.TotalMSatReceived
+	}
+
+	return summary, nil
+}
+
+// PendingHTLCSummary returns the number of HTLCs outstanding across all open
+// channels, along with their total value. The HTLCs of each channel are read
+// from its latest local commitment, which is loaded along with the channel
+// itself, so channels that have yet to be updated simply contribute nothing.
+func (d *DB) PendingHTLCSummary() (int, btcutil.Amount, error) {
+	var (
+		count      int
+		totalValue lnwire.MilliSatoshi
+	)
+	err := d.ForEachChannel(func(channel *OpenChannel) error {
+		for _, htlc := range channel.LocalCommitment.Htlcs {
+			count++
+			totalValue += htlc.Amt
+		}
+
+		return nil
+	})
+	switch {
+	case err == ErrNoActiveChannels:
+		return 0, 0, nil
+	case err != nil:
+		return 0, 0, err
+	}
+
+	return count, totalValue.ToSatoshis(), nil
+}
+
+// BalancePoint records the balances of each party within a channel as of a
+// particular commitment update.
+type BalancePoint struct {
+	// UpdateNum is the height of the commitment the balances were taken
+	// from.
+	UpdateNum uint64
+
+	// LocalBalance is our settled balance as of the update.
+	LocalBalance lnwire.MilliSatoshi
+
+	// RemoteBalance is the remote party's settled balance as of the
+	// update.
+	RemoteBalance lnwire.MilliSatoshi
+}
+
+// BalanceHistory returns the balances of the open channel with the target
+// funding outpoint as of each remote commitment recorded within its revocation
+// log, followed by those of the current remote commitment. The points are
+// returned in ascending update order.
+func (d *DB) BalanceHistory(chanID *wire.OutPoint) ([]BalancePoint, error) {
+	channel, err := d.fetchChannelByOutpoint(chanID)
+	if err != nil {
+		return nil, err
+	}
+
+	commits, err := channel.FetchChannelDeltas(0, math.MaxUint64)
+	if err != nil {
+		return nil, err
+	}
+
+	// The current remote commitment hasn't yet been revoked, so it won't
+	// be found within the log. We'll tack it onto the end so the history
+	// reflects the latest balances of the channel.
+	currentCommit := channel.RemoteCommitment
+	if len(commits) == 0 ||
+		commits[len(commits)-1].CommitHeight < currentCommit.CommitHeight {
+
+		commits = append(commits, &currentCommit)
+	}
+
+	history := make([]BalancePoint, 0, len(commits))
+	for _, commit := range commits {
+		history = append(history, BalancePoint{
+			UpdateNum:     commit.CommitHeight,
+			LocalBalance:  commit.LocalBalance,
+			RemoteBalance: commit.RemoteBalance,
+		})
+	}
+
+	return history, nil
+}
+
+// fetchChannelByOutpoint returns the open channel with the target funding
+// outpoint. If no such channel exists, ErrChannelNotFound is returned.
+func (d *DB) fetchChannelByOutpoint(chanID *wire.OutPoint) (*OpenChannel, error) {
+	var channel *OpenChannel
+	err := d.ForEachChannel(func(c *OpenChannel) error {
+		if c.FundingOutpoint == *chanID {
+			channel = c
+		}
+		return nil
+	})
+	switch {
+	case err == ErrNoActiveChannels:
+		return nil, ErrChannelNotFound
+	case err != nil:
+		return nil, err
+	case channel == nil:
+		return nil, ErrChannelNotFound
+	}
+
+	return channel, nil
+}
+
+// ChannelExists returns true if the channel with the target funding outpoint
+// is open with the target node. Unlike fetching the channel, only the presence
+// of the channel's bucket is checked, so none of its state is decoded.
+func (d *DB) ChannelExists(nodeID *btcec.PublicKey,
+	chanID *wire.OutPoint) (bool, error) {
+
+	var chanPointBuf bytes.Buffer
+	if err := writeOutpoint(&chanPointBuf, chanID); err != nil {
+		return false, err
+	}
+
+	var exists bool
+	err := d.View(func(tx *bolt.Tx) error {
+		openChanBucket := tx.Bucket(openChannelBucket)
+		if openChanBucket == nil {
+			return nil
+		}
+
+		nodePub := nodeID.SerializeCompressed()
+		nodeChanBucket := openChanBucket.Bucket(nodePub)
+		if nodeChanBucket == nil {
+			return nil
+		}
+
+		// As the chain the channel resides within isn't known, we'll
+		// check within each of the node's chain buckets.
+		cursor := nodeChanBucket.Cursor()
+		for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
+			// If there's a value, it's not a bucket so ignore it.
+			if v != nil {
+				continue
+			}
+
+			chainBucket := nodeChanBucket.Bucket(k)
+			if chainBucket == nil {
+				continue
+			}
+			if chainBucket.Bucket(chanPointBuf.Bytes()) != nil {
+				exists = true
+				return nil
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return exists, nil
+}
+
 // fetchNodeChannels retrieves all active channels from the target chainBucket
 // which is under a node's dedicated channel bucket. This function is typically
 // used to fetch all the active channels related to a particular node.
 func (d *DB) fetchNodeChannels(chainBucket *bolt.Bucket) ([]*OpenChannel, error) {
 
 	var channels []*OpenChannel
+	err := d.forEachNodeChannel(chainBucket, func(c *OpenChannel) error {
+		channels = append(channels, c)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return channels, nil
+}
+
+// forEachNodeChannel decodes each active channel within the target
+// chainBucket, handing them to the passed callback one at a time. If the
+// callback returns an error, then iteration is halted and the error is
+// returned unmodified.
+func (d *DB) forEachNodeChannel(chainBucket *bolt.Bucket,
+	cb func(*OpenChannel) error) error {
 
 	// A node may have channels on several chains, so for each known chain,
 	// we'll extract all the channels.
-	err := chainBucket.ForEach(func(chanPoint, v []byte) error {
+	return chainBucket.ForEach(func(chanPoint, v []byte) error {
 		// If there's a value, it's not a bucket so ignore it.
 		if v != nil {
 			return nil
@@ -300,15 +802,18 @@ func (d *DB) fetchNodeChannels(chainBucket *bolt.Bucket) ([]*OpenChannel, error)
 		}
 		oChannel.Db = d
 
-		channels = append(channels, oChannel)
+		// If we're able to re-derive our keys, then we'll do so now,
+		// using the stored public keys as a cross-check.
+		if d.keyDeriver != nil {
+			err := oChannel.LocalChanCfg.DeriveKeys(d.keyDeriver)
+			if err != nil {
+				return fmt.Errorf("unable to derive keys for "+
+					"chan_point=%v: %v", outPoint, err)
+			}
+		}
 
-		return nil
+		return cb(oChannel)
 	})
-	if err != nil {
-		return nil, err
-	}
-
-	return channels, nil
 }
 
 // FetchAllChannels attempts to retrieve all open channels currently stored
@@ -331,7 +836,73 @@ func (d *DB) FetchPendingChannels() ([]*OpenChannel, error) {
 func fetchChannels(d *DB, pendingOnly bool) ([]*OpenChannel, error) {
 	var channels []*OpenChannel
 
-	err := d.View(func(tx *bolt.Tx) error {
+	err := d.ForEachChannel(func(channel *OpenChannel) error {
+		if pendingOnly && !channel.IsPending {
+			return nil
+		}
+
+		channels = append(channels, channel)
+		return nil
+	})
+
+	return channels, err
+}
+
+// PutChannels writes each of the passed channels to the database within a
+// single transaction, such that either all of the channels are written, or
+// none of them are. A link node is created for each remote party that lacks
+// one, allowing the channels to be found by ForEachChannel. These link nodes
+// are created on the passed network, and as the addresses of the remote
+// parties aren't known, hold no addresses.
+func (d *DB) PutChannels(bitNet wire.BitcoinNet,
+	channels []*OpenChannel) error {
+
+	return d.Update(func(tx *bolt.Tx) error {
+		nodeMetaBucket, err := tx.CreateBucketIfNotExists(nodeInfoBucket)
+		if err != nil {
+			return err
+		}
+
+		for _, channel := range channels {
+			channel.Lock()
+			err := channel.fullSync(tx)
+			channel.Unlock()
+			if err != nil {
+				return fmt.Errorf("unable to write channel "+
+					"%v: %v", channel.FundingOutpoint, err)
+			}
+
+			nodePub := channel.IdentityPub.SerializeCompressed()
+			if nodeMetaBucket.Get(nodePub) != nil {
+				continue
+			}
+
+			linkNode := &LinkNode{
+				Network:     bitNet,
+				IdentityPub: channel.IdentityPub,
+				LastSeen:    time.Now(),
+				db:          d,
+			}
+			if err := putLinkNode(nodeMetaBucket, linkNode); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// ForEachChannel iterates through all open channels currently stored within
+// the database, decoding each in turn and handing it to the passed callback.
+// Unlike FetchAllChannels, only a single channel is held in memory at a time
+// by the iteration itself. If the callback returns an error, then iteration
+// is halted and the error is returned unmodified. If no active channels exist
+// within the database, then ErrNoActiveChannels is returned.
+//
+// NOTE: The callback is executed within the database's read transaction, so
+// it MUST NOT attempt to write to the database.
+func (d *DB) ForEachChannel(cb func(*OpenChannel) error) error {
+	return d.View(func(tx *bolt.Tx) error {
 		// Get the bucket dedicated to storing the metadata for open
 		// channels.
 		openChanBucket := tx.Bucket(openChannelBucket)
@@ -347,8 +918,8 @@ func fetchChannels(d *DB, pendingOnly bool) ([]*OpenChannel, error) {
 			return fmt.Errorf("node bucket not created")
 		}
 
-		// Finally for each node public key in the bucket, fetch all
-		// the channels related to this particular node.
+		// Finally for each node public key in the bucket, iterate
+		// over all the channels related to this particular node.
 		return nodeMetaBucket.ForEach(func(k, v []byte) error {
 			nodeChanBucket := openChanBucket.Bucket(k)
 			if nodeChanBucket == nil {
@@ -371,29 +942,10 @@ func fetchChannels(d *DB, pendingOnly bool) ([]*OpenChannel, error) {
 						"bucket for chain=%x", chainHash[:])
 				}
 
-				nodeChans, err := d.fetchNodeChannels(chainBucket)
-				if err != nil {
-					return fmt.Errorf("unable to read "+
-						"channel for chain_hash=%x, "+
-						"node_key=%x: %v", chainHash[:], k, err)
-				}
-				// TODO(roasbeef): simplify
-				if pendingOnly {
-					for _, channel := range nodeChans {
-						if channel.IsPending {
-							channels = append(channels, channel)
-						}
-					}
-				} else {
-					channels = append(channels, nodeChans...)
-				}
-				return nil
+				return d.forEachNodeChannel(chainBucket, cb)
 			})
-
 		})
 	})
-
-	return channels, err
 }
 
 // FetchClosedChannels attempts to fetch all closed channels from the database.
@@ -411,21 +963,25 @@ func (d *DB) FetchClosedChannels(pendingOnly bool) ([]*ChannelCloseSummary, erro
 			return ErrNoClosedChannels
 		}
 
-		return closeBucket.ForEach(func(chanID []byte, summaryBytes []byte) error {
-			summaryReader := bytes.NewReader(summaryBytes)
-			chanSummary, err := deserializeCloseChannelSummary(summaryReader)
-			if err != nil {
-				return err
+		return closeBucket.ForEach(func(nodeID, v []byte) error {
+			// If there's a value, it's not a node bucket so
+			// ignore it.
+			if v != nil {
+				return nil
 			}
 
-			// If the query specified to only include pending
-			// channels, then we'll skip any channels which aren't
-			// currently pending.
-			if !chanSummary.IsPending && pendingOnly {
+			nodeBucket := closeBucket.Bucket(nodeID)
+			if nodeBucket == nil {
 				return nil
 			}
+			summaries, err := fetchNodeCloseSummaries(
+				nodeBucket, pendingOnly,
+			)
+			if err != nil {
+				return err
+			}
 
-			chanSummaries = append(chanSummaries, chanSummary)
+			chanSummaries = append(chanSummaries, summaries...)
 			return nil
 		})
 	}); err != nil {
@@ -435,6 +991,69 @@ func (d *DB) FetchClosedChannels(pendingOnly bool) ([]*ChannelCloseSummary, erro
 	return chanSummaries, nil
 }
 
+// FetchClosedChannelsForNode returns the summaries of all closed channels we
+// formerly had with the target node, including those which are still pending
+// close. If we've never closed a channel with the node, then an empty slice
+// is returned.
+func (d *DB) FetchClosedChannelsForNode(
+	nodeID *btcec.PublicKey) ([]*ChannelCloseSummary, error) {
+
+	var chanSummaries []*ChannelCloseSummary
+	err := d.View(func(tx *bolt.Tx) error {
+		closeBucket := tx.Bucket(closedChannelBucket)
+		if closeBucket == nil {
+			return ErrNoClosedChannels
+		}
+
+		nodePub := nodeID.SerializeCompressed()
+		nodeBucket := closeBucket.Bucket(nodePub)
+		if nodeBucket == nil {
+			return nil
+		}
+
+		var err error
+		chanSummaries, err = fetchNodeCloseSummaries(nodeBucket, false)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return chanSummaries, nil
+}
+
+// fetchNodeCloseSummaries decodes each closed channel summary within the
+// target node bucket. The pendingOnly bool toggles if only the summaries of
+// channels that aren't yet fully closed should be returned.
+func fetchNodeCloseSummaries(nodeBucket *bolt.Bucket,
+	pendingOnly bool) ([]*ChannelCloseSummary, error) {
+
+	var chanSummaries []*ChannelCloseSummary
+	err := nodeBucket.ForEach(func(chanID, summaryBytes []byte) error {
+		chanSummary, err := decodeCloseSummaryEntry(
+			chanID, summaryBytes,
+		)
+		if err != nil {
+			return err
+		}
+
+		// If the query specified to only include pending channels,
+		// then we'll skip any channels which aren't currently
+		// pending.
+		if !chanSummary.IsPending && pendingOnly {
+			return nil
+		}
+
+		chanSummaries = append(chanSummaries, chanSummary)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return chanSummaries, nil
+}
+
 // ErrClosedChannelNotFound signals that a closed channel could not be found in
 // the channeldb.
 var ErrClosedChannelNotFound = errors.New("unable to find closed channel summary")
@@ -455,13 +1074,14 @@ func (d *DB) FetchClosedChannel(chanID *wire.OutPoint) (*ChannelCloseSummary, er
 			return err
 		}
 
-		summaryBytes := closeBucket.Get(b.Bytes())
+		_, summaryBytes := findClosedChannel(closeBucket, b.Bytes())
 		if summaryBytes == nil {
 			return ErrClosedChannelNotFound
 		}
 
-		summaryReader := bytes.NewReader(summaryBytes)
-		chanSummary, err = deserializeCloseChannelSummary(summaryReader)
+		chanSummary, err = decodeCloseSummaryEntry(
+			b.Bytes(), summaryBytes,
+		)
 
 		return err
 	}); err != nil {
@@ -491,7 +1111,9 @@ func (d *DB) MarkChanFullyClosed(chanPoint *wire.OutPoint) error {
 			return err
 		}
 
-		chanSummaryBytes := closedChanBucket.Get(chanID)
+		nodeBucket, chanSummaryBytes := findClosedChannel(
+			closedChanBucket, chanID,
+		)
 		if chanSummaryBytes == nil {
 			return fmt.Errorf("no closed channel by that chanID " +
 				"found")
@@ -513,10 +1135,27 @@ func (d *DB) MarkChanFullyClosed(chanPoint *wire.OutPoint) error {
 			return err
 		}
 
-		return closedChanBucket.Put(chanID, newSummary.Bytes())
+		return nodeBucket.Put(chanID, newSummary.Bytes())
 	})
 }
 
+// ErrMigrationFailed is returned when a schema migration fails to be applied
+// as the database is opened. As all migrations are applied within a single
+// transaction, the database is left at its prior version.
+type ErrMigrationFailed struct {
+	// Version is the version number of the migration that failed.
+	Version uint32
+
+	// Err is the error returned by the migration.
+	Err error
+}
+
+// Error returns a human readable string describing the error.
+func (e ErrMigrationFailed) Error() string {
+	return fmt.Sprintf("unable to apply migration #%v: %v", e.Version,
+		e.Err)
+}
+
 // syncVersions function is used for safe db version synchronization. It
 // applies migration functions to the current database and recovers the
 // previous state of db if at least one error/panic appeared during migration.
@@ -557,7 +1196,10 @@ func (d *DB) syncVersions(versions []version) error {
 			if err := migration(tx); err != nil {
 				log.Infof("Unable to apply migration #%v",
 					migrationVersions[i])
-				return err
+				return ErrMigrationFailed{
+					Version: migrationVersions[i],
+					Err:     err,
+				}
 			}
 		}
 
@@ -566,6 +1208,23 @@ func (d *DB) syncVersions(versions []version) error {
 	})
 }
 
+// checkVersion ensures that the version of the database matches the latest
+// version, returning ErrDBVersionMismatch if any migrations have yet to be
+// applied.
+func (d *DB) checkVersion(versions []version) error {
+	meta, err := d.FetchMeta(nil)
+	if err != nil {
+		return err
+	}
+
+	latestVersion := getLatestDBVersion(versions)
+	if meta.DbVersionNumber != latestVersion {
+		return ErrDBVersionMismatch
+	}
+
+	return nil
+}
+
 // ChannelGraph returns a new instance of the directed channel graph.
 func (d *DB) ChannelGraph() *ChannelGraph {
 	return &ChannelGraph{d}
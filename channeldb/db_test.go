@@ -1,10 +1,17 @@
 package channeldb
 
 import (
+	"bytes"
+	"errors"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
+
+	"github.com/coreos/bbolt"
+	"github.com/roasbeef/btcd/btcec"
+	"github.com/roasbeef/btcd/wire"
 )
 
 func TestOpenWithCreate(t *testing.T) {
@@ -33,3 +40,603 @@ func TestOpenWithCreate(t *testing.T) {
 		t.Fatalf("channeldb failed to create data directory")
 	}
 }
+
+// TestOpenWithOptions tests that the database can be opened read-only, and
+// that attempting to open a locked database respects the timeout.
+func TestOpenWithOptions(t *testing.T) {
+	t.Parallel()
+
+	tempDirName, err := ioutil.TempDir("", "channeldb")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDirName)
+
+	// A database that doesn't exist can't be opened read-only, and
+	// shouldn't be created by the attempt.
+	readOnly := &Options{
+		Timeout:  time.Second,
+		ReadOnly: true,
+	}
+	_, err = OpenWithOptions(tempDirName, readOnly)
+	if err != ErrNoChanDBFile {
+		t.Fatalf("expected ErrNoChanDBFile, got %v", err)
+	}
+	if fileExists(filepath.Join(tempDirName, dbName)) {
+		t.Fatalf("read-only open created the database")
+	}
+
+	cdb, err := Open(tempDirName)
+	if err != nil {
+		t.Fatalf("unable to create channeldb: %v", err)
+	}
+
+	// While the database is held open, a second attempt to open it should
+	// time out rather than block indefinitely.
+	timeout := &Options{
+		Timeout: 100 * time.Millisecond,
+	}
+	_, err = OpenWithOptions(tempDirName, timeout)
+	if err != bolt.ErrTimeout {
+		t.Fatalf("expected bolt.ErrTimeout, got %v", err)
+	}
+
+	if err := cdb.Close(); err != nil {
+		t.Fatalf("unable to close channeldb: %v", err)
+	}
+
+	// Once closed, the database can be opened read-only. Reads should
+	// succeed, while any writes are rejected.
+	cdb, err = OpenWithOptions(tempDirName, readOnly)
+	if err != nil {
+		t.Fatalf("unable to open channeldb read-only: %v", err)
+	}
+	defer cdb.Close()
+
+	if _, err := cdb.FetchMeta(nil); err != nil {
+		t.Fatalf("unable to fetch meta: %v", err)
+	}
+	err = cdb.Update(func(tx *bolt.Tx) error {
+		return nil
+	})
+	if err != bolt.ErrDatabaseReadOnly {
+		t.Fatalf("expected bolt.ErrDatabaseReadOnly, got %v", err)
+	}
+}
+
+// TestBackupToFile tests that a backup of a populated database can be opened
+// as a database in its own right, containing the same channels.
+func TestBackupToFile(t *testing.T) {
+	t.Parallel()
+
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	defer cleanUp()
+
+	const numChannels = 3
+	for i := 0; i < numChannels; i++ {
+		channel, err := createTestChannelState(cdb)
+		if err != nil {
+			t.Fatalf("unable to create channel state: %v", err)
+		}
+		channel.FundingOutpoint.Index = uint32(i)
+		if err := syncTestChannel(channel); err != nil {
+			t.Fatalf("unable to save and serialize channel "+
+				"state: %v", err)
+		}
+	}
+
+	backupDir, err := ioutil.TempDir("", "channeldb-backup")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(backupDir)
+
+	backupPath := filepath.Join(backupDir, dbName)
+	if err := cdb.BackupToFile(backupPath); err != nil {
+		t.Fatalf("unable to backup database: %v", err)
+	}
+
+	// Only the backup itself should remain within the directory, as the
+	// temporary file it was written to should have been renamed.
+	files, err := ioutil.ReadDir(backupDir)
+	if err != nil {
+		t.Fatalf("unable to read backup dir: %v", err)
+	}
+	if len(files) != 1 || files[0].Name() != dbName {
+		t.Fatalf("unexpected files within backup dir: %v", files)
+	}
+
+	backupDB, err := Open(backupDir)
+	if err != nil {
+		t.Fatalf("unable to open backup: %v", err)
+	}
+	defer backupDB.Close()
+
+	channels, err := cdb.FetchAllChannels()
+	if err != nil {
+		t.Fatalf("unable to fetch channels: %v", err)
+	}
+	backupChannels, err := backupDB.FetchAllChannels()
+	if err != nil {
+		t.Fatalf("unable to fetch backup channels: %v", err)
+	}
+	if len(channels) != numChannels {
+		t.Fatalf("expected %v channels, got %v", numChannels,
+			len(channels))
+	}
+	if len(backupChannels) != len(channels) {
+		t.Fatalf("expected %v channels in backup, got %v",
+			len(channels), len(backupChannels))
+	}
+
+	for i, channel := range channels {
+		backupChannel := backupChannels[i]
+		if backupChannel.FundingOutpoint != channel.FundingOutpoint {
+			t.Fatalf("channel %v: expected outpoint %v, got %v", i,
+				channel.FundingOutpoint,
+				backupChannel.FundingOutpoint)
+		}
+
+		assertCommitmentEqual(
+			t, &channel.LocalCommitment,
+			&backupChannel.LocalCommitment,
+		)
+		assertCommitmentEqual(
+			t, &channel.RemoteCommitment,
+			&backupChannel.RemoteCommitment,
+		)
+	}
+}
+
+// TestWipeChannels tests that wiping the channel state of the database leaves
+// unrelated state, such as invoices, intact, and that a single bucket can be
+// wiped in isolation.
+func TestWipeChannels(t *testing.T) {
+	t.Parallel()
+
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	defer cleanUp()
+
+	channel, err := createTestChannelState(cdb)
+	if err != nil {
+		t.Fatalf("unable to create channel state: %v", err)
+	}
+	if err := syncTestChannel(channel); err != nil {
+		t.Fatalf("unable to save and serialize channel state: %v", err)
+	}
+
+	invoice, err := randInvoice(1000)
+	if err != nil {
+		t.Fatalf("unable to create invoice: %v", err)
+	}
+	if err := cdb.AddInvoice(invoice); err != nil {
+		t.Fatalf("unable to add invoice: %v", err)
+	}
+
+	channels, err := cdb.FetchAllChannels()
+	if err != nil {
+		t.Fatalf("unable to fetch channels: %v", err)
+	}
+	if len(channels) != 1 {
+		t.Fatalf("expected %v channel, got %v", 1, len(channels))
+	}
+
+	// Once the channel state has been wiped, no channels should remain,
+	// while the invoice should survive.
+	if err := cdb.WipeChannels(); err != nil {
+		t.Fatalf("unable to wipe channels: %v", err)
+	}
+
+	channels, err = cdb.FetchAllChannels()
+	if err != nil {
+		t.Fatalf("unable to fetch channels: %v", err)
+	}
+	if len(channels) != 0 {
+		t.Fatalf("expected no channels, got %v", len(channels))
+	}
+
+	invoices, err := cdb.FetchAllInvoices(false)
+	if err != nil {
+		t.Fatalf("unable to fetch invoices: %v", err)
+	}
+	if len(invoices) != 1 {
+		t.Fatalf("expected %v invoice, got %v", 1, len(invoices))
+	}
+
+	// Wiping the invoice bucket alone should leave it empty, but still
+	// present.
+	if err := cdb.WipeBucket(invoiceBucket); err != nil {
+		t.Fatalf("unable to wipe invoices: %v", err)
+	}
+	invoices, err = cdb.FetchAllInvoices(false)
+	if err != nil {
+		t.Fatalf("unable to fetch invoices: %v", err)
+	}
+	if len(invoices) != 0 {
+		t.Fatalf("expected no invoices, got %v", len(invoices))
+	}
+
+	// Wiping a bucket that doesn't yet exist should simply create it.
+	unknownBucket := []byte("unknown-bucket")
+	if err := cdb.WipeBucket(unknownBucket); err != nil {
+		t.Fatalf("unable to wipe unknown bucket: %v", err)
+	}
+	var bucketExists bool
+	err = cdb.View(func(tx *bolt.Tx) error {
+		bucketExists = tx.Bucket(unknownBucket) != nil
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to read database: %v", err)
+	}
+	if !bucketExists {
+		t.Fatalf("wiped bucket wasn't created")
+	}
+}
+
+// TestTxPanicRecovery tests that a panic within a transaction is returned as
+// an error, and that the transaction is rolled back.
+func TestTxPanicRecovery(t *testing.T) {
+	t.Parallel()
+
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	defer cleanUp()
+
+	testBucket := []byte("test-bucket")
+	err = cdb.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucket(testBucket); err != nil {
+			return err
+		}
+
+		panic("panic within transaction")
+	})
+	if _, ok := err.(ErrTxPanic); !ok {
+		t.Fatalf("expected ErrTxPanic, got %v", err)
+	}
+
+	var bucketExists bool
+	err = cdb.View(func(tx *bolt.Tx) error {
+		bucketExists = tx.Bucket(testBucket) != nil
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to read database: %v", err)
+	}
+	if bucketExists {
+		t.Fatalf("transaction wasn't rolled back")
+	}
+}
+
+// TestTxRetryPolicy tests that transactions executed via UpdateWithRetry and
+// ViewWithRetry which fail with a transient error are retried as permitted by
+// the registered policy, while those executed via Update and View never are.
+func TestTxRetryPolicy(t *testing.T) {
+	t.Parallel()
+
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	defer cleanUp()
+
+	errTransient := errors.New("transient")
+	errPermanent := errors.New("permanent")
+	cdb.SetTxRetryPolicy(&TxRetryPolicy{
+		MaxRetries: 2,
+		IsTransient: func(err error) bool {
+			return err == errTransient
+		},
+	})
+
+	// failingTx returns a transaction closure which fails with the passed
+	// error the first numFailures times it's executed.
+	var attempts int
+	failingTx := func(numFailures int, failErr error) func(*bolt.Tx) error {
+		attempts = 0
+		return func(*bolt.Tx) error {
+			attempts++
+			if attempts <= numFailures {
+				return failErr
+			}
+			return nil
+		}
+	}
+
+	testCases := []struct {
+		name             string
+		numFailures      int
+		failErr          error
+		expectedErr      error
+		expectedAttempts int
+	}{
+		{
+			name:             "recovers within retries",
+			numFailures:      2,
+			failErr:          errTransient,
+			expectedErr:      nil,
+			expectedAttempts: 3,
+		},
+		{
+			name:             "retries exhausted",
+			numFailures:      3,
+			failErr:          errTransient,
+			expectedErr:      errTransient,
+			expectedAttempts: 3,
+		},
+		{
+			name:             "permanent error",
+			numFailures:      1,
+			failErr:          errPermanent,
+			expectedErr:      errPermanent,
+			expectedAttempts: 1,
+		},
+	}
+	for _, test := range testCases {
+		err := cdb.UpdateWithRetry(
+			failingTx(test.numFailures, test.failErr),
+		)
+		if err != test.expectedErr {
+			t.Fatalf("%v: expected error %v, got %v", test.name,
+				test.expectedErr, err)
+		}
+		if attempts != test.expectedAttempts {
+			t.Fatalf("%v: expected %v attempts, got %v", test.name,
+				test.expectedAttempts, attempts)
+		}
+	}
+
+	// Transactions executed via Update and View shouldn't be retried,
+	// despite the registered policy, as their closures may not be
+	// idempotent.
+	err = cdb.Update(failingTx(1, errTransient))
+	if err != errTransient {
+		t.Fatalf("expected error %v, got %v", errTransient, err)
+	}
+	if attempts != 1 {
+		t.Fatalf("expected 1 attempt, got %v", attempts)
+	}
+	err = cdb.View(failingTx(1, errTransient))
+	if err != errTransient {
+		t.Fatalf("expected error %v, got %v", errTransient, err)
+	}
+	if attempts != 1 {
+		t.Fatalf("expected 1 attempt, got %v", attempts)
+	}
+
+	// A panicking transaction should never be retried.
+	attempts = 0
+	err = cdb.ViewWithRetry(func(*bolt.Tx) error {
+		attempts++
+		panic("panic within transaction")
+	})
+	if _, ok := err.(ErrTxPanic); !ok {
+		t.Fatalf("expected ErrTxPanic, got %v", err)
+	}
+	if attempts != 1 {
+		t.Fatalf("expected panicking transaction to be attempted "+
+			"once, got %v", attempts)
+	}
+}
+
+// TestPutChannels tests that a batch of channels across several nodes can be
+// written at once, and that a failure to write any channel leaves the
+// database untouched.
+func TestPutChannels(t *testing.T) {
+	t.Parallel()
+
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	defer cleanUp()
+
+	const (
+		numNodes    = 5
+		numChannels = 100
+	)
+	var nodeKeys []*btcec.PublicKey
+	for i := 0; i < numNodes; i++ {
+		priv, err := btcec.NewPrivateKey(btcec.S256())
+		if err != nil {
+			t.Fatalf("unable to generate key: %v", err)
+		}
+		nodeKeys = append(nodeKeys, priv.PubKey())
+	}
+
+	var channels []*OpenChannel
+	for i := 0; i < numChannels; i++ {
+		channel, err := createTestChannelState(cdb)
+		if err != nil {
+			t.Fatalf("unable to create channel state: %v", err)
+		}
+		channel.IdentityPub = nodeKeys[i%numNodes]
+		channel.FundingOutpoint.Index = uint32(i)
+
+		channels = append(channels, channel)
+	}
+
+	// We'll first attempt to write the channels alongside one which can't
+	// be written, as its outpoint is already occupied by a value rather
+	// than a channel bucket.
+	badChannel, err := createTestChannelState(cdb)
+	if err != nil {
+		t.Fatalf("unable to create channel state: %v", err)
+	}
+	badChannel.FundingOutpoint.Index = numChannels
+	err = cdb.Update(func(tx *bolt.Tx) error {
+		chainBucket, err := createTestChainBucket(tx, badChannel)
+		if err != nil {
+			return err
+		}
+
+		var b bytes.Buffer
+		err = writeOutpoint(&b, &badChannel.FundingOutpoint)
+		if err != nil {
+			return err
+		}
+		return chainBucket.Put(b.Bytes(), []byte("occupied"))
+	})
+	if err != nil {
+		t.Fatalf("unable to occupy channel key: %v", err)
+	}
+
+	err = cdb.PutChannels(wire.TestNet3, append(channels, badChannel))
+	if err == nil {
+		t.Fatalf("expected batch containing bad channel to fail")
+	}
+
+	// As the batch failed, none of the channels should have been written.
+	// We count the channel buckets directly, as the link nodes which would
+	// make them visible to FetchAllChannels would also have been rolled
+	// back.
+	var numWritten int
+	err = cdb.View(func(tx *bolt.Tx) error {
+		var err error
+		numWritten, err = countOpenChannels(tx)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("unable to count channels: %v", err)
+	}
+	if numWritten != 0 {
+		t.Fatalf("expected no channels after failed batch, got %v",
+			numWritten)
+	}
+
+	// Without the bad channel, the batch should be written in full.
+	if err := cdb.PutChannels(wire.TestNet3, channels); err != nil {
+		t.Fatalf("unable to put channels: %v", err)
+	}
+
+	// A link node should have been created for each remote party, on the
+	// network passed in.
+	linkNodes, err := cdb.FetchAllLinkNodes()
+	if err != nil {
+		t.Fatalf("unable to fetch link nodes: %v", err)
+	}
+	if len(linkNodes) != numNodes {
+		t.Fatalf("expected %v link nodes, got %v", numNodes,
+			len(linkNodes))
+	}
+	for _, linkNode := range linkNodes {
+		if linkNode.Network != wire.TestNet3 {
+			t.Fatalf("expected link node on network %v, got %v",
+				wire.TestNet3, linkNode.Network)
+		}
+	}
+
+	diskChannels, err := cdb.FetchAllChannels()
+	if err != nil {
+		t.Fatalf("unable to fetch channels: %v", err)
+	}
+	if len(diskChannels) != numChannels {
+		t.Fatalf("expected %v channels, got %v", numChannels,
+			len(diskChannels))
+	}
+
+	expected := make(map[wire.OutPoint]*btcec.PublicKey)
+	for _, channel := range channels {
+		expected[channel.FundingOutpoint] = channel.IdentityPub
+	}
+	for _, channel := range diskChannels {
+		nodeKey, ok := expected[channel.FundingOutpoint]
+		if !ok {
+			t.Fatalf("unexpected channel %v",
+				channel.FundingOutpoint)
+		}
+		if !nodeKey.IsEqual(channel.IdentityPub) {
+			t.Fatalf("channel %v has wrong node key",
+				channel.FundingOutpoint)
+		}
+		delete(expected, channel.FundingOutpoint)
+	}
+}
+
+// createTestChainBucket creates the chain bucket that will house the passed
+// channel, along with the node bucket above it.
+func createTestChainBucket(tx *bolt.Tx, c *OpenChannel) (*bolt.Bucket, error) {
+	openChanBucket, err := tx.CreateBucketIfNotExists(openChannelBucket)
+	if err != nil {
+		return nil, err
+	}
+
+	nodePub := c.IdentityPub.SerializeCompressed()
+	nodeChanBucket, err := openChanBucket.CreateBucketIfNotExists(nodePub)
+	if err != nil {
+		return nil, err
+	}
+
+	return nodeChanBucket.CreateBucketIfNotExists(c.ChainHash[:])
+}
+
+// TestChannelExists tests that a channel is only reported as existing while
+// it remains open with the queried node.
+func TestChannelExists(t *testing.T) {
+	t.Parallel()
+
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	defer cleanUp()
+
+	channel, err := createTestChannelState(cdb)
+	if err != nil {
+		t.Fatalf("unable to create channel state: %v", err)
+	}
+
+	assertExists := func(nodeID *btcec.PublicKey, chanID *wire.OutPoint,
+		expected bool) {
+
+		exists, err := cdb.ChannelExists(nodeID, chanID)
+		if err != nil {
+			t.Fatalf("unable to check channel existence: %v", err)
+		}
+		if exists != expected {
+			t.Fatalf("expected channel %v existence to be %v, "+
+				"got %v", chanID, expected, exists)
+		}
+	}
+
+	// Before the channel has been written, it shouldn't exist.
+	assertExists(channel.IdentityPub, &channel.FundingOutpoint, false)
+
+	if err := syncTestChannel(channel); err != nil {
+		t.Fatalf("unable to save and serialize channel state: %v", err)
+	}
+
+	// Once written, the channel should exist, but only with its node.
+	assertExists(channel.IdentityPub, &channel.FundingOutpoint, true)
+
+	priv, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+	assertExists(priv.PubKey(), &channel.FundingOutpoint, false)
+
+	// A channel with the node that was never opened shouldn't exist.
+	unknownChanPoint := channel.FundingOutpoint
+	unknownChanPoint.Index++
+	assertExists(channel.IdentityPub, &unknownChanPoint, false)
+
+	// Finally, once the channel is closed, it should no longer exist.
+	summary := &ChannelCloseSummary{
+		ChanPoint: channel.FundingOutpoint,
+		RemotePub: channel.IdentityPub,
+		Capacity:  channel.Capacity,
+		CloseType: CooperativeClose,
+	}
+	if err := channel.CloseChannel(summary); err != nil {
+		t.Fatalf("unable to close channel: %v", err)
+	}
+	assertExists(channel.IdentityPub, &channel.FundingOutpoint, false)
+}
@@ -7,6 +7,14 @@ var (
 	// created.
 	ErrNoChanDBExists = fmt.Errorf("channel db has not yet been created")
 
+	// ErrNoChanDBFile is returned when a database which doesn't exist is
+	// opened read-only, as it can't be created.
+	ErrNoChanDBFile = fmt.Errorf("channel db file does not exist")
+
+	// ErrDBVersionMismatch is returned when a database opened read-only
+	// requires migrations which can't be applied.
+	ErrDBVersionMismatch = fmt.Errorf("channel db requires migration")
+
 	// ErrLinkNodesNotFound is returned when node info bucket hasn't been
 	// created.
 	ErrLinkNodesNotFound = fmt.Errorf("no link nodes exist")
@@ -15,10 +23,23 @@ var (
 	// channels within the database.
 	ErrNoActiveChannels = fmt.Errorf("no active channels exist")
 
+	// ErrChannelNotFound is returned when an open channel with the target
+	// funding outpoint can't be found.
+	ErrChannelNotFound = fmt.Errorf("channel not found")
+
 	// ErrNoPastDeltas is returned when the channel delta bucket hasn't been
 	// created.
 	ErrNoPastDeltas = fmt.Errorf("channel has no recorded deltas")
 
+	// ErrNonMonotonicUpdate is returned when a state is added to the
+	// revocation log at a height that doesn't exceed that of its tail.
+	ErrNonMonotonicUpdate = fmt.Errorf("revocation log update is not " +
+		"monotonic")
+
+	// ErrNoCloseNegotiation is returned when the fee negotiation state of
+	// a cooperative close is requested, but none has been saved.
+	ErrNoCloseNegotiation = fmt.Errorf("no close negotiation found")
+
 	// ErrInvoiceNotFound is returned when a targeted invoice can't be
 	// found.
 	ErrInvoiceNotFound = fmt.Errorf("unable to locate invoice")
@@ -89,4 +110,13 @@ var (
 	// ErrNoForwardingEvents is returned in the case that a query fails due
 	// to the log not having any recorded events.
 	ErrNoForwardingEvents = fmt.Errorf("no recorded forwarding events")
+
+	// ErrCorruptedMissionControl is returned when the stored failure
+	// history of mission control can't be decoded.
+	ErrCorruptedMissionControl = fmt.Errorf("mission control history " +
+		"is corrupted")
+
+	// ErrDBReadOnly is returned when attempting to modify a database which
+	// was opened read-only.
+	ErrDBReadOnly = fmt.Errorf("channel db was opened read-only")
 )
@@ -0,0 +1,470 @@
+package channeldb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/coreos/bbolt"
+	"github.com/roasbeef/btcd/btcec"
+	"github.com/roasbeef/btcd/wire"
+)
+
+const (
+	// nodeExportVersion is the current version of the serialization format
+	// used by ExportNode and ImportNode.
+	nodeExportVersion uint8 = 0
+
+	// maxExportFieldSize is the maximum size of any single key or value
+	// that we'll read from an exported node. This guards against
+	// allocating an unbounded amount of memory when reading a corrupt
+	// blob.
+	maxExportFieldSize = 1 << 24
+
+	// maxExportDepth is the maximum nesting depth of buckets that we'll
+	// read from an exported node. None of the buckets we export are
+	// nested this deeply.
+	maxExportDepth = 8
+)
+
+const (
+	// exportValueEntry denotes that an entry within an exported bucket
+	// is a key/value pair.
+	exportValueEntry uint8 = 0
+
+	// exportBucketEntry denotes that an entry within an exported bucket
+	// is a nested bucket.
+	exportBucketEntry uint8 = 1
+
+	// exportBucketEnd marks the end of the entries of an exported bucket.
+	exportBucketEnd uint8 = 0xff
+)
+
+var (
+	// ErrNodeExists is returned when attempting to import a node that
+	// already has channels or forwarding packages within the database,
+	// without forcing the import.
+	ErrNodeExists = fmt.Errorf("node already exists within database")
+
+	// ErrUnknownExportVersion is returned when attempting to import a node
+	// that was exported using an unknown serialization version.
+	ErrUnknownExportVersion = fmt.Errorf("unknown node export version")
+)
+
+// exportedEntry is a single entry within an exported bucket. Exactly one of
+// value or bucket will be set.
+type exportedEntry struct {
+	key    []byte
+	value  []byte
+	bucket *exportedBucket
+}
+
+// exportedBucket is an in-memory copy of a bucket, and all of its nested
+// buckets.
+type exportedBucket struct {
+	entries []exportedEntry
+}
+
+// exportedFwdPkgs is an in-memory copy of the forwarding packages of a single
+// channel, keyed by the channel's short channel ID.
+type exportedFwdPkgs struct {
+	source [8]byte
+	bucket *exportedBucket
+}
+
+// ExportNode serializes all state we hold for the channels with the passed
+// node into the passed writer. This includes the node's open channel bucket,
+// including the revocation log of each channel, the node's LinkNode, and the
+// forwarding packages of each of the node's channels. The resulting blob can
+// be installed into another database using ImportNode, allowing channels to
+// be migrated between databases at the granularity of a single peer.
+func (d *DB) ExportNode(nodeID *btcec.PublicKey, w io.Writer) error {
+	nodePub := nodeID.SerializeCompressed()
+
+	var b bytes.Buffer
+	err := d.View(func(tx *bolt.Tx) error {
+		openChanBucket := tx.Bucket(openChannelBucket)
+		if openChanBucket == nil {
+			return ErrNoChanDBExists
+		}
+		nodeChanBucket := openChanBucket.Bucket(nodePub)
+		if nodeChanBucket == nil {
+			return ErrNoActiveChannels
+		}
+
+		// The node's LinkNode may not exist, in which case we'll
+		// write an empty record.
+		var linkNodeBytes []byte
+		if nodeInfoBucket := tx.Bucket(nodeInfoBucket); nodeInfoBucket != nil {
+			linkNodeBytes = nodeInfoBucket.Get(nodePub)
+		}
+
+		// Collect the forwarding packages of each of the node's
+		// channels, which are stored in a distinct top-level bucket
+		// keyed by short channel ID.
+		var fwdPkgs []exportedFwdPkgs
+		fwdPkgBkt := tx.Bucket(fwdPackagesKey)
+		err := forEachNodeChanBucket(nodeChanBucket,
+			func(chanBucket *bolt.Bucket, chanPoint *wire.OutPoint) error {
+				if fwdPkgBkt == nil {
+					return nil
+				}
+
+				channel, err := fetchOpenChannel(
+					chanBucket, chanPoint,
+				)
+				if err != nil {
+					return err
+				}
+
+				source := makeLogKey(channel.ShortChanID.ToUint64())
+				sourceBkt := fwdPkgBkt.Bucket(source[:])
+				if sourceBkt == nil {
+					return nil
+				}
+
+				fwdPkgs = append(fwdPkgs, exportedFwdPkgs{
+					source: source,
+					bucket: exportBucket(sourceBkt),
+				})
+
+				return nil
+			},
+		)
+		if err != nil {
+			return err
+		}
+
+		if err := binary.Write(&b, byteOrder, nodeExportVersion); err != nil {
+			return err
+		}
+		if _, err := b.Write(nodePub); err != nil {
+			return err
+		}
+		if err := writeExportField(&b, linkNodeBytes); err != nil {
+			return err
+		}
+		if err := writeExportedBucket(&b, exportBucket(nodeChanBucket)); err != nil {
+			return err
+		}
+
+		numFwdPkgs := uint32(len(fwdPkgs))
+		if err := binary.Write(&b, byteOrder, numFwdPkgs); err != nil {
+			return err
+		}
+		for _, fwdPkg := range fwdPkgs {
+			if _, err := b.Write(fwdPkg.source[:]); err != nil {
+				return err
+			}
+			if err := writeExportedBucket(&b, fwdPkg.bucket); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(b.Bytes())
+	return err
+}
+
+// ImportNode installs the channel state of a single node, previously exported
+// using ExportNode, into the database. If the database already contains
+// channels or forwarding packages for the node, then ErrNodeExists is
+// returned, unless force is true, in which case the existing state is
+// replaced.
+func (d *DB) ImportNode(r io.Reader, force bool) error {
+	// We'll read the entire blob into memory before modifying the
+	// database, so a corrupt blob can't leave a partial import behind.
+	var version uint8
+	if err := binary.Read(r, byteOrder, &version); err != nil {
+		return err
+	}
+	if version != nodeExportVersion {
+		return ErrUnknownExportVersion
+	}
+
+	var nodePub [33]byte
+	if _, err := io.ReadFull(r, nodePub[:]); err != nil {
+		return err
+	}
+	if _, err := btcec.ParsePubKey(nodePub[:], btcec.S256()); err != nil {
+		return err
+	}
+
+	linkNodeBytes, err := readExportField(r)
+	if err != nil {
+		return err
+	}
+	nodeChans, err := readExportedBucket(r, 0)
+	if err != nil {
+		return err
+	}
+
+	var numFwdPkgs uint32
+	if err := binary.Read(r, byteOrder, &numFwdPkgs); err != nil {
+		return err
+	}
+	var fwdPkgs []exportedFwdPkgs
+	for i := uint32(0); i < numFwdPkgs; i++ {
+		var fwdPkg exportedFwdPkgs
+		if _, err := io.ReadFull(r, fwdPkg.source[:]); err != nil {
+			return err
+		}
+		fwdPkg.bucket, err = readExportedBucket(r, 0)
+		if err != nil {
+			return err
+		}
+
+		fwdPkgs = append(fwdPkgs, fwdPkg)
+	}
+
+	return d.Update(func(tx *bolt.Tx) error {
+		openChanBucket, err := tx.CreateBucketIfNotExists(
+			openChannelBucket,
+		)
+		if err != nil {
+			return err
+		}
+		fwdPkgBkt, err := tx.CreateBucketIfNotExists(fwdPackagesKey)
+		if err != nil {
+			return err
+		}
+
+		// Unless we're forcing the import, we'll refuse to overwrite
+		// any existing state for the node.
+		if openChanBucket.Bucket(nodePub[:]) != nil {
+			if !force {
+				return ErrNodeExists
+			}
+			if err := openChanBucket.DeleteBucket(nodePub[:]); err != nil {
+				return err
+			}
+		}
+		for _, fwdPkg := range fwdPkgs {
+			if fwdPkgBkt.Bucket(fwdPkg.source[:]) == nil {
+				continue
+			}
+			if !force {
+				return ErrNodeExists
+			}
+			err := fwdPkgBkt.DeleteBucket(fwdPkg.source[:])
+			if err != nil {
+				return err
+			}
+		}
+
+		// With any existing state cleared, we'll install the node's
+		// channels, followed by its forwarding packages.
+		nodeChanBucket, err := openChanBucket.CreateBucket(nodePub[:])
+		if err != nil {
+			return err
+		}
+		if err := importBucket(nodeChanBucket, nodeChans); err != nil {
+			return err
+		}
+
+		for _, fwdPkg := range fwdPkgs {
+			sourceBkt, err := fwdPkgBkt.CreateBucket(fwdPkg.source[:])
+			if err != nil {
+				return err
+			}
+			if err := importBucket(sourceBkt, fwdPkg.bucket); err != nil {
+				return err
+			}
+		}
+
+		// Finally, we'll install the node's LinkNode, if it was
+		// exported.
+		if len(linkNodeBytes) == 0 {
+			return nil
+		}
+		nodeInfoBucket, err := tx.CreateBucketIfNotExists(nodeInfoBucket)
+		if err != nil {
+			return err
+		}
+		return nodeInfoBucket.Put(nodePub[:], linkNodeBytes)
+	})
+}
+
+// forEachNodeChanBucket calls the passed callback for each channel within the
+// open channel bucket of a particular node, across all chains.
+func forEachNodeChanBucket(nodeChanBucket *bolt.Bucket,
+	cb func(*bolt.Bucket, *wire.OutPoint) error) error {
+
+	return nodeChanBucket.ForEach(func(chainHash, v []byte) error {
+		// If there's a value, it's not a bucket so ignore it.
+		if v != nil {
+			return nil
+		}
+
+		chainBucket := nodeChanBucket.Bucket(chainHash)
+		return chainBucket.ForEach(func(chanPoint, v []byte) error {
+			if v != nil {
+				return nil
+			}
+
+			var outPoint wire.OutPoint
+			err := readOutpoint(bytes.NewReader(chanPoint), &outPoint)
+			if err != nil {
+				return err
+			}
+
+			return cb(chainBucket.Bucket(chanPoint), &outPoint)
+		})
+	})
+}
+
+// exportBucket creates an in-memory copy of the passed bucket, and all of its
+// nested buckets.
+func exportBucket(b *bolt.Bucket) *exportedBucket {
+	bucket := &exportedBucket{}
+	b.ForEach(func(k, v []byte) error {
+		entry := exportedEntry{
+			key: append([]byte(nil), k...),
+		}
+		if v == nil {
+			entry.bucket = exportBucket(b.Bucket(k))
+		} else {
+			entry.value = append([]byte(nil), v...)
+		}
+
+		bucket.entries = append(bucket.entries, entry)
+		return nil
+	})
+
+	return bucket
+}
+
+// importBucket writes the contents of an exported bucket into the passed
+// bucket, creating any nested buckets.
+func importBucket(b *bolt.Bucket, bucket *exportedBucket) error {
+	for _, entry := range bucket.entries {
+		if entry.bucket == nil {
+			if err := b.Put(entry.key, entry.value); err != nil {
+				return err
+			}
+			continue
+		}
+
+		nested, err := b.CreateBucket(entry.key)
+		if err != nil {
+			return err
+		}
+		if err := importBucket(nested, entry.bucket); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeExportedBucket serializes an exported bucket to the passed writer.
+// Each entry is written as a type byte followed by its length-prefixed key,
+// and then either its length-prefixed value or its serialized nested bucket.
+// The entries are terminated by exportBucketEnd.
+func writeExportedBucket(w io.Writer, bucket *exportedBucket) error {
+	for _, entry := range bucket.entries {
+		entryType := exportValueEntry
+		if entry.bucket != nil {
+			entryType = exportBucketEntry
+		}
+
+		if err := binary.Write(w, byteOrder, entryType); err != nil {
+			return err
+		}
+		if err := writeExportField(w, entry.key); err != nil {
+			return err
+		}
+
+		if entry.bucket != nil {
+			err := writeExportedBucket(w, entry.bucket)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := writeExportField(w, entry.value); err != nil {
+			return err
+		}
+	}
+
+	return binary.Write(w, byteOrder, exportBucketEnd)
+}
+
+// readExportedBucket reads a bucket previously serialized using
+// writeExportedBucket from the passed reader.
+func readExportedBucket(r io.Reader, depth int) (*exportedBucket, error) {
+	if depth > maxExportDepth {
+		return nil, fmt.Errorf("exported buckets nested deeper than %d",
+			maxExportDepth)
+	}
+
+	bucket := &exportedBucket{}
+	for {
+		var entryType uint8
+		if err := binary.Read(r, byteOrder, &entryType); err != nil {
+			return nil, err
+		}
+		if entryType == exportBucketEnd {
+			return bucket, nil
+		}
+
+		key, err := readExportField(r)
+		if err != nil {
+			return nil, err
+		}
+		entry := exportedEntry{key: key}
+
+		switch entryType {
+		case exportValueEntry:
+			entry.value, err = readExportField(r)
+		case exportBucketEntry:
+			entry.bucket, err = readExportedBucket(r, depth+1)
+		default:
+			err = fmt.Errorf("unknown export entry type %d",
+				entryType)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		bucket.entries = append(bucket.entries, entry)
+	}
+}
+
+// writeExportField writes the passed byte slice to the writer, prefixed by
+// its length.
+func writeExportField(w io.Writer, b []byte) error {
+	if err := binary.Write(w, byteOrder, uint32(len(b))); err != nil {
+		return err
+	}
+
+	_, err := w.Write(b)
+	return err
+}
+
+// readExportField reads a length-prefixed byte slice, previously written
+// using writeExportField, from the passed reader.
+func readExportField(r io.Reader) ([]byte, error) {
+	var fieldLen uint32
+	if err := binary.Read(r, byteOrder, &fieldLen); err != nil {
+		return nil, err
+	}
+	if fieldLen > maxExportFieldSize {
+		return nil, fmt.Errorf("export field of %d bytes exceeds max "+
+			"of %d bytes", fieldLen, maxExportFieldSize)
+	}
+
+	b := make([]byte, fieldLen)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
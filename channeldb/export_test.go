@@ -0,0 +1,150 @@
+package channeldb
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+// TestExportImportNode tests that the channel state of a node can be exported
+// from one database and imported into another, and that an import will refuse
+// to overwrite existing state unless forced.
+func TestExportImportNode(t *testing.T) {
+	t.Parallel()
+
+	srcDB, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	defer cleanUp()
+
+	channel, err := createTestChannelState(srcDB)
+	if err != nil {
+		t.Fatalf("unable to create channel state: %v", err)
+	}
+
+	addr := &net.TCPAddr{
+		IP:   net.ParseIP("127.0.0.1"),
+		Port: 18556,
+	}
+	if err := channel.SyncPending(addr, 101); err != nil {
+		t.Fatalf("unable to save channel state: %v", err)
+	}
+
+	// We'll transition the channel to a new remote state, so that the
+	// channel has both a revocation log entry and a forwarding package.
+	remoteCommit := channel.RemoteCommitment
+	remoteCommit.CommitHeight++
+	commitDiff := &CommitDiff{
+		Commitment: remoteCommit,
+		CommitSig: &lnwire.CommitSig{
+			ChanID:    lnwire.NewChanIDFromOutPoint(&channel.FundingOutpoint),
+			CommitSig: wireSig,
+			HtlcSigs:  []lnwire.Sig{},
+		},
+		LogUpdates:        []LogUpdate{},
+		OpenedCircuitKeys: []CircuitKey{},
+		ClosedCircuitKeys: []CircuitKey{},
+	}
+	if err := channel.AppendRemoteCommitChain(commitDiff); err != nil {
+		t.Fatalf("unable to add to commit chain: %v", err)
+	}
+	fwdPkg := NewFwdPkg(
+		channel.ShortChanID, channel.RemoteCommitment.CommitHeight,
+		nil, nil,
+	)
+	if err := channel.AdvanceCommitChainTail(fwdPkg); err != nil {
+		t.Fatalf("unable to advance commit chain tail: %v", err)
+	}
+
+	var b bytes.Buffer
+	if err := srcDB.ExportNode(channel.IdentityPub, &b); err != nil {
+		t.Fatalf("unable to export node: %v", err)
+	}
+	blob := b.Bytes()
+
+	dstDB, cleanUp2, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	defer cleanUp2()
+
+	if err := dstDB.ImportNode(bytes.NewReader(blob), false); err != nil {
+		t.Fatalf("unable to import node: %v", err)
+	}
+
+	// The imported channel should match the original, including its
+	// revocation log and forwarding packages.
+	channels, err := dstDB.FetchOpenChannels(channel.IdentityPub)
+	if err != nil {
+		t.Fatalf("unable to fetch open channels: %v", err)
+	}
+	if len(channels) != 1 {
+		t.Fatalf("expected 1 channel, instead got %v", len(channels))
+	}
+	imported := channels[0]
+	if imported.FundingOutpoint != channel.FundingOutpoint {
+		t.Fatalf("funding outpoints don't match: %v vs %v",
+			imported.FundingOutpoint, channel.FundingOutpoint)
+	}
+	if imported.RemoteCommitment.CommitHeight !=
+		channel.RemoteCommitment.CommitHeight {
+
+		t.Fatalf("remote commit heights don't match: %v vs %v",
+			imported.RemoteCommitment.CommitHeight,
+			channel.RemoteCommitment.CommitHeight)
+	}
+
+	logTail, err := imported.RevocationLogTail()
+	if err != nil {
+		t.Fatalf("unable to fetch revocation log tail: %v", err)
+	}
+	if logTail.CommitHeight != remoteCommit.CommitHeight-1 {
+		t.Fatalf("unexpected revocation log tail height: %v",
+			logTail.CommitHeight)
+	}
+
+	fwdPkgs, err := imported.LoadFwdPkgs()
+	if err != nil {
+		t.Fatalf("unable to load fwd pkgs: %v", err)
+	}
+	if len(fwdPkgs) != 1 {
+		t.Fatalf("expected 1 fwd pkg, instead got %v", len(fwdPkgs))
+	}
+
+	linkNode, err := dstDB.FetchLinkNode(channel.IdentityPub)
+	if err != nil {
+		t.Fatalf("unable to fetch link node: %v", err)
+	}
+	if len(linkNode.Addresses) != 1 ||
+		linkNode.Addresses[0].String() != addr.String() {
+
+		t.Fatalf("unexpected link node addresses: %v",
+			linkNode.Addresses)
+	}
+
+	// Importing the node a second time should fail, unless forced.
+	err = dstDB.ImportNode(bytes.NewReader(blob), false)
+	if err != ErrNodeExists {
+		t.Fatalf("expected ErrNodeExists, instead got %v", err)
+	}
+	if err := dstDB.ImportNode(bytes.NewReader(blob), true); err != nil {
+		t.Fatalf("unable to force import node: %v", err)
+	}
+	channels, err = dstDB.FetchOpenChannels(channel.IdentityPub)
+	if err != nil {
+		t.Fatalf("unable to fetch open channels: %v", err)
+	}
+	if len(channels) != 1 {
+		t.Fatalf("expected 1 channel, instead got %v", len(channels))
+	}
+
+	// Finally, a truncated blob should be rejected without modifying the
+	// database.
+	err = dstDB.ImportNode(bytes.NewReader(blob[:len(blob)/2]), true)
+	if err == nil {
+		t.Fatalf("expected truncated import to fail")
+	}
+}
@@ -0,0 +1,222 @@
+package channeldb
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/coreos/bbolt"
+	"github.com/roasbeef/btcd/btcec"
+	"github.com/roasbeef/btcd/wire"
+)
+
+// CheckIntegrity validates the invariants that must hold across the top-level
+// buckets of the database, returning a description of each violation found.
+// Rather than failing on the first problem, every bucket is checked so that
+// the full extent of any corruption is reported. An error is only returned if
+// the database itself can't be read.
+//
+// The following invariants are checked:
+//   - Each link node is keyed by a valid public key.
+//   - Each node with open channels is keyed by a valid public key, and has a
+//     link node, without which its channels can't be found.
+//   - Each open channel is keyed by a valid outpoint, and holds its funding
+//     info, both commitments, and its revocation state.
+//   - Each closed channel summary is nested within the bucket of a node
+//     keyed by a valid public key, or the unknown node bucket.
+//   - Each closed channel summary is keyed by a valid outpoint, and doesn't
+//     reference a channel that's still open.
+//
+// NOTE: The database isn't modified.
+func (d *DB) CheckIntegrity() ([]string, error) {
+	var problems []string
+	err := d.ViewWithRetry(func(tx *bolt.Tx) error {
+		// Reset the problems found, in case the transaction is
+		// retried.
+		problems = nil
+
+		linkNodes := tx.Bucket(nodeInfoBucket)
+		if linkNodes != nil {
+			err := linkNodes.ForEach(func(nodePub, v []byte) error {
+				_, err := btcec.ParsePubKey(nodePub, btcec.S256())
+				if err != nil {
+					problems = append(problems, fmt.Sprintf(
+						"link node %x has invalid "+
+							"public key: %v",
+						nodePub, err))
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		openChanPoints, err := checkOpenChannels(tx, linkNodes,
+			&problems)
+		if err != nil {
+			return err
+		}
+
+		closedChans := tx.Bucket(closedChannelBucket)
+		if closedChans == nil {
+			return nil
+		}
+
+		return closedChans.ForEach(func(nodeID, v []byte) error {
+			nodeBucket := closedChans.Bucket(nodeID)
+			if nodeBucket == nil {
+				problems = append(problems, fmt.Sprintf(
+					"closed channel %x isn't within a "+
+						"node bucket", nodeID))
+				return nil
+			}
+
+			if !bytes.Equal(nodeID, unknownNodeKey) {
+				_, err := btcec.ParsePubKey(nodeID, btcec.S256())
+				if err != nil {
+					problems = append(problems, fmt.Sprintf(
+						"node %x with closed channels "+
+							"has invalid public "+
+							"key: %v", nodeID, err))
+				}
+			}
+
+			return checkClosedChannels(nodeBucket, openChanPoints,
+				&problems)
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return problems, nil
+}
+
+// checkOpenChannels checks the invariants of each open channel within the
+// database, appending a description of each violation to problems. The
+// serialized outpoints of all open channels are returned.
+func checkOpenChannels(tx *bolt.Tx, linkNodes *bolt.Bucket,
+	problems *[]string) (map[string]struct{}, error) {
+
+	openChanPoints := make(map[string]struct{})
+
+	openChanBucket := tx.Bucket(openChannelBucket)
+	if openChanBucket == nil {
+		return openChanPoints, nil
+	}
+
+	addProblem := func(format string, args ...interface{}) {
+		*problems = append(*problems, fmt.Sprintf(format, args...))
+	}
+
+	// Each open channel is required to hold each of these keys. The
+	// commitment keys are copied so they don't share a backing array.
+	localCommitKey := make([]byte, len(chanCommitmentKey)+1)
+	copy(localCommitKey, chanCommitmentKey)
+	remoteCommitKey := make([]byte, len(chanCommitmentKey)+1)
+	copy(remoteCommitKey, chanCommitmentKey)
+	remoteCommitKey[len(chanCommitmentKey)] = 0x01
+
+	requiredKeys := []struct {
+		key  []byte
+		name string
+	}{
+		{chanInfoKey, "funding info"},
+		{localCommitKey, "local commitment"},
+		{remoteCommitKey, "remote commitment"},
+		{revocationStateKey, "revocation state"},
+	}
+
+	err := openChanBucket.ForEach(func(nodePub, v []byte) error {
+		nodeChanBucket := openChanBucket.Bucket(nodePub)
+		if nodeChanBucket == nil {
+			return nil
+		}
+
+		_, err := btcec.ParsePubKey(nodePub, btcec.S256())
+		if err != nil {
+			addProblem("node %x with open channels has invalid "+
+				"public key: %v", nodePub, err)
+		}
+		if linkNodes == nil || linkNodes.Get(nodePub) == nil {
+			addProblem("node %x with open channels has no link "+
+				"node", nodePub)
+		}
+
+		return nodeChanBucket.ForEach(func(chainHash, v []byte) error {
+			chainBucket := nodeChanBucket.Bucket(chainHash)
+			if chainBucket == nil {
+				return nil
+			}
+
+			return chainBucket.ForEach(func(chanPoint, v []byte) error {
+				chanBucket := chainBucket.Bucket(chanPoint)
+				if chanBucket == nil {
+					return nil
+				}
+				openChanPoints[string(chanPoint)] = struct{}{}
+
+				if _, err := parseOutpointKey(chanPoint); err != nil {
+					addProblem("open channel %x has "+
+						"invalid outpoint: %v",
+						chanPoint, err)
+				}
+
+				for _, required := range requiredKeys {
+					if chanBucket.Get(required.key) != nil {
+						continue
+					}
+
+					addProblem("open channel %x is "+
+						"missing its %v", chanPoint,
+						required.name)
+				}
+
+				return nil
+			})
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return openChanPoints, nil
+}
+
+// checkClosedChannels checks that each closed channel summary within the
+// target node bucket is keyed by a valid outpoint, and doesn't reference a
+// channel within the passed set of open channels. A description of each
+// violation is appended to problems.
+func checkClosedChannels(nodeBucket *bolt.Bucket,
+	openChanPoints map[string]struct{}, problems *[]string) error {
+
+	return nodeBucket.ForEach(func(chanID, v []byte) error {
+		if _, err := parseOutpointKey(chanID); err != nil {
+			*problems = append(*problems, fmt.Sprintf(
+				"closed channel %x has invalid outpoint: %v",
+				chanID, err))
+			return nil
+		}
+
+		if _, ok := openChanPoints[string(chanID)]; ok {
+			*problems = append(*problems, fmt.Sprintf(
+				"closed channel %x is still open", chanID))
+		}
+		return nil
+	})
+}
+
+// parseOutpointKey parses a key holding an outpoint serialized with
+// writeOutpoint, ensuring no trailing bytes remain.
+func parseOutpointKey(key []byte) (*wire.OutPoint, error) {
+	var op wire.OutPoint
+	r := bytes.NewReader(key)
+	if err := readOutpoint(r, &op); err != nil {
+		return nil, err
+	}
+	if r.Len() != 0 {
+		return nil, fmt.Errorf("%v trailing bytes", r.Len())
+	}
+
+	return &op, nil
+}
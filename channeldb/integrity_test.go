@@ -0,0 +1,116 @@
+package channeldb
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/coreos/bbolt"
+)
+
+// TestCheckIntegrity tests that a consistent database passes the integrity
+// check, and that each violated invariant is reported.
+func TestCheckIntegrity(t *testing.T) {
+	t.Parallel()
+
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	defer cleanUp()
+
+	// We'll create two channels, one of which we'll then close.
+	var channels []*OpenChannel
+	for i := 0; i < 2; i++ {
+		channel, err := createTestChannelState(cdb)
+		if err != nil {
+			t.Fatalf("unable to create channel state: %v", err)
+		}
+		channel.FundingOutpoint.Index = uint32(i)
+		if err := syncTestChannel(channel); err != nil {
+			t.Fatalf("unable to save and serialize channel "+
+				"state: %v", err)
+		}
+
+		channels = append(channels, channel)
+	}
+
+	closedChannel := channels[1]
+	summary := &ChannelCloseSummary{
+		ChanPoint: closedChannel.FundingOutpoint,
+		RemotePub: closedChannel.IdentityPub,
+		Capacity:  closedChannel.Capacity,
+		CloseType: CooperativeClose,
+	}
+	if err := closedChannel.CloseChannel(summary); err != nil {
+		t.Fatalf("unable to close channel: %v", err)
+	}
+
+	// At this point, the database is consistent.
+	problems, err := cdb.CheckIntegrity()
+	if err != nil {
+		t.Fatalf("unable to check integrity: %v", err)
+	}
+	if len(problems) != 0 {
+		t.Fatalf("expected no problems, got: %v", problems)
+	}
+
+	// Now we'll violate several invariants at once: the open channel will
+	// lose its revocation state, a closed summary will be written for it
+	// while it remains open, and an invalid link node will be added.
+	openChannel := channels[0]
+	var chanPointBuf bytes.Buffer
+	err = writeOutpoint(&chanPointBuf, &openChannel.FundingOutpoint)
+	if err != nil {
+		t.Fatalf("unable to serialize outpoint: %v", err)
+	}
+	err = cdb.Update(func(tx *bolt.Tx) error {
+		chanBucket, err := readChanBucket(tx, openChannel.IdentityPub,
+			&openChannel.FundingOutpoint, openChannel.ChainHash)
+		if err != nil {
+			return err
+		}
+		if err := chanBucket.Delete(revocationStateKey); err != nil {
+			return err
+		}
+
+		err = putChannelCloseSummary(tx, chanPointBuf.Bytes(), summary)
+		if err != nil {
+			return err
+		}
+
+		linkNodes := tx.Bucket(nodeInfoBucket)
+		return linkNodes.Put([]byte("invalid"), []byte{})
+	})
+	if err != nil {
+		t.Fatalf("unable to corrupt database: %v", err)
+	}
+
+	problems, err = cdb.CheckIntegrity()
+	if err != nil {
+		t.Fatalf("unable to check integrity: %v", err)
+	}
+
+	expectedProblems := []string{
+		"missing its revocation state",
+		"is still open",
+		"has invalid public key",
+	}
+	if len(problems) != len(expectedProblems) {
+		t.Fatalf("expected %v problems, got: %v",
+			len(expectedProblems), problems)
+	}
+	for _, expected := range expectedProblems {
+		var found bool
+		for _, problem := range problems {
+			if strings.Contains(problem, expected) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Fatalf("problem %q not reported, got: %v", expected,
+				problems)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package channeldb
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/coreos/bbolt"
+	"github.com/roasbeef/btcd/wire"
+)
+
+var (
+	// eventLogBucket is the bucket that we'll use to store the lifecycle
+	// events of each channel, for auditing. The log is append-only. Each
+	// key within the bucket is the channel point of the channel, followed
+	// by the timestamp of the event (in nano seconds since the unix
+	// epoch), such that the events of a channel are stored contiguously,
+	// in the order they occurred.
+	//
+	// eventLog -> chanPoint || timestamp -> event
+	eventLogBucket = []byte("chan-event-log")
+)
+
+// LifecycleEventType denotes the kind of a channel lifecycle event.
+type LifecycleEventType uint8
+
+const (
+	// LifecycleOpen is recorded when a channel is first written to the
+	// database.
+	LifecycleOpen LifecycleEventType = 0
+
+	// LifecycleUpdateMilestone is recorded when a channel reaches a
+	// notable number of state updates.
+	LifecycleUpdateMilestone LifecycleEventType = 1
+
+	// LifecycleClose is recorded when a channel is closed, and its state
+	// deleted from the database.
+	LifecycleClose LifecycleEventType = 2
+)
+
+// String returns a human readable version of the event type.
+func (t LifecycleEventType) String() string {
+	switch t {
+	case LifecycleOpen:
+		return "Open"
+	case LifecycleUpdateMilestone:
+		return "UpdateMilestone"
+	case LifecycleClose:
+		return "Close"
+	default:
+		return fmt.Sprintf("Unknown(%d)", uint8(t))
+	}
+}
+
+// LifecycleEvent is an event within the lifecycle of a channel, as recorded
+// within the event log.
+type LifecycleEvent struct {
+	// Type is the kind of the event.
+	Type LifecycleEventType
+
+	// Timestamp is the time the event was recorded.
+	Timestamp time.Time
+
+	// UpdateNum is the number of the channel's latest state at the time
+	// of the event.
+	UpdateNum uint64
+}
+
+// RecordLifecycleEvent appends the passed event to the event log of the
+// target channel. If the event has no timestamp, then it's recorded with the
+// current time.
+func (d *DB) RecordLifecycleEvent(chanID *wire.OutPoint,
+	event LifecycleEvent) error {
+
+	return d.Update(func(tx *bolt.Tx) error {
+		return putLifecycleEvent(tx, chanID, event)
+	})
+}
+
+// FetchLifecycleEvents returns the events within the event log of the target
+// channel, in the order they occurred. If no events have been recorded for
+// the channel, then an empty slice is returned.
+func (d *DB) FetchLifecycleEvents(chanID *wire.OutPoint) ([]LifecycleEvent,
+	error) {
+
+	var chanPointBuf bytes.Buffer
+	if err := writeOutpoint(&chanPointBuf, chanID); err != nil {
+		return nil, err
+	}
+	prefix := chanPointBuf.Bytes()
+
+	var events []LifecycleEvent
+	err := d.ViewWithRetry(func(tx *bolt.Tx) error {
+		// Reset the events found, in case the transaction is retried.
+		events = nil
+
+		eventLog := tx.Bucket(eventLogBucket)
+		if eventLog == nil {
+			return nil
+		}
+
+		cursor := eventLog.Cursor()
+		k, v := cursor.Seek(prefix)
+		for ; k != nil && bytes.HasPrefix(k, prefix); k, v = cursor.Next() {
+			if len(k) != len(prefix)+8 {
+				return fmt.Errorf("invalid event log key: %x",
+					k)
+			}
+
+			event, err := deserializeLifecycleEvent(
+				bytes.NewReader(v),
+			)
+			if err != nil {
+				return err
+			}
+
+			timestamp := byteOrder.Uint64(k[len(prefix):])
+			event.Timestamp = time.Unix(0, int64(timestamp))
+
+			events = append(events, *event)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// putLifecycleEvent appends the passed event to the event log of the target
+// channel within the passed transaction. Events recorded within the same
+// nanosecond are ordered by bumping the timestamp of the later event.
+func putLifecycleEvent(tx *bolt.Tx, chanID *wire.OutPoint,
+	event LifecycleEvent) error {
+
+	eventLog, err := tx.CreateBucketIfNotExists(eventLogBucket)
+	if err != nil {
+		return err
+	}
+
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	var key bytes.Buffer
+	if err := writeOutpoint(&key, chanID); err != nil {
+		return err
+	}
+	var timestamp [8]byte
+	byteOrder.PutUint64(timestamp[:], uint64(event.Timestamp.UnixNano()))
+	if _, err := key.Write(timestamp[:]); err != nil {
+		return err
+	}
+
+	// As the log is append-only, an existing event is never overwritten.
+	eventKey := key.Bytes()
+	for eventLog.Get(eventKey) != nil {
+		ts := byteOrder.Uint64(eventKey[len(eventKey)-8:])
+		byteOrder.PutUint64(eventKey[len(eventKey)-8:], ts+1)
+	}
+
+	var b bytes.Buffer
+	if err := serializeLifecycleEvent(&b, &event); err != nil {
+		return err
+	}
+
+	return eventLog.Put(eventKey, b.Bytes())
+}
+
+// serializeLifecycleEvent writes the passed event to w. The timestamp isn't
+// written, as it's stored within the event's key.
+func serializeLifecycleEvent(w io.Writer, e *LifecycleEvent) error {
+	if _, err := w.Write([]byte{byte(e.Type)}); err != nil {
+		return err
+	}
+
+	return writeElements(w, e.UpdateNum)
+}
+
+// deserializeLifecycleEvent reads an event written by serializeLifecycleEvent
+// from r.
+func deserializeLifecycleEvent(r io.Reader) (*LifecycleEvent, error) {
+	var (
+		e         LifecycleEvent
+		eventType [1]byte
+	)
+	if _, err := io.ReadFull(r, eventType[:]); err != nil {
+		return nil, err
+	}
+	e.Type = LifecycleEventType(eventType[0])
+
+	if err := readElements(r, &e.UpdateNum); err != nil {
+		return nil, err
+	}
+
+	return &e, nil
+}
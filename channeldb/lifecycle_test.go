@@ -0,0 +1,78 @@
+package channeldb
+
+import (
+	"testing"
+)
+
+// TestLifecycleEvents tests that opening and then closing a channel records
+// an event for each within the channel's event log, in order.
+func TestLifecycleEvents(t *testing.T) {
+	t.Parallel()
+
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	defer cleanUp()
+
+	// We'll open two channels, only the first of which we'll close.
+	var channels []*OpenChannel
+	for i := 0; i < 2; i++ {
+		channel, err := createTestChannelState(cdb)
+		if err != nil {
+			t.Fatalf("unable to create channel state: %v", err)
+		}
+		channel.FundingOutpoint.Index = uint32(i)
+		if err := syncTestChannel(channel); err != nil {
+			t.Fatalf("unable to save and serialize channel "+
+				"state: %v", err)
+		}
+
+		channels = append(channels, channel)
+	}
+
+	// Syncing the channel again shouldn't record it as opened twice.
+	channel := channels[0]
+	if err := channel.FullSync(); err != nil {
+		t.Fatalf("unable to sync channel: %v", err)
+	}
+
+	summary := &ChannelCloseSummary{
+		ChanPoint: channel.FundingOutpoint,
+		RemotePub: channel.IdentityPub,
+		Capacity:  channel.Capacity,
+		CloseType: CooperativeClose,
+	}
+	if err := channel.CloseChannel(summary); err != nil {
+		t.Fatalf("unable to close channel: %v", err)
+	}
+
+	events, err := cdb.FetchLifecycleEvents(&channel.FundingOutpoint)
+	if err != nil {
+		t.Fatalf("unable to fetch events: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected %v events, got %v", 2, len(events))
+	}
+	if events[0].Type != LifecycleOpen {
+		t.Fatalf("expected first event to be %v, got %v",
+			LifecycleOpen, events[0].Type)
+	}
+	if events[1].Type != LifecycleClose {
+		t.Fatalf("expected second event to be %v, got %v",
+			LifecycleClose, events[1].Type)
+	}
+	if !events[0].Timestamp.Before(events[1].Timestamp) {
+		t.Fatalf("events out of order: open at %v, close at %v",
+			events[0].Timestamp, events[1].Timestamp)
+	}
+
+	// The channel that remains open should only have its open event.
+	events, err = cdb.FetchLifecycleEvents(&channels[1].FundingOutpoint)
+	if err != nil {
+		t.Fatalf("unable to fetch events: %v", err)
+	}
+	if len(events) != 1 || events[0].Type != LifecycleOpen {
+		t.Fatalf("unexpected events: %v", events)
+	}
+}
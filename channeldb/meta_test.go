@@ -2,10 +2,17 @@ package channeldb
 
 import (
 	"bytes"
+	"fmt"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/coreos/bbolt"
+	"github.com/davecgh/go-spew/spew"
 	"github.com/go-errors/errors"
+	"github.com/roasbeef/btcd/btcec"
+	"github.com/roasbeef/btcd/wire"
+	"github.com/roasbeef/btcutil"
 )
 
 // TestVersionFetchPut checks the propernces of fetch/put methods
@@ -380,3 +387,332 @@ func TestMigrationWithoutErrors(t *testing.T) {
 		migrationWithoutErrors,
 		false)
 }
+
+// TestMigrationOnOpen tests that any pending migrations are applied as the
+// database is opened, that a failed migration is reported as such, and that
+// a database requiring migration can't be opened read-only.
+//
+// NOTE: As this test modifies the global list of versions, it must not be run
+// in parallel.
+func TestMigrationOnOpen(t *testing.T) {
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	defer cleanUp()
+
+	// We'll roll the database back to the base version, then close it so
+	// we can re-open it with a new migration registered.
+	if err := cdb.PutMeta(&Meta{DbVersionNumber: 0}); err != nil {
+		t.Fatalf("unable to store meta data: %v", err)
+	}
+	dbPath := cdb.Path()
+	if err := cdb.Close(); err != nil {
+		t.Fatalf("unable to close database: %v", err)
+	}
+
+	migratedBucket := []byte("migrated")
+	var (
+		numCalls  int
+		migration = func(tx *bolt.Tx) error {
+			numCalls++
+			_, err := tx.CreateBucketIfNotExists(migratedBucket)
+			return err
+		}
+		migrationErr = errors.New("migration failed")
+	)
+
+	oldVersions := dbVersions
+	defer func() {
+		dbVersions = oldVersions
+	}()
+
+	// First, we'll register a migration that fails. Opening the database
+	// should report the failed migration.
+	dbVersions = []version{
+		{number: 0},
+		{
+			number: 1,
+			migration: func(tx *bolt.Tx) error {
+				return migrationErr
+			},
+		},
+	}
+	_, err = Open(dbPath)
+	migrationFailed, ok := err.(ErrMigrationFailed)
+	if !ok {
+		t.Fatalf("expected ErrMigrationFailed, got %v", err)
+	}
+	if migrationFailed.Version != 1 || migrationFailed.Err != migrationErr {
+		t.Fatalf("unexpected migration failure: %v", migrationFailed)
+	}
+
+	// With a working migration registered, the database shouldn't be able
+	// to be opened read-only, as the migration can't be applied.
+	dbVersions = []version{
+		{number: 0},
+		{number: 1, migration: migration},
+	}
+	_, err = OpenWithOptions(dbPath, &Options{ReadOnly: true})
+	if err != ErrDBVersionMismatch {
+		t.Fatalf("expected ErrDBVersionMismatch, got %v", err)
+	}
+
+	// Opening the database normally should apply the migration exactly
+	// once, bringing the database up to the latest version.
+	cdb, err = Open(dbPath)
+	if err != nil {
+		t.Fatalf("unable to open database: %v", err)
+	}
+	defer cdb.Close()
+
+	if numCalls != 1 {
+		t.Fatalf("expected migration to be applied once, was applied "+
+			"%v times", numCalls)
+	}
+
+	meta, err := cdb.FetchMeta(nil)
+	if err != nil {
+		t.Fatalf("unable to fetch meta data: %v", err)
+	}
+	if meta.DbVersionNumber != 1 {
+		t.Fatalf("expected db version 1, got %v", meta.DbVersionNumber)
+	}
+
+	err = cdb.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(migratedBucket) == nil {
+			return errors.New("migrated bucket not found")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestMigrateLastUpdateTime tests that the migration records an unknown last
+// update time for channels lacking one, while leaving existing times
+// untouched.
+func TestMigrateLastUpdateTime(t *testing.T) {
+	t.Parallel()
+
+	lastUpdate := time.Unix(1500000000, 0)
+
+	// We'll write two channels, only the second of which has a last
+	// update time. The key of the first is removed, as it would be absent
+	// for channels written before the time was recorded.
+	beforeMigrationFunc := func(d *DB) {
+		for i := 0; i < 2; i++ {
+			channel, err := createTestChannelState(d)
+			if err != nil {
+				t.Fatalf("unable to create channel state: %v", err)
+			}
+			channel.FundingOutpoint.Index = uint32(i)
+			if i == 1 {
+				channel.LastUpdateTime = lastUpdate
+			}
+
+			if err := syncTestChannel(channel); err != nil {
+				t.Fatalf("unable to save and serialize channel "+
+					"state: %v", err)
+			}
+			if i == 1 {
+				continue
+			}
+
+			err = d.Update(func(tx *bolt.Tx) error {
+				chanBucket, err := updateChanBucket(
+					tx, channel.IdentityPub,
+					&channel.FundingOutpoint,
+					channel.ChainHash,
+				)
+				if err != nil {
+					return err
+				}
+				return chanBucket.Delete(lastUpdateKey)
+			})
+			if err != nil {
+				t.Fatalf("unable to delete last update: %v", err)
+			}
+		}
+	}
+
+	afterMigrationFunc := func(d *DB) {
+		meta, err := d.FetchMeta(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if meta.DbVersionNumber != 1 {
+			t.Fatalf("expected db version 1, got %v",
+				meta.DbVersionNumber)
+		}
+
+		channels, err := d.FetchAllChannels()
+		if err != nil {
+			t.Fatalf("unable to fetch channels: %v", err)
+		}
+		if len(channels) != 2 {
+			t.Fatalf("expected %v channels, got %v", 2,
+				len(channels))
+		}
+
+		for _, channel := range channels {
+			switch channel.FundingOutpoint.Index {
+			case 0:
+				if !channel.LastUpdateTime.IsZero() {
+					t.Fatalf("expected unknown last "+
+						"update time, got %v",
+						channel.LastUpdateTime)
+				}
+
+			case 1:
+				if !channel.LastUpdateTime.Equal(lastUpdate) {
+					t.Fatalf("existing last update time "+
+						"changed: expected %v, got %v",
+						lastUpdate,
+						channel.LastUpdateTime)
+				}
+			}
+		}
+	}
+
+	applyMigration(t,
+		beforeMigrationFunc,
+		afterMigrationFunc,
+		migrateLastUpdateTime,
+		false)
+}
+
+// TestMigrateClosedChannelsByNode tests that the migration moves each closed
+// channel summary of the flat layout into the bucket of its node, and legacy
+// summaries lacking a node into the unknown node bucket.
+func TestMigrateClosedChannelsByNode(t *testing.T) {
+	t.Parallel()
+
+	priv, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+	remotePub := priv.PubKey()
+
+	summary := &ChannelCloseSummary{
+		ChanPoint: wire.OutPoint{Hash: rev, Index: 0},
+		RemotePub: remotePub,
+		Capacity:  btcutil.Amount(10000),
+		CloseType: ForceClose,
+		IsPending: true,
+	}
+	legacyChanPoint := wire.OutPoint{Hash: rev, Index: 1}
+
+	// We'll write a full summary and a legacy summary directly into the
+	// closed channel bucket, mirroring the flat layout.
+	beforeMigrationFunc := func(d *DB) {
+		err := d.Update(func(tx *bolt.Tx) error {
+			closeBucket, err := tx.CreateBucketIfNotExists(
+				closedChannelBucket,
+			)
+			if err != nil {
+				return err
+			}
+
+			var chanID, summaryBytes bytes.Buffer
+			err = writeOutpoint(&chanID, &summary.ChanPoint)
+			if err != nil {
+				return err
+			}
+			err = serializeChannelCloseSummary(&summaryBytes, summary)
+			if err != nil {
+				return err
+			}
+			err = closeBucket.Put(chanID.Bytes(), summaryBytes.Bytes())
+			if err != nil {
+				return err
+			}
+
+			var legacyChanID bytes.Buffer
+			err = writeOutpoint(&legacyChanID, &legacyChanPoint)
+			if err != nil {
+				return err
+			}
+			return closeBucket.Put(legacyChanID.Bytes(), nil)
+		})
+		if err != nil {
+			t.Fatalf("unable to write flat summaries: %v", err)
+		}
+	}
+
+	afterMigrationFunc := func(d *DB) {
+		meta, err := d.FetchMeta(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if meta.DbVersionNumber != 1 {
+			t.Fatalf("expected db version 1, got %v",
+				meta.DbVersionNumber)
+		}
+
+		closed, err := d.FetchClosedChannelsForNode(remotePub)
+		if err != nil {
+			t.Fatalf("unable to fetch closed channels: %v", err)
+		}
+		if len(closed) != 1 {
+			t.Fatalf("expected %v closed channels, got %v", 1,
+				len(closed))
+		}
+		if !reflect.DeepEqual(summary, closed[0]) {
+			t.Fatalf("summaries don't match: expected %v got %v",
+				spew.Sdump(summary), spew.Sdump(closed[0]))
+		}
+
+		legacySummary, err := d.FetchClosedChannel(&legacyChanPoint)
+		if err != nil {
+			t.Fatalf("unable to fetch legacy summary: %v", err)
+		}
+		if legacySummary.CloseType != UnknownClose {
+			t.Fatalf("wrong close type: expected %v, got %v",
+				UnknownClose, legacySummary.CloseType)
+		}
+
+		// Both summaries should now be nested within node buckets,
+		// the legacy summary within the unknown node bucket.
+		err = d.View(func(tx *bolt.Tx) error {
+			closeBucket := tx.Bucket(closedChannelBucket)
+			return closeBucket.ForEach(func(k, v []byte) error {
+				if v != nil {
+					return fmt.Errorf("summary %x wasn't "+
+						"migrated", k)
+				}
+				return nil
+			})
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var legacyChanID bytes.Buffer
+		err = writeOutpoint(&legacyChanID, &legacyChanPoint)
+		if err != nil {
+			t.Fatalf("unable to serialize outpoint: %v", err)
+		}
+		err = d.View(func(tx *bolt.Tx) error {
+			closeBucket := tx.Bucket(closedChannelBucket)
+			unknownBucket := closeBucket.Bucket(unknownNodeKey)
+			if unknownBucket == nil ||
+				unknownBucket.Get(legacyChanID.Bytes()) == nil {
+
+				return fmt.Errorf("legacy summary not within " +
+					"unknown node bucket")
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	applyMigration(t,
+		beforeMigrationFunc,
+		afterMigrationFunc,
+		migrateClosedChannelsByNode,
+		false)
+}
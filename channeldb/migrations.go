@@ -1 +1,140 @@
 package channeldb
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/coreos/bbolt"
+)
+
+// migrateLastUpdateTime is a migration function that records a last update
+// time for each open channel written before the time was tracked. As the true
+// time of the last update is unknown, and no other record of it exists, these
+// channels are given the zero time, matching what they reported before the
+// migration. Channels which already have a last update time are left
+// untouched.
+func migrateLastUpdateTime(tx *bolt.Tx) error {
+	openChanBucket := tx.Bucket(openChannelBucket)
+	if openChanBucket == nil {
+		return nil
+	}
+
+	// We'll first gather each channel bucket lacking a last update time,
+	// as buckets can't be safely modified while iterating over their
+	// parent.
+	var chanBuckets []*bolt.Bucket
+	err := openChanBucket.ForEach(func(nodePub, v []byte) error {
+		nodeChanBucket := openChanBucket.Bucket(nodePub)
+		if nodeChanBucket == nil {
+			return nil
+		}
+
+		return nodeChanBucket.ForEach(func(chainHash, v []byte) error {
+			chainBucket := nodeChanBucket.Bucket(chainHash)
+			if chainBucket == nil {
+				return nil
+			}
+
+			return chainBucket.ForEach(func(chanPoint, v []byte) error {
+				chanBucket := chainBucket.Bucket(chanPoint)
+				if chanBucket == nil {
+					return nil
+				}
+
+				if chanBucket.Get(lastUpdateKey) == nil {
+					chanBuckets = append(chanBuckets, chanBucket)
+				}
+				return nil
+			})
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, chanBucket := range chanBuckets {
+		if err := putChanLastUpdate(chanBucket, time.Time{}); err != nil {
+			return err
+		}
+	}
+
+	log.Infof("Recorded unknown last update time of %v channels",
+		len(chanBuckets))
+
+	return nil
+}
+
+// migrateClosedChannelsByNode is a migration function that moves each closed
+// channel summary from the flat layout, where summaries were keyed only by
+// their channel point, into the bucket of the node the channel was with.
+// Older databases stored only the channel point of some closed channels, so
+// as their node is unknown, these entries are moved into the unknown node
+// bucket instead.
+func migrateClosedChannelsByNode(tx *bolt.Tx) error {
+	closedChanBucket := tx.Bucket(closedChannelBucket)
+	if closedChanBucket == nil {
+		return nil
+	}
+
+	// We'll first gather the flat entries, copying them as the bucket
+	// can't be modified while iterating over it.
+	type closedEntry struct {
+		chanID       []byte
+		summaryBytes []byte
+	}
+	var entries []closedEntry
+	err := closedChanBucket.ForEach(func(k, v []byte) error {
+		// If there's no value, then this is a node bucket that's
+		// already in the new layout.
+		if v == nil {
+			return nil
+		}
+
+		summaryBytes := make([]byte, len(v))
+		copy(summaryBytes, v)
+		entries = append(entries, closedEntry{
+			chanID:       append([]byte(nil), k...),
+			summaryBytes: summaryBytes,
+		})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var numUnknown int
+	for _, entry := range entries {
+		nodeKey := unknownNodeKey
+		if len(entry.summaryBytes) != 0 {
+			summary, err := deserializeCloseChannelSummary(
+				bytes.NewReader(entry.summaryBytes),
+			)
+			if err != nil {
+				return err
+			}
+			nodeKey = summary.RemotePub.SerializeCompressed()
+		} else {
+			numUnknown++
+		}
+
+		nodeBucket, err := closedChanBucket.CreateBucketIfNotExists(
+			nodeKey,
+		)
+		if err != nil {
+			return err
+		}
+		err = nodeBucket.Put(entry.chanID, entry.summaryBytes)
+		if err != nil {
+			return err
+		}
+
+		if err := closedChanBucket.Delete(entry.chanID); err != nil {
+			return err
+		}
+	}
+
+	log.Infof("Moved %v closed channel summaries into node buckets, %v "+
+		"of which have an unknown node", len(entries), numUnknown)
+
+	return nil
+}
@@ -0,0 +1,324 @@
+package channeldb
+
+import (
+	"time"
+
+	"github.com/coreos/bbolt"
+	"github.com/roasbeef/btcutil"
+)
+
+var (
+	// missionControlBucket is the top-level bucket that stores the
+	// failure history of mission control, allowing it to survive
+	// restarts. It houses a nested bucket for each kind of failure.
+	missionControlBucket = []byte("mission-control")
+
+	// mcFailedEdgesBucket is the bucket within the mission control bucket
+	// that maps each failed edge, identified by its short channel ID and
+	// the node the failure was directed toward, to the time it expires
+	// from the prune view. Edges keyed by their short channel ID alone are
+	// considered to have failed in both directions.
+	//
+	// failedEdges -> chanID || toNode -> expiry
+	mcFailedEdgesBucket = []byte("failed-edges")
+
+	// mcFailedVertexesBucket is the bucket within the mission control
+	// bucket that maps the public key of each failed vertex to the time it
+	// expires from the prune view.
+	//
+	// failedVertexes -> pubKey -> expiry
+	mcFailedVertexesBucket = []byte("failed-vertexes")
+
+	// mcPersistentVertexesBucket is the bucket within the mission control
+	// bucket that maps the public key of each vertex which has failed
+	// persistently, and so been promoted to the longer lived prune tier,
+	// to the time of its latest failure.
+	//
+	// persistentVertexes -> pubKey -> pruneTime
+	mcPersistentVertexesBucket = []byte("persistent-failed-vertexes")
+
+	// mcBlacklistBucket is the bucket within the mission control bucket
+	// that stores the public key of each vertex which has been
+	// blacklisted, and so should never be routed through. The value of
+	// each key is empty.
+	//
+	// blacklist -> pubKey -> nil
+	mcBlacklistBucket = []byte("blacklisted-vertexes")
+
+	// mcFailedEdgeAmtsBucket is the bucket within the mission control
+	// bucket that maps each edge which failed to carry a payment,
+	// identified in the same way as within the failed edges bucket, to the
+	// smallest amount that failed, along with the time the failure expires
+	// from the prune view.
+	//
+	// failedEdgeAmts -> chanID || toNode -> amt || expiry
+	mcFailedEdgeAmtsBucket = []byte("failed-edge-amts")
+)
+
+// MissionControlHistory is the failure history of mission control, recording
+// the edges and vertexes which have been pruned, along with when each was
+// pruned or is due to expire from the prune view.
+type MissionControlHistory struct {
+	// FailedEdges maps each failed edge to the time it expires from the
+	// prune view.
+	FailedEdges map[FailedEdge]time.Time
+
+	// FailedVertexes maps the public key of each failed vertex to the
+	// time it expires from the prune view.
+	FailedVertexes map[[33]byte]time.Time
+
+	// PersistentVertexes maps the public key of each vertex which has
+	// failed persistently to the time of its latest failure. These
+	// vertexes remain pruned for longer than those within FailedVertexes.
+	PersistentVertexes map[[33]byte]time.Time
+
+	// Blacklist is the set of public keys of the vertexes which have been
+	// blacklisted. Unlike failed vertexes, these never expire.
+	Blacklist map[[33]byte]struct{}
+
+	// FailedEdgeAmts maps each edge which failed to carry a payment of a
+	// particular amount, in a particular direction, to the failure.
+	FailedEdgeAmts map[FailedEdge]EdgeAmtFailure
+}
+
+// FailedEdge identifies an edge which failed in a particular direction, by its
+// short channel ID and the node the failure was directed toward.
+type FailedEdge struct {
+	// ChannelID is the short channel ID of the edge.
+	ChannelID uint64
+
+	// ToNode is the public key of the node the failure was directed
+	// toward. If zero, then the edge failed in both directions.
+	ToNode [33]byte
+}
+
+// EdgeAmtFailure records the smallest amount that an edge failed to carry,
+// and the time the failure expires from the prune view.
+type EdgeAmtFailure struct {
+	// Amt is the smallest amount that failed to be carried by the edge.
+	Amt btcutil.Amount
+
+	// Expiry is the time the failure expires from the prune view.
+	Expiry time.Time
+}
+
+// PutMissionControlHistory stores the passed failure history of mission
+// control, replacing any history stored previously.
+func (d *DB) PutMissionControlHistory(history *MissionControlHistory) error {
+	return d.Update(func(tx *bolt.Tx) error {
+		err := tx.DeleteBucket(missionControlBucket)
+		if err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+
+		mcBucket, err := tx.CreateBucket(missionControlBucket)
+		if err != nil {
+			return err
+		}
+
+		edges, err := mcBucket.CreateBucket(mcFailedEdgesBucket)
+		if err != nil {
+			return err
+		}
+		for edge, pruneTime := range history.FailedEdges {
+			var k [8 + 33]byte
+			byteOrder.PutUint64(k[:8], edge.ChannelID)
+			copy(k[8:], edge.ToNode[:])
+			if err := putPruneTime(edges, k[:], pruneTime); err != nil {
+				return err
+			}
+		}
+
+		err = putVertexPruneTimes(
+			mcBucket, mcFailedVertexesBucket, history.FailedVertexes,
+		)
+		if err != nil {
+			return err
+		}
+		err = putVertexPruneTimes(
+			mcBucket, mcPersistentVertexesBucket,
+			history.PersistentVertexes,
+		)
+		if err != nil {
+			return err
+		}
+
+		blacklist, err := mcBucket.CreateBucket(mcBlacklistBucket)
+		if err != nil {
+			return err
+		}
+		for pubKey := range history.Blacklist {
+			if err := blacklist.Put(pubKey[:], []byte{}); err != nil {
+				return err
+			}
+		}
+
+		edgeAmts, err := mcBucket.CreateBucket(mcFailedEdgeAmtsBucket)
+		if err != nil {
+			return err
+		}
+		for edge, failure := range history.FailedEdgeAmts {
+			var k [8 + 33]byte
+			byteOrder.PutUint64(k[:8], edge.ChannelID)
+			copy(k[8:], edge.ToNode[:])
+
+			var v [16]byte
+			byteOrder.PutUint64(v[:8], uint64(failure.Amt))
+			byteOrder.PutUint64(
+				v[8:], uint64(failure.Expiry.UnixNano()),
+			)
+			if err := edgeAmts.Put(k[:], v[:]); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// FetchMissionControlHistory returns the failure history of mission control
+// stored within the database. If no history has been stored, then an empty
+// history is returned.
+func (d *DB) FetchMissionControlHistory() (*MissionControlHistory, error) {
+	var history *MissionControlHistory
+	err := d.View(func(tx *bolt.Tx) error {
+		history = &MissionControlHistory{
+			FailedEdges:        make(map[FailedEdge]time.Time),
+			FailedVertexes:     make(map[[33]byte]time.Time),
+			PersistentVertexes: make(map[[33]byte]time.Time),
+			Blacklist:          make(map[[33]byte]struct{}),
+			FailedEdgeAmts:     make(map[FailedEdge]EdgeAmtFailure),
+		}
+
+		mcBucket := tx.Bucket(missionControlBucket)
+		if mcBucket == nil {
+			return nil
+		}
+
+		if edges := mcBucket.Bucket(mcFailedEdgesBucket); edges != nil {
+			err := edges.ForEach(func(k, v []byte) error {
+				if (len(k) != 8 && len(k) != 8+33) || len(v) != 8 {
+					return ErrCorruptedMissionControl
+				}
+
+				var edge FailedEdge
+				edge.ChannelID = byteOrder.Uint64(k[:8])
+				copy(edge.ToNode[:], k[8:])
+				history.FailedEdges[edge] = readPruneTime(v)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		err := readVertexPruneTimes(
+			mcBucket.Bucket(mcFailedVertexesBucket),
+			history.FailedVertexes,
+		)
+		if err != nil {
+			return err
+		}
+		err = readVertexPruneTimes(
+			mcBucket.Bucket(mcPersistentVertexesBucket),
+			history.PersistentVertexes,
+		)
+		if err != nil {
+			return err
+		}
+
+		if blacklist := mcBucket.Bucket(mcBlacklistBucket); blacklist != nil {
+			err := blacklist.ForEach(func(k, _ []byte) error {
+				if len(k) != 33 {
+					return ErrCorruptedMissionControl
+				}
+
+				var pubKey [33]byte
+				copy(pubKey[:], k)
+				history.Blacklist[pubKey] = struct{}{}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		edgeAmts := mcBucket.Bucket(mcFailedEdgeAmtsBucket)
+		if edgeAmts == nil {
+			return nil
+		}
+		return edgeAmts.ForEach(func(k, v []byte) error {
+			if (len(k) != 8 && len(k) != 8+33) || len(v) != 16 {
+				return ErrCorruptedMissionControl
+			}
+
+			var edge FailedEdge
+			edge.ChannelID = byteOrder.Uint64(k[:8])
+			copy(edge.ToNode[:], k[8:])
+			history.FailedEdgeAmts[edge] = EdgeAmtFailure{
+				Amt:    btcutil.Amount(byteOrder.Uint64(v[:8])),
+				Expiry: readPruneTime(v[8:]),
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return history, nil
+}
+
+// putVertexPruneTimes creates the named bucket within the mission control
+// bucket, and stores the passed prune time of each vertex within it.
+func putVertexPruneTimes(mcBucket *bolt.Bucket, bucketName []byte,
+	vertexes map[[33]byte]time.Time) error {
+
+	bucket, err := mcBucket.CreateBucket(bucketName)
+	if err != nil {
+		return err
+	}
+
+	for pubKey, pruneTime := range vertexes {
+		if err := putPruneTime(bucket, pubKey[:], pruneTime); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readVertexPruneTimes reads the prune time of each vertex stored within the
+// passed bucket by putVertexPruneTimes into the vertexes map. If the bucket is
+// nil, then no prune times are read.
+func readVertexPruneTimes(bucket *bolt.Bucket,
+	vertexes map[[33]byte]time.Time) error {
+
+	if bucket == nil {
+		return nil
+	}
+
+	return bucket.ForEach(func(k, v []byte) error {
+		if len(k) != 33 || len(v) != 8 {
+			return ErrCorruptedMissionControl
+		}
+
+		var pubKey [33]byte
+		copy(pubKey[:], k)
+		vertexes[pubKey] = readPruneTime(v)
+		return nil
+	})
+}
+
+// putPruneTime stores the passed prune time, or expiry, under the target key,
+// as the number of nano seconds since the unix epoch.
+func putPruneTime(bucket *bolt.Bucket, k []byte, pruneTime time.Time) error {
+	var v [8]byte
+	byteOrder.PutUint64(v[:], uint64(pruneTime.UnixNano()))
+	return bucket.Put(k, v[:])
+}
+
+// readPruneTime reads a prune time stored by putPruneTime.
+func readPruneTime(v []byte) time.Time {
+	return time.Unix(0, int64(byteOrder.Uint64(v)))
+}
@@ -0,0 +1,159 @@
+package channeldb
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+
+	"github.com/coreos/bbolt"
+)
+
+// DBStats summarizes the size and contents of the database, allowing the
+// health of the database to be monitored.
+type DBStats struct {
+	// FileSize is the size of the database file on disk in bytes.
+	FileSize int64
+
+	// TxStats holds the transaction and page statistics of the underlying
+	// bolt database.
+	TxStats bolt.Stats
+
+	// BucketKeys maps the name of each top-level bucket to the total
+	// number of keys within it, including those within nested buckets.
+	BucketKeys map[string]int
+
+	// NumOpenChannels is the number of open channels.
+	NumOpenChannels int
+
+	// NumClosedChannels is the number of closed channels, including those
+	// which are still pending close.
+	NumClosedChannels int
+
+	// NumInvoices is the number of invoices.
+	NumInvoices int
+
+	// NumNodes is the number of nodes within the channel graph.
+	NumNodes int
+}
+
+// Stats returns a summary of the size and contents of the database. The
+// counts are gathered within a single read transaction without decoding any
+// of the records, so this is cheap enough to be called periodically.
+func (d *DB) Stats() (*DBStats, error) {
+	info, err := os.Stat(filepath.Join(d.dbPath, dbName))
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &DBStats{
+		FileSize:   info.Size(),
+		TxStats:    d.DB.Stats(),
+		BucketKeys: make(map[string]int),
+	}
+
+	err = d.View(func(tx *bolt.Tx) error {
+		err := tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			stats.BucketKeys[string(name)] = b.Stats().KeyN
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		stats.NumOpenChannels, err = countOpenChannels(tx)
+		if err != nil {
+			return err
+		}
+
+		closedChans := tx.Bucket(closedChannelBucket)
+		if closedChans != nil {
+			// Each closed channel summary is nested within the
+			// bucket of the node the channel was with.
+			err := closedChans.ForEach(func(nodeID, v []byte) error {
+				nodeBucket := closedChans.Bucket(nodeID)
+				if nodeBucket == nil {
+					return nil
+				}
+
+				stats.NumClosedChannels += nodeBucket.Stats().KeyN
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		if invoices := tx.Bucket(invoiceBucket); invoices != nil {
+			// Only the top-level keys with a value are invoices,
+			// the remainder being nested index buckets.
+			err := invoices.ForEach(func(k, v []byte) error {
+				if v != nil {
+					stats.NumInvoices++
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		if nodes := tx.Bucket(nodeBucket); nodes != nil {
+			// Nodes are keyed by their public key, alongside the
+			// source key and nested index buckets.
+			err := nodes.ForEach(func(k, v []byte) error {
+				if v != nil && len(k) == 33 &&
+					!bytes.Equal(k, sourceKey) {
+
+					stats.NumNodes++
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// countOpenChannels returns the number of open channels within the database,
+// by counting the channel buckets nested within each node and chain bucket.
+func countOpenChannels(tx *bolt.Tx) (int, error) {
+	openChanBucket := tx.Bucket(openChannelBucket)
+	if openChanBucket == nil {
+		return 0, nil
+	}
+
+	var numChannels int
+	err := openChanBucket.ForEach(func(nodePub, v []byte) error {
+		nodeChanBucket := openChanBucket.Bucket(nodePub)
+		if nodeChanBucket == nil {
+			return nil
+		}
+
+		return nodeChanBucket.ForEach(func(chainHash, v []byte) error {
+			chainBucket := nodeChanBucket.Bucket(chainHash)
+			if chainBucket == nil {
+				return nil
+			}
+
+			return chainBucket.ForEach(func(chanPoint, v []byte) error {
+				if v == nil {
+					numChannels++
+				}
+				return nil
+			})
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return numChannels, nil
+}
@@ -0,0 +1,69 @@
+package channeldb
+
+import (
+	"testing"
+)
+
+// TestDBStats tests that the statistics reported for the database reflect its
+// contents.
+func TestDBStats(t *testing.T) {
+	t.Parallel()
+
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to make test database: %v", err)
+	}
+	defer cleanUp()
+
+	const (
+		numChannels = 3
+		numInvoices = 2
+	)
+	for i := 0; i < numChannels; i++ {
+		channel, err := createTestChannelState(cdb)
+		if err != nil {
+			t.Fatalf("unable to create channel state: %v", err)
+		}
+		channel.FundingOutpoint.Index = uint32(i)
+		if err := channel.FullSync(); err != nil {
+			t.Fatalf("unable to save and serialize channel "+
+				"state: %v", err)
+		}
+	}
+	for i := 0; i < numInvoices; i++ {
+		invoice, err := randInvoice(1000)
+		if err != nil {
+			t.Fatalf("unable to create invoice: %v", err)
+		}
+		if err := cdb.AddInvoice(invoice); err != nil {
+			t.Fatalf("unable to add invoice: %v", err)
+		}
+	}
+
+	stats, err := cdb.Stats()
+	if err != nil {
+		t.Fatalf("unable to fetch stats: %v", err)
+	}
+
+	if stats.FileSize == 0 {
+		t.Fatalf("expected non-zero file size")
+	}
+	if stats.NumOpenChannels != numChannels {
+		t.Fatalf("expected %v open channels, got %v", numChannels,
+			stats.NumOpenChannels)
+	}
+	if stats.NumClosedChannels != 0 {
+		t.Fatalf("expected no closed channels, got %v",
+			stats.NumClosedChannels)
+	}
+	if stats.NumInvoices != numInvoices {
+		t.Fatalf("expected %v invoices, got %v", numInvoices,
+			stats.NumInvoices)
+	}
+	if stats.NumNodes != 0 {
+		t.Fatalf("expected no nodes, got %v", stats.NumNodes)
+	}
+	if stats.BucketKeys[string(openChannelBucket)] == 0 {
+		t.Fatalf("expected keys within open channel bucket")
+	}
+}
@@ -481,9 +481,7 @@ func (f *fundingManager) Start() error {
 		// already broadcast this transaction. Otherwise, we simply log
 		// the error as there isn't anything we can currently do to
 		// recover.
-		if channel.ChanType == channeldb.SingleFunder &&
-			channel.IsInitiator {
-
+		if channel.ChanType.IsSingleFunder() && channel.IsInitiator {
 			err := f.cfg.PublishTransaction(channel.FundingTxn)
 			if err != nil && err != lnwallet.ErrDoubleSpend {
 				fndgLog.Warnf("unable to rebroadcast funding "+
@@ -1535,6 +1535,13 @@ func (l *channelLink) ChanID() lnwire.ChannelID {
 // be used by callers when making forwarding decisions to determine if a link
 // can accept an HTLC.
 //
+// NOTE: The bandwidth isn't cached or persisted by the link. Instead it's
+// computed from the channel's update logs, which are restored from disk along
+// with any un-acked updates on restart, so in-flight HTLCs are accounted for
+// immediately after a restart. HTLCs only held in the overflow queue are
+// re-forwarded from their forwarding packages, so they don't need to be
+// reserved across restarts either.
+//
 // NOTE: Part of the ChannelLink interface.
 func (l *channelLink) Bandwidth() lnwire.MilliSatoshi {
 	channelBandwidth := l.channel.AvailableBalance()
@@ -36,6 +36,10 @@ var (
 	// txn.
 	ErrIncompleteForward = errors.Errorf("incomplete forward detected")
 
+	// ErrSwitchDraining is returned when a new htlc is sent through the
+	// switch after it has begun draining all of its links.
+	ErrSwitchDraining = errors.New("htlc switch is draining links")
+
 	// zeroPreimage is the empty preimage which is returned when we have
 	// some errors.
 	zeroPreimage [sha256.Size]byte
@@ -135,8 +139,26 @@ type Config struct {
 	// error encrypters stored in the circuit map on restarts, since they
 	// are not stored directly within the database.
 	ExtractErrorEncrypter ErrorEncrypterExtracter
+
+	// NumForwardWorkers is the number of goroutines that will concurrently
+	// process packets sent to the switch for forwarding. This includes
+	// setting up and tearing down circuits, and obfuscating any failures.
+	// Packets are sharded amongst the workers by their outgoing short
+	// channel ID, such that the packets destined for, or returning from,
+	// any one link are always handled by the same worker, in order. If
+	// zero, DefaultNumForwardWorkers will be used.
+	NumForwardWorkers int
 }
 
+// DefaultNumForwardWorkers is the default number of goroutines used by the
+// switch to process forwarded packets.
+const DefaultNumForwardWorkers = 1
+
+// forwardWorkerQueueSize is the number of packets that may be queued for each
+// forwarding worker, allowing packets for other workers to be dispatched while
+// a worker is busy.
+const forwardWorkerQueueSize = 50
+
 // Switch is the central messaging bus for all incoming/outgoing HTLCs.
 // Connected peers with active channels are treated as named interfaces which
 // refer to active channels as links. A link is the switch's message
@@ -148,6 +170,7 @@ type Config struct {
 type Switch struct {
 	started  int32
 	shutdown int32
+	draining int32
 	wg       sync.WaitGroup
 	quit     chan struct{}
 
@@ -168,6 +191,12 @@ type Switch struct {
 	// forward the settle/fail htlc updates back to the add htlc initiator.
 	circuits CircuitMap
 
+	// indexMtx is a read/write mutex that protects the link indexes below.
+	// The indexes are only ever modified by the htlcForwarder goroutine,
+	// so it may read them without holding the mutex, but the forwarding
+	// workers must hold a read lock.
+	indexMtx sync.RWMutex
+
 	// links is a map of channel id and channel link which manages
 	// this channel.
 	linkIndex map[lnwire.ChannelID]ChannelLink
@@ -195,9 +224,15 @@ type Switch struct {
 	// the setup/teardown of Sphinx (onion routing) payment circuits.
 	// Active links forward any add/settle messages over this channel each
 	// state transition, sending new adds/settles which are fully locked
-	// in.
+	// in. Packets sent over this channel are dispatched to the pool of
+	// forwarding workers.
 	htlcPlex chan *plexPacket
 
+	// workerPlexes holds the queue of packets for each forwarding worker.
+	// Packets are dispatched from htlcPlex to the worker queue selected by
+	// their outgoing short channel ID.
+	workerPlexes []chan *plexPacket
+
 	// chanCloseRequests is used to transfer the channel close request to
 	// the channel close handler.
 	chanCloseRequests chan *ChanClose
@@ -232,6 +267,10 @@ func New(cfg Config) (*Switch, error) {
 		return nil, err
 	}
 
+	if cfg.NumForwardWorkers <= 0 {
+		cfg.NumForwardWorkers = DefaultNumForwardWorkers
+	}
+
 	return &Switch{
 		cfg:               &cfg,
 		circuits:          circuitMap,
@@ -290,6 +329,12 @@ func (s *Switch) ProcessContractResolution(msg contractcourt.ResolutionMsg) erro
 func (s *Switch) SendHTLC(nextNode [33]byte, htlc *lnwire.UpdateAddHTLC,
 	deobfuscator ErrorDecrypter) ([sha256.Size]byte, error) {
 
+	// If we're draining our links in preparation for shutdown, then we
+	// won't accept any new payments.
+	if atomic.LoadInt32(&s.draining) == 1 {
+		return zeroPreimage, ErrSwitchDraining
+	}
+
 	// Create payment and add to the map of payment in order later to be
 	// able to retrieve it and return response to the user.
 	payment := &pendingPayment{
@@ -880,6 +925,14 @@ func (s *Switch) handlePacketForward(packet *htlcPacket) error {
 			return s.handleLocalDispatch(packet)
 		}
 
+		// If we're draining our links, then we'll refuse to forward
+		// any new htlcs, and instead fail them back to the incoming
+		// link.
+		if atomic.LoadInt32(&s.draining) == 1 {
+			failure := lnwire.NewTemporaryChannelFailure(nil)
+			return s.failAddPacket(packet, failure, ErrSwitchDraining)
+		}
+
 		targetLink, err := s.getLinkByShortID(packet.outgoingChanID)
 		if err != nil {
 			// If packet was forwarded from another channel link
@@ -1329,12 +1382,6 @@ func (s *Switch) htlcForwarder() {
 			// With the message processed, we'll now close out
 			close(resolutionMsg.doneChan)
 
-		// A new packet has arrived for forwarding, we'll interpret the
-		// packet concretely, then either forward it along, or
-		// interpret a return packet to a locally initialized one.
-		case cmd := <-s.htlcPlex:
-			cmd.err <- s.handlePacketForward(cmd.pkt)
-
 		// When this time ticks, then it indicates that we should
 		// collect all the forwarding events since the last internal,
 		// and write them out to our log.
@@ -1441,6 +1488,56 @@ func (s *Switch) htlcForwarder() {
 	}
 }
 
+// forwardDispatcher is a goroutine that hands each packet sent to the switch
+// for forwarding to the queue of a forwarding worker. The worker is selected
+// by the packet's outgoing short channel ID, so all packets of a link are
+// handled by one worker in the order they were sent to the switch.
+//
+// NOTE: This MUST be run as a goroutine.
+func (s *Switch) forwardDispatcher() {
+	defer s.wg.Done()
+
+	numWorkers := uint64(len(s.workerPlexes))
+	for {
+		select {
+		case cmd := <-s.htlcPlex:
+			shard := cmd.pkt.outgoingChanID.ToUint64() % numWorkers
+
+			select {
+			case s.workerPlexes[shard] <- cmd:
+			case <-s.quit:
+				return
+			}
+
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// forwardWorker is a goroutine that handles the packets dispatched to its
+// queue for forwarding. Several of these may be running concurrently, so any
+// state shared between links and accessed while handling a packet must be
+// safe for concurrent use.
+//
+// NOTE: This MUST be run as a goroutine.
+func (s *Switch) forwardWorker(queue <-chan *plexPacket) {
+	defer s.wg.Done()
+
+	for {
+		select {
+		// A new packet has arrived for forwarding, we'll interpret the
+		// packet concretely, then either forward it along, or
+		// interpret a return packet to a locally initialized one.
+		case cmd := <-queue:
+			cmd.err <- s.handlePacketForward(cmd.pkt)
+
+		case <-s.quit:
+			return
+		}
+	}
+}
+
 // Start starts all helper goroutines required for the operation of the switch.
 func (s *Switch) Start() error {
 	if !atomic.CompareAndSwapInt32(&s.started, 0, 1) {
@@ -1453,6 +1550,18 @@ func (s *Switch) Start() error {
 	s.wg.Add(1)
 	go s.htlcForwarder()
 
+	s.workerPlexes = make([]chan *plexPacket, s.cfg.NumForwardWorkers)
+	s.wg.Add(s.cfg.NumForwardWorkers)
+	for i := range s.workerPlexes {
+		s.workerPlexes[i] = make(
+			chan *plexPacket, forwardWorkerQueueSize,
+		)
+		go s.forwardWorker(s.workerPlexes[i])
+	}
+
+	s.wg.Add(1)
+	go s.forwardDispatcher()
+
 	if err := s.reforwardResponses(); err != nil {
 		s.Stop()
 		log.Errorf("unable to reforward responses: %v", err)
@@ -1623,6 +1732,49 @@ func (s *Switch) Stop() error {
 	return nil
 }
 
+// DrainAllLinks stops the switch from forwarding any new htlcs over any of its
+// links, then waits up to the passed timeout for all active circuits to be
+// settled or failed. This allows the forwarding plane to be quiesced before
+// the switch, and the database backing it, are shut down. If any circuits are
+// still active once the timeout expires, then an error reporting them is
+// returned.
+//
+// NOTE: Once called, the switch will no longer forward new htlcs, even if the
+// drain times out.
+func (s *Switch) DrainAllLinks(timeout time.Duration) error {
+	atomic.StoreInt32(&s.draining, 1)
+
+	log.Infof("Draining all links, waiting up to %v for %v active "+
+		"circuits", timeout, s.NumActiveCircuits())
+
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	deadline := time.After(timeout)
+	for {
+		numActive := s.NumActiveCircuits()
+		if numActive == 0 {
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-deadline:
+			return fmt.Errorf("unable to drain links within %v: "+
+				"%v circuits still active (%v open)", timeout,
+				numActive, s.circuits.NumOpen())
+		case <-s.quit:
+			return errors.New("htlc switch shutting down")
+		}
+	}
+}
+
+// NumActiveCircuits returns the number of circuits that have been committed
+// to the switch's circuit map, but have yet to be settled or failed.
+func (s *Switch) NumActiveCircuits() int {
+	return s.circuits.NumPending()
+}
+
 // addLinkCmd is a add link command wrapper, it is used to propagate handler
 // parameters and return handler error.
 type addLinkCmd struct {
@@ -1660,6 +1812,7 @@ func (s *Switch) addLink(link ChannelLink) error {
 	// up a channel when we need to close or register it, and the
 	// forwarding index which'll be used when forwarding HTLC's in the
 	// multi-hop setting.
+	s.indexMtx.Lock()
 	s.linkIndex[link.ChanID()] = link
 	s.forwardingIndex[link.ShortChanID()] = link
 
@@ -1670,6 +1823,7 @@ func (s *Switch) addLink(link ChannelLink) error {
 		s.interfaceIndex[peerPub] = make(map[ChannelLink]struct{})
 	}
 	s.interfaceIndex[peerPub][link] = struct{}{}
+	s.indexMtx.Unlock()
 
 	// Get the mailbox for this link, which buffers packets in case there
 	// packets that we tried to deliver while this link was offline.
@@ -1768,6 +1922,9 @@ func (s *Switch) getLink(chanID lnwire.ChannelID) (ChannelLink, error) {
 // getLinkByShortID attempts to return the link which possesses the target
 // short channel ID.
 func (s *Switch) getLinkByShortID(chanID lnwire.ShortChannelID) (ChannelLink, error) {
+	s.indexMtx.RLock()
+	defer s.indexMtx.RUnlock()
+
 	link, ok := s.forwardingIndex[chanID]
 	if !ok {
 		return nil, ErrChannelLinkNotFound
@@ -1814,12 +1971,14 @@ func (s *Switch) removeLink(chanID lnwire.ChannelID) error {
 	}
 
 	// Remove the channel from channel map.
+	s.indexMtx.Lock()
 	delete(s.linkIndex, chanID)
 	delete(s.forwardingIndex, link.ShortChanID())
 
 	// Remove the channel from channel index.
 	peerPub := link.Peer().PubKey()
 	delete(s.interfaceIndex, peerPub)
+	s.indexMtx.Unlock()
 
 	link.Stop()
 
@@ -1878,7 +2037,9 @@ func (s *Switch) updateShortChanID(chanID lnwire.ChannelID,
 
 	// At this point the link is actually active, so we'll update the
 	// forwarding index with the next short channel ID.
+	s.indexMtx.Lock()
 	s.forwardingIndex[shortChanID] = link
+	s.indexMtx.Unlock()
 
 	// Finally, we'll notify the link of its new short channel ID.
 	link.UpdateShortChanID(shortChanID)
@@ -1928,6 +2089,9 @@ query:
 // getLinks is function which returns the channel links of the peer by hop
 // destination id.
 func (s *Switch) getLinks(destination [33]byte) ([]ChannelLink, error) {
+	s.indexMtx.RLock()
+	defer s.indexMtx.RUnlock()
+
 	links, ok := s.interfaceIndex[destination]
 	if !ok {
 		return nil, errors.Errorf("unable to locate channel link by "+
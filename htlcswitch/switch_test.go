@@ -3,8 +3,10 @@ package htlcswitch
 import (
 	"crypto/rand"
 	"crypto/sha256"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -1778,3 +1780,312 @@ func TestMultiHopPaymentForwardingEvents(t *testing.T) {
 		}
 	}
 }
+
+// TestSwitchDrainAllLinks tests that once the switch begins draining its
+// links, new htlcs are rejected, and that the drain only completes once all
+// active circuits have been resolved.
+func TestSwitchDrainAllLinks(t *testing.T) {
+	t.Parallel()
+
+	alicePeer, err := newMockServer(t, "alice", nil)
+	if err != nil {
+		t.Fatalf("unable to create alice server: %v", err)
+	}
+	bobPeer, err := newMockServer(t, "bob", nil)
+	if err != nil {
+		t.Fatalf("unable to create bob server: %v", err)
+	}
+
+	s, err := initSwitchWithDB(nil)
+	if err != nil {
+		t.Fatalf("unable to init switch: %v", err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatalf("unable to start switch: %v", err)
+	}
+	defer s.Stop()
+
+	chanID1, chanID2, aliceChanID, bobChanID := genIDs()
+
+	aliceChannelLink := newMockChannelLink(
+		s, chanID1, aliceChanID, alicePeer, true,
+	)
+	bobChannelLink := newMockChannelLink(
+		s, chanID2, bobChanID, bobPeer, true,
+	)
+	if err := s.AddLink(aliceChannelLink); err != nil {
+		t.Fatalf("unable to add alice link: %v", err)
+	}
+	if err := s.AddLink(bobChannelLink); err != nil {
+		t.Fatalf("unable to add bob link: %v", err)
+	}
+
+	// First, we'll forward an htlc from Alice to Bob before draining, so
+	// that there's a single active circuit within the switch.
+	preimage, err := genPreimage()
+	if err != nil {
+		t.Fatalf("unable to generate preimage: %v", err)
+	}
+	rhash := fastsha256.Sum256(preimage[:])
+	packet := &htlcPacket{
+		incomingChanID: aliceChannelLink.ShortChanID(),
+		incomingHTLCID: 0,
+		outgoingChanID: bobChannelLink.ShortChanID(),
+		obfuscator:     NewMockObfuscator(),
+		htlc: &lnwire.UpdateAddHTLC{
+			PaymentHash: rhash,
+			Amount:      1,
+		},
+	}
+	if err := s.forward(packet); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-bobChannelLink.packets:
+		if err := bobChannelLink.completeCircuit(packet); err != nil {
+			t.Fatalf("unable to complete payment circuit: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("request was not propagated to destination")
+	}
+
+	// As the circuit is still active, the drain should time out.
+	if err := s.DrainAllLinks(100 * time.Millisecond); err == nil {
+		t.Fatalf("drain should time out with active circuit")
+	}
+	if s.NumActiveCircuits() != 1 {
+		t.Fatalf("expected 1 active circuit, got %v",
+			s.NumActiveCircuits())
+	}
+
+	// Now that the switch is draining, a new htlc from Alice should be
+	// failed back to her rather than forwarded to Bob.
+	packet2 := &htlcPacket{
+		incomingChanID: aliceChannelLink.ShortChanID(),
+		incomingHTLCID: 1,
+		outgoingChanID: bobChannelLink.ShortChanID(),
+		obfuscator:     NewMockObfuscator(),
+		htlc: &lnwire.UpdateAddHTLC{
+			PaymentHash: rhash,
+			Amount:      1,
+		},
+	}
+	if err := s.forward(packet2); err != ErrSwitchDraining {
+		t.Fatalf("expected ErrSwitchDraining, got %v", err)
+	}
+
+	select {
+	case pkt := <-aliceChannelLink.packets:
+		if _, ok := pkt.htlc.(*lnwire.UpdateFailHTLC); !ok {
+			t.Fatalf("expected fail htlc, got %T", pkt.htlc)
+		}
+		if err := aliceChannelLink.deleteCircuit(pkt); err != nil {
+			t.Fatalf("unable to remove circuit: %v", err)
+		}
+	case <-bobChannelLink.packets:
+		t.Fatalf("htlc forwarded while draining")
+	case <-time.After(time.Second):
+		t.Fatal("fail was not propagated to source")
+	}
+
+	// Locally initiated payments should also be rejected.
+	addMsg := &lnwire.UpdateAddHTLC{
+		PaymentHash: rhash,
+		Amount:      1,
+	}
+	_, err = s.SendHTLC(bobChannelLink.Peer().PubKey(), addMsg, nil)
+	if err != ErrSwitchDraining {
+		t.Fatalf("expected ErrSwitchDraining, got %v", err)
+	}
+
+	// Finally, we'll settle the original htlc, after which the drain
+	// should complete.
+	packet = &htlcPacket{
+		outgoingChanID: bobChannelLink.ShortChanID(),
+		outgoingHTLCID: 0,
+		amount:         1,
+		htlc: &lnwire.UpdateFulfillHTLC{
+			PaymentPreimage: preimage,
+		},
+	}
+	if err := s.forward(packet); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case pkt := <-aliceChannelLink.packets:
+		if err := aliceChannelLink.deleteCircuit(pkt); err != nil {
+			t.Fatalf("unable to remove circuit: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("request was not propagated to channelPoint")
+	}
+
+	if err := s.DrainAllLinks(time.Second); err != nil {
+		t.Fatalf("unable to drain links: %v", err)
+	}
+}
+
+// TestSwitchForwardWorkersOrdering tests that with several forwarding
+// workers, the packets destined for a link are still handed off to it in the
+// order they were sent to the switch.
+func TestSwitchForwardWorkersOrdering(t *testing.T) {
+	t.Parallel()
+
+	alicePeer, err := newMockServer(t, "alice", nil)
+	if err != nil {
+		t.Fatalf("unable to create alice server: %v", err)
+	}
+	bobPeer, err := newMockServer(t, "bob", nil)
+	if err != nil {
+		t.Fatalf("unable to create bob server: %v", err)
+	}
+
+	s, err := initSwitchWithDB(nil)
+	if err != nil {
+		t.Fatalf("unable to init switch: %v", err)
+	}
+	s.cfg.NumForwardWorkers = 4
+	if err := s.Start(); err != nil {
+		t.Fatalf("unable to start switch: %v", err)
+	}
+	defer s.Stop()
+
+	chanID1, chanID2, aliceChanID, bobChanID := genIDs()
+
+	aliceChannelLink := newMockChannelLink(
+		s, chanID1, aliceChanID, alicePeer, true,
+	)
+	bobChannelLink := newMockChannelLink(
+		s, chanID2, bobChanID, bobPeer, true,
+	)
+	if err := s.AddLink(aliceChannelLink); err != nil {
+		t.Fatalf("unable to add alice link: %v", err)
+	}
+	if err := s.AddLink(bobChannelLink); err != nil {
+		t.Fatalf("unable to add bob link: %v", err)
+	}
+
+	// We'll route a series of adds from alice to bob, without waiting for
+	// each to be handled.
+	const numPackets = 100
+	errChan := make(chan error, numPackets)
+	for i := uint64(0); i < numPackets; i++ {
+		packet := &htlcPacket{
+			incomingChanID: aliceChannelLink.ShortChanID(),
+			incomingHTLCID: i,
+			outgoingChanID: bobChannelLink.ShortChanID(),
+			obfuscator:     NewMockObfuscator(),
+			htlc: &lnwire.UpdateAddHTLC{
+				Amount: 1,
+			},
+		}
+		if err := s.routeAsync(packet, errChan); err != nil {
+			t.Fatalf("unable to route packet: %v", err)
+		}
+	}
+
+	// Bob should receive every add in the order they were routed.
+	for i := uint64(0); i < numPackets; i++ {
+		select {
+		case pkt := <-bobChannelLink.packets:
+			if pkt.incomingHTLCID != i {
+				t.Fatalf("expected packet %v, got %v", i,
+					pkt.incomingHTLCID)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("packet %v was not forwarded", i)
+		}
+	}
+}
+
+// BenchmarkSwitchForwardWorkers measures the throughput of the switch when
+// forwarding add packets between two links concurrently, using a varying
+// number of forwarding workers. As packets are sharded amongst the workers by
+// their outgoing link, all of these packets are handled by a single worker,
+// so this measures the overhead of dispatching them.
+func BenchmarkSwitchForwardWorkers(b *testing.B) {
+	for _, numWorkers := range []int{1, 2, 4, 8} {
+		numWorkers := numWorkers
+		b.Run(fmt.Sprintf("workers=%d", numWorkers), func(b *testing.B) {
+			benchmarkSwitchForward(b, numWorkers)
+		})
+	}
+}
+
+func benchmarkSwitchForward(b *testing.B, numWorkers int) {
+	alicePeer, err := newMockServer(b, "alice", nil)
+	if err != nil {
+		b.Fatalf("unable to create alice server: %v", err)
+	}
+	bobPeer, err := newMockServer(b, "bob", nil)
+	if err != nil {
+		b.Fatalf("unable to create bob server: %v", err)
+	}
+
+	s, err := initSwitchWithDB(nil)
+	if err != nil {
+		b.Fatalf("unable to init switch: %v", err)
+	}
+	s.cfg.NumForwardWorkers = numWorkers
+	if err := s.Start(); err != nil {
+		b.Fatalf("unable to start switch: %v", err)
+	}
+	defer s.Stop()
+
+	chanID1, chanID2, aliceChanID, bobChanID := genIDs()
+
+	aliceChannelLink := newMockChannelLink(
+		s, chanID1, aliceChanID, alicePeer, true,
+	)
+	bobChannelLink := newMockChannelLink(
+		s, chanID2, bobChanID, bobPeer, true,
+	)
+	if err := s.AddLink(aliceChannelLink); err != nil {
+		b.Fatalf("unable to add alice link: %v", err)
+	}
+	if err := s.AddLink(bobChannelLink); err != nil {
+		b.Fatalf("unable to add bob link: %v", err)
+	}
+
+	// Drain all packets delivered to Bob so that his mailbox doesn't grow
+	// unbounded during the benchmark.
+	quit := make(chan struct{})
+	defer close(quit)
+	go func() {
+		for {
+			select {
+			case <-bobChannelLink.packets:
+			case <-quit:
+				return
+			}
+		}
+	}()
+
+	var htlcID uint64
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	// We route the packets directly, as opposed to forwarding them, so
+	// that we only measure the work done by the forwarding workers, and
+	// not the cost of committing each circuit to disk.
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			packet := &htlcPacket{
+				incomingChanID: aliceChannelLink.ShortChanID(),
+				incomingHTLCID: atomic.AddUint64(&htlcID, 1),
+				outgoingChanID: bobChannelLink.ShortChanID(),
+				obfuscator:     NewMockObfuscator(),
+				htlc: &lnwire.UpdateAddHTLC{
+					Amount: 1,
+				},
+			}
+			if err := s.route(packet); err != nil {
+				b.Errorf("unable to route packet: %v", err)
+				return
+			}
+		}
+	})
+}
@@ -2,13 +2,17 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"math"
 
 	"github.com/coreos/bbolt"
 	"github.com/lightningnetwork/lnd/channeldb"
+	"github.com/lightningnetwork/lnd/lnwallet"
 	"github.com/roasbeef/btcd/chaincfg/chainhash"
 	"github.com/roasbeef/btcd/wire"
+	"github.com/roasbeef/btcutil"
 )
 
 //	              Overview of Nursery Store Storage Hierarchy
@@ -99,7 +103,9 @@ type NurseryStore interface {
 	// our commitment transaction, or a commitment output), and a slice of
 	// outgoing htlc outputs to be swept back into the user's wallet. The
 	// event is persisted to disk, such that the nursery can resume the
-	// incubation process after a potential crash.
+	// incubation process after a potential crash. All outputs are written
+	// within a single database transaction, so either every output is
+	// incubated, or none of them are.
 	Incubate([]kidOutput, []babyOutput) error
 
 	// CribToKinder atomically moves a babyOutput in the crib bucket to the
@@ -116,6 +122,16 @@ type NurseryStore interface {
 	// our commitment outputs fall into this class.
 	PreschoolToKinder(*kidOutput) error
 
+	// BumpKinderFee records a new sweep fee rate for a kindergarten
+	// output, and increments its broadcast attempts. The provided
+	// kidOutput is updated to reflect the persisted values.
+	BumpKinderFee(kid *kidOutput, newFeeRate btcutil.Amount) error
+
+	// RelocateKinder corrects the confirmation height of a kindergarten
+	// output, moving its entry in the height index to the maturity height
+	// computed from the new confirmation height.
+	RelocateKinder(kid *kidOutput, newConfHeight uint32) error
+
 	// GraduateKinder atomically moves the kindergarten class at the
 	// provided height into the graduated status. This involves removing the
 	// kindergarten entries from both the height and channel indexes, and
@@ -124,22 +140,83 @@ type NurseryStore interface {
 	// removed.
 	GraduateKinder(height uint32) error
 
+	// GraduateKinderWithSweep graduates the kindergarten class at the
+	// provided height, additionally recording the graduated outpoints
+	// under the txid of the transaction that swept them.
+	GraduateKinderWithSweep(height uint32,
+		sweepTxid chainhash.Hash) ([]wire.OutPoint, error)
+
+	// FetchSweepOutputs returns the outpoints swept by the transaction
+	// with the given txid, as recorded by GraduateKinderWithSweep.
+	FetchSweepOutputs(txid chainhash.Hash) ([]wire.OutPoint, error)
+
+	// RewindToHeight moves all kindergarten outputs confirmed at or above
+	// the provided height back into the preschool bucket, removing their
+	// entries from the height index. This should be called after a reorg
+	// has invalidated the confirmation of their transactions.
+	RewindToHeight(height uint32) error
+
 	// FetchPreschools returns a list of all outputs currently stored in
 	// the preschool bucket.
 	FetchPreschools() ([]kidOutput, error)
 
+	// FetchPreschoolsContext returns a list of all outputs currently
+	// stored in the preschool bucket, aborting the scan with the
+	// context's error if it is cancelled.
+	FetchPreschoolsContext(ctx context.Context) ([]kidOutput, error)
+
 	// FetchClass returns a list of kindergarten and crib outputs whose
 	// timelocks expire at the given height. If the kindergarten class at
 	// this height hash been finalized previously, via FinalizeKinder, it
-	// will also returns the finalized kindergarten sweep txn.
+	// will also returns the finalized kindergarten sweep txn. Each
+	// kindergarten output reports its origin via kidOutput.Origin.
 	FetchClass(height uint32) (*wire.MsgTx, []kidOutput, []babyOutput, error)
 
+	// ForEachKindergarten passes each kindergarten output maturing at the
+	// given height to the provided callback, aborting if the callback
+	// returns an error. The callback must not retain the kidOutput beyond
+	// the call.
+	ForEachKindergarten(height uint32, cb func(*kidOutput) error) error
+
+	// ForEachCrib passes each crib output expiring at the given height to
+	// the provided callback, aborting if the callback returns an error.
+	// The callback must not retain the babyOutput beyond the call.
+	ForEachCrib(height uint32, cb func(*babyOutput) error) error
+
+	// FetchKindergartensByChannel returns the kindergarten outputs
+	// maturing at the given height, grouped by their origin channel point.
+	FetchKindergartensByChannel(
+		height uint32) (map[wire.OutPoint][]kidOutput, error)
+
+	// FetchKindergartensRange returns all kindergarten outputs whose
+	// maturity height falls within the inclusive range [fromHeight,
+	// toHeight]. The outputs are returned in order of maturity height,
+	// and are deduplicated by outpoint.
+	FetchKindergartensRange(fromHeight, toHeight uint32) ([]kidOutput, error)
+
+	// FetchOutputsConfirmedAt returns all kindergarten outputs whose
+	// transaction confirmed at the provided height.
+	FetchOutputsConfirmedAt(height uint32) ([]kidOutput, error)
+
 	// FinalizeKinder accepts a block height and the kindergarten sweep txn
 	// computed for this height. Upon startup, we will rebroadcast any
 	// finalized kindergarten txns instead of signing a new txn, as this
 	// result in a different txid from a preceding broadcast.
 	FinalizeKinder(height uint32, tx *wire.MsgTx) error
 
+	// FinalizeKinderAt finalizes the kindergarten class at the height
+	// lagging the provided best height by the store's reorg safety depth,
+	// without recording a sweep txn. This is a no-op if the best height is
+	// below the safety depth, or if the resulting height is at or below
+	// the last finalized height.
+	FinalizeKinderAt(bestHeight uint32) error
+
+	// FinalizeKinderRange finalizes the contiguous span of heights
+	// [fromHeight, toHeight] in a single transaction, without recording
+	// any sweep txns. The span must begin directly after the last
+	// finalized height.
+	FinalizeKinderRange(fromHeight, toHeight uint32) error
+
 	// LastFinalizedHeight returns the last block height for which the
 	// nursery store finalized a kindergarten class.
 	LastFinalizedHeight() (uint32, error)
@@ -156,6 +233,23 @@ type NurseryStore interface {
 	// height index, that exist at or below the provided upper bound.
 	HeightsBelowOrEqual(height uint32) ([]uint32, error)
 
+	// NextActionHeight returns the lowest non-empty height in the height
+	// index that is strictly above the provided height. The returned
+	// boolean indicates whether any such height exists.
+	NextActionHeight(afterHeight uint32) (uint32, bool, error)
+
+	// ActiveChannelsAtHeight returns the distinct channel points that
+	// have outputs referenced in the height index at the provided height.
+	ActiveChannelsAtHeight(height uint32) ([]wire.OutPoint, error)
+
+	// VerifyIntegrity cross-checks the height index against the channel
+	// index, returning a description of each discrepancy found.
+	VerifyIntegrity() ([]string, error)
+
+	// CompactHeightIndex removes any height buckets that no longer
+	// reference any outputs, returning the number removed.
+	CompactHeightIndex() (removed int, err error)
+
 	// ForChanOutputs iterates over all outputs being incubated for a
 	// particular channel point. This method accepts a callback that allows
 	// the caller to process each key-value pair. The key will be a prefixed
@@ -166,14 +260,42 @@ type NurseryStore interface {
 	// ListChannels returns all channels the nursery is currently tracking.
 	ListChannels() ([]wire.OutPoint, error)
 
+	// NurseryReport summarizes the outputs in limbo for a particular
+	// channel point, grouped by the stage of incubation. If the channel
+	// point is nil, the report aggregates across all channels being
+	// tracked by the nursery.
+	NurseryReport(*wire.OutPoint) (*NurseryReport, error)
+
+	// NurseryStats returns the number of outputs in the crib, preschool,
+	// and kindergarten buckets across all channels, without decoding
+	// them.
+	NurseryStats() (cribCount, preschoolCount, kinderCount int, err error)
+
+	// LimboBalance returns the total value of all outputs in the crib,
+	// preschool, and kindergarten buckets across all channels.
+	LimboBalance() (btcutil.Amount, error)
+
 	// IsMatureChannel determines the whether or not all of the outputs in a
 	// particular channel bucket have been marked as graduated.
 	IsMatureChannel(*wire.OutPoint) (bool, error)
 
+	// GraduateKinderDryRun reports the channels that would become mature
+	// if the provided kindergarten outputs were graduated, without
+	// modifying the database.
+	GraduateKinderDryRun(kids ...kidOutput) ([]wire.OutPoint, error)
+
 	// RemoveChannel channel erases all entries from the channel bucket for
 	// the provided channel point, this method should only be called if
 	// IsMatureChannel indicates the channel is ready for removal.
 	RemoveChannel(*wire.OutPoint) error
+
+	// PurgeChannel forcibly erases all state for the provided channel
+	// point, regardless of whether its outputs have graduated. This
+	// includes the channel bucket, as well as any references to the
+	// channel within the height index. This should only be used for
+	// channels whose outputs will never be swept, e.g. if they've been
+	// abandoned.
+	PurgeChannel(*wire.OutPoint) error
 }
 
 var (
@@ -198,6 +320,15 @@ var (
 	// action.
 	heightIndexKey = []byte("height-index")
 
+	// confHeightIndexKey is a static key used to retrieve the index
+	// mapping each confirmation height to the kindergarten outputs that
+	// confirmed at that height.
+	confHeightIndexKey = []byte("conf-height-index")
+
+	// sweptOutputsKey is a static key used to retrieve the bucket mapping
+	// the txid of each kindergarten sweep txn to the outpoints it swept.
+	sweptOutputsKey = []byte("swept-outputs")
+
 	// finalizedKndrTxnKey is a static key that can be used to locate a
 	// finalized kindergarten sweep txn.
 	finalizedKndrTxnKey = []byte("finalized-kndr-txn")
@@ -280,6 +411,27 @@ type nurseryStore struct {
 	db        *channeldb.DB
 
 	pfxChainKey []byte
+
+	// reorgSafetyDepth is the number of blocks that FinalizeKinderAt will
+	// lag behind the best height, to protect against finalizing a class
+	// that may later be reorged out.
+	reorgSafetyDepth uint32
+
+	// encryptor, if set, is used to encrypt all serialized outputs before
+	// they're written to disk, and decrypt them after they're read.
+	encryptor EncryptorDecryptor
+}
+
+// EncryptorDecryptor encrypts and decrypts the serialized outputs persisted
+// by the nursery store. As these outputs include the sign descriptors needed
+// to sweep them, some deployments may wish to avoid storing them in
+// plaintext.
+type EncryptorDecryptor interface {
+	// Encrypt returns the ciphertext of the passed plaintext.
+	Encrypt(plaintext []byte) ([]byte, error)
+
+	// Decrypt returns the plaintext of the passed ciphertext.
+	Decrypt(ciphertext []byte) ([]byte, error)
 }
 
 // newNurseryStore accepts a chain hash and a channeldb.DB instance, returning
@@ -303,9 +455,148 @@ func newNurseryStore(chainHash *chainhash.Hash,
 	}, nil
 }
 
+// SetEncryptor registers an EncryptorDecryptor that will be used to encrypt
+// all outputs subsequently written to the nursery store, and decrypt all
+// outputs read from it. If no encryptor is registered, outputs are stored in
+// plaintext.
+//
+// NOTE: The encryptor must be set before any outputs are written, as outputs
+// previously stored in plaintext will fail to decrypt.
+func (ns *nurseryStore) SetEncryptor(encryptor EncryptorDecryptor) {
+	ns.encryptor = encryptor
+}
+
+// encryptOutput encrypts a serialized output using the registered encryptor,
+// if any.
+func (ns *nurseryStore) encryptOutput(b []byte) ([]byte, error) {
+	if ns.encryptor == nil {
+		return b, nil
+	}
+
+	return ns.encryptor.Encrypt(b)
+}
+
+// decryptOutput decrypts a serialized output using the registered encryptor,
+// if any.
+func (ns *nurseryStore) decryptOutput(b []byte) ([]byte, error) {
+	if ns.encryptor == nil {
+		return b, nil
+	}
+
+	return ns.encryptor.Decrypt(b)
+}
+
+// SetReorgSafetyDepth sets the number of blocks that FinalizeKinderAt will lag
+// behind the best height.
+func (ns *nurseryStore) SetReorgSafetyDepth(depth uint32) {
+	ns.reorgSafetyDepth = depth
+}
+
+// ListNurseryChains returns the chain hashes of all nursery stores that have
+// persisted state within the database. This is determined by scanning the
+// top-level buckets for those prefixed by "utxn", and parsing the chain hash
+// that follows the prefix. If no nursery stores exist, an empty slice is
+// returned.
+func ListNurseryChains(db *channeldb.DB) ([]chainhash.Hash, error) {
+	chains := make([]chainhash.Hash, 0)
+	err := db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+			if !bytes.HasPrefix(name, utxnChainPrefix) {
+				return nil
+			}
+
+			// Skip any buckets that share our prefix, but couldn't
+			// have been created by prefixChainKey.
+			hashBytes := name[len(utxnChainPrefix):]
+			if len(hashBytes) != chainhash.HashSize {
+				return nil
+			}
+
+			var chainHash chainhash.Hash
+			copy(chainHash[:], hashBytes)
+			chains = append(chains, chainHash)
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return chains, nil
+}
+
+// MigrateNurseryChain moves the nursery store persisted for the old chain hash
+// to the new chain hash, e.g. after a testnet reset. All buckets and values
+// under the old root bucket, including the channel index, height index, and
+// last finalized and graduated heights, are copied to the new root bucket,
+// after which the old root bucket is deleted. This is done within a single
+// database transaction. An error is returned if no nursery store exists for
+// the old chain hash, or if one already exists for the new chain hash.
+func MigrateNurseryChain(db *channeldb.DB, oldHash,
+	newHash *chainhash.Hash) error {
+
+	oldChainKey, err := prefixChainKey(utxnChainPrefix, oldHash)
+	if err != nil {
+		return err
+	}
+	newChainKey, err := prefixChainKey(utxnChainPrefix, newHash)
+	if err != nil {
+		return err
+	}
+
+	return db.Update(func(tx *bolt.Tx) error {
+		oldChainBucket := tx.Bucket(oldChainKey)
+		if oldChainBucket == nil {
+			return fmt.Errorf("no nursery store found for chain %v",
+				oldHash)
+		}
+		if tx.Bucket(newChainKey) != nil {
+			return fmt.Errorf("nursery store already exists for "+
+				"chain %v", newHash)
+		}
+
+		newChainBucket, err := tx.CreateBucket(newChainKey)
+		if err != nil {
+			return err
+		}
+		if err := copyBucket(newChainBucket, oldChainBucket); err != nil {
+			return err
+		}
+
+		utxnLog.Infof("Migrated nursery store from chain %v to %v",
+			oldHash, newHash)
+
+		return tx.DeleteBucket(oldChainKey)
+	})
+}
+
+// copyBucket recursively copies all values and nested buckets within the
+// source bucket into the destination bucket.
+func copyBucket(dst, src *bolt.Bucket) error {
+	return src.ForEach(func(k, v []byte) error {
+		// A nil value indicates a nested bucket, which we'll create
+		// and copy recursively.
+		if v == nil {
+			nestedDst, err := dst.CreateBucket(k)
+			if err != nil {
+				return err
+			}
+
+			return copyBucket(nestedDst, src.Bucket(k))
+		}
+
+		return dst.Put(k, v)
+	})
+}
+
 // Incubate persists the beginning of the incubation process for the
 // CSV-delayed outputs (commitment and incoming HTLC's), commitment output and
 // a list of outgoing two-stage htlc outputs.
+//
+// NOTE: Crib outputs for all of a channel's outgoing htlcs are batched into
+// the same db transaction as the channel's kid outputs, so there is no need
+// for a separate batched variant of enterCrib.
 func (ns *nurseryStore) Incubate(kids []kidOutput, babies []babyOutput) error {
 	return ns.db.Update(func(tx *bolt.Tx) error {
 		// If we have any kid outputs to incubate, then we'll attempt
@@ -372,6 +663,12 @@ func (ns *nurseryStore) CribToKinder(bby *babyOutput) error {
 		// key with the kindergarten prefix.
 		copy(pfxOutputKey, kndrPrefix)
 
+		// The kidOutput was produced by the confirmed second-stage
+		// HTLC timeout transaction, record this so that the sweeper
+		// and nursery reports can distinguish it from commitment
+		// outputs.
+		bby.kidOutput.origin = kidOriginHtlcSecondStage
+
 		// Now, serialize babyOutput's encapsulated kidOutput such that
 		// it can be written to the channel bucket under the new
 		// kindergarten-prefixed key.
@@ -379,7 +676,10 @@ func (ns *nurseryStore) CribToKinder(bby *babyOutput) error {
 		if err := bby.kidOutput.Encode(&kidBuffer); err != nil {
 			return err
 		}
-		kidBytes := kidBuffer.Bytes()
+		kidBytes, err := ns.encryptOutput(kidBuffer.Bytes())
+		if err != nil {
+			return err
+		}
 
 		// Persist the serialized kidOutput under the
 		// kindergarten-prefixed outpoint key.
@@ -408,7 +708,14 @@ func (ns *nurseryStore) CribToKinder(bby *babyOutput) error {
 		// height-channel bucket corresponding to its maturity height.
 		// This informs the utxo nursery that it should attempt to spend
 		// this output when the blockchain reaches the maturity height.
-		return hghtChanBucketCsv.Put(pfxOutputKey, []byte{})
+		err = hghtChanBucketCsv.Put(pfxOutputKey, []byte{})
+		if err != nil {
+			return err
+		}
+
+		// Finally, record the output at its confirmation height.
+		return ns.addToConfHeightIndex(tx, bby.ConfHeight(), chanPoint,
+			pfxOutputKey)
 	})
 }
 
@@ -448,13 +755,27 @@ func (ns *nurseryStore) PreschoolToKinder(kid *kidOutput) error {
 		// the same outpoint.
 		copy(pfxOutputKey, kndrPrefix)
 
+		// Record the origin of this kindergarten output. Incoming
+		// HTLCs on our commitment transaction pass through the
+		// preschool bucket while awaiting confirmation of their
+		// second-stage success transaction, all other preschool
+		// outputs originate from the commitment transaction itself.
+		if kid.WitnessType() == lnwallet.HtlcAcceptedSuccessSecondLevel {
+			kid.origin = kidOriginHtlcSecondStage
+		} else {
+			kid.origin = kidOriginCommitment
+		}
+
 		// Reserialize the kid here to capture any differences in the
 		// new and old kid output, such as the confirmation height.
 		var kidBuffer bytes.Buffer
 		if err := kid.Encode(&kidBuffer); err != nil {
 			return err
 		}
-		kidBytes := kidBuffer.Bytes()
+		kidBytes, err := ns.encryptOutput(kidBuffer.Bytes())
+		if err != nil {
+			return err
+		}
 
 		// And store the kid output in its channel bucket using the
 		// kindergarten prefixed key.
@@ -462,37 +783,12 @@ func (ns *nurseryStore) PreschoolToKinder(kid *kidOutput) error {
 			return err
 		}
 
-		// If this output has an absolute time lock, then we'll set the
-		// maturity height directly.
-		var maturityHeight uint32
-		if kid.BlocksToMaturity() == 0 {
-			maturityHeight = kid.absoluteMaturity
-		} else {
-			// Otherwise, since the CSV delay on the kid output has
-			// now begun ticking, we must insert a record of in the
-			// height index to remind us to revisit this output
-			// once it has fully matured.
-			//
-			// Compute the maturity height, by adding the output's
-			// CSV delay to its confirmation height.
-			maturityHeight = kid.ConfHeight() + kid.BlocksToMaturity()
-		}
-
-		// In the case of a Late Registration, we've already graduated
-		// the class that this kid is destined for. So we'll bump its
-		// height by one to ensure we don't forget to graduate it.
-		lastGradHeight, err := ns.getLastGraduatedHeight(tx)
+		// Determine the height at which the kid output will mature,
+		// as this is where it will be placed in the height index.
+		maturityHeight, err := ns.kinderMaturityHeight(tx, kid)
 		if err != nil {
 			return err
 		}
-		if maturityHeight <= lastGradHeight {
-			utxnLog.Debugf("Late Registration for kid output=%v "+
-				"detected: class_height=%v, "+
-				"last_graduated_height=%v", kid.OutPoint(),
-				maturityHeight, lastGradHeight)
-
-			maturityHeight = lastGradHeight + 1
-		}
 
 		utxnLog.Infof("Transitioning (crib -> kid) output for "+
 			"chan_point=%v at height_index=%v", chanPoint,
@@ -511,294 +807,1263 @@ func (ns *nurseryStore) PreschoolToKinder(kid *kidOutput) error {
 		// The key is named using a kindergarten prefixed key, signaling
 		// that this CSV delayed output will be ready to broadcast at
 		// the maturity height, after a brief period of incubation.
-		return hghtChanBucket.Put(pfxOutputKey, []byte{})
+		if err := hghtChanBucket.Put(pfxOutputKey, []byte{}); err != nil {
+			return err
+		}
+
+		// Record the output at its confirmation height, allowing it to
+		// be found by FetchOutputsConfirmedAt.
+		return ns.addToConfHeightIndex(tx, kid.ConfHeight(), chanPoint,
+			pfxOutputKey)
 	})
 }
 
-// GraduateKinder atomically moves the kindergarten class at the provided height
-// into the graduated status. This involves removing the kindergarten entries
-// from both the height and channel indexes, and cleaning up the finalized
-// kindergarten sweep txn. The height bucket will be opportunistically pruned
-// from the height index as outputs are removed.
-func (ns *nurseryStore) GraduateKinder(height uint32) error {
-	return ns.db.Update(func(tx *bolt.Tx) error {
+// RelocateKinder corrects the confirmation height of a kindergarten output,
+// e.g. if it reconfirmed at a different height after a reorg. The output's
+// entry in the height index is moved from its stale maturity height to the
+// maturity height computed from the new confirmation height, and the stored
+// output is updated to reflect the new confirmation height. The provided
+// kidOutput is also updated. If the output is not currently in the
+// kindergarten bucket, ErrKinderNotFound is returned.
+func (ns *nurseryStore) RelocateKinder(kid *kidOutput,
+	newConfHeight uint32) error {
 
-		// Since all kindergarten outputs at a particular height are
-		// swept in a single txn, we can now safely delete the finalized
-		// txn, since it has already been broadcast and confirmed.
-		hghtBucket := ns.getHeightBucket(tx, height)
-		if hghtBucket == nil {
-			// Nothing to delete, bucket has already been removed.
-			return nil
+	return ns.db.Update(func(tx *bolt.Tx) error {
+		chanPoint := kid.OriginChanPoint()
+		chanBucket := ns.getChannelBucket(tx, chanPoint)
+		if chanBucket == nil {
+			return ErrContractNotFound
 		}
 
-		// Remove the finalized kindergarten txn, we do this before
-		// removing the outputs so that the extra entry doesn't prevent
-		// the height bucket from being opportunistically pruned below.
-		if err := hghtBucket.Delete(finalizedKndrTxnKey); err != nil {
+		pfxOutputKey, err := prefixOutputKey(kndrPrefix, kid.OutPoint())
+		if err != nil {
 			return err
 		}
 
-		// For each kindergarten found output, delete its entry from the
-		// height and channel index, and create a new grad output in the
-		// channel index.
-		return ns.forEachHeightPrefix(tx, kndrPrefix, height,
-			func(v []byte) error {
-				var kid kidOutput
-				err := kid.Decode(bytes.NewReader(v))
-				if err != nil {
-					return err
-				}
+		// We'll relocate the stored output, rather than the one
+		// provided, as the stored confirmation height is the one
+		// reflected in the indexes.
+		kidBytes := chanBucket.Get(pfxOutputKey)
+		if kidBytes == nil {
+			return ErrKinderNotFound
+		}
+		kidBytes, err = ns.decryptOutput(kidBytes)
+		if err != nil {
+			return err
+		}
 
-				outpoint := kid.OutPoint()
-				chanPoint := kid.OriginChanPoint()
+		var diskKid kidOutput
+		if err := diskKid.Decode(bytes.NewReader(kidBytes)); err != nil {
+			return err
+		}
 
-				// Construct the key under which the output is
-				// currently stored height and channel indexes.
-				pfxOutputKey, err := prefixOutputKey(kndrPrefix,
-					outpoint)
-				if err != nil {
-					return err
-				}
+		// Remove the output from the height index at its stale
+		// maturity height. Since the maturity height may have been
+		// bumped upon a late registration, we'll remove every
+		// reference to the output rather than recompute it.
+		heights, err := ns.heightsWithOutput(tx, chanPoint, pfxOutputKey)
+		if err != nil {
+			return err
+		}
+		for _, height := range heights {
+			err := ns.removeOutputFromHeight(
+				tx, height, chanPoint, pfxOutputKey,
+			)
+			if err != nil {
+				return err
+			}
+		}
+		err = ns.removeFromConfHeightIndex(
+			tx, diskKid.ConfHeight(), pfxOutputKey,
+		)
+		if err != nil {
+			return err
+		}
 
-				// Remove the grad output's entry in the height
-				// index.
-				err = ns.removeOutputFromHeight(tx, height,
-					chanPoint, pfxOutputKey)
-				if err != nil {
-					return err
-				}
+		// With the stale entries removed, update the confirmation
+		// height and store the output once again.
+		diskKid.SetConfHeight(newConfHeight)
 
-				chanBucket := ns.getChannelBucket(tx,
-					chanPoint)
-				if chanBucket == nil {
-					return ErrContractNotFound
-				}
+		var kidBuffer bytes.Buffer
+		if err := diskKid.Encode(&kidBuffer); err != nil {
+			return err
+		}
+		kidBytes, err = ns.encryptOutput(kidBuffer.Bytes())
+		if err != nil {
+			return err
+		}
+		if err := chanBucket.Put(pfxOutputKey, kidBytes); err != nil {
+			return err
+		}
 
-				// Remove previous output with kindergarten
-				// prefix.
-				err = chanBucket.Delete(pfxOutputKey)
-				if err != nil {
-					return err
-				}
+		// Finally, insert the output into the height index at its
+		// corrected maturity height, and the confirmation height
+		// index at its new confirmation height.
+		maturityHeight, err := ns.kinderMaturityHeight(tx, &diskKid)
+		if err != nil {
+			return err
+		}
 
-				// Convert kindergarten key to graduate key.
-				copy(pfxOutputKey, gradPrefix)
+		utxnLog.Infof("Relocating kid output=%v for chan_point=%v to "+
+			"height_index=%v", diskKid.OutPoint(), chanPoint,
+			maturityHeight)
 
-				var gradBuffer bytes.Buffer
-				if err := kid.Encode(&gradBuffer); err != nil {
-					return err
-				}
+		hghtChanBucket, err := ns.createHeightChanBucket(
+			tx, maturityHeight, chanPoint,
+		)
+		if err != nil {
+			return err
+		}
+		if err := hghtChanBucket.Put(pfxOutputKey, []byte{}); err != nil {
+			return err
+		}
 
-				// Insert serialized output into channel bucket
-				// using graduate-prefixed key.
-				return chanBucket.Put(pfxOutputKey,
-					gradBuffer.Bytes())
-			},
+		err = ns.addToConfHeightIndex(
+			tx, newConfHeight, chanPoint, pfxOutputKey,
 		)
-	})
-}
+		if err != nil {
+			return err
+		}
 
-// FinalizeKinder accepts a block height and a finalized kindergarten sweep
-// transaction, persisting the transaction at the appropriate height bucket. The
-// nursery store's last finalized height is also updated with the provided
-// height.
-func (ns *nurseryStore) FinalizeKinder(height uint32,
-	finalTx *wire.MsgTx) error {
+		kid.SetConfHeight(newConfHeight)
 
-	return ns.db.Update(func(tx *bolt.Tx) error {
-		return ns.finalizeKinder(tx, height, finalTx)
+		return nil
 	})
 }
 
-// GraduateHeight persists the provided height as the nursery store's last
-// graduated height.
-func (ns *nurseryStore) GraduateHeight(height uint32) error {
+// BumpKinderFee records a new sweep fee rate for a kindergarten output, and
+// increments its broadcast attempts. The provided kidOutput is updated to
+// reflect the persisted values. If the output is not currently in the
+// kindergarten bucket, ErrKinderNotFound is returned.
+func (ns *nurseryStore) BumpKinderFee(kid *kidOutput,
+	newFeeRate btcutil.Amount) error {
 
 	return ns.db.Update(func(tx *bolt.Tx) error {
-		return ns.putLastGraduatedHeight(tx, height)
-	})
-}
-
-// FetchClass returns a list of babyOutputs in the crib bucket whose CLTV
-// delay expires at the provided block height.
-// FetchClass returns a list of the kindergarten and crib outputs whose timeouts
-// are expiring
-func (ns *nurseryStore) FetchClass(
-	height uint32) (*wire.MsgTx, []kidOutput, []babyOutput, error) {
-
-	// Construct list of all crib and kindergarten outputs that need to be
-	// processed at the provided block height.
-	var finalTx *wire.MsgTx
-	var kids []kidOutput
-	var babies []babyOutput
-	if err := ns.db.View(func(tx *bolt.Tx) error {
+		chanBucket := ns.getChannelBucket(tx, kid.OriginChanPoint())
+		if chanBucket == nil {
+			return ErrContractNotFound
+		}
 
-		var err error
-		finalTx, err = ns.getFinalizedTxn(tx, height)
+		pfxOutputKey, err := prefixOutputKey(kndrPrefix, kid.OutPoint())
 		if err != nil {
 			return err
 		}
 
-		// Append each crib output to our list of babyOutputs.
-		if err = ns.forEachHeightPrefix(tx, cribPrefix, height,
-			func(buf []byte) error {
-
-				// We will attempt to deserialize all outputs
-				// stored with the crib prefix into babyOutputs,
-				// since this is the expected type that would
-				// have been serialized previously.
-				var baby babyOutput
-				babyReader := bytes.NewReader(buf)
-				if err := baby.Decode(babyReader); err != nil {
-					return err
-				}
-
-				babies = append(babies, baby)
-
-				return nil
+		// We'll apply the update to the stored output, rather than
+		// the one provided, so that the broadcast count can't regress
+		// if the caller's copy is stale.
+		kidBytes := chanBucket.Get(pfxOutputKey)
+		if kidBytes == nil {
+			return ErrKinderNotFound
+		}
 
-			},
-		); err != nil {
+		kidBytes, err = ns.decryptOutput(kidBytes)
+		if err != nil {
 			return err
 		}
 
-		// Append each kindergarten output to our list of kidOutputs.
-		return ns.forEachHeightPrefix(tx, kndrPrefix, height,
-			func(buf []byte) error {
-				// We will attempt to deserialize all outputs
-				// stored with the kindergarten prefix into
-				// kidOutputs, since this is the expected type
-				// that would have been serialized previously.
-				var kid kidOutput
-				kidReader := bytes.NewReader(buf)
-				if err := kid.Decode(kidReader); err != nil {
-					return err
-				}
-
-				kids = append(kids, kid)
+		var diskKid kidOutput
+		if err := diskKid.Decode(bytes.NewReader(kidBytes)); err != nil {
+			return err
+		}
+		diskKid.sweepFeeRate = newFeeRate
+		diskKid.broadcastAttempts++
 
-				return nil
+		var kidBuffer bytes.Buffer
+		if err := diskKid.Encode(&kidBuffer); err != nil {
+			return err
+		}
 
-			})
+		kidBytes, err = ns.encryptOutput(kidBuffer.Bytes())
+		if err != nil {
+			return err
+		}
+		if err := chanBucket.Put(pfxOutputKey, kidBytes); err != nil {
+			return err
+		}
 
-	}); err != nil {
-		return nil, nil, nil, err
-	}
+		kid.sweepFeeRate = diskKid.sweepFeeRate
+		kid.broadcastAttempts = diskKid.broadcastAttempts
 
-	return finalTx, kids, babies, nil
+		return nil
+	})
 }
 
-// FetchPreschools returns a list of all outputs currently stored in the
-// preschool bucket.
-func (ns *nurseryStore) FetchPreschools() ([]kidOutput, error) {
-	var kids []kidOutput
-	if err := ns.db.View(func(tx *bolt.Tx) error {
+// RewindToHeight moves all kindergarten outputs confirmed at or above the
+// provided height back into the preschool bucket, removing their entries from
+// the height index. The rewound outputs will have their confirmation height
+// reset, such that they can be moved to the kindergarten bucket again once
+// they reconfirm. This method is idempotent, though it will refuse to rewind
+// below the last finalized height.
+func (ns *nurseryStore) RewindToHeight(height uint32) error {
+	return ns.db.Update(func(tx *bolt.Tx) error {
+		lastFinalizedHeight, err := ns.getLastFinalizedHeight(tx)
+		if err != nil {
+			return err
+		}
+		if height < lastFinalizedHeight {
+			return fmt.Errorf("unable to rewind to height %d below "+
+				"last finalized height %d", height,
+				lastFinalizedHeight)
+		}
+
+		chainBucket := tx.Bucket(ns.pfxChainKey)
+		if chainBucket == nil {
+			return nil
+		}
+		chanIndex := chainBucket.Bucket(channelIndexKey)
+		if chanIndex == nil {
+			return nil
+		}
+
+		// Since buckets can't be modified while iterating, we'll
+		// first collect all kindergarten outputs that need to be
+		// rewound.
+		var (
+			rewoundKids []kidOutput
+			rewoundKeys [][]byte
+		)
+		err = chanIndex.ForEach(func(chanBytes, v []byte) error {
+			if v != nil {
+				return nil
+			}
+
+			chanBucket := chanIndex.Bucket(chanBytes)
+			return chanBucket.ForEach(func(k, v []byte) error {
+				if !bytes.HasPrefix(k, kndrPrefix) {
+					return nil
+				}
+
+				v, err := ns.decryptOutput(v)
+				if err != nil {
+					return err
+				}
+
+				var kid kidOutput
+				if err := kid.Decode(bytes.NewReader(v)); err != nil {
+					return err
+				}
+
+				if kid.ConfHeight() < height {
+					return nil
+				}
+
+				rewoundKids = append(rewoundKids, kid)
+				rewoundKeys = append(
+					rewoundKeys, append([]byte(nil), k...),
+				)
+
+				return nil
+			})
+		})
+		if err != nil {
+			return err
+		}
+
+		for i := range rewoundKids {
+			kid := &rewoundKids[i]
+			pfxOutputKey := rewoundKeys[i]
+			chanPoint := kid.OriginChanPoint()
+
+			// The output's maturity height may have been bumped
+			// upon a late registration, so rather than recompute
+			// it, we'll remove every reference to the output from
+			// the height index.
+			heights, err := ns.heightsWithOutput(
+				tx, chanPoint, pfxOutputKey,
+			)
+			if err != nil {
+				return err
+			}
+			for _, hght := range heights {
+				err := ns.removeOutputFromHeight(
+					tx, hght, chanPoint, pfxOutputKey,
+				)
+				if err != nil {
+					return err
+				}
+			}
+
+			err = ns.removeFromConfHeightIndex(
+				tx, kid.ConfHeight(), pfxOutputKey,
+			)
+			if err != nil {
+				return err
+			}
+
+			chanBucket := ns.getChannelBucket(tx, chanPoint)
+			if err := chanBucket.Delete(pfxOutputKey); err != nil {
+				return err
+			}
+
+			// Reset the confirmation height, as the output is once
+			// again awaiting confirmation, and store it under the
+			// preschool prefix.
+			kid.SetConfHeight(0)
+
+			var kidBuffer bytes.Buffer
+			if err := kid.Encode(&kidBuffer); err != nil {
+				return err
+			}
+
+			psclKey := make([]byte, len(pfxOutputKey))
+			copy(psclKey, pfxOutputKey)
+			copy(psclKey, psclPrefix)
+
+			kidBytes, err := ns.encryptOutput(kidBuffer.Bytes())
+			if err != nil {
+				return err
+			}
+			if err := chanBucket.Put(psclKey, kidBytes); err != nil {
+				return err
+			}
+
+			utxnLog.Infof("Rewound (kid -> pscl) output=%v for "+
+				"chan_point=%v", kid.OutPoint(), chanPoint)
+		}
+
+		return nil
+	})
+}
+
+// GraduateKinder atomically moves the kindergarten class at the provided height
+// into the graduated status. This involves removing the kindergarten entries
+// from both the height and channel indexes, and cleaning up the finalized
+// kindergarten sweep txn. The height bucket will be opportunistically pruned
+// from the height index as outputs are removed.
+func (ns *nurseryStore) GraduateKinder(height uint32) error {
+	return ns.db.Update(func(tx *bolt.Tx) error {
+		_, err := ns.graduateKinder(tx, height)
+		return err
+	})
+}
+
+// GraduateKinderWithSweep graduates the kindergarten class at the provided
+// height, exactly as GraduateKinder does, and additionally records the
+// outpoints of the graduated outputs under the txid of the transaction that
+// swept them. The graduated outpoints are returned, and can later be
+// retrieved using FetchSweepOutputs.
+func (ns *nurseryStore) GraduateKinderWithSweep(height uint32,
+	sweepTxid chainhash.Hash) ([]wire.OutPoint, error) {
+
+	var graduated []wire.OutPoint
+	err := ns.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		graduated, err = ns.graduateKinder(tx, height)
+		if err != nil {
+			return err
+		}
+
+		// If no outputs graduated, there's nothing to record.
+		if len(graduated) == 0 {
+			return nil
+		}
+
+		chainBucket, err := tx.CreateBucketIfNotExists(ns.pfxChainKey)
+		if err != nil {
+			return err
+		}
+		sweptOutputs, err := chainBucket.CreateBucketIfNotExists(
+			sweptOutputsKey,
+		)
+		if err != nil {
+			return err
+		}
+
+		var b bytes.Buffer
+		for i := range graduated {
+			if err := writeOutpoint(&b, &graduated[i]); err != nil {
+				return err
+			}
+		}
+
+		return sweptOutputs.Put(sweepTxid[:], b.Bytes())
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return graduated, nil
+}
+
+// FetchSweepOutputs returns the outpoints of the kindergarten outputs swept by
+// the transaction with the given txid, as recorded by GraduateKinderWithSweep.
+// If no outputs were recorded for the txid, ErrSweepNotFound is returned.
+func (ns *nurseryStore) FetchSweepOutputs(
+	txid chainhash.Hash) ([]wire.OutPoint, error) {
+
+	var outpoints []wire.OutPoint
+	err := ns.db.View(func(tx *bolt.Tx) error {
+		chainBucket := tx.Bucket(ns.pfxChainKey)
+		if chainBucket == nil {
+			return ErrSweepNotFound
+		}
+		sweptOutputs := chainBucket.Bucket(sweptOutputsKey)
+		if sweptOutputs == nil {
+			return ErrSweepNotFound
+		}
+
+		outpointBytes := sweptOutputs.Get(txid[:])
+		if outpointBytes == nil {
+			return ErrSweepNotFound
+		}
+
+		r := bytes.NewReader(outpointBytes)
+		for r.Len() > 0 {
+			var outpoint wire.OutPoint
+			if err := readOutpoint(r, &outpoint); err != nil {
+				return err
+			}
+
+			outpoints = append(outpoints, outpoint)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return outpoints, nil
+}
+
+// graduateKinder moves the kindergarten class at the provided height into the
+// graduated status, returning the outpoints of all graduated outputs.
+func (ns *nurseryStore) graduateKinder(tx *bolt.Tx,
+	height uint32) ([]wire.OutPoint, error) {
+
+	// Since all kindergarten outputs at a particular height are
+	// swept in a single txn, we can now safely delete the finalized
+	// txn, since it has already been broadcast and confirmed.
+	hghtBucket := ns.getHeightBucket(tx, height)
+	if hghtBucket == nil {
+		// Nothing to delete, bucket has already been removed.
+		return nil, nil
+	}
+
+	// Remove the finalized kindergarten txn, we do this before
+	// removing the outputs so that the extra entry doesn't prevent
+	// the height bucket from being opportunistically pruned below.
+	if err := hghtBucket.Delete(finalizedKndrTxnKey); err != nil {
+		return nil, err
+	}
+
+	// For each kindergarten found output, delete its entry from the
+	// height and channel index, and create a new grad output in the
+	// channel index.
+	var graduated []wire.OutPoint
+	err := ns.forEachHeightPrefix(
+		context.Background(), tx, kndrPrefix, height,
+		func(v []byte) error {
+			var kid kidOutput
+			err := kid.Decode(bytes.NewReader(v))
+			if err != nil {
+				return err
+			}
+
+			outpoint := kid.OutPoint()
+			chanPoint := kid.OriginChanPoint()
+
+			// Construct the key under which the output is
+			// currently stored height and channel indexes.
+			pfxOutputKey, err := prefixOutputKey(kndrPrefix,
+				outpoint)
+			if err != nil {
+				return err
+			}
+
+			// Remove the grad output's entry in the height
+			// index.
+			err = ns.removeOutputFromHeight(tx, height,
+				chanPoint, pfxOutputKey)
+			if err != nil {
+				return err
+			}
+
+			chanBucket := ns.getChannelBucket(tx,
+				chanPoint)
+			if chanBucket == nil {
+				return ErrContractNotFound
+			}
+
+			// Remove previous output with kindergarten
+			// prefix.
+			err = chanBucket.Delete(pfxOutputKey)
+			if err != nil {
+				return err
+			}
+
+			// Remove the output from the confirmation height
+			// index, as it's no longer in the kindergarten.
+			err = ns.removeFromConfHeightIndex(tx,
+				kid.ConfHeight(), pfxOutputKey)
+			if err != nil {
+				return err
+			}
+
+			// Convert kindergarten key to graduate key.
+			copy(pfxOutputKey, gradPrefix)
+
+			var gradBuffer bytes.Buffer
+			if err := kid.Encode(&gradBuffer); err != nil {
+				return err
+			}
+
+			graduated = append(graduated, *outpoint)
+
+			gradBytes, err := ns.encryptOutput(gradBuffer.Bytes())
+			if err != nil {
+				return err
+			}
+
+			// Insert serialized output into channel bucket
+			// using graduate-prefixed key.
+			return chanBucket.Put(pfxOutputKey, gradBytes)
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return graduated, nil
+}
+
+// FinalizeKinder accepts a block height and a finalized kindergarten sweep
+// transaction, persisting the transaction at the appropriate height bucket. The
+// nursery store's last finalized height is also updated with the provided
+// height.
+func (ns *nurseryStore) FinalizeKinder(height uint32,
+	finalTx *wire.MsgTx) error {
+
+	return ns.db.Update(func(tx *bolt.Tx) error {
+		return ns.finalizeKinder(tx, height, finalTx)
+	})
+}
+
+// FinalizeKinderAt finalizes the kindergarten class at the height lagging the
+// provided best height by the store's reorg safety depth, without recording a
+// sweep txn. This is a no-op if the best height is below the safety depth.
+// Since the best height may rewind during a reorg, we also refuse to finalize
+// any height at or below the last finalized height, as those classes have
+// already been finalized.
+func (ns *nurseryStore) FinalizeKinderAt(bestHeight uint32) error {
+	if bestHeight < ns.reorgSafetyDepth {
+		return nil
+	}
+	height := bestHeight - ns.reorgSafetyDepth
+
+	return ns.db.Update(func(tx *bolt.Tx) error {
+		lastFinalizedHeight, err := ns.getLastFinalizedHeight(tx)
+		if err != nil {
+			return err
+		}
+
+		if height <= lastFinalizedHeight {
+			utxnLog.Debugf("Skipping finalization of height=%d, "+
+				"last finalized height is %d", height,
+				lastFinalizedHeight)
+			return nil
+		}
+
+		return ns.finalizeKinder(tx, height, nil)
+	})
+}
+
+// FinalizeKinderRange finalizes the contiguous span of heights [fromHeight,
+// toHeight] in a single transaction, without recording any sweep txns. This
+// allows many heights to be finalized at once, e.g. after a long period
+// offline. To prevent skipping any unfinalized heights, fromHeight must be
+// exactly one above the last finalized height. Any height buckets in the span
+// that no longer hold outputs are pruned.
+func (ns *nurseryStore) FinalizeKinderRange(fromHeight, toHeight uint32) error {
+	if toHeight < fromHeight {
+		return fmt.Errorf("invalid height range [%d, %d]",
+			fromHeight, toHeight)
+	}
+
+	return ns.db.Update(func(tx *bolt.Tx) error {
+		lastFinalizedHeight, err := ns.getLastFinalizedHeight(tx)
+		if err != nil {
+			return err
+		}
+		if fromHeight != lastFinalizedHeight+1 {
+			return fmt.Errorf("unable to finalize from height %d, "+
+				"last finalized height is %d", fromHeight,
+				lastFinalizedHeight)
+		}
+
+		if err := ns.finalizeKinder(tx, toHeight, nil); err != nil {
+			return err
+		}
+
+		// Collect the heights within the span that are present in the
+		// height index, as we can't prune them while iterating.
+		hghtIndex := tx.Bucket(ns.pfxChainKey).Bucket(heightIndexKey)
+		if hghtIndex == nil {
+			return nil
+		}
+
+		var lower, upper [4]byte
+		byteOrder.PutUint32(lower[:], fromHeight)
+		byteOrder.PutUint32(upper[:], toHeight)
+
+		var heights []uint32
+		c := hghtIndex.Cursor()
+		for k, _ := c.Seek(lower[:]); k != nil &&
+			bytes.Compare(k, upper[:]) <= 0; k, _ = c.Next() {
+
+			if len(k) != 4 {
+				continue
+			}
+			heights = append(heights, byteOrder.Uint32(k))
+		}
+
+		// Opportunistically prune each height bucket, which will only
+		// succeed if it no longer holds any outputs.
+		for _, height := range heights {
+			pruned, err := ns.pruneHeight(tx, height)
+			if err != nil && err != errBucketNotEmpty {
+				return err
+			} else if err == nil && pruned {
+				utxnLog.Infof("Height bucket %d pruned", height)
+			}
+		}
+
+		return nil
+	})
+}
+
+// GraduateHeight persists the provided height as the nursery store's last
+// graduated height.
+func (ns *nurseryStore) GraduateHeight(height uint32) error {
+
+	return ns.db.Update(func(tx *bolt.Tx) error {
+		return ns.putLastGraduatedHeight(tx, height)
+	})
+}
+
+// FetchClass returns a list of babyOutputs in the crib bucket whose CLTV
+// delay expires at the provided block height.
+// FetchClass returns a list of the kindergarten and crib outputs whose timeouts
+// are expiring
+func (ns *nurseryStore) FetchClass(
+	height uint32) (*wire.MsgTx, []kidOutput, []babyOutput, error) {
+
+	// Construct list of all crib and kindergarten outputs that need to be
+	// processed at the provided block height.
+	var finalTx *wire.MsgTx
+	var kids []kidOutput
+	var babies []babyOutput
+	if err := ns.db.View(func(tx *bolt.Tx) error {
+
+		var err error
+		finalTx, err = ns.getFinalizedTxn(tx, height)
+		if err != nil {
+			return err
+		}
+
+		// Append each crib output to our list of babyOutputs.
+		err = ns.forEachCrib(tx, height, func(baby *babyOutput) error {
+			babies = append(babies, *baby)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// Append each kindergarten output to our list of kidOutputs.
+		return ns.forEachKindergarten(tx, height,
+			func(kid *kidOutput) error {
+				kids = append(kids, *kid)
+				return nil
+			},
+		)
+
+	}); err != nil {
+		return nil, nil, nil, err
+	}
+
+	return finalTx, kids, babies, nil
+}
+
+// FetchOutputsConfirmedAt returns all kindergarten outputs whose transaction
+// confirmed at the provided height, using the confirmation height index.
+func (ns *nurseryStore) FetchOutputsConfirmedAt(
+	height uint32) ([]kidOutput, error) {
+
+	var kids []kidOutput
+	if err := ns.db.View(func(tx *bolt.Tx) error {
+		confBucket := ns.getConfHeightBucket(tx, height)
+		if confBucket == nil {
+			return nil
+		}
+
+		return confBucket.ForEach(func(pfxKey, chanBytes []byte) error {
+			var chanPoint wire.OutPoint
+			err := readOutpoint(bytes.NewReader(chanBytes), &chanPoint)
+			if err != nil {
+				return err
+			}
+
+			chanBucket := ns.getChannelBucket(tx, &chanPoint)
+			if chanBucket == nil {
+				return ErrContractNotFound
+			}
+
+			kidBytes := chanBucket.Get(pfxKey)
+			if kidBytes == nil {
+				return fmt.Errorf("output %x referenced by "+
+					"conf height index not found", pfxKey)
+			}
+
+			kidBytes, err = ns.decryptOutput(kidBytes)
+			if err != nil {
+				return err
+			}
+
+			var kid kidOutput
+			err = kid.Decode(bytes.NewReader(kidBytes))
+			if err != nil {
+				return err
+			}
+			kids = append(kids, kid)
+
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	return kids, nil
+}
+
+// ForEachKindergarten decodes each kindergarten output maturing at the given
+// height, and passes it to the provided callback within a single read
+// transaction. Iteration is aborted if the callback returns an error.
+//
+// NOTE: The callback must not retain the decoded kidOutput beyond the call,
+// as it may be reused for the next output.
+func (ns *nurseryStore) ForEachKindergarten(height uint32,
+	cb func(*kidOutput) error) error {
+
+	return ns.db.View(func(tx *bolt.Tx) error {
+		return ns.forEachKindergarten(tx, height, cb)
+	})
+}
+
+// ForEachCrib decodes each crib output expiring at the given height, and
+// passes it to the provided callback within a single read transaction.
+// Iteration is aborted if the callback returns an error.
+//
+// NOTE: The callback must not retain the decoded babyOutput beyond the call,
+// as it may be reused for the next output.
+func (ns *nurseryStore) ForEachCrib(height uint32,
+	cb func(*babyOutput) error) error {
+
+	return ns.db.View(func(tx *bolt.Tx) error {
+		return ns.forEachCrib(tx, height, cb)
+	})
+}
+
+// FetchKindergartensByChannel returns the kindergarten outputs maturing at the
+// given height, grouped by their origin channel point. Unlike FetchClass, which
+// flattens the outputs into a single slice, this allows the caller to decide
+// whether to sweep each channel's outputs in a separate transaction, or to
+// batch all of them into one. If no outputs mature at the height, an empty map
+// is returned.
+func (ns *nurseryStore) FetchKindergartensByChannel(
+	height uint32) (map[wire.OutPoint][]kidOutput, error) {
+
+	kidsByChan := make(map[wire.OutPoint][]kidOutput)
+	if err := ns.db.View(func(tx *bolt.Tx) error {
+		return ns.forEachKindergarten(tx, height,
+			func(kid *kidOutput) error {
+				// The kidOutput is reused between calls, so we
+				// append a copy of it.
+				chanPoint := *kid.OriginChanPoint()
+				kidsByChan[chanPoint] = append(
+					kidsByChan[chanPoint], *kid,
+				)
+
+				return nil
+			},
+		)
+	}); err != nil {
+		return nil, err
+	}
+
+	return kidsByChan, nil
+}
+
+// FetchKindergartensRange returns all kindergarten outputs whose maturity
+// height falls within the inclusive range [fromHeight, toHeight]. This allows
+// the outputs of several heights, e.g. those missed during downtime, to be
+// swept within a single transaction. The outputs are returned in order of
+// maturity height, and are deduplicated by outpoint.
+func (ns *nurseryStore) FetchKindergartensRange(fromHeight,
+	toHeight uint32) ([]kidOutput, error) {
+
+	if fromHeight > toHeight {
+		return nil, fmt.Errorf("invalid height range [%d, %d]",
+			fromHeight, toHeight)
+	}
+
+	var kids []kidOutput
+	if err := ns.db.View(func(tx *bolt.Tx) error {
+		// Ensure that the chain bucket for this nursery store exists.
+		chainBucket := tx.Bucket(ns.pfxChainKey)
+		if chainBucket == nil {
+			return nil
+		}
+
+		// Ensure that the height index has been properly initialized
+		// for this chain.
+		hghtIndex := chainBucket.Bucket(heightIndexKey)
+		if hghtIndex == nil {
+			return nil
+		}
+
+		// Collect all non-empty heights within the range. As the
+		// height buckets are keyed by their big-endian height, the
+		// cursor will visit them in ascending order.
+		var lower, upper [4]byte
+		byteOrder.PutUint32(lower[:], fromHeight)
+		byteOrder.PutUint32(upper[:], toHeight)
+
+		var heights []uint32
+		c := hghtIndex.Cursor()
+		for k, _ := c.Seek(lower[:]); k != nil &&
+			bytes.Compare(k, upper[:]) <= 0; k, _ = c.Next() {
+
+			if len(k) != 4 {
+				continue
+			}
+			heights = append(heights, byteOrder.Uint32(k))
+		}
+
+		// Now, append the kindergarten outputs at each height, taking
+		// care to skip any outputs we've already seen.
+		seen := make(map[wire.OutPoint]struct{})
+		for _, height := range heights {
+			err := ns.forEachHeightPrefix(
+				context.Background(), tx, kndrPrefix, height,
+				func(buf []byte) error {
+					var kid kidOutput
+					kidReader := bytes.NewReader(buf)
+					if err := kid.Decode(kidReader); err != nil {
+						return err
+					}
+
+					if _, ok := seen[*kid.OutPoint()]; ok {
+						return nil
+					}
+					seen[*kid.OutPoint()] = struct{}{}
+
+					kids = append(kids, kid)
+
+					return nil
+				},
+			)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return kids, nil
+}
+
+// FetchPreschools returns a list of all outputs currently stored in the
+// preschool bucket.
+func (ns *nurseryStore) FetchPreschools() ([]kidOutput, error) {
+	return ns.FetchPreschoolsContext(context.Background())
+}
+
+// FetchPreschoolsContext returns a list of all outputs currently stored in the
+// preschool bucket. The scan periodically checks the provided context, and
+// aborts with the context's error if it has been cancelled, releasing the read
+// transaction.
+func (ns *nurseryStore) FetchPreschoolsContext(
+	ctx context.Context) ([]kidOutput, error) {
+
+	var kids []kidOutput
+	if err := ns.db.View(func(tx *bolt.Tx) error {
+
+		// Retrieve the existing chain bucket for this nursery store.
+		chainBucket := tx.Bucket(ns.pfxChainKey)
+		if chainBucket == nil {
+			return nil
+		}
+
+		// Load the existing channel index from the chain bucket.
+		chanIndex := chainBucket.Bucket(channelIndexKey)
+		if chanIndex == nil {
+			return nil
+		}
+
+		// Construct a list of all channels in the channel index that
+		// are currently being tracked by the nursery store.
+		var activeChannels [][]byte
+		if err := chanIndex.ForEach(func(chanBytes, _ []byte) error {
+			activeChannels = append(activeChannels, chanBytes)
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		// Iterate over all of the accumulated channels, and do a prefix
+		// scan inside of each channel bucket. Each output found that
+		// has a preschool prefix will be deserialized into a kidOutput,
+		// and added to our list of preschool outputs to return to the
+		// caller.
+		var numScanned int
+		for _, chanBytes := range activeChannels {
+			// Retrieve the channel bucket associated with this
+			// channel.
+			chanBucket := chanIndex.Bucket(chanBytes)
+			if chanBucket == nil {
+				continue
+			}
+
+			// All of the outputs of interest will start with the
+			// "pscl" prefix. So, we will perform a prefix scan of
+			// the channel bucket to efficiently enumerate all the
+			// desired outputs.
+			c := chanBucket.Cursor()
+			for k, v := c.Seek(psclPrefix); bytes.HasPrefix(
+				k, psclPrefix); k, v = c.Next() {
+
+				err := checkScanCancelled(ctx, numScanned)
+				if err != nil {
+					return err
+				}
+				numScanned++
+
+				// Deserialize each output as a kidOutput, since
+				// this should have been the type that was
+				// serialized when it was written to disk.
+				v, err := ns.decryptOutput(v)
+				if err != nil {
+					return err
+				}
+
+				var psclOutput kidOutput
+				psclReader := bytes.NewReader(v)
+				err = psclOutput.Decode(psclReader)
+				if err != nil {
+					return err
+				}
+
+				// Add the deserialized output to our list of
+				// preschool outputs.
+				kids = append(kids, psclOutput)
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return kids, nil
+}
+
+// HeightsBelowOrEqual returns a slice of all non-empty heights in the height
+// index at or below the provided upper bound.
+func (ns *nurseryStore) HeightsBelowOrEqual(height uint32) ([]uint32, error) {
+	var activeHeights []uint32
+	err := ns.db.View(func(tx *bolt.Tx) error {
+		// Ensure that the chain bucket for this nursery store exists.
+		chainBucket := tx.Bucket(ns.pfxChainKey)
+		if chainBucket == nil {
+			return nil
+		}
+
+		// Ensure that the height index has been properly initialized for this
+		// chain.
+		hghtIndex := chainBucket.Bucket(heightIndexKey)
+		if hghtIndex == nil {
+			return nil
+		}
+
+		// Serialize the provided height, as this will form the name of the
+		// bucket.
+		var lower, upper [4]byte
+		byteOrder.PutUint32(upper[:], height)
+
+		c := hghtIndex.Cursor()
+		for k, _ := c.Seek(lower[:]); bytes.Compare(k, upper[:]) <= 0 &&
+			len(k) == 4; k, _ = c.Next() {
+
+			activeHeights = append(activeHeights, byteOrder.Uint32(k))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return activeHeights, nil
+}
+
+// NextActionHeight returns the lowest non-empty height in the height index
+// that is strictly above the provided height. The returned boolean indicates
+// whether any such height exists, allowing the caller to wait until exactly
+// that height rather than polling at every block.
+func (ns *nurseryStore) NextActionHeight(afterHeight uint32) (uint32,
+	bool, error) {
+
+	var (
+		nextHeight uint32
+		found      bool
+	)
+	err := ns.db.View(func(tx *bolt.Tx) error {
+		// No heights can exist above the maximum height.
+		if afterHeight == math.MaxUint32 {
+			return nil
+		}
+
+		chainBucket := tx.Bucket(ns.pfxChainKey)
+		if chainBucket == nil {
+			return nil
+		}
+
+		hghtIndex := chainBucket.Bucket(heightIndexKey)
+		if hghtIndex == nil {
+			return nil
+		}
+
+		// Since heights are serialized big-endian, seeking to the
+		// height directly after the provided one will position the
+		// cursor at the next highest height in the index.
+		var lower [4]byte
+		byteOrder.PutUint32(lower[:], afterHeight+1)
+
+		c := hghtIndex.Cursor()
+		for k, _ := c.Seek(lower[:]); k != nil; k, _ = c.Next() {
+			if len(k) != 4 {
+				continue
+			}
+
+			nextHeight = byteOrder.Uint32(k)
+			found = true
 
-		// Retrieve the existing chain bucket for this nursery store.
-		chainBucket := tx.Bucket(ns.pfxChainKey)
-		if chainBucket == nil {
 			return nil
 		}
 
-		// Load the existing channel index from the chain bucket.
-		chanIndex := chainBucket.Bucket(channelIndexKey)
-		if chanIndex == nil {
+		return nil
+	})
+	if err != nil {
+		return 0, false, err
+	}
+
+	return nextHeight, found, nil
+}
+
+// ActiveChannelsAtHeight returns the distinct channel points that have outputs
+// referenced in the height index at the provided height. If the height has no
+// bucket in the height index, an empty slice is returned.
+func (ns *nurseryStore) ActiveChannelsAtHeight(
+	height uint32) ([]wire.OutPoint, error) {
+
+	activeChannels := make([]wire.OutPoint, 0)
+	if err := ns.db.View(func(tx *bolt.Tx) error {
+		hghtBucket := ns.getHeightBucket(tx, height)
+		if hghtBucket == nil {
 			return nil
 		}
 
-		// Construct a list of all channels in the channel index that
-		// are currently being tracked by the nursery store.
-		var activeChannels [][]byte
-		if err := chanIndex.ForEach(func(chanBytes, _ []byte) error {
-			activeChannels = append(activeChannels, chanBytes)
+		// Each channel with outputs at this height has a nested
+		// height-channel bucket, named by its serialized channel
+		// point.
+		return hghtBucket.ForEach(func(chanBytes, v []byte) error {
+			// Skip the finalized txn key, or any other values.
+			if v != nil {
+				return nil
+			}
+
+			var chanPoint wire.OutPoint
+			err := readOutpoint(bytes.NewReader(chanBytes), &chanPoint)
+			if err != nil {
+				return err
+			}
+
+			activeChannels = append(activeChannels, chanPoint)
+
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	return activeChannels, nil
+}
+
+// VerifyIntegrity performs a read-only cross-check of the height index against
+// the channel index. Every output referenced from the height index must have a
+// corresponding value in its channel bucket, and every crib or kindergarten
+// output in the channel index must be referenced by exactly one entry in the
+// height index. Rather than failing on the first inconsistency, a
+// human-readable description of each discrepancy is returned. An empty slice
+// indicates that no discrepancies were found.
+func (ns *nurseryStore) VerifyIntegrity() ([]string, error) {
+	discrepancies := make([]string, 0)
+	if err := ns.db.View(func(tx *bolt.Tx) error {
+		chainBucket := tx.Bucket(ns.pfxChainKey)
+		if chainBucket == nil {
 			return nil
-		}); err != nil {
-			return err
 		}
 
-		// Iterate over all of the accumulated channels, and do a prefix
-		// scan inside of each channel bucket. Each output found that
-		// has a preschool prefix will be deserialized into a kidOutput,
-		// and added to our list of preschool outputs to return to the
-		// caller.
-		for _, chanBytes := range activeChannels {
-			// Retrieve the channel bucket associated with this
-			// channel.
-			chanBucket := chanIndex.Bucket(chanBytes)
-			if chanBucket == nil {
-				continue
-			}
+		chanIndex := chainBucket.Bucket(channelIndexKey)
 
-			// All of the outputs of interest will start with the
-			// "pscl" prefix. So, we will perform a prefix scan of
-			// the channel bucket to efficiently enumerate all the
-			// desired outputs.
-			c := chanBucket.Cursor()
-			for k, v := c.Seek(psclPrefix); bytes.HasPrefix(
-				k, psclPrefix); k, v = c.Next() {
+		// First, walk the height index, ensuring each output it
+		// references exists in the channel index, and recording the
+		// number of times each output is referenced.
+		heightRefs := make(map[string]int)
+		hghtIndex := chainBucket.Bucket(heightIndexKey)
+		if hghtIndex != nil {
+			err := hghtIndex.ForEach(func(k, v []byte) error {
+				if v != nil || len(k) != 4 {
+					return nil
+				}
 
-				// Deserialize each output as a kidOutput, since
-				// this should have been the type that was
-				// serialized when it was written to disk.
-				var psclOutput kidOutput
-				psclReader := bytes.NewReader(v)
-				err := psclOutput.Decode(psclReader)
+				height := byteOrder.Uint32(k)
+				hghtBucket := hghtIndex.Bucket(k)
+
+				found, err := verifyHeightBucket(
+					chanIndex, hghtBucket, height,
+					heightRefs,
+				)
 				if err != nil {
 					return err
 				}
+				discrepancies = append(discrepancies, found...)
 
-				// Add the deserialized output to our list of
-				// preschool outputs.
-				kids = append(kids, psclOutput)
+				return nil
+			})
+			if err != nil {
+				return err
 			}
 		}
 
-		return nil
+		if chanIndex == nil {
+			return nil
+		}
+
+		// Now, walk the channel index, ensuring that each crib and
+		// kindergarten output is referenced exactly once from the
+		// height index.
+		return chanIndex.ForEach(func(chanBytes, v []byte) error {
+			if v != nil {
+				return nil
+			}
+
+			chanBucket := chanIndex.Bucket(chanBytes)
+			return chanBucket.ForEach(func(pfxKey, _ []byte) error {
+				if !bytes.HasPrefix(pfxKey, cribPrefix) &&
+					!bytes.HasPrefix(pfxKey, kndrPrefix) {
+
+					return nil
+				}
+
+				refKey := string(chanBytes) + string(pfxKey)
+				if heightRefs[refKey] == 1 {
+					return nil
+				}
+
+				desc := fmt.Sprintf("%v is referenced %d "+
+					"times in the height index, expected 1",
+					describeOutputKey(chanBytes, pfxKey),
+					heightRefs[refKey])
+				discrepancies = append(discrepancies, desc)
+
+				return nil
+			})
+		})
 	}); err != nil {
 		return nil, err
 	}
 
-	return kids, nil
+	return discrepancies, nil
 }
 
-// HeightsBelowOrEqual returns a slice of all non-empty heights in the height
-// index at or below the provided upper bound.
-func (ns *nurseryStore) HeightsBelowOrEqual(height uint32) ([]uint32, error) {
-	var activeHeights []uint32
-	err := ns.db.View(func(tx *bolt.Tx) error {
-		// Ensure that the chain bucket for this nursery store exists.
+// CompactHeightIndex removes any height buckets that no longer reference any
+// outputs, which may accumulate if the transitions that would normally prune
+// them are skipped, e.g. due to reorgs or crashes. Any empty height-channel
+// buckets are removed first, such that a height bucket is only deleted if none
+// of its height-channel buckets hold outputs. The number of height buckets
+// removed is returned. This is a maintenance operation that is safe to run at
+// any time.
+func (ns *nurseryStore) CompactHeightIndex() (removed int, err error) {
+	err = ns.db.Update(func(tx *bolt.Tx) error {
+		removed = 0
+
 		chainBucket := tx.Bucket(ns.pfxChainKey)
 		if chainBucket == nil {
 			return nil
 		}
-
-		// Ensure that the height index has been properly initialized for this
-		// chain.
 		hghtIndex := chainBucket.Bucket(heightIndexKey)
 		if hghtIndex == nil {
 			return nil
 		}
 
-		// Serialize the provided height, as this will form the name of the
-		// bucket.
-		var lower, upper [4]byte
-		byteOrder.PutUint32(upper[:], height)
+		// Collect all heights in the height index, as we can't remove
+		// buckets while iterating over them.
+		var heights []uint32
+		if err := hghtIndex.ForEach(func(k, v []byte) error {
+			if v == nil && len(k) == 4 {
+				heights = append(heights, byteOrder.Uint32(k))
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
 
-		c := hghtIndex.Cursor()
-		for k, _ := c.Seek(lower[:]); bytes.Compare(k, upper[:]) <= 0 &&
-			len(k) == 4; k, _ = c.Next() {
+		for _, height := range heights {
+			hghtBucket := ns.getHeightBucket(tx, height)
 
-			activeHeights = append(activeHeights, byteOrder.Uint32(k))
+			// Gather the height-channel buckets at this height, and
+			// remove those that are empty.
+			var channels [][]byte
+			if err := hghtBucket.ForEach(func(k, v []byte) error {
+				if v == nil {
+					channels = append(channels, k)
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+
+			for _, chanBytes := range channels {
+				err := removeBucketIfEmpty(hghtBucket, chanBytes)
+				if err != nil && err != errBucketNotEmpty {
+					return err
+				}
+			}
+
+			// With the empty height-channel buckets removed, the
+			// height bucket can be pruned if none remain.
+			pruned, err := ns.pruneHeight(tx, height)
+			if err != nil && err != errBucketNotEmpty {
+				return err
+			} else if err == nil && pruned {
+				utxnLog.Infof("Height bucket %d pruned", height)
+				removed++
+			}
 		}
 
 		return nil
 	})
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 
-	return activeHeights, nil
+	return removed, nil
 }
 
 // ForChanOutputs iterates over all outputs being incubated for a particular
@@ -832,39 +2097,324 @@ func (ns *nurseryStore) ListChannels() ([]wire.OutPoint, error) {
 			return nil
 		}
 
-		return chanIndex.ForEach(func(chanBytes, _ []byte) error {
-			var chanPoint wire.OutPoint
-			err := readOutpoint(bytes.NewReader(chanBytes), &chanPoint)
-			if err != nil {
+		return chanIndex.ForEach(func(chanBytes, _ []byte) error {
+			var chanPoint wire.OutPoint
+			err := readOutpoint(bytes.NewReader(chanBytes), &chanPoint)
+			if err != nil {
+				return err
+			}
+
+			activeChannels = append(activeChannels, chanPoint)
+
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	return activeChannels, nil
+}
+
+// NurseryStageReport summarizes the outputs in a single stage of incubation.
+type NurseryStageReport struct {
+	// NumOutputs is the number of outputs in this stage.
+	NumOutputs uint32
+
+	// Amount is the total value of the outputs in this stage.
+	Amount btcutil.Amount
+}
+
+// NurseryReport summarizes the funds in limbo within the nursery store,
+// grouped by the stage of incubation.
+type NurseryReport struct {
+	// Crib summarizes the outgoing htlc outputs awaiting the expiry of
+	// their CLTV before the second-layer timeout txn can be broadcast.
+	Crib NurseryStageReport
+
+	// Preschool summarizes the outputs awaiting the confirmation of the
+	// transaction that created them.
+	Preschool NurseryStageReport
+
+	// Kindergarten summarizes the outputs whose timelocks have begun
+	// ticking, and are awaiting maturity before being swept.
+	Kindergarten NurseryStageReport
+
+	// EarliestMaturity is the lowest maturity height of any crib or
+	// kindergarten output. Preschool outputs are not considered, as their
+	// maturity is not known until they confirm. This value will be zero
+	// if no such outputs exist.
+	EarliestMaturity uint32
+}
+
+// NurseryReport summarizes the outputs in limbo for a particular channel
+// point, grouped by the stage of incubation. If the channel point is nil, the
+// report aggregates across all channels being tracked by the nursery.
+func (ns *nurseryStore) NurseryReport(
+	chanPoint *wire.OutPoint) (*NurseryReport, error) {
+
+	report := &NurseryReport{}
+	if err := ns.db.View(func(tx *bolt.Tx) error {
+		if chanPoint != nil {
+			return ns.forChanOutputs(tx, chanPoint,
+				report.addOutput)
+		}
+
+		// Otherwise, we'll aggregate the outputs of every channel in
+		// the channel index.
+		chainBucket := tx.Bucket(ns.pfxChainKey)
+		if chainBucket == nil {
+			return nil
+		}
+		chanIndex := chainBucket.Bucket(channelIndexKey)
+		if chanIndex == nil {
+			return nil
+		}
+
+		return chanIndex.ForEach(func(chanBytes, v []byte) error {
+			// Each channel is stored as a nested bucket, so we'll
+			// skip any non-bucket entries.
+			if v != nil {
+				return nil
+			}
+
+			return chanIndex.Bucket(chanBytes).ForEach(
+				func(k, v []byte) error {
+					v, err := ns.decryptOutput(v)
+					if err != nil {
+						return err
+					}
+
+					return report.addOutput(k, v)
+				},
+			)
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// LimboBalance returns the total value of all outputs in the crib, preschool,
+// and kindergarten buckets across all channels, as a single figure. Preschool
+// outputs are included since, although their commitment transaction has not
+// yet confirmed, the funds are no longer spendable until swept.
+func (ns *nurseryStore) LimboBalance() (btcutil.Amount, error) {
+	// The aggregate nursery report visits each channel bucket once,
+	// decoding each output according to its prefix, so we'll simply sum
+	// the amounts of each stage.
+	report, err := ns.NurseryReport(nil)
+	if err != nil {
+		return 0, err
+	}
+
+	return report.Crib.Amount + report.Preschool.Amount +
+		report.Kindergarten.Amount, nil
+}
+
+// NurseryStats returns the number of outputs in the crib, preschool, and
+// kindergarten buckets across all channels. Since each output is keyed by its
+// state prefix, the outputs are classified by key alone, without decoding
+// their values. If the nursery store has not yet been initialized, zero is
+// returned for each count.
+func (ns *nurseryStore) NurseryStats() (cribCount, preschoolCount,
+	kinderCount int, err error) {
+
+	err = ns.db.View(func(tx *bolt.Tx) error {
+		chainBucket := tx.Bucket(ns.pfxChainKey)
+		if chainBucket == nil {
+			return nil
+		}
+		chanIndex := chainBucket.Bucket(channelIndexKey)
+		if chanIndex == nil {
+			return nil
+		}
+
+		chanCursor := chanIndex.Cursor()
+		chanBytes, v := chanCursor.First()
+		for ; chanBytes != nil; chanBytes, v = chanCursor.Next() {
+			// Each channel is stored as a nested bucket, so we'll
+			// skip any non-bucket entries.
+			if v != nil {
+				continue
+			}
+
+			c := chanIndex.Bucket(chanBytes).Cursor()
+			for k, _ := c.First(); k != nil; k, _ = c.Next() {
+				switch {
+				case bytes.HasPrefix(k, cribPrefix):
+					cribCount++
+				case bytes.HasPrefix(k, psclPrefix):
+					preschoolCount++
+				case bytes.HasPrefix(k, kndrPrefix):
+					kinderCount++
+				}
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	return cribCount, preschoolCount, kinderCount, nil
+}
+
+// addOutput adds the prefixed output stored in a channel bucket to the
+// report. Graduated outputs are no longer in limbo, and are ignored.
+func (r *NurseryReport) addOutput(k, v []byte) error {
+	var (
+		stage    *NurseryStageReport
+		kid      kidOutput
+		maturity uint32
+	)
+
+	switch {
+	case bytes.HasPrefix(k, cribPrefix):
+		// Crib outputs are the only kind stored as baby outputs, and
+		// mature once their CLTV expires.
+		var baby babyOutput
+		if err := baby.Decode(bytes.NewReader(v)); err != nil {
+			return err
+		}
+
+		stage = &r.Crib
+		kid = baby.kidOutput
+		maturity = baby.expiry
+
+	case bytes.HasPrefix(k, psclPrefix):
+		if err := kid.Decode(bytes.NewReader(v)); err != nil {
+			return err
+		}
+
+		stage = &r.Preschool
+
+	case bytes.HasPrefix(k, kndrPrefix):
+		if err := kid.Decode(bytes.NewReader(v)); err != nil {
+			return err
+		}
+
+		// Kindergarten outputs either have an absolute maturity, or
+		// one relative to their confirmation height.
+		stage = &r.Kindergarten
+		if kid.BlocksToMaturity() == 0 {
+			maturity = kid.absoluteMaturity
+		} else {
+			maturity = kid.ConfHeight() + kid.BlocksToMaturity()
+		}
+
+	default:
+		return nil
+	}
+
+	stage.NumOutputs++
+	stage.Amount += kid.Amount()
+
+	if maturity != 0 &&
+		(r.EarliestMaturity == 0 || maturity < r.EarliestMaturity) {
+
+		r.EarliestMaturity = maturity
+	}
+
+	return nil
+}
+
+// IsMatureChannel determines the whether or not all of the outputs in a
+// particular channel bucket have been marked as graduated.
+func (ns *nurseryStore) IsMatureChannel(chanPoint *wire.OutPoint) (bool, error) {
+	var isMature bool
+	err := ns.db.View(func(tx *bolt.Tx) error {
+		var err error
+		isMature, err = ns.isMatureChannel(tx, chanPoint, nil)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return isMature, nil
+}
+
+// GraduateKinderDryRun reports the channels that would become mature, and
+// thus be removed by RemoveChannel, if the provided kindergarten outputs were
+// graduated, without modifying the database. This allows the caller to learn
+// which channels a sweep would close before it is broadcast, deferring the
+// actual graduation until the sweep has confirmed. The channel points are
+// returned in the order they are first referenced by the provided outputs.
+// Channels that are unknown to the nursery store are skipped.
+func (ns *nurseryStore) GraduateKinderDryRun(
+	kids ...kidOutput) ([]wire.OutPoint, error) {
+
+	// Construct the set of kindergarten keys that would be graduated,
+	// along with the list of distinct channels they belong to.
+	graduating := make(map[string]struct{})
+	var chanPoints []wire.OutPoint
+	seenChans := make(map[wire.OutPoint]struct{})
+	for i := range kids {
+		pfxOutputKey, err := prefixOutputKey(
+			kndrPrefix, kids[i].OutPoint(),
+		)
+		if err != nil {
+			return nil, err
+		}
+		graduating[string(pfxOutputKey)] = struct{}{}
+
+		chanPoint := *kids[i].OriginChanPoint()
+		if _, ok := seenChans[chanPoint]; ok {
+			continue
+		}
+		seenChans[chanPoint] = struct{}{}
+		chanPoints = append(chanPoints, chanPoint)
+	}
+
+	var matureChans []wire.OutPoint
+	if err := ns.db.View(func(tx *bolt.Tx) error {
+		matureChans = nil
+		for i := range chanPoints {
+			isMature, err := ns.isMatureChannel(
+				tx, &chanPoints[i], graduating,
+			)
+			switch {
+			case err == ErrContractNotFound:
+				continue
+			case err != nil:
 				return err
 			}
 
-			activeChannels = append(activeChannels, chanPoint)
+			if isMature {
+				matureChans = append(matureChans, chanPoints[i])
+			}
+		}
 
-			return nil
-		})
+		return nil
 	}); err != nil {
 		return nil, err
 	}
 
-	return activeChannels, nil
+	return matureChans, nil
 }
 
-// IsMatureChannel determines the whether or not all of the outputs in a
-// particular channel bucket have been marked as graduated.
-func (ns *nurseryStore) IsMatureChannel(chanPoint *wire.OutPoint) (bool, error) {
-	err := ns.db.View(func(tx *bolt.Tx) error {
-		// Iterate over the contents of the channel bucket, computing
-		// both total number of outputs, and those that have the grad
-		// prefix.
-		return ns.forChanOutputs(tx, chanPoint,
-			func(pfxKey, _ []byte) error {
-				if !bytes.HasPrefix(pfxKey, gradPrefix) {
-					return ErrImmatureChannel
-				}
-				return nil
-			})
+// isMatureChannel determines whether or not all of the outputs in a particular
+// channel bucket have been marked as graduated. Any kindergarten outputs whose
+// prefixed keys are contained in the graduating set are considered graduated,
+// allowing the caller to determine whether the channel would be mature after
+// graduating them. A nil set may be provided to only consider the outputs that
+// have already graduated.
+func (ns *nurseryStore) isMatureChannel(tx *bolt.Tx, chanPoint *wire.OutPoint,
+	graduating map[string]struct{}) (bool, error) {
+
+	// Iterate over the contents of the channel bucket, ensuring that each
+	// output either has the grad prefix, or is about to be graduated.
+	err := ns.forChanOutputs(tx, chanPoint, func(pfxKey, _ []byte) error {
+		if bytes.HasPrefix(pfxKey, gradPrefix) {
+			return nil
+		}
+		if _, ok := graduating[string(pfxKey)]; ok {
+			return nil
+		}
 
+		return ErrImmatureChannel
 	})
 	if err != nil && err != ErrImmatureChannel {
 		return false, err
@@ -873,6 +2423,14 @@ func (ns *nurseryStore) IsMatureChannel(chanPoint *wire.OutPoint) (bool, error)
 	return err == nil, nil
 }
 
+// ErrSweepNotFound signals that no swept outputs have been recorded for a
+// particular sweep txid.
+var ErrSweepNotFound = errors.New("no outputs recorded for sweep txn")
+
+// ErrKinderNotFound signals that an output could not be found in the
+// kindergarten bucket.
+var ErrKinderNotFound = errors.New("kindergarten output not found")
+
 // ErrImmatureChannel signals a channel cannot be removed because not all of its
 // outputs have graduated.
 var ErrImmatureChannel = errors.New("cannot remove immature channel, " +
@@ -938,6 +2496,100 @@ func (ns *nurseryStore) RemoveChannel(chanPoint *wire.OutPoint) error {
 	})
 }
 
+// PurgeChannel forcibly erases all state for the provided channel point,
+// regardless of whether its outputs have graduated. The channel is removed
+// from every height bucket that references it, and any height buckets left
+// empty are pruned. If the channel is unknown, ErrContractNotFound is
+// returned.
+func (ns *nurseryStore) PurgeChannel(chanPoint *wire.OutPoint) error {
+	return ns.db.Update(func(tx *bolt.Tx) error {
+		// Retrieve the existing chain bucket for this nursery store.
+		chainBucket := tx.Bucket(ns.pfxChainKey)
+		if chainBucket == nil {
+			return ErrContractNotFound
+		}
+
+		// Retrieve the channel index stored in the chain bucket.
+		chanIndex := chainBucket.Bucket(channelIndexKey)
+		if chanIndex == nil {
+			return ErrContractNotFound
+		}
+
+		// Serialize the provided channel point, such that we can locate
+		// the channel's bucket in both the channel and height indexes.
+		var chanBuffer bytes.Buffer
+		if err := writeOutpoint(&chanBuffer, chanPoint); err != nil {
+			return err
+		}
+		chanBytes := chanBuffer.Bytes()
+
+		if chanIndex.Bucket(chanBytes) == nil {
+			return ErrContractNotFound
+		}
+
+		// The channel's outputs may be spread across many heights, so
+		// we'll scan the entire height index for height-channel
+		// buckets belonging to this channel. Since buckets can't be
+		// modified while iterating, we'll first collect the heights.
+		var heights []uint32
+		if hghtIndex := chainBucket.Bucket(heightIndexKey); hghtIndex != nil {
+			err := hghtIndex.ForEach(func(heightBytes, v []byte) error {
+				if v != nil || len(heightBytes) != 4 {
+					return nil
+				}
+
+				hghtBucket := hghtIndex.Bucket(heightBytes)
+				if hghtBucket.Bucket(chanBytes) == nil {
+					return nil
+				}
+
+				heights = append(
+					heights, byteOrder.Uint32(heightBytes),
+				)
+
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		// Now, remove the channel from each height bucket, pruning the
+		// height bucket if the channel was its last occupant.
+		for _, height := range heights {
+			hghtBucket := ns.getHeightBucket(tx, height)
+			if err := hghtBucket.DeleteBucket(chanBytes); err != nil {
+				return err
+			}
+
+			pruned, err := ns.pruneHeight(tx, height)
+			if err != nil && err != errBucketNotEmpty {
+				return err
+			} else if err == nil && pruned {
+				utxnLog.Infof("Height bucket %d pruned", height)
+			}
+		}
+
+		// Remove any of the channel's kindergarten outputs from the
+		// confirmation height index.
+		err := ns.chanBucketForEachKinder(tx, chanPoint,
+			func(pfxKey []byte, kid *kidOutput) error {
+				return ns.removeFromConfHeightIndex(
+					tx, kid.ConfHeight(), pfxKey,
+				)
+			},
+		)
+		if err != nil {
+			return err
+		}
+
+		utxnLog.Infof("Purged ChannelPoint(%v) and its entries at %d "+
+			"heights from nursery store", chanPoint, len(heights))
+
+		return chanIndex.DeleteBucket(chanBytes)
+	})
+}
+
 // LastFinalizedHeight returns the last block height for which the nursery
 // store has finalized a kindergarten class.
 func (ns *nurseryStore) LastFinalizedHeight() (uint32, error) {
@@ -1006,7 +2658,10 @@ func (ns *nurseryStore) enterCrib(tx *bolt.Tx, baby *babyOutput) error {
 	if err := baby.Encode(&babyBuffer); err != nil {
 		return err
 	}
-	babyBytes := babyBuffer.Bytes()
+	babyBytes, err := ns.encryptOutput(babyBuffer.Bytes())
+	if err != nil {
+		return err
+	}
 
 	// Now, insert the serialized output into its channel bucket under the
 	// prefixed key created above.
@@ -1053,7 +2708,12 @@ func (ns *nurseryStore) enterPreschool(tx *bolt.Tx, kid *kidOutput) error {
 		return err
 	}
 
-	return chanBucket.Put(pfxOutputKey, kidBuffer.Bytes())
+	kidBytes, err := ns.encryptOutput(kidBuffer.Bytes())
+	if err != nil {
+		return err
+	}
+
+	return chanBucket.Put(pfxOutputKey, kidBytes)
 }
 
 // createChannelBucket creates or retrieves a channel bucket for the provided
@@ -1232,9 +2892,11 @@ func (ns *nurseryStore) getHeightChanBucket(tx *bolt.Tx,
 // prefix matches that which is provided. This is used as a subroutine to help
 // enumerate crib and kindergarten outputs at a particular height. The callback
 // is invoked with serialized bytes retrieved for each output of interest,
-// allowing the caller to deserialize them into the appropriate type.
-func (ns *nurseryStore) forEachHeightPrefix(tx *bolt.Tx, prefix []byte,
-	height uint32, callback func([]byte) error) error {
+// allowing the caller to deserialize them into the appropriate type. The
+// provided context is checked periodically, and the scan is aborted with the
+// context's error if it has been cancelled.
+func (ns *nurseryStore) forEachHeightPrefix(ctx context.Context, tx *bolt.Tx,
+	prefix []byte, height uint32, callback func([]byte) error) error {
 
 	// Start by retrieving the height bucket corresponding to the provided
 	// block height.
@@ -1271,6 +2933,7 @@ func (ns *nurseryStore) forEachHeightPrefix(tx *bolt.Tx, prefix []byte,
 	// this height, filtering for outputs in each height-channel bucket that
 	// begin with the given prefix, and then retrieving the serialized
 	// outputs from the appropriate channel bucket.
+	var numScanned int
 	for _, chanBytes := range channelsAtHeight {
 		// Retrieve the height-channel bucket for this channel, which
 		// holds a sub-bucket for all outputs maturing at this height.
@@ -1297,6 +2960,12 @@ func (ns *nurseryStore) forEachHeightPrefix(tx *bolt.Tx, prefix []byte,
 		for k, _ := c.Seek(prefix); bytes.HasPrefix(
 			k, prefix); k, _ = c.Next() {
 
+			err := checkScanCancelled(ctx, numScanned)
+			if err != nil {
+				return err
+			}
+			numScanned++
+
 			// Use the prefix output key emitted from our scan to
 			// load the serialized babyOutput from the appropriate
 			// channel bucket.
@@ -1305,6 +2974,11 @@ func (ns *nurseryStore) forEachHeightPrefix(tx *bolt.Tx, prefix []byte,
 				return errors.New("unable to retrieve output")
 			}
 
+			outputBytes, err = ns.decryptOutput(outputBytes)
+			if err != nil {
+				return err
+			}
+
 			// Present the serialized bytes to our call back
 			// function, which is responsible for deserializing the
 			// bytes into the appropriate type.
@@ -1317,10 +2991,25 @@ func (ns *nurseryStore) forEachHeightPrefix(tx *bolt.Tx, prefix []byte,
 	return nil
 }
 
+// scanCancelInterval is the number of outputs visited by a long-running scan
+// between checks of whether its context has been cancelled.
+const scanCancelInterval = 100
+
+// checkScanCancelled returns the error of the provided context if it has been
+// cancelled, checking only once every scanCancelInterval outputs scanned.
+func checkScanCancelled(ctx context.Context, numScanned int) error {
+	if numScanned%scanCancelInterval != 0 {
+		return nil
+	}
+
+	return ctx.Err()
+}
+
 // forChanOutputs enumerates the outputs contained in a channel bucket to the
 // provided callback. The callback accepts a key-value pair of byte slices
 // corresponding to the prefixed-output key and the serialized output,
-// respectively.
+// respectively. If an encryptor is registered, the serialized output will be
+// decrypted before being passed to the callback.
 func (ns *nurseryStore) forChanOutputs(tx *bolt.Tx, chanPoint *wire.OutPoint,
 	callback func([]byte, []byte) error) error {
 
@@ -1329,7 +3018,18 @@ func (ns *nurseryStore) forChanOutputs(tx *bolt.Tx, chanPoint *wire.OutPoint,
 		return ErrContractNotFound
 	}
 
-	return chanBucket.ForEach(callback)
+	if ns.encryptor == nil {
+		return chanBucket.ForEach(callback)
+	}
+
+	return chanBucket.ForEach(func(k, v []byte) error {
+		v, err := ns.decryptOutput(v)
+		if err != nil {
+			return err
+		}
+
+		return callback(k, v)
+	})
 }
 
 // getLastFinalizedHeight is a helper method that retrieves the last height for
@@ -1475,6 +3175,316 @@ func (ns *nurseryStore) putLastGraduatedHeight(tx *bolt.Tx, height uint32) error
 // bucket failed because it still has active outputs.
 var errBucketNotEmpty = errors.New("bucket is not empty, cannot be pruned")
 
+// forEachKindergarten decodes each kindergarten output maturing at the given
+// height, and passes it to the provided callback.
+func (ns *nurseryStore) forEachKindergarten(tx *bolt.Tx, height uint32,
+	cb func(*kidOutput) error) error {
+
+	var kid kidOutput
+	return ns.forEachHeightPrefix(
+		context.Background(), tx, kndrPrefix, height,
+		func(buf []byte) error {
+			// We will attempt to deserialize all outputs stored
+			// with the kindergarten prefix into kidOutputs, since
+			// this is the expected type that would have been
+			// serialized previously.
+			kid = kidOutput{}
+			if err := kid.Decode(bytes.NewReader(buf)); err != nil {
+				return err
+			}
+
+			return cb(&kid)
+		},
+	)
+}
+
+// forEachCrib decodes each crib output expiring at the given height, and
+// passes it to the provided callback.
+func (ns *nurseryStore) forEachCrib(tx *bolt.Tx, height uint32,
+	cb func(*babyOutput) error) error {
+
+	var baby babyOutput
+	return ns.forEachHeightPrefix(
+		context.Background(), tx, cribPrefix, height,
+		func(buf []byte) error {
+			// We will attempt to deserialize all outputs stored
+			// with the crib prefix into babyOutputs, since this is
+			// the expected type that would have been serialized
+			// previously.
+			baby = babyOutput{}
+			if err := baby.Decode(bytes.NewReader(buf)); err != nil {
+				return err
+			}
+
+			return cb(&baby)
+		},
+	)
+}
+
+// addToConfHeightIndex records the prefixed output key of a kindergarten
+// output under its confirmation height, along with its channel point.
+func (ns *nurseryStore) addToConfHeightIndex(tx *bolt.Tx, height uint32,
+	chanPoint *wire.OutPoint, pfxKey []byte) error {
+
+	chainBucket, err := tx.CreateBucketIfNotExists(ns.pfxChainKey)
+	if err != nil {
+		return err
+	}
+	confIndex, err := chainBucket.CreateBucketIfNotExists(
+		confHeightIndexKey,
+	)
+	if err != nil {
+		return err
+	}
+
+	var heightBytes [4]byte
+	byteOrder.PutUint32(heightBytes[:], height)
+
+	confBucket, err := confIndex.CreateBucketIfNotExists(heightBytes[:])
+	if err != nil {
+		return err
+	}
+
+	var chanBuffer bytes.Buffer
+	if err := writeOutpoint(&chanBuffer, chanPoint); err != nil {
+		return err
+	}
+
+	return confBucket.Put(pfxKey, chanBuffer.Bytes())
+}
+
+// removeFromConfHeightIndex removes the prefixed output key from the
+// confirmation height index, pruning the height's bucket if it's left empty.
+func (ns *nurseryStore) removeFromConfHeightIndex(tx *bolt.Tx, height uint32,
+	pfxKey []byte) error {
+
+	confBucket := ns.getConfHeightBucket(tx, height)
+	if confBucket == nil {
+		return nil
+	}
+
+	if err := confBucket.Delete(pfxKey); err != nil {
+		return err
+	}
+
+	var heightBytes [4]byte
+	byteOrder.PutUint32(heightBytes[:], height)
+
+	confIndex := tx.Bucket(ns.pfxChainKey).Bucket(confHeightIndexKey)
+	err := removeBucketIfEmpty(confIndex, heightBytes[:])
+	if err != nil && err != errBucketNotEmpty {
+		return err
+	}
+
+	return nil
+}
+
+// getConfHeightBucket retrieves the bucket in the confirmation height index
+// for the provided height. If the bucket, or any bucket along its path, does
+// not exist, a nil value is returned.
+func (ns *nurseryStore) getConfHeightBucket(tx *bolt.Tx,
+	height uint32) *bolt.Bucket {
+
+	chainBucket := tx.Bucket(ns.pfxChainKey)
+	if chainBucket == nil {
+		return nil
+	}
+	confIndex := chainBucket.Bucket(confHeightIndexKey)
+	if confIndex == nil {
+		return nil
+	}
+
+	var heightBytes [4]byte
+	byteOrder.PutUint32(heightBytes[:], height)
+
+	return confIndex.Bucket(heightBytes[:])
+}
+
+// chanBucketForEachKinder decodes each kindergarten output of the provided
+// channel, and passes it to the callback along with its prefixed key.
+func (ns *nurseryStore) chanBucketForEachKinder(tx *bolt.Tx,
+	chanPoint *wire.OutPoint, cb func([]byte, *kidOutput) error) error {
+
+	// Since the callback may modify other buckets, we'll first collect
+	// the outputs before invoking it.
+	var (
+		pfxKeys [][]byte
+		kids    []kidOutput
+	)
+	err := ns.forChanOutputs(tx, chanPoint, func(k, v []byte) error {
+		if !bytes.HasPrefix(k, kndrPrefix) {
+			return nil
+		}
+
+		var kid kidOutput
+		if err := kid.Decode(bytes.NewReader(v)); err != nil {
+			return err
+		}
+
+		pfxKeys = append(pfxKeys, append([]byte(nil), k...))
+		kids = append(kids, kid)
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for i := range kids {
+		if err := cb(pfxKeys[i], &kids[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// kinderMaturityHeight computes the height at which the provided kindergarten
+// output will mature, and at which it should be placed in the height index.
+func (ns *nurseryStore) kinderMaturityHeight(tx *bolt.Tx,
+	kid *kidOutput) (uint32, error) {
+
+	// If this output has an absolute time lock, then we'll set the
+	// maturity height directly.
+	var maturityHeight uint32
+	if kid.BlocksToMaturity() == 0 {
+		maturityHeight = kid.absoluteMaturity
+	} else {
+		// Otherwise, since the CSV delay on the kid output has now
+		// begun ticking, we must insert a record of in the height
+		// index to remind us to revisit this output once it has fully
+		// matured.
+		//
+		// Compute the maturity height, by adding the output's CSV
+		// delay to its confirmation height.
+		maturityHeight = kid.ConfHeight() + kid.BlocksToMaturity()
+	}
+
+	// In the case of a Late Registration, we've already graduated the
+	// class that this kid is destined for. So we'll bump its height by one
+	// to ensure we don't forget to graduate it.
+	lastGradHeight, err := ns.getLastGraduatedHeight(tx)
+	if err != nil {
+		return 0, err
+	}
+	if maturityHeight <= lastGradHeight {
+		utxnLog.Debugf("Late Registration for kid output=%v "+
+			"detected: class_height=%v, last_graduated_height=%v",
+			kid.OutPoint(), maturityHeight, lastGradHeight)
+
+		maturityHeight = lastGradHeight + 1
+	}
+
+	return maturityHeight, nil
+}
+
+// verifyHeightBucket checks that every output referenced by the provided
+// height bucket exists in the channel index, returning a description of each
+// output that does not. The number of references to each output is also
+// recorded in heightRefs, keyed by the concatenation of its serialized channel
+// point and prefixed outpoint.
+func verifyHeightBucket(chanIndex, hghtBucket *bolt.Bucket, height uint32,
+	heightRefs map[string]int) ([]string, error) {
+
+	var discrepancies []string
+	err := hghtBucket.ForEach(func(chanBytes, v []byte) error {
+		// Skip the finalized txn key.
+		if v != nil {
+			return nil
+		}
+
+		var chanBucket *bolt.Bucket
+		if chanIndex != nil {
+			chanBucket = chanIndex.Bucket(chanBytes)
+		}
+
+		hghtChanBucket := hghtBucket.Bucket(chanBytes)
+		return hghtChanBucket.ForEach(func(pfxKey, _ []byte) error {
+			heightRefs[string(chanBytes)+string(pfxKey)]++
+
+			if chanBucket != nil && chanBucket.Get(pfxKey) != nil {
+				return nil
+			}
+
+			desc := fmt.Sprintf("height index at height=%d "+
+				"references %v, which is missing from the "+
+				"channel index", height,
+				describeOutputKey(chanBytes, pfxKey))
+			discrepancies = append(discrepancies, desc)
+
+			return nil
+		})
+	})
+
+	return discrepancies, err
+}
+
+// describeOutputKey returns a human-readable description of the output
+// identified by the provided serialized channel point and prefixed outpoint,
+// for use in logs and integrity reports. If either cannot be parsed, their raw
+// bytes are described instead.
+func describeOutputKey(chanBytes, pfxKey []byte) string {
+	var chanPoint wire.OutPoint
+	err := readOutpoint(bytes.NewReader(chanBytes), &chanPoint)
+	if err != nil || len(pfxKey) < 4 {
+		return fmt.Sprintf("output=%x of chan_point=%x", pfxKey,
+			chanBytes)
+	}
+
+	var outpoint wire.OutPoint
+	err = readOutpoint(bytes.NewReader(pfxKey[4:]), &outpoint)
+	if err != nil {
+		return fmt.Sprintf("output=%x of chan_point=%v", pfxKey,
+			chanPoint)
+	}
+
+	return fmt.Sprintf("%s output=%v of chan_point=%v", pfxKey[:4],
+		outpoint, chanPoint)
+}
+
+// heightsWithOutput returns all heights in the height index whose
+// height-channel bucket for the given channel point references the provided
+// prefixed output key.
+func (ns *nurseryStore) heightsWithOutput(tx *bolt.Tx, chanPoint *wire.OutPoint,
+	pfxKey []byte) ([]uint32, error) {
+
+	chainBucket := tx.Bucket(ns.pfxChainKey)
+	if chainBucket == nil {
+		return nil, nil
+	}
+	hghtIndex := chainBucket.Bucket(heightIndexKey)
+	if hghtIndex == nil {
+		return nil, nil
+	}
+
+	var chanBuffer bytes.Buffer
+	if err := writeOutpoint(&chanBuffer, chanPoint); err != nil {
+		return nil, err
+	}
+	chanBytes := chanBuffer.Bytes()
+
+	var heights []uint32
+	err := hghtIndex.ForEach(func(heightBytes, v []byte) error {
+		if v != nil || len(heightBytes) != 4 {
+			return nil
+		}
+
+		hghtChanBucket := hghtIndex.Bucket(heightBytes).Bucket(chanBytes)
+		if hghtChanBucket == nil || hghtChanBucket.Get(pfxKey) == nil {
+			return nil
+		}
+
+		heights = append(heights, byteOrder.Uint32(heightBytes))
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return heights, nil
+}
+
 // removeOutputFromHeight will delete the given output from the specified
 // height-channel bucket, and attempt to prune the upstream directories if they
 // are empty.
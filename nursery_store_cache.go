@@ -0,0 +1,261 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/roasbeef/btcd/chaincfg/chainhash"
+	"github.com/roasbeef/btcd/wire"
+	"github.com/roasbeef/btcutil"
+)
+
+// defaultNurseryCacheSize is the maximum number of channels whose outputs will
+// be held in memory by a cachedNurseryStore.
+const defaultNurseryCacheSize = 1000
+
+// cachedOutput is a copy of a single key-value pair from a channel bucket, as
+// passed to a ForChanOutputs callback.
+type cachedOutput struct {
+	key   []byte
+	value []byte
+}
+
+// cachedNurseryStore is a NurseryStore decorator that memoizes the results of
+// ForChanOutputs for each channel point. Any method that may modify the
+// outputs of a channel invalidates that channel's cache entry, while methods
+// that may modify the outputs of any number of channels, such as graduating
+// an entire height, invalidate the cache entirely. All other methods are
+// passed directly to the underlying store.
+type cachedNurseryStore struct {
+	NurseryStore
+
+	maxEntries int
+
+	mu       sync.RWMutex
+	chanOuts map[wire.OutPoint][]cachedOutput
+
+	// generation is incremented on every invalidation, and is used to
+	// prevent a read that raced with a write from caching stale outputs.
+	generation uint64
+}
+
+// A compile-time constraint to ensure cachedNurseryStore implements
+// NurseryStore.
+var _ NurseryStore = (*cachedNurseryStore)(nil)
+
+// NewCachedNurseryStore wraps the provided NurseryStore with a bounded,
+// concurrency-safe cache of the outputs of each channel, as returned by
+// ForChanOutputs.
+func NewCachedNurseryStore(store NurseryStore) NurseryStore {
+	return &cachedNurseryStore{
+		NurseryStore: store,
+		maxEntries:   defaultNurseryCacheSize,
+		chanOuts:     make(map[wire.OutPoint][]cachedOutput),
+	}
+}
+
+// ForChanOutputs iterates over all outputs being incubated for a particular
+// channel point, serving the outputs from the cache if they are present. On a
+// cache miss, the outputs are read from the underlying store and cached
+// before being passed to the callback.
+//
+// NOTE: Part of the NurseryStore interface.
+func (cs *cachedNurseryStore) ForChanOutputs(chanPoint *wire.OutPoint,
+	callback func([]byte, []byte) error) error {
+
+	cs.mu.RLock()
+	outputs, ok := cs.chanOuts[*chanPoint]
+	generation := cs.generation
+	cs.mu.RUnlock()
+
+	if !ok {
+		// The byte slices passed to the callback are only valid for
+		// the lifetime of the underlying transaction, so we'll copy
+		// each of them before adding them to the cache.
+		outputs = nil
+		err := cs.NurseryStore.ForChanOutputs(chanPoint,
+			func(k, v []byte) error {
+				outputs = append(outputs, cachedOutput{
+					key:   append([]byte(nil), k...),
+					value: append([]byte(nil), v...),
+				})
+				return nil
+			},
+		)
+		if err != nil {
+			return err
+		}
+
+		// Only cache the outputs if no invalidation occurred while
+		// they were being read, as they may otherwise be stale.
+		cs.mu.Lock()
+		if cs.generation == generation {
+			cs.insert(chanPoint, outputs)
+		}
+		cs.mu.Unlock()
+	}
+
+	for _, output := range outputs {
+		if err := callback(output.key, output.value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// insert adds the outputs of a channel to the cache, evicting an arbitrary
+// entry if the cache is full.
+//
+// NOTE: The caller MUST hold the write lock.
+func (cs *cachedNurseryStore) insert(chanPoint *wire.OutPoint,
+	outputs []cachedOutput) {
+
+	if _, ok := cs.chanOuts[*chanPoint]; !ok &&
+		len(cs.chanOuts) >= cs.maxEntries {
+
+		// Since map iteration order is randomized, this evicts a
+		// random entry.
+		for evicted := range cs.chanOuts {
+			delete(cs.chanOuts, evicted)
+			break
+		}
+	}
+
+	cs.chanOuts[*chanPoint] = outputs
+}
+
+// invalidate removes the cache entries for the provided channel points.
+func (cs *cachedNurseryStore) invalidate(chanPoints ...*wire.OutPoint) {
+	cs.mu.Lock()
+	cs.generation++
+	for _, chanPoint := range chanPoints {
+		delete(cs.chanOuts, *chanPoint)
+	}
+	cs.mu.Unlock()
+}
+
+// invalidateAll removes all entries from the cache.
+func (cs *cachedNurseryStore) invalidateAll() {
+	cs.mu.Lock()
+	cs.generation++
+	cs.chanOuts = make(map[wire.OutPoint][]cachedOutput)
+	cs.mu.Unlock()
+}
+
+// Incubate registers a set of CSV delayed outputs and incoming HTLC outputs,
+// invalidating the cache entries of their channels.
+//
+// NOTE: Part of the NurseryStore interface.
+func (cs *cachedNurseryStore) Incubate(kids []kidOutput,
+	babies []babyOutput) error {
+
+	chanPoints := make([]*wire.OutPoint, 0, len(kids)+len(babies))
+	for i := range kids {
+		chanPoints = append(chanPoints, kids[i].OriginChanPoint())
+	}
+	for i := range babies {
+		chanPoints = append(chanPoints, babies[i].OriginChanPoint())
+	}
+	defer cs.invalidate(chanPoints...)
+
+	return cs.NurseryStore.Incubate(kids, babies)
+}
+
+// CribToKinder atomically moves a babyOutput in the crib bucket to the
+// kindergarten bucket, invalidating the cache entry of its channel.
+//
+// NOTE: Part of the NurseryStore interface.
+func (cs *cachedNurseryStore) CribToKinder(baby *babyOutput) error {
+	defer cs.invalidate(baby.OriginChanPoint())
+
+	return cs.NurseryStore.CribToKinder(baby)
+}
+
+// PreschoolToKinder atomically moves a kidOutput from the preschool bucket to
+// the kindergarten bucket, invalidating the cache entry of its channel.
+//
+// NOTE: Part of the NurseryStore interface.
+func (cs *cachedNurseryStore) PreschoolToKinder(kid *kidOutput) error {
+	defer cs.invalidate(kid.OriginChanPoint())
+
+	return cs.NurseryStore.PreschoolToKinder(kid)
+}
+
+// BumpKinderFee records a new sweep fee rate for a kindergarten output,
+// invalidating the cache entry of its channel.
+//
+// NOTE: Part of the NurseryStore interface.
+func (cs *cachedNurseryStore) BumpKinderFee(kid *kidOutput,
+	newFeeRate btcutil.Amount) error {
+
+	defer cs.invalidate(kid.OriginChanPoint())
+
+	return cs.NurseryStore.BumpKinderFee(kid, newFeeRate)
+}
+
+// RelocateKinder corrects the confirmation height of a kindergarten output,
+// invalidating the cache entry of its channel.
+//
+// NOTE: Part of the NurseryStore interface.
+func (cs *cachedNurseryStore) RelocateKinder(kid *kidOutput,
+	newConfHeight uint32) error {
+
+	defer cs.invalidate(kid.OriginChanPoint())
+
+	return cs.NurseryStore.RelocateKinder(kid, newConfHeight)
+}
+
+// GraduateKinder moves the kindergarten outputs at the provided height into
+// the graduated state. As this may touch any number of channels, the cache is
+// invalidated entirely.
+//
+// NOTE: Part of the NurseryStore interface.
+func (cs *cachedNurseryStore) GraduateKinder(height uint32) error {
+	defer cs.invalidateAll()
+
+	return cs.NurseryStore.GraduateKinder(height)
+}
+
+// GraduateKinderWithSweep moves the kindergarten outputs at the provided
+// height into the graduated state, recording the sweeping txid. As this may
+// touch any number of channels, the cache is invalidated entirely.
+//
+// NOTE: Part of the NurseryStore interface.
+func (cs *cachedNurseryStore) GraduateKinderWithSweep(height uint32,
+	sweepTxid chainhash.Hash) ([]wire.OutPoint, error) {
+
+	defer cs.invalidateAll()
+
+	return cs.NurseryStore.GraduateKinderWithSweep(height, sweepTxid)
+}
+
+// RewindToHeight moves kindergarten outputs confirmed at or above the
+// provided height back to preschool. As this may touch any number of
+// channels, the cache is invalidated entirely.
+//
+// NOTE: Part of the NurseryStore interface.
+func (cs *cachedNurseryStore) RewindToHeight(height uint32) error {
+	defer cs.invalidateAll()
+
+	return cs.NurseryStore.RewindToHeight(height)
+}
+
+// RemoveChannel erases all entries from the channel bucket for the
+// provided channel point, invalidating its cache entry.
+//
+// NOTE: Part of the NurseryStore interface.
+func (cs *cachedNurseryStore) RemoveChannel(chanPoint *wire.OutPoint) error {
+	defer cs.invalidate(chanPoint)
+
+	return cs.NurseryStore.RemoveChannel(chanPoint)
+}
+
+// PurgeChannel removes all state for the provided channel point, regardless of
+// the stage of its outputs, invalidating its cache entry.
+//
+// NOTE: Part of the NurseryStore interface.
+func (cs *cachedNurseryStore) PurgeChannel(chanPoint *wire.OutPoint) error {
+	defer cs.invalidate(chanPoint)
+
+	return cs.NurseryStore.PurgeChannel(chanPoint)
+}
@@ -0,0 +1,113 @@
+// +build !rpctest
+
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/roasbeef/btcd/wire"
+)
+
+// countPrefix returns the number of outputs of the channel returned by
+// ForChanOutputs whose keys have the provided prefix.
+func countPrefix(t *testing.T, store NurseryStore, chanPoint *wire.OutPoint,
+	prefix []byte) int {
+
+	var count int
+	err := store.ForChanOutputs(chanPoint, func(k, _ []byte) error {
+		if bytes.HasPrefix(k, prefix) {
+			count++
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to iterate channel outputs: %v", err)
+	}
+
+	return count
+}
+
+// TestCachedNurseryStore tests that the cached nursery store serves repeated
+// ForChanOutputs calls from memory, invalidates a channel's entry when it is
+// modified through the cache, and never holds more than its maximum number of
+// entries.
+func TestCachedNurseryStore(t *testing.T) {
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to open channel db: %v", err)
+	}
+	defer cleanUp()
+
+	ns, err := newNurseryStore(&bitcoinTestnetGenesis, cdb)
+	if err != nil {
+		t.Fatalf("unable to open nursery store: %v", err)
+	}
+	store := NewCachedNurseryStore(ns)
+	cache := store.(*cachedNurseryStore)
+
+	kid0 := kidOutputs[0]
+	kid1 := kidOutputs[1]
+	chanPoint := kid0.OriginChanPoint()
+
+	// Querying an unknown channel should return an error, which must not
+	// be cached.
+	err = store.ForChanOutputs(chanPoint, func(_, _ []byte) error {
+		return nil
+	})
+	if err != ErrContractNotFound {
+		t.Fatalf("expected ErrContractNotFound, got: %v", err)
+	}
+
+	if err := store.Incubate([]kidOutput{kid0, kid1}, nil); err != nil {
+		t.Fatalf("unable to incubate outputs: %v", err)
+	}
+	if n := countPrefix(t, store, chanPoint, psclPrefix); n != 2 {
+		t.Fatalf("expected 2 pscl outputs, got %d", n)
+	}
+
+	// Modify the channel behind the cache's back. As the channel's
+	// outputs are now cached, the modification should not be visible
+	// through the cache.
+	if err := ns.PreschoolToKinder(&kid0); err != nil {
+		t.Fatalf("unable to move pscl output to kndr: %v", err)
+	}
+	if n := countPrefix(t, store, chanPoint, psclPrefix); n != 2 {
+		t.Fatalf("expected 2 cached pscl outputs, got %d", n)
+	}
+
+	// Modifying the channel through the cache should invalidate its
+	// entry, such that both modifications are now visible.
+	if err := store.PreschoolToKinder(&kid1); err != nil {
+		t.Fatalf("unable to move pscl output to kndr: %v", err)
+	}
+	if n := countPrefix(t, store, chanPoint, psclPrefix); n != 0 {
+		t.Fatalf("expected 0 pscl outputs, got %d", n)
+	}
+	if n := countPrefix(t, store, chanPoint, kndrPrefix); n != 2 {
+		t.Fatalf("expected 2 kndr outputs, got %d", n)
+	}
+
+	// Finally, shrink the cache to a single entry, and check that caching
+	// the outputs of a second channel evicts the first.
+	cache.maxEntries = 1
+
+	baby := babyOutputs[0]
+	baby.originChanPoint = outPoints[5]
+	if err := store.Incubate(nil, []babyOutput{baby}); err != nil {
+		t.Fatalf("unable to incubate output: %v", err)
+	}
+	if n := countPrefix(t, store, &outPoints[5], cribPrefix); n != 1 {
+		t.Fatalf("expected 1 crib output, got %d", n)
+	}
+
+	cache.mu.RLock()
+	numEntries := len(cache.chanOuts)
+	_, ok := cache.chanOuts[outPoints[5]]
+	cache.mu.RUnlock()
+
+	if numEntries != 1 || !ok {
+		t.Fatalf("expected only the second channel to be cached, "+
+			"found %d entries", numEntries)
+	}
+}
@@ -3,14 +3,25 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	crand "crypto/rand"
+	"fmt"
 	"io/ioutil"
+	"math"
+	"math/rand"
 	"os"
 	"reflect"
 	"testing"
 
 	"github.com/btcsuite/btclog"
+	"github.com/coreos/bbolt"
 	"github.com/lightningnetwork/lnd/channeldb"
+	"github.com/roasbeef/btcd/chaincfg/chainhash"
 	"github.com/roasbeef/btcd/wire"
+	"github.com/roasbeef/btcutil"
 )
 
 func init() {
@@ -99,6 +110,63 @@ func TestNurseryStoreInit(t *testing.T) {
 	assertLastGraduatedHeight(t, ns, 0)
 }
 
+// TestListNurseryChains asserts that ListNurseryChains returns the chain hash
+// of each nursery store that has persisted state, and nothing else.
+func TestListNurseryChains(t *testing.T) {
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to open channel db: %v", err)
+	}
+	defer cleanUp()
+
+	// Before any nursery store has written state, no chains should be
+	// returned.
+	chains, err := ListNurseryChains(cdb)
+	if err != nil {
+		t.Fatalf("unable to list nursery chains: %v", err)
+	}
+	if chains == nil || len(chains) != 0 {
+		t.Fatalf("expected empty slice of chains, got %v", chains)
+	}
+
+	// Incubate an output within a nursery store for each of two chains.
+	chainHashes := []chainhash.Hash{
+		bitcoinTestnetGenesis, litecoinTestnetGenesis,
+	}
+	for i := range chainHashes {
+		ns, err := newNurseryStore(&chainHashes[i], cdb)
+		if err != nil {
+			t.Fatalf("unable to open nursery store: %v", err)
+		}
+
+		err = ns.Incubate([]kidOutput{kidOutputs[0]}, nil)
+		if err != nil {
+			t.Fatalf("unable to incubate output: %v", err)
+		}
+	}
+
+	chains, err = ListNurseryChains(cdb)
+	if err != nil {
+		t.Fatalf("unable to list nursery chains: %v", err)
+	}
+	if len(chains) != len(chainHashes) {
+		t.Fatalf("expected %d chains, got %d", len(chainHashes),
+			len(chains))
+	}
+	for _, chainHash := range chainHashes {
+		var found bool
+		for _, chain := range chains {
+			if chain == chainHash {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Fatalf("chain %v not listed", chainHash)
+		}
+	}
+}
+
 // TestNurseryStoreIncubate tests the primary state transitions taken by outputs
 // in the nursery store. The test is designed to walk both commitment or htlc
 // outputs through the nursery store, verifying the properties of the
@@ -244,10 +312,10 @@ func TestNurseryStoreIncubate(t *testing.T) {
 		// If there are any htlc outputs to incubate, we will walk them
 		// through their two-stage incubation process.
 		if len(test.htlcOutputs) > 0 {
-			for i, htlcOutput := range test.htlcOutputs {
+			for i := range test.htlcOutputs {
 				// Begin by moving each htlc output from the
 				// crib to kindergarten state.
-				err = ns.CribToKinder(&htlcOutput)
+				err = ns.CribToKinder(&test.htlcOutputs[i])
 				if err != nil {
 					t.Fatalf("unable to move htlc output from "+
 						"crib to kndr: %v", err)
@@ -511,225 +579,2001 @@ func TestNurseryStoreGraduate(t *testing.T) {
 	assertHeightIsPurged(t, ns, maturityHeight)
 }
 
-// assertNumChanOutputs checks that the channel bucket has the expected number
-// of outputs.
-func assertNumChanOutputs(t *testing.T, ns NurseryStore,
-	chanPoint *wire.OutPoint, expectedNum int) {
-
-	var count int
-	err := ns.ForChanOutputs(chanPoint, func([]byte, []byte) error {
-		count++
-		return nil
-	})
+// TestNurseryStoreFetchKindergartensRange tests that kindergarten outputs
+// maturing across a range of heights can be fetched in a single call, ordered
+// by their maturity height.
+func TestNurseryStoreFetchKindergartensRange(t *testing.T) {
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to open channel db: %v", err)
+	}
+	defer cleanUp()
 
-	if count == 0 && err == ErrContractNotFound {
-		return
-	} else if err != nil {
-		t.Fatalf("unable to count num outputs for channel %v: %v",
-			chanPoint, err)
+	ns, err := newNurseryStore(&bitcoinTestnetGenesis, cdb)
+	if err != nil {
+		t.Fatalf("unable to open nursery store: %v", err)
 	}
 
-	if count != expectedNum {
-		t.Fatalf("nursery store should have %d outputs, found %d",
-			expectedNum, count)
+	// We'll incubate the first four kid outputs, two of which mature at
+	// height 1042, and two at height 528, then move them all to the
+	// kindergarten bucket.
+	kids := make([]kidOutput, 4)
+	copy(kids, kidOutputs[:4])
+	if err := ns.Incubate(kids, nil); err != nil {
+		t.Fatalf("unable to incubate outputs: %v", err)
+	}
+	for i := range kids {
+		if err := ns.PreschoolToKinder(&kids[i]); err != nil {
+			t.Fatalf("unable to move pscl output to kndr: %v", err)
+		}
 	}
-}
 
-// assertLastFinalizedHeight checks that the nursery stores last finalized
-// height matches the expected height.
-func assertLastFinalizedHeight(t *testing.T, ns NurseryStore,
-	expected uint32) {
+	// Outputs maturing at the same height may be returned in any order,
+	// so we'll only assert that the expected set of outputs is returned,
+	// and that they're sorted by maturity height.
+	assertKndrRange := func(from, to uint32, expected []kidOutput) {
+		kndrOutputs, err := ns.FetchKindergartensRange(from, to)
+		if err != nil {
+			t.Fatalf("unable to fetch kindergartens in range "+
+				"[%d, %d]: %v", from, to, err)
+		}
+		if len(kndrOutputs) != len(expected) {
+			t.Fatalf("expected %d outputs in range [%d, %d], "+
+				"got %d", len(expected), from, to,
+				len(kndrOutputs))
+		}
 
-	lfh, err := ns.LastFinalizedHeight()
-	if err != nil {
-		t.Fatalf("unable to get last finalized height: %v", err)
+		expectedSet := make(map[wire.OutPoint]struct{})
+		for _, kid := range expected {
+			expectedSet[*kid.OutPoint()] = struct{}{}
+		}
+
+		var lastMaturity uint32
+		for _, kid := range kndrOutputs {
+			if _, ok := expectedSet[*kid.OutPoint()]; !ok {
+				t.Fatalf("unexpected output %v in range "+
+					"[%d, %d]", kid.OutPoint(), from, to)
+			}
+
+			maturity := kid.ConfHeight() + kid.BlocksToMaturity()
+			if maturity < lastMaturity {
+				t.Fatalf("outputs not sorted by maturity "+
+					"height: %d after %d", maturity,
+					lastMaturity)
+			}
+			lastMaturity = maturity
+		}
 	}
 
-	if lfh != expected {
-		t.Fatalf("expected last finalized height to be %d, got %d",
-			expected, lfh)
+	// The full range should return all outputs.
+	assertKndrRange(0, 2000, kids)
+
+	// Ranges that only partially cover the maturity heights should only
+	// return the outputs maturing within them.
+	assertKndrRange(528, 528, kids[2:])
+	assertKndrRange(1000, 1042, kids[:2])
+	assertKndrRange(529, 1041, nil)
+
+	// Finally, an invalid range should be rejected.
+	if _, err := ns.FetchKindergartensRange(10, 9); err == nil {
+		t.Fatalf("expected error for invalid range")
 	}
 }
 
-// assertLastGraduatedHeight checks that the nursery stores last purged height
-// matches the expected height.
-func assertLastGraduatedHeight(t *testing.T, ns NurseryStore, expected uint32) {
-	lgh, err := ns.LastGraduatedHeight()
+// TestNurseryStoreNurseryReport tests that the nursery report correctly
+// summarizes the outputs in limbo at each stage, both for a single channel and
+// aggregated across all channels.
+func TestNurseryStoreNurseryReport(t *testing.T) {
+	cdb, cleanUp, err := makeTestDB()
 	if err != nil {
-		t.Fatalf("unable to get last graduated height: %v", err)
+		t.Fatalf("unable to open channel db: %v", err)
 	}
+	defer cleanUp()
 
-	if lgh != expected {
-		t.Fatalf("expected last graduated height to be %d, got %d",
-			expected, lgh)
+	ns, err := newNurseryStore(&bitcoinTestnetGenesis, cdb)
+	if err != nil {
+		t.Fatalf("unable to open nursery store: %v", err)
 	}
-}
 
-// assertNumPreschools loads all preschool outputs and verifies their count
-// matches the expected number.
-func assertNumPreschools(t *testing.T, ns NurseryStore, expected int) {
-	psclOutputs, err := ns.FetchPreschools()
-	if err != nil {
-		t.Fatalf("unable to retrieve preschool outputs: %v", err)
+	// We'll incubate two preschool outputs and a single crib output for
+	// the first channel, which will mature at the crib's expiry height of
+	// 4.
+	firstChan := kidOutputs[0].OriginChanPoint()
+	kids := []kidOutput{kidOutputs[0], kidOutputs[1]}
+	babies := []babyOutput{babyOutputs[1]}
+	if err := ns.Incubate(kids, babies); err != nil {
+		t.Fatalf("unable to incubate outputs: %v", err)
 	}
 
-	if len(psclOutputs) != expected {
-		t.Fatalf("expected number of pscl outputs to be %d, got %v",
-			expected, len(psclOutputs))
+	// For the second channel, we'll incubate a single output and move it
+	// to the kindergarten bucket, where it will mature at height 528.
+	secondKid := kidOutputs[3]
+	secondKid.originChanPoint = outPoints[5]
+	if err := ns.Incubate([]kidOutput{secondKid}, nil); err != nil {
+		t.Fatalf("unable to incubate outputs: %v", err)
+	}
+	if err := ns.PreschoolToKinder(&secondKid); err != nil {
+		t.Fatalf("unable to move pscl output to kndr: %v", err)
 	}
-}
 
-// assertNumChannels checks that the nursery has a given number of active
-// channels.
-func assertNumChannels(t *testing.T, ns NurseryStore, expected int) {
-	channels, err := ns.ListChannels()
-	if err != nil {
-		t.Fatalf("unable to fetch channels from nursery store: %v",
-			err)
+	assertReport := func(chanPoint *wire.OutPoint,
+		expected *NurseryReport) {
+
+		report, err := ns.NurseryReport(chanPoint)
+		if err != nil {
+			t.Fatalf("unable to fetch nursery report: %v", err)
+		}
+		if *report != *expected {
+			t.Fatalf("unexpected nursery report for %v: want "+
+				"%+v, got %+v", chanPoint, expected, report)
+		}
 	}
 
-	if len(channels) != expected {
-		t.Fatalf("expected number of active channels to be %d, got %d",
-			expected, len(channels))
+	assertReport(firstChan, &NurseryReport{
+		Crib: NurseryStageReport{
+			NumOutputs: 1,
+			Amount:     babyOutputs[1].Amount(),
+		},
+		Preschool: NurseryStageReport{
+			NumOutputs: 2,
+			Amount:     kids[0].Amount() + kids[1].Amount(),
+		},
+		EarliestMaturity: 4,
+	})
+	assertReport(&outPoints[5], &NurseryReport{
+		Kindergarten: NurseryStageReport{
+			NumOutputs: 1,
+			Amount:     secondKid.Amount(),
+		},
+		EarliestMaturity: 528,
+	})
+
+	// A nil channel point should aggregate the outputs of both channels.
+	assertReport(nil, &NurseryReport{
+		Crib: NurseryStageReport{
+			NumOutputs: 1,
+			Amount:     babyOutputs[1].Amount(),
+		},
+		Preschool: NurseryStageReport{
+			NumOutputs: 2,
+			Amount:     kids[0].Amount() + kids[1].Amount(),
+		},
+		Kindergarten: NurseryStageReport{
+			NumOutputs: 1,
+			Amount:     secondKid.Amount(),
+		},
+		EarliestMaturity: 4,
+	})
+
+	// Finally, requesting a report for an unknown channel should fail.
+	if _, err := ns.NurseryReport(&outPoints[4]); err != ErrContractNotFound {
+		t.Fatalf("expected ErrContractNotFound, got %v", err)
 	}
 }
 
-// assertHeightIsPurged checks that the finalized transaction, kindergarten, and
-// htlc outputs at a particular height are all nil.
-func assertHeightIsPurged(t *testing.T, ns NurseryStore,
-	height uint32) {
-
-	finalTx, kndrOutputs, cribOutputs, err := ns.FetchClass(height)
+// TestNurseryStorePurgeChannel tests that purging a channel removes all of its
+// outputs from the channel and height indexes, pruning any emptied height
+// buckets, while leaving other channels untouched.
+func TestNurseryStorePurgeChannel(t *testing.T) {
+	cdb, cleanUp, err := makeTestDB()
 	if err != nil {
-		t.Fatalf("unable to retrieve class at height=%d: %v",
-			height, err)
+		t.Fatalf("unable to open channel db: %v", err)
 	}
+	defer cleanUp()
 
-	if finalTx != nil {
-		t.Fatalf("height=%d not purged, final txn should be nil", height)
+	ns, err := newNurseryStore(&bitcoinTestnetGenesis, cdb)
+	if err != nil {
+		t.Fatalf("unable to open nursery store: %v", err)
 	}
 
-	if kndrOutputs != nil {
-		t.Fatalf("height=%d not purged, kndr outputs should be nil", height)
+	// The first channel will have outputs spread across three heights:
+	// two crib outputs expiring at heights 4 and 3829, and a kindergarten
+	// output maturing at height 1042.
+	firstChan := kidOutputs[0].OriginChanPoint()
+	kid := kidOutputs[0]
+	babies := []babyOutput{babyOutputs[0], babyOutputs[1]}
+	if err := ns.Incubate([]kidOutput{kid}, babies); err != nil {
+		t.Fatalf("unable to incubate outputs: %v", err)
 	}
-
-	if cribOutputs != nil {
-		t.Fatalf("height=%d not purged, crib outputs should be nil", height)
+	if err := ns.PreschoolToKinder(&kid); err != nil {
+		t.Fatalf("unable to move pscl output to kndr: %v", err)
 	}
-}
 
-// assertCribAtExpiryHeight loads the class at the given height, and verifies
-// that the given htlc output is one of the crib outputs.
-func assertCribAtExpiryHeight(t *testing.T, ns NurseryStore,
-	htlcOutput *babyOutput) {
-
-	expiryHeight := htlcOutput.expiry
-	_, _, cribOutputs, err := ns.FetchClass(expiryHeight)
-	if err != nil {
-		t.Fatalf("unable to retrieve class at height=%d: %v",
-			expiryHeight, err)
+	// The second channel will have a single kindergarten output that
+	// shares the height of 1042 with the first channel.
+	secondKid := kidOutputs[3]
+	secondKid.originChanPoint = outPoints[5]
+	secondKid.confHeight = 1000
+	secondKid.blocksToMaturity = 42
+	if err := ns.Incubate([]kidOutput{secondKid}, nil); err != nil {
+		t.Fatalf("unable to incubate outputs: %v", err)
+	}
+	if err := ns.PreschoolToKinder(&secondKid); err != nil {
+		t.Fatalf("unable to move pscl output to kndr: %v", err)
 	}
 
-	for _, crib := range cribOutputs {
-		if reflect.DeepEqual(&crib, htlcOutput) {
-			return
+	assertNumChannels(t, ns, 2)
+	assertHeightIndex := func(expected []uint32) {
+		heights, err := ns.HeightsBelowOrEqual(5000)
+		if err != nil {
+			t.Fatalf("unable to fetch heights: %v", err)
+		}
+		if !reflect.DeepEqual(heights, expected) {
+			t.Fatalf("expected heights %v, got %v", expected,
+				heights)
 		}
 	}
+	assertHeightIndex([]uint32{4, 1042, 3829})
 
-	t.Fatalf("could not find crib output %v at height %d",
-		htlcOutput.OutPoint(), expiryHeight)
-}
+	// Purging the first channel should remove it entirely, pruning the
+	// heights that only it occupied.
+	if err := ns.PurgeChannel(firstChan); err != nil {
+		t.Fatalf("unable to purge channel: %v", err)
+	}
 
-// assertCribNotAtExpiryHeight loads the class at the given height, and verifies
-// that the given htlc output is not one of the crib outputs.
-func assertCribNotAtExpiryHeight(t *testing.T, ns NurseryStore,
-	htlcOutput *babyOutput) {
+	assertNumChannels(t, ns, 1)
+	assertHeightIndex([]uint32{1042})
+	assertNumChanOutputs(t, ns, &outPoints[5], 1)
 
-	expiryHeight := htlcOutput.expiry
-	_, _, cribOutputs, err := ns.FetchClass(expiryHeight)
-	if err != nil {
-		t.Fatalf("unable to retrieve class at height %d: %v",
-			expiryHeight, err)
+	err = ns.ForChanOutputs(firstChan, func(_, _ []byte) error {
+		return nil
+	})
+	if err != ErrContractNotFound {
+		t.Fatalf("expected ErrContractNotFound, got %v", err)
 	}
 
-	for _, crib := range cribOutputs {
-		if reflect.DeepEqual(&crib, htlcOutput) {
-			t.Fatalf("found find crib output %v at height %d",
-				htlcOutput.OutPoint(), expiryHeight)
-		}
+	// The second channel's output should still be retrievable at its
+	// maturity height.
+	_, kndrOutputs, _, err := ns.FetchClass(1042)
+	if err != nil {
+		t.Fatalf("unable to fetch class: %v", err)
 	}
-}
-
-// assertFinalizedTxn loads the class at the given height and compares the
-// returned finalized txn to that in the class. It is safe to presented a nil
-// expected transaction.
-func assertFinalizedTxn(t *testing.T, ns NurseryStore, height uint32,
-	exFinalTx *wire.MsgTx) {
+	if len(kndrOutputs) != 1 ||
+		*kndrOutputs[0].OutPoint() != *secondKid.OutPoint() {
 
-	finalTx, _, _, err := ns.FetchClass(height)
-	if err != nil {
-		t.Fatalf("unable to fetch class at height=%d: %v", height,
-			err)
+		t.Fatalf("unexpected kindergarten outputs: %v", kndrOutputs)
 	}
 
-	if !reflect.DeepEqual(finalTx, exFinalTx) {
-		t.Fatalf("expected finalized txn at height=%d "+
-			"to be %v, got %v", height, finalTx.TxHash(),
-			exFinalTx.TxHash())
+	// Finally, purging an unknown channel should fail.
+	if err := ns.PurgeChannel(firstChan); err != ErrContractNotFound {
+		t.Fatalf("expected ErrContractNotFound, got %v", err)
 	}
 }
 
-// assertKndrAtMaturityHeight loads the class at the provided height and
-// verifies that the provided kid output is one of the kindergarten outputs
-// returned.
-func assertKndrAtMaturityHeight(t *testing.T, ns NurseryStore,
-	kndrOutput *kidOutput) {
+// TestNurseryStoreBumpKinderFee tests that bumping the fee of a kindergarten
+// output persists the new fee rate and increments its broadcast attempts.
+func TestNurseryStoreBumpKinderFee(t *testing.T) {
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to open channel db: %v", err)
+	}
+	defer cleanUp()
 
-	maturityHeight := kndrOutput.ConfHeight() +
-		kndrOutput.BlocksToMaturity()
-	_, kndrOutputs, _, err := ns.FetchClass(maturityHeight)
+	ns, err := newNurseryStore(&bitcoinTestnetGenesis, cdb)
 	if err != nil {
-		t.Fatalf("unable to retrieve class at height %d: %v",
-			maturityHeight, err)
+		t.Fatalf("unable to open nursery store: %v", err)
 	}
 
-	for _, kndr := range kndrOutputs {
-		if reflect.DeepEqual(&kndr, kndrOutput) {
-			return
-		}
+	kid := kidOutputs[0]
+	if err := ns.Incubate([]kidOutput{kid}, nil); err != nil {
+		t.Fatalf("unable to incubate outputs: %v", err)
 	}
 
-	t.Fatalf("could not find kndr output %v at height %d",
-		kndrOutput.OutPoint(), maturityHeight)
-}
+	// The output can't have its fee bumped while in preschool.
+	if err := ns.BumpKinderFee(&kid, 1000); err != ErrKinderNotFound {
+		t.Fatalf("expected ErrKinderNotFound, got %v", err)
+	}
 
-// assertKndrNotAtMaturityHeight loads the class at the provided height and
-// verifies that the provided kid output is not one of the kindergarten outputs
-// returned.
-func assertKndrNotAtMaturityHeight(t *testing.T, ns NurseryStore,
-	kndrOutput *kidOutput) {
+	if err := ns.PreschoolToKinder(&kid); err != nil {
+		t.Fatalf("unable to move pscl output to kndr: %v", err)
+	}
 
-	maturityHeight := kndrOutput.ConfHeight() +
-		kndrOutput.BlocksToMaturity()
+	// Bump the fee twice, each of which should increment the broadcast
+	// attempts.
+	feeRates := []btcutil.Amount{1000, 2500}
+	for i, feeRate := range feeRates {
+		if err := ns.BumpKinderFee(&kid, feeRate); err != nil {
+			t.Fatalf("unable to bump kinder fee: %v", err)
+		}
+		if kid.SweepFeeRate() != feeRate ||
+			kid.BroadcastAttempts() != uint32(i+1) {
 
-	_, kndrOutputs, _, err := ns.FetchClass(maturityHeight)
+			t.Fatalf("kid output not updated: fee rate %v, "+
+				"attempts %v", kid.SweepFeeRate(),
+				kid.BroadcastAttempts())
+		}
+	}
+
+	// The persisted output should reflect the latest fee rate and
+	// broadcast count.
+	_, kndrOutputs, _, err := ns.FetchClass(
+		kid.ConfHeight() + kid.BlocksToMaturity(),
+	)
 	if err != nil {
-		t.Fatalf("unable to retrieve class at height %d: %v",
-			maturityHeight, err)
+		t.Fatalf("unable to fetch class: %v", err)
 	}
+	if len(kndrOutputs) != 1 {
+		t.Fatalf("expected 1 kindergarten output, got %d",
+			len(kndrOutputs))
+	}
+	if kndrOutputs[0].SweepFeeRate() != 2500 ||
+		kndrOutputs[0].BroadcastAttempts() != 2 {
 
-	for _, kndr := range kndrOutputs {
-		if reflect.DeepEqual(&kndr, kndrOutput) {
-			t.Fatalf("found find kndr output %v at height %d",
-				kndrOutput.OutPoint(), maturityHeight)
-		}
+		t.Fatalf("unexpected persisted output: fee rate %v, "+
+			"attempts %v", kndrOutputs[0].SweepFeeRate(),
+			kndrOutputs[0].BroadcastAttempts())
 	}
 }
 
-// assertChannelMaturity queries the nursery store for the maturity of the given
-// channel, failing if the result does not match the expectedMaturity.
-func assertChannelMaturity(t *testing.T, ns NurseryStore,
-	chanPoint *wire.OutPoint, expectedMaturity bool) {
+// TestNurseryStoreNextActionHeight tests that NextActionHeight returns the
+// lowest height in the height index strictly above the provided height.
+func TestNurseryStoreNextActionHeight(t *testing.T) {
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to open channel db: %v", err)
+	}
+	defer cleanUp()
+
+	ns, err := newNurseryStore(&bitcoinTestnetGenesis, cdb)
+	if err != nil {
+		t.Fatalf("unable to open nursery store: %v", err)
+	}
+
+	// With an empty nursery store, there should be no next height.
+	if _, ok, err := ns.NextActionHeight(0); err != nil || ok {
+		t.Fatalf("expected no next height, got ok=%v err=%v", ok, err)
+	}
+
+	// Incubating the crib outputs will populate the height index at their
+	// expiry heights of 4 and 3829.
+	babies := []babyOutput{babyOutputs[0], babyOutputs[1]}
+	if err := ns.Incubate(nil, babies); err != nil {
+		t.Fatalf("unable to incubate outputs: %v", err)
+	}
+
+	tests := []struct {
+		afterHeight uint32
+		nextHeight  uint32
+		found       bool
+	}{
+		{0, 4, true},
+		{3, 4, true},
+		{4, 3829, true},
+		{3828, 3829, true},
+		{3829, 0, false},
+		{math.MaxUint32, 0, false},
+	}
+	for _, test := range tests {
+		nextHeight, found, err := ns.NextActionHeight(test.afterHeight)
+		if err != nil {
+			t.Fatalf("unable to fetch next action height: %v", err)
+		}
+		if nextHeight != test.nextHeight || found != test.found {
+			t.Fatalf("after height %d: expected (%d, %v), got "+
+				"(%d, %v)", test.afterHeight, test.nextHeight,
+				test.found, nextHeight, found)
+		}
+	}
+}
+
+// TestNurseryStoreFinalizeKinderAt tests that FinalizeKinderAt lags the best
+// height by the reorg safety depth, and never rewinds the last finalized
+// height when the best height rewinds during a reorg.
+func TestNurseryStoreFinalizeKinderAt(t *testing.T) {
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to open channel db: %v", err)
+	}
+	defer cleanUp()
+
+	ns, err := newNurseryStore(&bitcoinTestnetGenesis, cdb)
+	if err != nil {
+		t.Fatalf("unable to open nursery store: %v", err)
+	}
+
+	const reorgSafetyDepth = 6
+	ns.SetReorgSafetyDepth(reorgSafetyDepth)
+
+	finalizeAt := func(bestHeight, expLastFinalized uint32) {
+		if err := ns.FinalizeKinderAt(bestHeight); err != nil {
+			t.Fatalf("unable to finalize at best height %d: %v",
+				bestHeight, err)
+		}
+		assertLastFinalizedHeight(t, ns, expLastFinalized)
+	}
+
+	// While the best height is below the safety depth, nothing should be
+	// finalized.
+	finalizeAt(reorgSafetyDepth-1, 0)
+
+	// Advancing the best height should finalize the height lagging it by
+	// the safety depth.
+	finalizeAt(99, 99-reorgSafetyDepth)
+	finalizeAt(100, 100-reorgSafetyDepth)
+
+	// Now, simulate a reorg that replaces the blocks at heights 99 and
+	// 100. As the new blocks are connected, the target heights will fall
+	// at or below the last finalized height, so they should be skipped.
+	finalizeAt(99, 100-reorgSafetyDepth)
+	finalizeAt(100, 100-reorgSafetyDepth)
+
+	// Once the new chain extends past the old tip, finalization should
+	// resume as usual.
+	finalizeAt(101, 101-reorgSafetyDepth)
+}
+
+// TestNurseryStoreRewindToHeight tests that rewinding after a reorg moves any
+// kindergarten outputs confirmed within the reorged blocks back into the
+// preschool bucket, leaving earlier outputs untouched.
+func TestNurseryStoreRewindToHeight(t *testing.T) {
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to open channel db: %v", err)
+	}
+	defer cleanUp()
+
+	ns, err := newNurseryStore(&bitcoinTestnetGenesis, cdb)
+	if err != nil {
+		t.Fatalf("unable to open nursery store: %v", err)
+	}
+
+	// We'll incubate the first four kid outputs, two of which confirmed at
+	// height 1000, and two at height 500, then move them all to the
+	// kindergarten bucket.
+	chanPoint := kidOutputs[0].OriginChanPoint()
+	kids := make([]kidOutput, 4)
+	copy(kids, kidOutputs[:4])
+	if err := ns.Incubate(kids, nil); err != nil {
+		t.Fatalf("unable to incubate outputs: %v", err)
+	}
+	for i := range kids {
+		if err := ns.PreschoolToKinder(&kids[i]); err != nil {
+			t.Fatalf("unable to move pscl output to kndr: %v", err)
+		}
+	}
+	assertNumPreschools(t, ns, 0)
+
+	// Simulate a 3-block reorg from a best height of 1001 back to 998,
+	// which invalidates the confirmations at heights 999 through 1001.
+	// The outputs confirmed at height 1000 should be rewound, and it
+	// should be safe to do so repeatedly.
+	for i := 0; i < 2; i++ {
+		if err := ns.RewindToHeight(999); err != nil {
+			t.Fatalf("unable to rewind to height: %v", err)
+		}
+
+		assertNumPreschools(t, ns, 2)
+		assertNumChanOutputs(t, ns, chanPoint, 4)
+		if err := verifyNurseryIndexes(ns); err != nil {
+			t.Fatalf("inconsistent indexes after rewind: %v", err)
+		}
+
+		// Only the height of the outputs confirmed at height 500
+		// should remain in the height index.
+		heights, err := ns.HeightsBelowOrEqual(2000)
+		if err != nil {
+			t.Fatalf("unable to fetch heights: %v", err)
+		}
+		if !reflect.DeepEqual(heights, []uint32{528}) {
+			t.Fatalf("unexpected heights after rewind: %v",
+				heights)
+		}
+	}
+
+	// The rewound outputs should no longer have a confirmation height,
+	// and can be moved to the kindergarten bucket once they reconfirm.
+	preschools, err := ns.FetchPreschools()
+	if err != nil {
+		t.Fatalf("unable to fetch preschools: %v", err)
+	}
+	for i := range preschools {
+		if preschools[i].ConfHeight() != 0 {
+			t.Fatalf("expected rewound output to have no "+
+				"confirmation height, got %d",
+				preschools[i].ConfHeight())
+		}
+
+		preschools[i].SetConfHeight(1001)
+		if err := ns.PreschoolToKinder(&preschools[i]); err != nil {
+			t.Fatalf("unable to move pscl output to kndr: %v", err)
+		}
+	}
+	assertNumPreschools(t, ns, 0)
+
+	// Finally, once a height has been finalized, rewinding below it
+	// should be refused.
+	if err := ns.FinalizeKinder(1043, nil); err != nil {
+		t.Fatalf("unable to finalize kinder: %v", err)
+	}
+	if err := ns.RewindToHeight(999); err == nil {
+		t.Fatalf("expected rewind below last finalized height to fail")
+	}
+	assertNumPreschools(t, ns, 0)
+}
+
+// TestNurseryStoreForEachOutput tests that the streaming iterators visit each
+// crib and kindergarten output at a height, and abort early if the callback
+// returns an error.
+func TestNurseryStoreForEachOutput(t *testing.T) {
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to open channel db: %v", err)
+	}
+	defer cleanUp()
+
+	ns, err := newNurseryStore(&bitcoinTestnetGenesis, cdb)
+	if err != nil {
+		t.Fatalf("unable to open nursery store: %v", err)
+	}
+
+	// We'll incubate two kid outputs maturing at height 1042, and two
+	// crib outputs expiring at height 4.
+	kids := make([]kidOutput, 2)
+	copy(kids, kidOutputs[:2])
+	babies := []babyOutput{babyOutputs[1], babyOutputs[2]}
+	if err := ns.Incubate(kids, babies); err != nil {
+		t.Fatalf("unable to incubate outputs: %v", err)
+	}
+	for i := range kids {
+		if err := ns.PreschoolToKinder(&kids[i]); err != nil {
+			t.Fatalf("unable to move pscl output to kndr: %v", err)
+		}
+	}
+
+	var numKids int
+	err = ns.ForEachKindergarten(1042, func(kid *kidOutput) error {
+		numKids++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to iterate kindergarten outputs: %v", err)
+	}
+	if numKids != len(kids) {
+		t.Fatalf("expected %d kindergarten outputs, got %d",
+			len(kids), numKids)
+	}
+
+	var cribAmt btcutil.Amount
+	err = ns.ForEachCrib(4, func(baby *babyOutput) error {
+		cribAmt += baby.Amount()
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to iterate crib outputs: %v", err)
+	}
+	if cribAmt != babies[0].Amount()+babies[1].Amount() {
+		t.Fatalf("unexpected total crib amount: %v", cribAmt)
+	}
+
+	// Returning an error from the callback should abort iteration after
+	// the first output, and the error should be passed through.
+	errAbort := fmt.Errorf("abort")
+	numKids = 0
+	err = ns.ForEachKindergarten(1042, func(kid *kidOutput) error {
+		numKids++
+		return errAbort
+	})
+	if err != errAbort || numKids != 1 {
+		t.Fatalf("expected iteration to abort after one output, "+
+			"visited %d with err %v", numKids, err)
+	}
+}
+
+// TestNurseryStoreGraduateKinderWithSweep tests that graduating a kindergarten
+// class with a sweep txid records the graduated outpoints under that txid.
+func TestNurseryStoreGraduateKinderWithSweep(t *testing.T) {
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to open channel db: %v", err)
+	}
+	defer cleanUp()
+
+	ns, err := newNurseryStore(&bitcoinTestnetGenesis, cdb)
+	if err != nil {
+		t.Fatalf("unable to open nursery store: %v", err)
+	}
+
+	// We'll incubate two kid outputs maturing at height 1042, and move
+	// them to the kindergarten bucket.
+	kids := make([]kidOutput, 2)
+	copy(kids, kidOutputs[:2])
+	if err := ns.Incubate(kids, nil); err != nil {
+		t.Fatalf("unable to incubate outputs: %v", err)
+	}
+	for i := range kids {
+		if err := ns.PreschoolToKinder(&kids[i]); err != nil {
+			t.Fatalf("unable to move pscl output to kndr: %v", err)
+		}
+	}
+
+	sweepTxid := timeoutTx.TxHash()
+	if _, err := ns.FetchSweepOutputs(sweepTxid); err != ErrSweepNotFound {
+		t.Fatalf("expected ErrSweepNotFound, got %v", err)
+	}
+
+	graduated, err := ns.GraduateKinderWithSweep(1042, sweepTxid)
+	if err != nil {
+		t.Fatalf("unable to graduate kindergarten class: %v", err)
+	}
+	if len(graduated) != len(kids) {
+		t.Fatalf("expected %d graduated outputs, got %d", len(kids),
+			len(graduated))
+	}
+
+	// The recorded outpoints should match those returned, and include
+	// each of the kid outputs.
+	swept, err := ns.FetchSweepOutputs(sweepTxid)
+	if err != nil {
+		t.Fatalf("unable to fetch sweep outputs: %v", err)
+	}
+	if !reflect.DeepEqual(swept, graduated) {
+		t.Fatalf("expected swept outputs %v, got %v", graduated,
+			swept)
+	}
+	sweptSet := make(map[wire.OutPoint]struct{})
+	for _, outpoint := range swept {
+		sweptSet[outpoint] = struct{}{}
+	}
+	for _, kid := range kids {
+		if _, ok := sweptSet[*kid.OutPoint()]; !ok {
+			t.Fatalf("output %v missing from sweep", kid.OutPoint())
+		}
+	}
+
+	// The outputs should now be graduated.
+	assertChannelMaturity(t, ns, kids[0].OriginChanPoint(), true)
+}
+
+// TestNurseryStoreStats tests that NurseryStats counts the outputs in each
+// stage of incubation.
+func TestNurseryStoreStats(t *testing.T) {
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to open channel db: %v", err)
+	}
+	defer cleanUp()
+
+	ns, err := newNurseryStore(&bitcoinTestnetGenesis, cdb)
+	if err != nil {
+		t.Fatalf("unable to open nursery store: %v", err)
+	}
+
+	assertStats := func(expCrib, expPscl, expKndr int) {
+		crib, pscl, kndr, err := ns.NurseryStats()
+		if err != nil {
+			t.Fatalf("unable to fetch nursery stats: %v", err)
+		}
+		if crib != expCrib || pscl != expPscl || kndr != expKndr {
+			t.Fatalf("expected (crib=%d, pscl=%d, kndr=%d), got "+
+				"(crib=%d, pscl=%d, kndr=%d)", expCrib,
+				expPscl, expKndr, crib, pscl, kndr)
+		}
+	}
+
+	// An empty nursery store should report no outputs.
+	assertStats(0, 0, 0)
+
+	kids := make([]kidOutput, 2)
+	copy(kids, kidOutputs[:2])
+	babies := []babyOutput{babyOutputs[1], babyOutputs[2]}
+	if err := ns.Incubate(kids, babies); err != nil {
+		t.Fatalf("unable to incubate outputs: %v", err)
+	}
+	assertStats(2, 2, 0)
+
+	if err := ns.PreschoolToKinder(&kids[0]); err != nil {
+		t.Fatalf("unable to move pscl output to kndr: %v", err)
+	}
+	assertStats(2, 1, 1)
+
+	// Graduated outputs are no longer counted.
+	if err := ns.GraduateKinder(1042); err != nil {
+		t.Fatalf("unable to graduate kindergarten class: %v", err)
+	}
+	assertStats(2, 1, 0)
+}
+
+// BenchmarkNurseryStats measures the cost of counting the outputs in the
+// nursery store, which should scale with the total number of outputs without
+// allocating for each one.
+func BenchmarkNurseryStats(b *testing.B) {
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		b.Fatalf("unable to open channel db: %v", err)
+	}
+	defer cleanUp()
+
+	ns, err := newNurseryStore(&bitcoinTestnetGenesis, cdb)
+	if err != nil {
+		b.Fatalf("unable to open nursery store: %v", err)
+	}
+
+	// Populate the nursery store with a number of preschool outputs spread
+	// across several channels.
+	const numChans, numOutputsPerChan = 10, 100
+	var kids []kidOutput
+	for i := 0; i < numChans; i++ {
+		for j := 0; j < numOutputsPerChan; j++ {
+			kid := kidOutputs[0]
+			kid.originChanPoint.Index = uint32(i)
+			kid.outpoint.Index = uint32(j)
+			kids = append(kids, kid)
+		}
+	}
+	if err := ns.Incubate(kids, nil); err != nil {
+		b.Fatalf("unable to incubate outputs: %v", err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, pscl, _, err := ns.NurseryStats()
+		if err != nil {
+			b.Fatalf("unable to fetch nursery stats: %v", err)
+		}
+		if pscl != len(kids) {
+			b.Fatalf("expected %d preschool outputs, got %d",
+				len(kids), pscl)
+		}
+	}
+}
+
+// TestMigrateNurseryChain tests that migrating a nursery store to a new chain
+// hash preserves all of its outputs and persisted heights, and removes the
+// store for the old chain hash.
+func TestMigrateNurseryChain(t *testing.T) {
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to open channel db: %v", err)
+	}
+	defer cleanUp()
+
+	oldStore, err := newNurseryStore(&bitcoinTestnetGenesis, cdb)
+	if err != nil {
+		t.Fatalf("unable to open nursery store: %v", err)
+	}
+
+	// Populate the store with preschool, kindergarten, and crib outputs,
+	// along with a finalized and graduated height.
+	kids := make([]kidOutput, 3)
+	copy(kids, kidOutputs[:3])
+	babies := []babyOutput{babyOutputs[0]}
+	if err := oldStore.Incubate(kids, babies); err != nil {
+		t.Fatalf("unable to incubate outputs: %v", err)
+	}
+	if err := oldStore.PreschoolToKinder(&kids[0]); err != nil {
+		t.Fatalf("unable to move pscl output to kndr: %v", err)
+	}
+	if err := oldStore.FinalizeKinder(500, nil); err != nil {
+		t.Fatalf("unable to finalize kinder: %v", err)
+	}
+	if err := oldStore.GraduateHeight(400); err != nil {
+		t.Fatalf("unable to graduate height: %v", err)
+	}
+
+	oldPreschools, err := oldStore.FetchPreschools()
+	if err != nil {
+		t.Fatalf("unable to fetch preschools: %v", err)
+	}
+	_, oldKndr, oldCribs, err := oldStore.FetchClass(1042)
+	if err != nil {
+		t.Fatalf("unable to fetch class: %v", err)
+	}
+	_, _, oldCribs2, err := oldStore.FetchClass(3829)
+	if err != nil {
+		t.Fatalf("unable to fetch class: %v", err)
+	}
+	oldCribs = append(oldCribs, oldCribs2...)
+
+	err = MigrateNurseryChain(
+		cdb, &bitcoinTestnetGenesis, &litecoinTestnetGenesis,
+	)
+	if err != nil {
+		t.Fatalf("unable to migrate nursery chain: %v", err)
+	}
+
+	// Only the new chain should now have a nursery store.
+	chains, err := ListNurseryChains(cdb)
+	if err != nil {
+		t.Fatalf("unable to list nursery chains: %v", err)
+	}
+	if len(chains) != 1 || chains[0] != litecoinTestnetGenesis {
+		t.Fatalf("unexpected nursery chains after migration: %v",
+			chains)
+	}
+
+	newStore, err := newNurseryStore(&litecoinTestnetGenesis, cdb)
+	if err != nil {
+		t.Fatalf("unable to open nursery store: %v", err)
+	}
+
+	newPreschools, err := newStore.FetchPreschools()
+	if err != nil {
+		t.Fatalf("unable to fetch preschools: %v", err)
+	}
+	if !reflect.DeepEqual(oldPreschools, newPreschools) {
+		t.Fatalf("preschools don't match after migration")
+	}
+
+	_, newKndr, newCribs, err := newStore.FetchClass(1042)
+	if err != nil {
+		t.Fatalf("unable to fetch class: %v", err)
+	}
+	_, _, newCribs2, err := newStore.FetchClass(3829)
+	if err != nil {
+		t.Fatalf("unable to fetch class: %v", err)
+	}
+	newCribs = append(newCribs, newCribs2...)
+	if !reflect.DeepEqual(oldKndr, newKndr) {
+		t.Fatalf("kindergarten outputs don't match after migration")
+	}
+	if !reflect.DeepEqual(oldCribs, newCribs) {
+		t.Fatalf("crib outputs don't match after migration")
+	}
+
+	assertLastFinalizedHeight(t, newStore, 500)
+	assertLastGraduatedHeight(t, newStore, 400)
+	assertNumChanOutputs(t, newStore, kids[0].OriginChanPoint(), 4)
+
+	// Migrating again from the old chain should fail, as it no longer
+	// exists.
+	err = MigrateNurseryChain(
+		cdb, &bitcoinTestnetGenesis, &litecoinTestnetGenesis,
+	)
+	if err == nil {
+		t.Fatalf("expected migration of missing chain to fail")
+	}
+}
+
+// TestNurseryStoreConfHeightIndex tests that the confirmation height index
+// tracks each kindergarten output throughout its lifecycle, and is left empty
+// once all outputs have graduated or been purged.
+func TestNurseryStoreConfHeightIndex(t *testing.T) {
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to open channel db: %v", err)
+	}
+	defer cleanUp()
+
+	ns, err := newNurseryStore(&bitcoinTestnetGenesis, cdb)
+	if err != nil {
+		t.Fatalf("unable to open nursery store: %v", err)
+	}
+
+	assertConfirmedAt := func(height uint32, expected []kidOutput) {
+		kids, err := ns.FetchOutputsConfirmedAt(height)
+		if err != nil {
+			t.Fatalf("unable to fetch outputs confirmed at "+
+				"height %d: %v", height, err)
+		}
+		if len(kids) != len(expected) {
+			t.Fatalf("expected %d outputs confirmed at height "+
+				"%d, got %d", len(expected), height, len(kids))
+		}
+
+		expectedSet := make(map[wire.OutPoint]struct{})
+		for _, kid := range expected {
+			expectedSet[*kid.OutPoint()] = struct{}{}
+		}
+		for _, kid := range kids {
+			if _, ok := expectedSet[*kid.OutPoint()]; !ok {
+				t.Fatalf("unexpected output %v confirmed at "+
+					"height %d", kid.OutPoint(), height)
+			}
+		}
+	}
+	assertConfIndexEmpty := func() {
+		err := cdb.View(func(tx *bolt.Tx) error {
+			chainBucket := tx.Bucket(ns.pfxChainKey)
+			if chainBucket == nil {
+				return nil
+			}
+			confIndex := chainBucket.Bucket(confHeightIndexKey)
+			if confIndex == nil {
+				return nil
+			}
+
+			return isBucketEmpty(confIndex)
+		})
+		if err != nil {
+			t.Fatalf("conf height index not empty: %v", err)
+		}
+	}
+
+	// We'll incubate two kid outputs confirmed at height 1000, and a crib
+	// output whose second-stage txn confirmed at height 500.
+	kids := make([]kidOutput, 2)
+	copy(kids, kidOutputs[:2])
+	baby := babyOutputs[1]
+	if err := ns.Incubate(kids, []babyOutput{baby}); err != nil {
+		t.Fatalf("unable to incubate outputs: %v", err)
+	}
+
+	// Outputs that haven't reached the kindergarten aren't indexed.
+	assertConfirmedAt(1000, nil)
+	assertConfirmedAt(500, nil)
+
+	for i := range kids {
+		if err := ns.PreschoolToKinder(&kids[i]); err != nil {
+			t.Fatalf("unable to move pscl output to kndr: %v", err)
+		}
+	}
+	if err := ns.CribToKinder(&baby); err != nil {
+		t.Fatalf("unable to move crib output to kndr: %v", err)
+	}
+
+	assertConfirmedAt(1000, kids)
+	assertConfirmedAt(500, []kidOutput{baby.kidOutput})
+
+	// Graduating each class should remove its outputs from the index.
+	if err := ns.GraduateKinder(1042); err != nil {
+		t.Fatalf("unable to graduate kindergarten class: %v", err)
+	}
+	assertConfirmedAt(1000, nil)
+	assertConfirmedAt(500, []kidOutput{baby.kidOutput})
+
+	if err := ns.GraduateKinder(528); err != nil {
+		t.Fatalf("unable to graduate kindergarten class: %v", err)
+	}
+	assertConfirmedAt(500, nil)
+	assertConfIndexEmpty()
+
+	// Finally, purging a channel with kindergarten outputs should also
+	// remove them from the index.
+	purgedKid := kidOutputs[3]
+	purgedKid.originChanPoint = outPoints[5]
+	if err := ns.Incubate([]kidOutput{purgedKid}, nil); err != nil {
+		t.Fatalf("unable to incubate outputs: %v", err)
+	}
+	if err := ns.PreschoolToKinder(&purgedKid); err != nil {
+		t.Fatalf("unable to move pscl output to kndr: %v", err)
+	}
+	assertConfirmedAt(500, []kidOutput{purgedKid})
+
+	if err := ns.PurgeChannel(&outPoints[5]); err != nil {
+		t.Fatalf("unable to purge channel: %v", err)
+	}
+	assertConfirmedAt(500, nil)
+	assertConfIndexEmpty()
+}
+
+// aesGCMEncryptor is an EncryptorDecryptor backed by AES-GCM, which prepends
+// a random nonce to each ciphertext.
+type aesGCMEncryptor struct {
+	aead cipher.AEAD
+}
+
+func newAESGCMEncryptor() (*aesGCMEncryptor, error) {
+	var key [32]byte
+	if _, err := crand.Read(key[:]); err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &aesGCMEncryptor{aead: aead}, nil
+}
+
+func (e *aesGCMEncryptor) Encrypt(plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, e.aead.NonceSize())
+	if _, err := crand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return e.aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func (e *aesGCMEncryptor) Decrypt(ciphertext []byte) ([]byte, error) {
+	nonceSize := e.aead.NonceSize()
+	if len(ciphertext) < nonceSize {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+
+	return e.aead.Open(
+		nil, ciphertext[:nonceSize], ciphertext[nonceSize:], nil,
+	)
+}
+
+// TestNurseryStoreEncryptor tests that outputs are encrypted on disk when an
+// encryptor is registered, and are transparently decrypted when read.
+func TestNurseryStoreEncryptor(t *testing.T) {
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to open channel db: %v", err)
+	}
+	defer cleanUp()
+
+	ns, err := newNurseryStore(&bitcoinTestnetGenesis, cdb)
+	if err != nil {
+		t.Fatalf("unable to open nursery store: %v", err)
+	}
+
+	encryptor, err := newAESGCMEncryptor()
+	if err != nil {
+		t.Fatalf("unable to create encryptor: %v", err)
+	}
+	ns.SetEncryptor(encryptor)
+
+	kid := kidOutputs[0]
+	baby := babyOutputs[1]
+	if err := ns.Incubate([]kidOutput{kid}, []babyOutput{baby}); err != nil {
+		t.Fatalf("unable to incubate outputs: %v", err)
+	}
+
+	// The bytes stored on disk should differ from the plaintext encoding
+	// of the output.
+	var plaintext bytes.Buffer
+	if err := kid.Encode(&plaintext); err != nil {
+		t.Fatalf("unable to encode kid output: %v", err)
+	}
+	pfxOutputKey, err := prefixOutputKey(psclPrefix, kid.OutPoint())
+	if err != nil {
+		t.Fatalf("unable to create output key: %v", err)
+	}
+	err = cdb.View(func(tx *bolt.Tx) error {
+		chanBucket := ns.getChannelBucket(tx, kid.OriginChanPoint())
+		if chanBucket == nil {
+			return ErrContractNotFound
+		}
+
+		diskBytes := chanBucket.Get(pfxOutputKey)
+		if diskBytes == nil {
+			return fmt.Errorf("output not found")
+		}
+		if bytes.Equal(diskBytes, plaintext.Bytes()) {
+			return fmt.Errorf("output stored in plaintext")
+		}
+		if bytes.Contains(diskBytes, plaintext.Bytes()[:8]) {
+			return fmt.Errorf("output amount stored in plaintext")
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected on-disk output: %v", err)
+	}
+
+	// Reading the outputs back should transparently decrypt them.
+	preschools, err := ns.FetchPreschools()
+	if err != nil {
+		t.Fatalf("unable to fetch preschools: %v", err)
+	}
+	if len(preschools) != 1 || !reflect.DeepEqual(preschools[0], kid) {
+		t.Fatalf("preschool output not round-tripped")
+	}
+
+	_, _, cribs, err := ns.FetchClass(baby.expiry)
+	if err != nil {
+		t.Fatalf("unable to fetch class: %v", err)
+	}
+	if len(cribs) != 1 || !reflect.DeepEqual(cribs[0], baby) {
+		t.Fatalf("crib output not round-tripped")
+	}
+
+	// The outputs should also survive state transitions.
+	if err := ns.PreschoolToKinder(&kid); err != nil {
+		t.Fatalf("unable to move pscl output to kndr: %v", err)
+	}
+	_, kndrOutputs, _, err := ns.FetchClass(
+		kid.ConfHeight() + kid.BlocksToMaturity(),
+	)
+	if err != nil {
+		t.Fatalf("unable to fetch class: %v", err)
+	}
+	if len(kndrOutputs) != 1 || !reflect.DeepEqual(kndrOutputs[0], kid) {
+		t.Fatalf("kindergarten output not round-tripped")
+	}
+	assertNumChanOutputs(t, ns, kid.OriginChanPoint(), 2)
+}
+
+// TestNurseryStoreFinalizeKinderRange tests that a contiguous span of heights
+// can be finalized at once, and that spans which would skip unfinalized
+// heights are rejected.
+func TestNurseryStoreFinalizeKinderRange(t *testing.T) {
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to open channel db: %v", err)
+	}
+	defer cleanUp()
+
+	ns, err := newNurseryStore(&bitcoinTestnetGenesis, cdb)
+	if err != nil {
+		t.Fatalf("unable to open nursery store: %v", err)
+	}
+
+	// Incubate a crib output expiring at height 4, which should not be
+	// pruned when its height is finalized.
+	if err := ns.Incubate(nil, []babyOutput{babyOutputs[1]}); err != nil {
+		t.Fatalf("unable to incubate outputs: %v", err)
+	}
+
+	// An inverted range should be rejected.
+	if err := ns.FinalizeKinderRange(10, 9); err == nil {
+		t.Fatalf("expected inverted range to fail")
+	}
+
+	// A range that doesn't begin directly after the last finalized
+	// height should be rejected.
+	if err := ns.FinalizeKinderRange(2, 10); err == nil {
+		t.Fatalf("expected range skipping height 1 to fail")
+	}
+	assertLastFinalizedHeight(t, ns, 0)
+
+	if err := ns.FinalizeKinderRange(1, 10); err != nil {
+		t.Fatalf("unable to finalize range: %v", err)
+	}
+	assertLastFinalizedHeight(t, ns, 10)
+
+	// The crib output's height should remain in the height index.
+	heights, err := ns.HeightsBelowOrEqual(10)
+	if err != nil {
+		t.Fatalf("unable to fetch heights: %v", err)
+	}
+	if !reflect.DeepEqual(heights, []uint32{4}) {
+		t.Fatalf("unexpected heights after finalizing: %v", heights)
+	}
+
+	// Re-finalizing an already finalized span should be rejected, while
+	// the following span should succeed.
+	if err := ns.FinalizeKinderRange(5, 20); err == nil {
+		t.Fatalf("expected overlapping range to fail")
+	}
+	if err := ns.FinalizeKinderRange(11, 20); err != nil {
+		t.Fatalf("unable to finalize range: %v", err)
+	}
+	assertLastFinalizedHeight(t, ns, 20)
+}
+
+// TestNurseryStoreActiveChannelsAtHeight tests that the channels with outputs
+// at a particular height can be enumerated from the height index.
+func TestNurseryStoreActiveChannelsAtHeight(t *testing.T) {
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to open channel db: %v", err)
+	}
+	defer cleanUp()
+
+	ns, err := newNurseryStore(&bitcoinTestnetGenesis, cdb)
+	if err != nil {
+		t.Fatalf("unable to open nursery store: %v", err)
+	}
+
+	assertActiveChannels := func(height uint32,
+		expected []wire.OutPoint) {
+
+		channels, err := ns.ActiveChannelsAtHeight(height)
+		if err != nil {
+			t.Fatalf("unable to fetch active channels: %v", err)
+		}
+		if channels == nil {
+			t.Fatalf("expected non-nil slice of active channels")
+		}
+		if len(channels) != len(expected) {
+			t.Fatalf("expected %d active channels at height %d, "+
+				"got %d", len(expected), height, len(channels))
+		}
+
+		expectedSet := make(map[wire.OutPoint]struct{})
+		for _, chanPoint := range expected {
+			expectedSet[chanPoint] = struct{}{}
+		}
+		for _, chanPoint := range channels {
+			if _, ok := expectedSet[chanPoint]; !ok {
+				t.Fatalf("unexpected active channel %v at "+
+					"height %d", chanPoint, height)
+			}
+		}
+	}
+
+	// With no outputs, there are no active channels.
+	assertActiveChannels(4, nil)
+
+	// We'll incubate two crib outputs from one channel, and a crib output
+	// from a second channel, all expiring at height 4.
+	secondBaby := babyOutputs[0]
+	secondBaby.expiry = 4
+	secondBaby.originChanPoint = outPoints[5]
+	babies := []babyOutput{babyOutputs[1], babyOutputs[2], secondBaby}
+	if err := ns.Incubate(nil, babies); err != nil {
+		t.Fatalf("unable to incubate outputs: %v", err)
+	}
+
+	assertActiveChannels(4, []wire.OutPoint{
+		*babyOutputs[1].OriginChanPoint(), outPoints[5],
+	})
+	assertActiveChannels(5, nil)
+}
+
+// TestNurseryStoreRelocateKinder tests that a kindergarten output can be moved
+// to both an earlier and later maturity height after its confirmation height
+// is corrected, and that the stored output reflects the new height.
+func TestNurseryStoreRelocateKinder(t *testing.T) {
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to open channel db: %v", err)
+	}
+	defer cleanUp()
+
+	ns, err := newNurseryStore(&bitcoinTestnetGenesis, cdb)
+	if err != nil {
+		t.Fatalf("unable to open nursery store: %v", err)
+	}
+
+	// Relocating an output that was never incubated should fail.
+	kid := kidOutputs[0]
+	err = ns.RelocateKinder(&kid, 990)
+	if err != ErrContractNotFound {
+		t.Fatalf("expected ErrContractNotFound, got: %v", err)
+	}
+
+	// Relocating an output that is still in preschool should also fail.
+	if err := ns.Incubate([]kidOutput{kid}, nil); err != nil {
+		t.Fatalf("unable to incubate output: %v", err)
+	}
+	err = ns.RelocateKinder(&kid, 990)
+	if err != ErrKinderNotFound {
+		t.Fatalf("expected ErrKinderNotFound, got: %v", err)
+	}
+
+	if err := ns.PreschoolToKinder(&kid); err != nil {
+		t.Fatalf("unable to move pscl output to kndr: %v", err)
+	}
+
+	// assertKinderAt checks that the output is only found in the height
+	// index at the expected maturity height, and with the expected
+	// confirmation height.
+	assertKinderAt := func(confHeight, maturityHeight uint32) {
+		heights, err := ns.HeightsBelowOrEqual(math.MaxUint32)
+		if err != nil {
+			t.Fatalf("unable to fetch heights: %v", err)
+		}
+		if len(heights) != 1 || heights[0] != maturityHeight {
+			t.Fatalf("expected output at height %d, found heights "+
+				"%v", maturityHeight, heights)
+		}
+
+		_, kids, _, err := ns.FetchClass(maturityHeight)
+		if err != nil {
+			t.Fatalf("unable to fetch class: %v", err)
+		}
+		if len(kids) != 1 {
+			t.Fatalf("expected 1 kid output at height %d, got %d",
+				maturityHeight, len(kids))
+		}
+		if kids[0].ConfHeight() != confHeight {
+			t.Fatalf("expected conf height %d, got %d", confHeight,
+				kids[0].ConfHeight())
+		}
+
+		confirmed, err := ns.FetchOutputsConfirmedAt(confHeight)
+		if err != nil {
+			t.Fatalf("unable to fetch confirmed outputs: %v", err)
+		}
+		if len(confirmed) != 1 {
+			t.Fatalf("expected 1 output confirmed at height %d, "+
+				"got %d", confHeight, len(confirmed))
+		}
+
+		if err := verifyNurseryIndexes(ns); err != nil {
+			t.Fatalf("nursery indexes inconsistent: %v", err)
+		}
+	}
+
+	assertKinderAt(1000, 1042)
+
+	// Relocate the output to an earlier confirmation height, which should
+	// move it to an earlier maturity height.
+	if err := ns.RelocateKinder(&kid, 990); err != nil {
+		t.Fatalf("unable to relocate kndr output: %v", err)
+	}
+	if kid.ConfHeight() != 990 {
+		t.Fatalf("expected conf height of 990, got %d",
+			kid.ConfHeight())
+	}
+	assertKinderAt(990, 1032)
+
+	// Now relocate the output to a later confirmation height, past its
+	// original maturity height.
+	if err := ns.RelocateKinder(&kid, 1010); err != nil {
+		t.Fatalf("unable to relocate kndr output: %v", err)
+	}
+	if kid.ConfHeight() != 1010 {
+		t.Fatalf("expected conf height of 1010, got %d",
+			kid.ConfHeight())
+	}
+	assertKinderAt(1010, 1052)
+}
+
+// TestNurseryStoreVerifyIntegrity tests that VerifyIntegrity reports no
+// discrepancies for a consistent store, and reports each discrepancy after the
+// height and channel indexes have been corrupted.
+func TestNurseryStoreVerifyIntegrity(t *testing.T) {
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to open channel db: %v", err)
+	}
+	defer cleanUp()
+
+	ns, err := newNurseryStore(&bitcoinTestnetGenesis, cdb)
+	if err != nil {
+		t.Fatalf("unable to open nursery store: %v", err)
+	}
+
+	assertNumDiscrepancies := func(expected int) {
+		discrepancies, err := ns.VerifyIntegrity()
+		if err != nil {
+			t.Fatalf("unable to verify integrity: %v", err)
+		}
+		if len(discrepancies) != expected {
+			t.Fatalf("expected %d discrepancies, got %d: %v",
+				expected, len(discrepancies), discrepancies)
+		}
+	}
+
+	// An empty store should have no discrepancies.
+	assertNumDiscrepancies(0)
+
+	// Incubate a crib output, and a commitment output that we'll move to
+	// the kindergarten bucket, both belonging to the same channel.
+	kid := kidOutputs[0]
+	baby := babyOutputs[1]
+	err = ns.Incubate([]kidOutput{kid}, []babyOutput{baby})
+	if err != nil {
+		t.Fatalf("unable to incubate outputs: %v", err)
+	}
+	if err := ns.PreschoolToKinder(&kid); err != nil {
+		t.Fatalf("unable to move pscl output to kndr: %v", err)
+	}
+
+	assertNumDiscrepancies(0)
+
+	// Now, corrupt the store by removing the crib output from its channel
+	// bucket, leaving a dangling reference in the height index, and by
+	// referencing the kindergarten output from a second height.
+	err = cdb.Update(func(tx *bolt.Tx) error {
+		chanBucket := ns.getChannelBucket(tx, baby.OriginChanPoint())
+		cribKey, err := prefixOutputKey(cribPrefix, baby.OutPoint())
+		if err != nil {
+			return err
+		}
+		if err := chanBucket.Delete(cribKey); err != nil {
+			return err
+		}
+
+		hghtChanBucket, err := ns.createHeightChanBucket(
+			tx, 2000, kid.OriginChanPoint(),
+		)
+		if err != nil {
+			return err
+		}
+		kndrKey, err := prefixOutputKey(kndrPrefix, kid.OutPoint())
+		if err != nil {
+			return err
+		}
+		return hghtChanBucket.Put(kndrKey, []byte{})
+	})
+	if err != nil {
+		t.Fatalf("unable to corrupt nursery store: %v", err)
+	}
+
+	// Both discrepancies should be reported.
+	assertNumDiscrepancies(2)
+}
+
+// TestNurseryStoreCompactHeightIndex tests that CompactHeightIndex removes
+// height buckets that no longer reference any outputs, along with any empty
+// height-channel buckets, while leaving heights with active outputs intact.
+func TestNurseryStoreCompactHeightIndex(t *testing.T) {
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to open channel db: %v", err)
+	}
+	defer cleanUp()
+
+	ns, err := newNurseryStore(&bitcoinTestnetGenesis, cdb)
+	if err != nil {
+		t.Fatalf("unable to open nursery store: %v", err)
+	}
+
+	// Compacting an empty store should remove nothing.
+	removed, err := ns.CompactHeightIndex()
+	if err != nil {
+		t.Fatalf("unable to compact height index: %v", err)
+	}
+	if removed != 0 {
+		t.Fatalf("expected 0 heights removed, got %d", removed)
+	}
+
+	// Incubate a crib output, which will be placed in the height index at
+	// its expiry height of 4.
+	if err := ns.Incubate(nil, []babyOutput{babyOutputs[1]}); err != nil {
+		t.Fatalf("unable to incubate output: %v", err)
+	}
+
+	// Now, seed the height index with orphaned buckets: an empty
+	// height-channel bucket at a height with no outputs, an empty height
+	// bucket, and an empty height-channel bucket alongside the active
+	// output at height 4.
+	err = cdb.Update(func(tx *bolt.Tx) error {
+		_, err := ns.createHeightChanBucket(tx, 100, &outPoints[5])
+		if err != nil {
+			return err
+		}
+		if _, err := ns.createHeightBucket(tx, 200); err != nil {
+			return err
+		}
+		_, err = ns.createHeightChanBucket(tx, 4, &outPoints[5])
+		return err
+	})
+	if err != nil {
+		t.Fatalf("unable to seed height index: %v", err)
+	}
+
+	heights, err := ns.HeightsBelowOrEqual(math.MaxUint32)
+	if err != nil {
+		t.Fatalf("unable to fetch heights: %v", err)
+	}
+	if !reflect.DeepEqual(heights, []uint32{4, 100, 200}) {
+		t.Fatalf("unexpected heights before compaction: %v", heights)
+	}
+
+	// Compaction should remove the two orphaned height buckets, but keep
+	// the height with the active output.
+	removed, err = ns.CompactHeightIndex()
+	if err != nil {
+		t.Fatalf("unable to compact height index: %v", err)
+	}
+	if removed != 2 {
+		t.Fatalf("expected 2 heights removed, got %d", removed)
+	}
+
+	heights, err = ns.HeightsBelowOrEqual(math.MaxUint32)
+	if err != nil {
+		t.Fatalf("unable to fetch heights: %v", err)
+	}
+	if !reflect.DeepEqual(heights, []uint32{4}) {
+		t.Fatalf("unexpected heights after compaction: %v", heights)
+	}
+
+	// The empty height-channel bucket at height 4 should also have been
+	// removed.
+	channels, err := ns.ActiveChannelsAtHeight(4)
+	if err != nil {
+		t.Fatalf("unable to fetch active channels: %v", err)
+	}
+	expectedChan := *babyOutputs[1].OriginChanPoint()
+	if len(channels) != 1 || channels[0] != expectedChan {
+		t.Fatalf("unexpected active channels at height 4: %v",
+			channels)
+	}
+
+	if err := verifyNurseryIndexes(ns); err != nil {
+		t.Fatalf("nursery indexes inconsistent: %v", err)
+	}
+}
+
+// TestNurseryStoreLimboBalance tests that LimboBalance sums the amounts of all
+// crib, preschool, and kindergarten outputs, and excludes graduated outputs.
+func TestNurseryStoreLimboBalance(t *testing.T) {
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to open channel db: %v", err)
+	}
+	defer cleanUp()
+
+	ns, err := newNurseryStore(&bitcoinTestnetGenesis, cdb)
+	if err != nil {
+		t.Fatalf("unable to open nursery store: %v", err)
+	}
+
+	assertLimboBalance := func(expected btcutil.Amount) {
+		balance, err := ns.LimboBalance()
+		if err != nil {
+			t.Fatalf("unable to fetch limbo balance: %v", err)
+		}
+		if balance != expected {
+			t.Fatalf("expected limbo balance of %v, got %v",
+				expected, balance)
+		}
+	}
+
+	// An empty store has no funds in limbo.
+	assertLimboBalance(0)
+
+	// Incubate two commitment outputs in preschool, and a crib output
+	// belonging to a second channel.
+	kid0 := kidOutputs[0]
+	kid1 := kidOutputs[1]
+	baby := babyOutputs[1]
+	baby.originChanPoint = outPoints[5]
+	err = ns.Incubate([]kidOutput{kid0, kid1}, []babyOutput{baby})
+	if err != nil {
+		t.Fatalf("unable to incubate outputs: %v", err)
+	}
+
+	total := kid0.Amount() + kid1.Amount() + baby.Amount()
+	assertLimboBalance(total)
+
+	// Moving an output to the kindergarten bucket shouldn't change the
+	// balance.
+	if err := ns.PreschoolToKinder(&kid1); err != nil {
+		t.Fatalf("unable to move pscl output to kndr: %v", err)
+	}
+	assertLimboBalance(total)
+
+	// Once the kindergarten output graduates, it should no longer be
+	// counted.
+	maturityHeight := kid1.ConfHeight() + kid1.BlocksToMaturity()
+	if err := ns.GraduateKinder(maturityHeight); err != nil {
+		t.Fatalf("unable to graduate kndr output: %v", err)
+	}
+	assertLimboBalance(total - kid1.Amount())
+}
+
+// TestNurseryStoreScanCancellation tests that the context-aware preschool and
+// height prefix scans abort with the context's error once it is cancelled.
+func TestNurseryStoreScanCancellation(t *testing.T) {
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to open channel db: %v", err)
+	}
+	defer cleanUp()
+
+	ns, err := newNurseryStore(&bitcoinTestnetGenesis, cdb)
+	if err != nil {
+		t.Fatalf("unable to open nursery store: %v", err)
+	}
+
+	// Incubate a preschool output, and a crib output expiring at height 4.
+	baby := babyOutputs[1]
+	err = ns.Incubate([]kidOutput{kidOutputs[0]}, []babyOutput{baby})
+	if err != nil {
+		t.Fatalf("unable to incubate outputs: %v", err)
+	}
+
+	// With an active context, both scans should find their output.
+	preschools, err := ns.FetchPreschoolsContext(context.Background())
+	if err != nil {
+		t.Fatalf("unable to fetch preschools: %v", err)
+	}
+	if len(preschools) != 1 {
+		t.Fatalf("expected 1 preschool output, got %d",
+			len(preschools))
+	}
+
+	scanCribs := func(ctx context.Context) (int, error) {
+		var numCribs int
+		err := cdb.View(func(tx *bolt.Tx) error {
+			return ns.forEachHeightPrefix(
+				ctx, tx, cribPrefix, baby.expiry,
+				func([]byte) error {
+					numCribs++
+					return nil
+				},
+			)
+		})
+		return numCribs, err
+	}
+
+	numCribs, err := scanCribs(context.Background())
+	if err != nil {
+		t.Fatalf("unable to scan crib outputs: %v", err)
+	}
+	if numCribs != 1 {
+		t.Fatalf("expected 1 crib output, got %d", numCribs)
+	}
+
+	// Once the context is cancelled, both scans should abort with the
+	// context's error before visiting any outputs.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = ns.FetchPreschoolsContext(ctx)
+	if err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got: %v", err)
+	}
+
+	numCribs, err = scanCribs(ctx)
+	if err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got: %v", err)
+	}
+	if numCribs != 0 {
+		t.Fatalf("expected no crib outputs to be visited, got %d",
+			numCribs)
+	}
+}
+
+// TestNurseryStoreFetchKindergartensByChannel tests that kindergarten outputs
+// maturing at the same height are grouped by their origin channel point.
+func TestNurseryStoreFetchKindergartensByChannel(t *testing.T) {
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to open channel db: %v", err)
+	}
+	defer cleanUp()
+
+	ns, err := newNurseryStore(&bitcoinTestnetGenesis, cdb)
+	if err != nil {
+		t.Fatalf("unable to open nursery store: %v", err)
+	}
+
+	// Both of the first two kid outputs belong to the same channel and
+	// mature at the same height. We'll add a third, maturing at the same
+	// height but belonging to a second channel.
+	secondKid := kidOutputs[2]
+	secondKid.originChanPoint = outPoints[5]
+	secondKid.confHeight = kidOutputs[0].ConfHeight()
+	secondKid.blocksToMaturity = kidOutputs[0].BlocksToMaturity()
+
+	kids := []kidOutput{kidOutputs[0], kidOutputs[1], secondKid}
+	if err := ns.Incubate(kids, nil); err != nil {
+		t.Fatalf("unable to incubate outputs: %v", err)
+	}
+	for i := range kids {
+		if err := ns.PreschoolToKinder(&kids[i]); err != nil {
+			t.Fatalf("unable to move pscl output to kndr: %v", err)
+		}
+	}
+
+	maturityHeight := kids[0].ConfHeight() + kids[0].BlocksToMaturity()
+	kidsByChan, err := ns.FetchKindergartensByChannel(maturityHeight)
+	if err != nil {
+		t.Fatalf("unable to fetch kindergartens by channel: %v", err)
+	}
+	if len(kidsByChan) != 2 {
+		t.Fatalf("expected outputs for 2 channels, got %d",
+			len(kidsByChan))
+	}
+
+	firstChanKids := kidsByChan[outPoints[0]]
+	if len(firstChanKids) != 2 {
+		t.Fatalf("expected 2 outputs for first channel, got %d",
+			len(firstChanKids))
+	}
+	for _, kid := range firstChanKids {
+		if *kid.OutPoint() != outPoints[1] &&
+			*kid.OutPoint() != outPoints[2] {
+
+			t.Fatalf("unexpected output %v for first channel",
+				kid.OutPoint())
+		}
+	}
+
+	secondChanKids := kidsByChan[outPoints[5]]
+	if len(secondChanKids) != 1 ||
+		*secondChanKids[0].OutPoint() != *secondKid.OutPoint() {
+
+		t.Fatalf("unexpected outputs for second channel: %+v",
+			secondChanKids)
+	}
+
+	// A height without any outputs should return an empty map.
+	kidsByChan, err = ns.FetchKindergartensByChannel(maturityHeight + 1)
+	if err != nil {
+		t.Fatalf("unable to fetch kindergartens by channel: %v", err)
+	}
+	if len(kidsByChan) != 0 {
+		t.Fatalf("expected no outputs, got %d channels",
+			len(kidsByChan))
+	}
+}
+
+// TestNurseryStoreGraduateKinderDryRun tests that GraduateKinderDryRun reports
+// exactly the channels that become mature once the provided outputs graduate,
+// without modifying the store.
+func TestNurseryStoreGraduateKinderDryRun(t *testing.T) {
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		t.Fatalf("unable to open channel db: %v", err)
+	}
+	defer cleanUp()
+
+	ns, err := newNurseryStore(&bitcoinTestnetGenesis, cdb)
+	if err != nil {
+		t.Fatalf("unable to open nursery store: %v", err)
+	}
+
+	// We'll incubate two outputs for the first channel, and one for a
+	// second channel, all maturing at the same height.
+	secondKid := kidOutputs[2]
+	secondKid.originChanPoint = outPoints[5]
+	secondKid.confHeight = kidOutputs[0].ConfHeight()
+	secondKid.blocksToMaturity = kidOutputs[0].BlocksToMaturity()
+
+	kids := []kidOutput{kidOutputs[0], kidOutputs[1], secondKid}
+	if err := ns.Incubate(kids, nil); err != nil {
+		t.Fatalf("unable to incubate outputs: %v", err)
+	}
+	for i := range kids {
+		if err := ns.PreschoolToKinder(&kids[i]); err != nil {
+			t.Fatalf("unable to move pscl output to kndr: %v", err)
+		}
+	}
+
+	assertDryRun := func(expected []wire.OutPoint, kids ...kidOutput) {
+		matureChans, err := ns.GraduateKinderDryRun(kids...)
+		if err != nil {
+			t.Fatalf("unable to perform dry run: %v", err)
+		}
+		if len(matureChans) != len(expected) {
+			t.Fatalf("expected %d mature channels, got %d: %v",
+				len(expected), len(matureChans), matureChans)
+		}
+		for i := range expected {
+			if matureChans[i] != expected[i] {
+				t.Fatalf("expected mature channel %v, got %v",
+					expected[i], matureChans[i])
+			}
+		}
+	}
+
+	// Graduating only one of the first channel's outputs wouldn't mature
+	// any channel.
+	assertDryRun(nil, kids[0])
+
+	// Graduating all outputs of the second channel, and only one of the
+	// first, would mature only the second channel.
+	assertDryRun([]wire.OutPoint{outPoints[5]}, kids[0], kids[2])
+
+	// Graduating every output would mature both channels.
+	assertDryRun([]wire.OutPoint{outPoints[0], outPoints[5]}, kids...)
+
+	// The dry runs should not have modified the store.
+	assertNumChanOutputs(t, ns, &outPoints[0], 2)
+	bothChans := []wire.OutPoint{outPoints[0], outPoints[5]}
+	for _, chanPoint := range bothChans {
+		isMature, err := ns.IsMatureChannel(&chanPoint)
+		if err != nil {
+			t.Fatalf("unable to check channel maturity: %v", err)
+		}
+		if isMature {
+			t.Fatalf("channel %v should not be mature", chanPoint)
+		}
+	}
+
+	// Once the outputs have actually graduated, both channels should be
+	// mature, matching the result of the dry run.
+	maturityHeight := kids[0].ConfHeight() + kids[0].BlocksToMaturity()
+	if err := ns.GraduateKinder(maturityHeight); err != nil {
+		t.Fatalf("unable to graduate kndr outputs: %v", err)
+	}
+	for _, chanPoint := range bothChans {
+		isMature, err := ns.IsMatureChannel(&chanPoint)
+		if err != nil {
+			t.Fatalf("unable to check channel maturity: %v", err)
+		}
+		if !isMature {
+			t.Fatalf("channel %v should be mature", chanPoint)
+		}
+	}
+}
+
+// assertNumChanOutputs checks that the channel bucket has the expected number
+// of outputs.
+func assertNumChanOutputs(t *testing.T, ns NurseryStore,
+	chanPoint *wire.OutPoint, expectedNum int) {
+
+	var count int
+	err := ns.ForChanOutputs(chanPoint, func([]byte, []byte) error {
+		count++
+		return nil
+	})
+
+	if count == 0 && err == ErrContractNotFound {
+		return
+	} else if err != nil {
+		t.Fatalf("unable to count num outputs for channel %v: %v",
+			chanPoint, err)
+	}
+
+	if count != expectedNum {
+		t.Fatalf("nursery store should have %d outputs, found %d",
+			expectedNum, count)
+	}
+}
+
+// assertLastFinalizedHeight checks that the nursery stores last finalized
+// height matches the expected height.
+func assertLastFinalizedHeight(t *testing.T, ns NurseryStore,
+	expected uint32) {
+
+	lfh, err := ns.LastFinalizedHeight()
+	if err != nil {
+		t.Fatalf("unable to get last finalized height: %v", err)
+	}
+
+	if lfh != expected {
+		t.Fatalf("expected last finalized height to be %d, got %d",
+			expected, lfh)
+	}
+}
+
+// assertLastGraduatedHeight checks that the nursery stores last purged height
+// matches the expected height.
+func assertLastGraduatedHeight(t *testing.T, ns NurseryStore, expected uint32) {
+	lgh, err := ns.LastGraduatedHeight()
+	if err != nil {
+		t.Fatalf("unable to get last graduated height: %v", err)
+	}
+
+	if lgh != expected {
+		t.Fatalf("expected last graduated height to be %d, got %d",
+			expected, lgh)
+	}
+}
+
+// assertNumPreschools loads all preschool outputs and verifies their count
+// matches the expected number.
+func assertNumPreschools(t *testing.T, ns NurseryStore, expected int) {
+	psclOutputs, err := ns.FetchPreschools()
+	if err != nil {
+		t.Fatalf("unable to retrieve preschool outputs: %v", err)
+	}
+
+	if len(psclOutputs) != expected {
+		t.Fatalf("expected number of pscl outputs to be %d, got %v",
+			expected, len(psclOutputs))
+	}
+}
+
+// assertNumChannels checks that the nursery has a given number of active
+// channels.
+func assertNumChannels(t *testing.T, ns NurseryStore, expected int) {
+	channels, err := ns.ListChannels()
+	if err != nil {
+		t.Fatalf("unable to fetch channels from nursery store: %v",
+			err)
+	}
+
+	if len(channels) != expected {
+		t.Fatalf("expected number of active channels to be %d, got %d",
+			expected, len(channels))
+	}
+}
+
+// assertHeightIsPurged checks that the finalized transaction, kindergarten, and
+// htlc outputs at a particular height are all nil.
+func assertHeightIsPurged(t *testing.T, ns NurseryStore,
+	height uint32) {
+
+	finalTx, kndrOutputs, cribOutputs, err := ns.FetchClass(height)
+	if err != nil {
+		t.Fatalf("unable to retrieve class at height=%d: %v",
+			height, err)
+	}
+
+	if finalTx != nil {
+		t.Fatalf("height=%d not purged, final txn should be nil", height)
+	}
+
+	if kndrOutputs != nil {
+		t.Fatalf("height=%d not purged, kndr outputs should be nil", height)
+	}
+
+	if cribOutputs != nil {
+		t.Fatalf("height=%d not purged, crib outputs should be nil", height)
+	}
+}
+
+// assertCribAtExpiryHeight loads the class at the given height, and verifies
+// that the given htlc output is one of the crib outputs.
+func assertCribAtExpiryHeight(t *testing.T, ns NurseryStore,
+	htlcOutput *babyOutput) {
+
+	expiryHeight := htlcOutput.expiry
+	_, _, cribOutputs, err := ns.FetchClass(expiryHeight)
+	if err != nil {
+		t.Fatalf("unable to retrieve class at height=%d: %v",
+			expiryHeight, err)
+	}
+
+	for _, crib := range cribOutputs {
+		if reflect.DeepEqual(&crib, htlcOutput) {
+			return
+		}
+	}
+
+	t.Fatalf("could not find crib output %v at height %d",
+		htlcOutput.OutPoint(), expiryHeight)
+}
+
+// assertCribNotAtExpiryHeight loads the class at the given height, and verifies
+// that the given htlc output is not one of the crib outputs.
+func assertCribNotAtExpiryHeight(t *testing.T, ns NurseryStore,
+	htlcOutput *babyOutput) {
+
+	expiryHeight := htlcOutput.expiry
+	_, _, cribOutputs, err := ns.FetchClass(expiryHeight)
+	if err != nil {
+		t.Fatalf("unable to retrieve class at height %d: %v",
+			expiryHeight, err)
+	}
+
+	for _, crib := range cribOutputs {
+		if reflect.DeepEqual(&crib, htlcOutput) {
+			t.Fatalf("found find crib output %v at height %d",
+				htlcOutput.OutPoint(), expiryHeight)
+		}
+	}
+}
+
+// assertFinalizedTxn loads the class at the given height and compares the
+// returned finalized txn to that in the class. It is safe to presented a nil
+// expected transaction.
+func assertFinalizedTxn(t *testing.T, ns NurseryStore, height uint32,
+	exFinalTx *wire.MsgTx) {
+
+	finalTx, _, _, err := ns.FetchClass(height)
+	if err != nil {
+		t.Fatalf("unable to fetch class at height=%d: %v", height,
+			err)
+	}
+
+	if !reflect.DeepEqual(finalTx, exFinalTx) {
+		t.Fatalf("expected finalized txn at height=%d "+
+			"to be %v, got %v", height, finalTx.TxHash(),
+			exFinalTx.TxHash())
+	}
+}
+
+// assertKndrAtMaturityHeight loads the class at the provided height and
+// verifies that the provided kid output is one of the kindergarten outputs
+// returned.
+func assertKndrAtMaturityHeight(t *testing.T, ns NurseryStore,
+	kndrOutput *kidOutput) {
+
+	maturityHeight := kndrOutput.ConfHeight() +
+		kndrOutput.BlocksToMaturity()
+	_, kndrOutputs, _, err := ns.FetchClass(maturityHeight)
+	if err != nil {
+		t.Fatalf("unable to retrieve class at height %d: %v",
+			maturityHeight, err)
+	}
+
+	for _, kndr := range kndrOutputs {
+		if reflect.DeepEqual(&kndr, kndrOutput) {
+			return
+		}
+	}
+
+	t.Fatalf("could not find kndr output %v at height %d",
+		kndrOutput.OutPoint(), maturityHeight)
+}
+
+// assertKndrNotAtMaturityHeight loads the class at the provided height and
+// verifies that the provided kid output is not one of the kindergarten outputs
+// returned.
+func assertKndrNotAtMaturityHeight(t *testing.T, ns NurseryStore,
+	kndrOutput *kidOutput) {
+
+	maturityHeight := kndrOutput.ConfHeight() +
+		kndrOutput.BlocksToMaturity()
+
+	_, kndrOutputs, _, err := ns.FetchClass(maturityHeight)
+	if err != nil {
+		t.Fatalf("unable to retrieve class at height %d: %v",
+			maturityHeight, err)
+	}
+
+	for _, kndr := range kndrOutputs {
+		if reflect.DeepEqual(&kndr, kndrOutput) {
+			t.Fatalf("found find kndr output %v at height %d",
+				kndrOutput.OutPoint(), maturityHeight)
+		}
+	}
+}
+
+// assertChannelMaturity queries the nursery store for the maturity of the given
+// channel, failing if the result does not match the expectedMaturity.
+func assertChannelMaturity(t *testing.T, ns NurseryStore,
+	chanPoint *wire.OutPoint, expectedMaturity bool) {
 
 	isMature, err := ns.IsMatureChannel(chanPoint)
 	if err != nil {
@@ -756,3 +2600,477 @@ func assertCanRemoveChannel(t *testing.T, ns NurseryStore,
 			"active channel: %v", err)
 	}
 }
+
+// nurseryOpType enumerates the state transitions that can be replayed against
+// a nursery store using ReplayAndVerify.
+type nurseryOpType uint8
+
+const (
+	opIncubate nurseryOpType = iota
+	opPreschoolToKinder
+	opCribToKinder
+	opFinalizeKinder
+	opGraduateKinder
+	opGraduateHeight
+	opRemoveChannel
+)
+
+// String returns a human readable name for the operation type.
+func (o nurseryOpType) String() string {
+	switch o {
+	case opIncubate:
+		return "Incubate"
+	case opPreschoolToKinder:
+		return "PreschoolToKinder"
+	case opCribToKinder:
+		return "CribToKinder"
+	case opFinalizeKinder:
+		return "FinalizeKinder"
+	case opGraduateKinder:
+		return "GraduateKinder"
+	case opGraduateHeight:
+		return "GraduateHeight"
+	case opRemoveChannel:
+		return "RemoveChannel"
+	default:
+		return "Unknown"
+	}
+}
+
+// NurseryOp describes a single operation to be applied to a nursery store.
+// Only the fields relevant to the operation's type need to be populated.
+type NurseryOp struct {
+	Type nurseryOpType
+
+	// Kids and Babies are the outputs passed to Incubate.
+	Kids   []kidOutput
+	Babies []babyOutput
+
+	// Kid is the output passed to PreschoolToKinder.
+	Kid *kidOutput
+
+	// Baby is the output passed to CribToKinder.
+	Baby *babyOutput
+
+	// Height is the height passed to FinalizeKinder, GraduateKinder and
+	// GraduateHeight.
+	Height uint32
+
+	// FinalTx is the sweep txn passed to FinalizeKinder.
+	FinalTx *wire.MsgTx
+
+	// ChanPoint is the channel passed to RemoveChannel.
+	ChanPoint *wire.OutPoint
+}
+
+// ReplayAndVerify applies the given sequence of operations to a fresh nursery
+// store. After each operation, the channel and height indexes are checked for
+// mutual consistency, and the total value tracked by the store is checked
+// against the value that has been incubated and not yet removed.
+func ReplayAndVerify(ops []NurseryOp) error {
+	cdb, cleanUp, err := makeTestDB()
+	if err != nil {
+		return err
+	}
+	defer cleanUp()
+
+	ns, err := newNurseryStore(&bitcoinTestnetGenesis, cdb)
+	if err != nil {
+		return err
+	}
+
+	// chanValues tracks the total value incubated for each channel, which
+	// should remain constant across all transitions until the channel is
+	// removed.
+	chanValues := make(map[wire.OutPoint]btcutil.Amount)
+
+	for i, op := range ops {
+		switch op.Type {
+		case opIncubate:
+			err = ns.Incubate(op.Kids, op.Babies)
+			for _, kid := range op.Kids {
+				chanValues[*kid.OriginChanPoint()] += kid.Amount()
+			}
+			for _, baby := range op.Babies {
+				chanValues[*baby.OriginChanPoint()] += baby.Amount()
+			}
+
+		case opPreschoolToKinder:
+			err = ns.PreschoolToKinder(op.Kid)
+
+		case opCribToKinder:
+			err = ns.CribToKinder(op.Baby)
+
+		case opFinalizeKinder:
+			err = ns.FinalizeKinder(op.Height, op.FinalTx)
+
+		case opGraduateKinder:
+			err = ns.GraduateKinder(op.Height)
+
+		case opGraduateHeight:
+			err = ns.GraduateHeight(op.Height)
+
+		case opRemoveChannel:
+			err = ns.RemoveChannel(op.ChanPoint)
+			if err == nil {
+				delete(chanValues, *op.ChanPoint)
+			}
+
+		default:
+			err = fmt.Errorf("unknown op type %v", op.Type)
+		}
+		if err != nil {
+			return fmt.Errorf("op #%d (%v) failed: %v", i, op.Type,
+				err)
+		}
+
+		if err := verifyNurseryIndexes(ns); err != nil {
+			return fmt.Errorf("op #%d (%v) left inconsistent "+
+				"indexes: %v", i, op.Type, err)
+		}
+
+		for chanPoint, expValue := range chanValues {
+			value, err := nurseryChanValue(ns, &chanPoint)
+			if err != nil {
+				return fmt.Errorf("op #%d (%v): unable to "+
+					"compute value of %v: %v", i, op.Type,
+					chanPoint, err)
+			}
+
+			if value != expValue {
+				return fmt.Errorf("op #%d (%v): expected %v "+
+					"to have value %v, found %v", i,
+					op.Type, chanPoint, expValue, value)
+			}
+		}
+	}
+
+	return nil
+}
+
+// verifyNurseryIndexes asserts that the channel index and height index of the
+// nursery store agree with one another. Every entry in the height index must
+// reference a crib or kindergarten output in the channel index, every crib and
+// kindergarten output must be referenced exactly once from the height index,
+// at a height consistent with its expiry or maturity, and no finalized sweep
+// txn may exist above the last finalized height.
+func verifyNurseryIndexes(ns *nurseryStore) error {
+	return ns.db.View(func(tx *bolt.Tx) error {
+		chainBucket := tx.Bucket(ns.pfxChainKey)
+		if chainBucket == nil {
+			return nil
+		}
+
+		lastFinalizedHeight, err := ns.getLastFinalizedHeight(tx)
+		if err != nil {
+			return err
+		}
+
+		chanIndex := chainBucket.Bucket(channelIndexKey)
+
+		// Walk the height index, recording each output it references.
+		heightRefs := make(map[string]int)
+		hghtIndex := chainBucket.Bucket(heightIndexKey)
+		if hghtIndex != nil {
+			err := hghtIndex.ForEach(func(hghtBytes, v []byte) error {
+				if v != nil {
+					return fmt.Errorf("unexpected value "+
+						"in height index: %x", hghtBytes)
+				}
+
+				height := byteOrder.Uint32(hghtBytes)
+				hghtBucket := hghtIndex.Bucket(hghtBytes)
+
+				return hghtBucket.ForEach(func(k, v []byte) error {
+					if v != nil {
+						if !bytes.Equal(k, finalizedKndrTxnKey) {
+							return fmt.Errorf("unexpected "+
+								"key %x at height %d",
+								k, height)
+						}
+						if height > lastFinalizedHeight {
+							return fmt.Errorf("finalized "+
+								"txn at height %d is above "+
+								"last finalized height %d",
+								height, lastFinalizedHeight)
+						}
+						return nil
+					}
+
+					return verifyHeightChanBucket(chanIndex,
+						hghtBucket, k, height, heightRefs)
+				})
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		if chanIndex == nil {
+			if len(heightRefs) != 0 {
+				return fmt.Errorf("height index references "+
+					"%d outputs, but channel index is "+
+					"missing", len(heightRefs))
+			}
+			return nil
+		}
+
+		// Now, walk the channel index, ensuring that each output is
+		// referenced from the height index if and only if it is
+		// awaiting a height-based transition.
+		return chanIndex.ForEach(func(chanBytes, _ []byte) error {
+			chanBucket := chanIndex.Bucket(chanBytes)
+			if chanBucket == nil {
+				return fmt.Errorf("channel bucket %x missing",
+					chanBytes)
+			}
+
+			return chanBucket.ForEach(func(k, _ []byte) error {
+				refs := heightRefs[string(chanBytes)+string(k)]
+				switch {
+				case bytes.HasPrefix(k, cribPrefix),
+					bytes.HasPrefix(k, kndrPrefix):
+
+					if refs != 1 {
+						return fmt.Errorf("output %x "+
+							"referenced %d times in "+
+							"height index", k, refs)
+					}
+
+				case bytes.HasPrefix(k, psclPrefix),
+					bytes.HasPrefix(k, gradPrefix):
+
+					if refs != 0 {
+						return fmt.Errorf("output %x "+
+							"should not be in height "+
+							"index", k)
+					}
+
+				default:
+					return fmt.Errorf("unknown prefix for "+
+						"output %x", k)
+				}
+
+				return nil
+			})
+		})
+	})
+}
+
+// verifyHeightChanBucket checks that each output referenced by a single
+// height-channel bucket exists in the channel index, and that the height at
+// which it is referenced is consistent with the serialized output.
+func verifyHeightChanBucket(chanIndex, hghtBucket *bolt.Bucket,
+	chanBytes []byte, height uint32, heightRefs map[string]int) error {
+
+	hghtChanBucket := hghtBucket.Bucket(chanBytes)
+	if hghtChanBucket == nil {
+		return fmt.Errorf("height-channel bucket %x missing at "+
+			"height %d", chanBytes, height)
+	}
+
+	if chanIndex == nil {
+		return fmt.Errorf("channel index missing")
+	}
+	chanBucket := chanIndex.Bucket(chanBytes)
+	if chanBucket == nil {
+		return fmt.Errorf("channel %x at height %d not found in "+
+			"channel index", chanBytes, height)
+	}
+
+	return hghtChanBucket.ForEach(func(pfxKey, _ []byte) error {
+		v := chanBucket.Get(pfxKey)
+		if v == nil {
+			return fmt.Errorf("output %x at height %d not found "+
+				"in channel index", pfxKey, height)
+		}
+
+		switch {
+		case bytes.HasPrefix(pfxKey, cribPrefix):
+			var baby babyOutput
+			if err := baby.Decode(bytes.NewReader(v)); err != nil {
+				return err
+			}
+			if baby.expiry != height {
+				return fmt.Errorf("crib output %v at height "+
+					"%d, expected expiry %d",
+					baby.OutPoint(), height, baby.expiry)
+			}
+
+		case bytes.HasPrefix(pfxKey, kndrPrefix):
+			var kid kidOutput
+			if err := kid.Decode(bytes.NewReader(v)); err != nil {
+				return err
+			}
+
+			maturityHeight := kid.absoluteMaturity
+			if kid.BlocksToMaturity() != 0 {
+				maturityHeight = kid.ConfHeight() +
+					kid.BlocksToMaturity()
+			}
+
+			// Late registrations may push an output to a height
+			// above its maturity height, but never below.
+			if height < maturityHeight {
+				return fmt.Errorf("kndr output %v at height "+
+					"%d, before maturity height %d",
+					kid.OutPoint(), height, maturityHeight)
+			}
+
+		default:
+			return fmt.Errorf("unexpected output %x in height "+
+				"index at height %d", pfxKey, height)
+		}
+
+		heightRefs[string(chanBytes)+string(pfxKey)]++
+
+		return nil
+	})
+}
+
+// nurseryChanValue sums the value of all outputs tracked by the nursery store
+// for the given channel, regardless of their state.
+func nurseryChanValue(ns NurseryStore,
+	chanPoint *wire.OutPoint) (btcutil.Amount, error) {
+
+	var total btcutil.Amount
+	err := ns.ForChanOutputs(chanPoint, func(k, v []byte) error {
+		if bytes.HasPrefix(k, cribPrefix) {
+			var baby babyOutput
+			if err := baby.Decode(bytes.NewReader(v)); err != nil {
+				return err
+			}
+			total += baby.Amount()
+			return nil
+		}
+
+		var kid kidOutput
+		if err := kid.Decode(bytes.NewReader(v)); err != nil {
+			return err
+		}
+		total += kid.Amount()
+
+		return nil
+	})
+	if err == ErrContractNotFound {
+		return 0, nil
+	}
+
+	return total, err
+}
+
+// genNurseryOps generates a random, valid sequence of nursery operations that
+// walks a single channel's outputs from incubation through to removal.
+func genNurseryOps(r *rand.Rand) []NurseryOp {
+	chanPoint := outPoints[r.Intn(len(outPoints))]
+
+	// Derive a set of kid and baby outputs from our test vectors, giving
+	// each a unique outpoint belonging to the chosen channel.
+	kids := make([]kidOutput, r.Intn(len(kidOutputs)+1))
+	for i := range kids {
+		kids[i] = kidOutputs[r.Intn(len(kidOutputs))]
+		kids[i].outpoint = wire.OutPoint{
+			Hash:  chanPoint.Hash,
+			Index: uint32(1000 + i),
+		}
+		kids[i].originChanPoint = chanPoint
+		kids[i].origin = kidOriginUnknown
+	}
+
+	babies := make([]babyOutput, r.Intn(len(babyOutputs)+1))
+	for i := range babies {
+		babies[i] = babyOutputs[r.Intn(len(babyOutputs))]
+		babies[i].outpoint = wire.OutPoint{
+			Hash:  chanPoint.Hash,
+			Index: uint32(2000 + i),
+		}
+		babies[i].originChanPoint = chanPoint
+		babies[i].origin = kidOriginUnknown
+	}
+
+	ops := []NurseryOp{{
+		Type:   opIncubate,
+		Kids:   kids,
+		Babies: babies,
+	}}
+
+	pscl := r.Perm(len(kids))
+	cribs := r.Perm(len(babies))
+	kndrHeights := make(map[uint32]struct{})
+	var lastFinalizedHeight uint32
+
+	for len(pscl) > 0 || len(cribs) > 0 || len(kndrHeights) > 0 {
+		switch r.Intn(3) {
+		case 0:
+			if len(pscl) == 0 {
+				continue
+			}
+
+			kid := &kids[pscl[0]]
+			pscl = pscl[1:]
+
+			ops = append(ops, NurseryOp{
+				Type: opPreschoolToKinder,
+				Kid:  kid,
+			})
+			kndrHeights[kid.ConfHeight()+kid.BlocksToMaturity()] =
+				struct{}{}
+
+		case 1:
+			if len(cribs) == 0 {
+				continue
+			}
+
+			baby := &babies[cribs[0]]
+			cribs = cribs[1:]
+
+			ops = append(ops, NurseryOp{
+				Type: opCribToKinder,
+				Baby: baby,
+			})
+			kndrHeights[baby.ConfHeight()+baby.BlocksToMaturity()] =
+				struct{}{}
+
+		case 2:
+			for height := range kndrHeights {
+				// Only finalize heights in ascending order, as
+				// the nursery would.
+				if height >= lastFinalizedHeight && r.Intn(2) == 0 {
+					ops = append(ops, NurseryOp{
+						Type:    opFinalizeKinder,
+						Height:  height,
+						FinalTx: timeoutTx,
+					})
+					lastFinalizedHeight = height
+				}
+
+				ops = append(ops, NurseryOp{
+					Type:   opGraduateKinder,
+					Height: height,
+				})
+				delete(kndrHeights, height)
+				break
+			}
+		}
+	}
+
+	return append(ops, NurseryOp{
+		Type:      opRemoveChannel,
+		ChanPoint: &chanPoint,
+	})
+}
+
+// TestNurseryStoreReplayInvariants generates random, valid sequences of
+// nursery operations, and asserts that the nursery store's indexes remain
+// consistent and that no value is lost across state transitions.
+func TestNurseryStoreReplayInvariants(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	const numTrials = 25
+	for i := 0; i < numTrials; i++ {
+		ops := genNurseryOps(r)
+		if err := ReplayAndVerify(ops); err != nil {
+			t.Fatalf("trial #%d: %v", i, err)
+		}
+	}
+}
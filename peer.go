@@ -1282,7 +1282,10 @@ func (p *peer) ChannelSnapshots() []*channeldb.ChannelSnapshot {
 }
 
 // genDeliveryScript returns a new script to be used to send our funds to in
-// the case of a cooperative channel close negotiation.
+// the case of a cooperative channel close negotiation. Delivery scripts aren't
+// stored alongside the channel, instead a fresh script is generated each time
+// a cooperative close is initiated or accepted, so the address used is always
+// the wallet's latest.
 func (p *peer) genDeliveryScript() ([]byte, error) {
 	deliveryAddr, err := p.server.cc.wallet.NewAddress(
 		lnwallet.WitnessPubKey, false,
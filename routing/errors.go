@@ -1,6 +1,10 @@
 package routing
 
-import "github.com/go-errors/errors"
+import (
+	"fmt"
+
+	"github.com/go-errors/errors"
+)
 
 // errorCode is used to represent the various errors that can occur within this
 // package.
@@ -42,6 +46,16 @@ const (
 	// ErrPaymentAttemptTimeout is an error that indicates that a payment
 	// attempt timed out before we were able to successfully route an HTLC.
 	ErrPaymentAttemptTimeout
+
+	// ErrFeeLimitExceeded is returned when a path to the target
+	// destination exists, yet every route found would require paying more
+	// in fees than the fee limit of the payment.
+	ErrFeeLimitExceeded
+
+	// ErrCltvLimitExceeded is returned when a path to the target
+	// destination exists, yet every route found would require a total
+	// time-lock delta larger than the CLTV limit of the payment.
+	ErrCltvLimitExceeded
 )
 
 // routerError is a structure that represent the error inside the routing package,
@@ -79,9 +93,46 @@ func newErrf(code errorCode, format string, a ...interface{}) *routerError {
 	}
 }
 
+// RouteConstructionError is returned when a route can't be constructed from
+// a path found, due to the constraints of a particular hop within the path.
+// It identifies the offending hop, such that the caller may report the failure
+// back to mission control.
+type RouteConstructionError struct {
+	// HopIndex is the index of the offending hop within the path, with
+	// the first hop out of the source at index zero.
+	HopIndex int
+
+	// Vertex is the node the offending hop leads to.
+	Vertex Vertex
+
+	// ChannelID is the short channel ID of the offending hop's channel.
+	ChannelID uint64
+
+	// Err is the underlying error, detailing why the hop couldn't be
+	// used.
+	Err *routerError
+}
+
+// Error returns the underlying error, prefixed by the offending hop.
+//
+// NOTE: Part of the error interface.
+func (e *RouteConstructionError) Error() string {
+	return fmt.Sprintf("unable to construct route at hop %v (chan_id=%v, "+
+		"vertex=%v): %v", e.HopIndex, e.ChannelID, e.Vertex, e.Err)
+}
+
+// A compile time check to ensure RouteConstructionError implements the error
+// interface.
+var _ error = (*RouteConstructionError)(nil)
+
 // IsError is a helper function which is needed to have ability to check that
-// returned error has specific error code.
+// returned error has specific error code. The code of a RouteConstructionError
+// is that of its underlying error.
 func IsError(e interface{}, codes ...errorCode) bool {
+	if constructionErr, ok := e.(*RouteConstructionError); ok {
+		e = constructionErr.Err
+	}
+
 	err, ok := e.(*routerError)
 	if !ok {
 		return false
@@ -1,31 +1,164 @@
 package routing
 
 import (
+	"bytes"
+	"math"
+	"math/rand"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/lightningnetwork/lnd/channeldb"
+	"github.com/lightningnetwork/lnd/lnwire"
+	"github.com/roasbeef/btcutil"
 )
 
 const (
-	// vertexDecay is the decay period of colored vertexes added to
-	// missionControl. Once vertexDecay passes after an entry has been
-	// added to the prune view, it is garbage collected. This value is
-	// larger than edgeDecay as an edge failure typical indicates an
-	// unbalanced channel, while a vertex failure indicates a node is not
-	// online and active.
+	// vertexDecay is the default decay period of colored vertexes added
+	// to missionControl. Once vertexDecay, plus a random jitter, passes
+	// after an entry has been added to the prune view, it is garbage
+	// collected. This value is larger than edgeDecay as an edge failure
+	// typical indicates an unbalanced channel, while a vertex failure
+	// indicates a node is not online and active.
 	vertexDecay = time.Duration(time.Minute * 5)
 
-	// edgeDecay is the decay period of colored edges added to
-	// missionControl. Once edgeDecay passed after an entry has been added,
-	// it is garbage collected. This value is smaller than vertexDecay as
-	// an edge related failure during payment sending typically indicates
-	// that a channel was unbalanced, a condition which may quickly change.
-	//
-	// TODO(roasbeef): instead use random delay on each?
+	// edgeDecay is the default decay period of colored edges added to
+	// missionControl. Once edgeDecay, plus a random jitter, passed after
+	// an entry has been added, it is garbage collected. This value is
+	// smaller than vertexDecay as an edge related failure during payment
+	// sending typically indicates that a channel was unbalanced, a
+	// condition which may quickly change.
 	edgeDecay = time.Duration(time.Second * 5)
+
+	// decayJitter is the default maximum jitter added to the decay period
+	// of each failed edge and vertex, as a fraction of the decay period.
+	// Without it, edges and vertexes which failed together would be
+	// un-pruned together, only to likely fail again in lockstep.
+	decayJitter = 0.1
+
+	// successDecay is the default decay period of the successes reported
+	// to missionControl. Once successDecay passes after a success has been
+	// reported, it no longer biases path finding.
+	successDecay = time.Duration(time.Minute * 10)
+
+	// successWeight is the default amount by which the weight of an edge
+	// is reduced during path finding, for each recent success of the edge
+	// and of the vertex it leads to. This value is small in comparison to
+	// the fee component of an edge's weight, such that the bias mostly
+	// serves to break ties between paths of similar cost.
+	successWeight = 10
+
+	// vertexPromotionFailures is the number of failures a vertex must
+	// suffer in succession, each reported before the failure prior to it
+	// has decayed, for the vertex to be promoted to the second generation
+	// of the prune view.
+	vertexPromotionFailures = 3
+
+	// secondGenDecayFactor is the factor by which the decay period of a
+	// vertex within the second generation of the prune view exceeds the
+	// vertex decay period. Vertexes which continually fail are likely
+	// offline for an extended period, so there's little use in retrying
+	// them as often.
+	secondGenDecayFactor = 10
+
+	// maxConcurrentPathFinding is the default maximum number of path
+	// finding searches missionControl runs at once. Any further callers
+	// wait for one of the running searches to complete, such that a burst
+	// of payments doesn't thrash the CPU.
+	maxConcurrentPathFinding = 4
+
+	// aprioriProbability is the default success probability assumed for
+	// edges which haven't failed, when scoring edges by probability.
+	aprioriProbability = 0.6
+
+	// probabilityHalfLife is the default period over which the difference
+	// between the success probability of a failed edge and the apriori
+	// probability halves, when scoring edges by probability.
+	probabilityHalfLife = time.Duration(time.Hour)
+
+	// probabilityWeight is the default weight added to an edge during
+	// path finding, per unit of the negative log of its success
+	// probability. This is equal to the weight of a hop charging a fee of
+	// one satoshi, such that an unreliable edge must be considerably
+	// cheaper to be chosen over a reliable one.
+	probabilityWeight = 1000 * 1000
+
+	// probabilityFailureFactor is the factor by which the success
+	// probability of an edge is multiplied upon each failure.
+	probabilityFailureFactor = 0.5
+
+	// minProbability is the lowest success probability an edge may be
+	// assigned, bounding the penalty of an edge which has failed many
+	// times.
+	minProbability = 0.001
+
+	// probabilityForgetHalfLives is the number of half-lives after the
+	// latest failure of an edge at which its success probability is
+	// considered to have returned to the apriori probability, and so is
+	// forgotten.
+	probabilityForgetHalfLives = 10
+
+	// historyFlushInterval is the interval at which the failure history of
+	// missionControl is flushed to the database, such that it survives a
+	// restart.
+	historyFlushInterval = time.Minute
 )
 
+// MissionControlConfig houses the parameters which tune how aggressively
+// missionControl forgets the failures and successes reported to it, and how
+// strongly successes bias path finding.
+type MissionControlConfig struct {
+	// VertexDecay is the period after which a failed vertex is removed
+	// from the prune view.
+	VertexDecay time.Duration
+
+	// EdgeDecay is the period after which a failed edge is removed from
+	// the prune view.
+	EdgeDecay time.Duration
+
+	// DecayJitter is the maximum random jitter added to the decay period
+	// of each failed edge and vertex, as a fraction of the decay period.
+	// For example, a value of 0.1 extends each decay period by up to 10%.
+	// A value of zero disables the jitter.
+	DecayJitter float64
+
+	// SuccessDecay is the period after which a success no longer biases
+	// path finding.
+	SuccessDecay time.Duration
+
+	// SuccessWeight is the amount by which the weight of an edge is
+	// reduced during path finding, for each recent success of the edge and
+	// of the vertex it leads to. A weight of zero disables the bias.
+	SuccessWeight int64
+
+	// MaxConcurrentPathFinding is the maximum number of path finding
+	// searches run at once. Any further route requests are queued until a
+	// search completes. A value of zero disables the limit.
+	MaxConcurrentPathFinding int
+
+	// ProbabilityScoring, if true, causes channel failures to lower the
+	// estimated success probability of the channel, rather than pruning
+	// it from the shared prune view. Path finding then penalizes each
+	// channel according to its probability. Channels are still pruned for
+	// the remainder of the payment session which reported the failure.
+	ProbabilityScoring bool
+
+	// AprioriProbability is the success probability assumed for channels
+	// which haven't failed, within (0, 1]. Only used if
+	// ProbabilityScoring is set.
+	AprioriProbability float64
+
+	// ProbabilityHalfLife is the period over which the difference between
+	// the success probability of a failed channel and the apriori
+	// probability halves. Only used if ProbabilityScoring is set.
+	ProbabilityHalfLife time.Duration
+
+	// ProbabilityWeight is the weight added to a channel during path
+	// finding, per unit of the negative log of its success probability.
+	// Only used if ProbabilityScoring is set.
+	ProbabilityWeight int64
+}
+
 // missionControl contains state which summarizes the past attempts of HTLC
 // routing by external callers when sending payments throughout the network.
 // missionControl remembers the outcome of these past routing attempts (success
@@ -39,41 +172,202 @@ const (
 // vertexes/edges that should be ignored. Items in the view decay after a set
 // period of time, allowing the view to be dynamic w.r.t network changes.
 type missionControl struct {
-	// failedEdges maps a short channel ID to be pruned, to the time that
-	// it was added to the prune view. Edges are added to this map if a
+	// failedEdges maps a directed edge to be pruned, to the time that it
+	// expires from the prune view. Edges are added to this map if a
 	// caller reports to missionControl a failure localized to that edge
-	// when sending a payment.
-	failedEdges map[uint64]time.Time
+	// when sending a payment. If the direction of the failure isn't known,
+	// then the edge is pruned in both directions.
+	failedEdges map[directedEdge]time.Time
 
 	// failedVertexes maps a node's public key that should be pruned, to
-	// the time that it was added to the prune view. Vertexes are added to
+	// the time that it expires from the prune view. Vertexes are added to
 	// this map if a caller reports to missionControl a failure localized
 	// to that particular vertex.
 	failedVertexes map[Vertex]time.Time
 
+	// vertexFailCounts maps each vertex within failedVertexes to the
+	// number of failures that have been reported for it in succession,
+	// each before the failure prior to it decayed. Once this reaches
+	// vertexPromotionFailures, the vertex is promoted to the second
+	// generation.
+	vertexFailCounts map[Vertex]uint32
+
+	// secondGenVertexes maps the public key of each node which has failed
+	// persistently, to the time of its latest failure. These vertexes
+	// form the second generation of the prune view, and remain pruned
+	// for secondGenDecayFactor times the vertex decay period.
+	secondGenVertexes map[Vertex]time.Time
+
+	// blacklist is the set of vertexes which have been blacklisted by the
+	// operator, and so should never be routed through. Unlike the failed
+	// vertexes, these never decay.
+	blacklist map[Vertex]struct{}
+
+	// failedEdgeAmts maps a directed edge, to the smallest amount that
+	// failed to be carried by the edge in that direction, and the time
+	// that failure expires from the prune view. Unlike failedEdges, these
+	// edges are only pruned for payments of at least the failed amount, as
+	// the failure likely only indicates that the channel lacked the
+	// liquidity to carry that amount toward the node.
+	failedEdgeAmts map[directedEdge]channeldb.EdgeAmtFailure
+
+	// succeededEdges maps the short channel ID of each edge which has
+	// carried a payment successfully, to the time of its latest success.
+	succeededEdges map[uint64]time.Time
+
+	// succeededVertexes maps the public key of each node which has
+	// forwarded or received a payment successfully, to the time of its
+	// latest success.
+	succeededVertexes map[Vertex]time.Time
+
+	// vertexDecay is the period after which a failed vertex is garbage
+	// collected from the prune view.
+	vertexDecay time.Duration
+
+	// edgeDecay is the period after which a failed edge is garbage
+	// collected from the prune view.
+	edgeDecay time.Duration
+
+	// decayJitter is the maximum jitter added to the decay period of each
+	// failed edge and vertex, as a fraction of the decay period.
+	decayJitter float64
+
+	// rand is the source of the jitter added to decay periods.
+	rand *rand.Rand
+
+	// successDecay is the period after which a success no longer biases
+	// path finding.
+	successDecay time.Duration
+
+	// successWeight is the amount by which path finding reduces the
+	// weight of an edge for each recent success.
+	successWeight int64
+
 	graph *channeldb.ChannelGraph
 
 	selfNode *channeldb.LightningNode
 
-	sync.Mutex
+	// frozenView, if non-nil, is the snapshot of the prune view that
+	// GraphPruneView will return while the prune view is frozen. Failures
+	// reported while frozen are still recorded, but won't be reflected in
+	// the returned view until it's unfrozen.
+	frozenView *graphPruneView
 
-	// TODO(roasbeef): further counters, if vertex continually unavailable,
-	// add to another generation
+	// generation is incremented each time the prune view changes, be it
+	// due to a newly reported failure, or the garbage collection of a
+	// stale one, along with each time the graph changes. Payment sessions
+	// created at the same generation share the same prune view and graph,
+	// and so may share the paths found for them.
+	generation uint64
 
-	// TODO(roasbeef): also add favorable metrics for nodes
+	// routeCache caches the paths recently found for payment sessions,
+	// keyed in part by the generation of the prune view they were found
+	// with.
+	routeCache *routeCache
+
+	// pathFindingSlots is a semaphore bounding the number of path finding
+	// searches run at once, each holding a slot for the duration of the
+	// search. If nil, then the number of searches is unbounded.
+	pathFindingSlots chan struct{}
+
+	// failuresReported is the number of vertex and channel failures
+	// reported to missionControl since it was created.
+	failuresReported uint64
+
+	// prunesCollected is the number of failures garbage collected from
+	// the prune view after decaying, since missionControl was created.
+	prunesCollected uint64
+
+	// routeRequests is the number of routes requested from missionControl
+	// since it was created.
+	routeRequests uint64
+
+	// probabilityScoring is true if channel failures lower the success
+	// probability of the channel, rather than pruning it.
+	probabilityScoring bool
+
+	// edgeProbabilities maps each directed edge which has failed, while
+	// scoring by probability, to its estimated success probability. Edges
+	// without an entry are assumed to have the apriori probability.
+	edgeProbabilities map[directedEdge]edgeProbability
+
+	// aprioriProbability is the success probability assumed for edges
+	// which haven't failed.
+	aprioriProbability float64
+
+	// probabilityHalfLife is the period over which the success
+	// probability of a failed edge halves its distance to the apriori
+	// probability.
+	probabilityHalfLife time.Duration
+
+	// probabilityWeight is the weight added to an edge per unit of the
+	// negative log of its success probability.
+	probabilityWeight int64
+
+	sync.Mutex
 }
 
-// newMissionControl returns a new instance of missionControl.
-//
-// TODO(roasbeef): persist memory
+// newMissionControl returns a new instance of missionControl. If cfg is nil,
+// then the default decay periods of vertexDecay, edgeDecay and successDecay,
+// along with the default decayJitter, successWeight and
+// maxConcurrentPathFinding, are used, with probability scoring disabled. The
+// failure history stored within the graph's database isn't loaded until
+// LoadHistory is called. Success probabilities aren't part of the stored
+// history.
 func newMissionControl(g *channeldb.ChannelGraph,
-	selfNode *channeldb.LightningNode) *missionControl {
+	selfNode *channeldb.LightningNode,
+	cfg *MissionControlConfig) *missionControl {
+
+	if cfg == nil {
+		cfg = &MissionControlConfig{
+			VertexDecay:   vertexDecay,
+			EdgeDecay:     edgeDecay,
+			DecayJitter:   decayJitter,
+			SuccessDecay:  successDecay,
+			SuccessWeight: successWeight,
+
+			MaxConcurrentPathFinding: maxConcurrentPathFinding,
+
+			AprioriProbability:  aprioriProbability,
+			ProbabilityHalfLife: probabilityHalfLife,
+			ProbabilityWeight:   probabilityWeight,
+		}
+	}
+
+	randSource := rand.NewSource(time.Now().UnixNano())
+
+	var pathFindingSlots chan struct{}
+	if cfg.MaxConcurrentPathFinding > 0 {
+		pathFindingSlots = make(
+			chan struct{}, cfg.MaxConcurrentPathFinding,
+		)
+	}
 
 	return &missionControl{
-		failedEdges:    make(map[uint64]time.Time),
-		failedVertexes: make(map[Vertex]time.Time),
-		selfNode:       selfNode,
-		graph:          g,
+		failedEdges:       make(map[directedEdge]time.Time),
+		failedVertexes:    make(map[Vertex]time.Time),
+		vertexFailCounts:  make(map[Vertex]uint32),
+		secondGenVertexes: make(map[Vertex]time.Time),
+		blacklist:         make(map[Vertex]struct{}),
+		failedEdgeAmts:    make(map[directedEdge]channeldb.EdgeAmtFailure),
+		succeededEdges:    make(map[uint64]time.Time),
+		succeededVertexes: make(map[Vertex]time.Time),
+		vertexDecay:       cfg.VertexDecay,
+		edgeDecay:         cfg.EdgeDecay,
+		decayJitter:       cfg.DecayJitter,
+		rand:              rand.New(randSource),
+		successDecay:      cfg.SuccessDecay,
+		successWeight:     cfg.SuccessWeight,
+		routeCache:        newRouteCache(routeCacheSize),
+		pathFindingSlots:  pathFindingSlots,
+		edgeProbabilities: make(map[directedEdge]edgeProbability),
+		selfNode:          selfNode,
+		graph:             g,
+
+		probabilityScoring:  cfg.ProbabilityScoring,
+		aprioriProbability:  cfg.AprioriProbability,
+		probabilityHalfLife: cfg.ProbabilityHalfLife,
+		probabilityWeight:   cfg.ProbabilityWeight,
 	}
 }
 
@@ -83,9 +377,34 @@ func newMissionControl(g *channeldb.ChannelGraph,
 // state of the wider network from the PoV of mission control compiled via HTLC
 // routing attempts in the past.
 type graphPruneView struct {
-	edges map[uint64]struct{}
+	edges map[directedEdge]struct{}
 
 	vertexes map[Vertex]struct{}
+
+	// edgeAmts maps each directed edge that should only be ignored for
+	// larger payments, to the smallest amount that failed to be carried by
+	// it in that direction.
+	edgeAmts map[directedEdge]btcutil.Amount
+}
+
+// ignoredEdges returns the set of edges that path finding should ignore when
+// routing a payment of the passed amount. This includes each edge which has
+// failed outright, along with each edge which has failed to carry an amount
+// no larger than the payment.
+func (g *graphPruneView) ignoredEdges(
+	amt btcutil.Amount) map[directedEdge]struct{} {
+
+	edges := make(map[directedEdge]struct{}, len(g.edges)+len(g.edgeAmts))
+	for edge := range g.edges {
+		edges[edge] = struct{}{}
+	}
+	for edge, failedAmt := range g.edgeAmts {
+		if amt >= failedAmt {
+			edges[edge] = struct{}{}
+		}
+	}
+
+	return edges
 }
 
 // GraphPruneView returns a new graphPruneView instance which is to be
@@ -93,52 +412,428 @@ type graphPruneView struct {
 // prune view, it is to be ignored as a goroutine has had issues routing
 // through it successfully. Within this method the main view of the
 // missionControl is garbage collected as entries are detected to be "stale".
+//
+// NOTE: If the prune view has been frozen, then a copy of the frozen snapshot
+// is returned instead, and no garbage collection takes place.
 func (m *missionControl) GraphPruneView() graphPruneView {
-	// First, we'll grab the current time, this value will be used to
-	// determine if an entry is stale or not.
-	now := time.Now()
+	m.Lock()
+	defer m.Unlock()
+
+	return m.currentPruneView()
+}
+
+// currentPruneView returns the prune view which new payment sessions are to
+// use, being the frozen snapshot if any, and the garbage collected main view
+// otherwise.
+//
+// NOTE: This method MUST be called with the mission control mutex held.
+func (m *missionControl) currentPruneView() graphPruneView {
+	if m.frozenView != nil {
+		log.Debugf("Mission Control returning frozen prune view of %v "+
+			"edges, %v vertexes", len(m.frozenView.edges),
+			len(m.frozenView.vertexes))
+
+		return m.frozenView.copy()
+	}
+
+	view := m.graphPruneView()
+
+	log.Debugf("Mission Control returning prune view of %v edges, %v "+
+		"vertexes", len(view.edges), len(view.vertexes))
+
+	return view
+}
+
+// FreezePruneView freezes the prune view returned by GraphPruneView at its
+// current state. Until UnfreezePruneView is called, GraphPruneView will return
+// this same snapshot, without garbage collecting stale entries or reflecting
+// any newly reported failures. This allows callers to ensure that a burst of
+// payment attempts all observe a consistent view of the network.
+func (m *missionControl) FreezePruneView() {
+	m.Lock()
+	defer m.Unlock()
+
+	if m.frozenView != nil {
+		return
+	}
 
+	view := m.graphPruneView()
+	m.frozenView = &view
+}
+
+// UnfreezePruneView resumes the normal behavior of GraphPruneView after a
+// prior call to FreezePruneView. Any failures reported while the view was
+// frozen will be reflected in the next view returned.
+func (m *missionControl) UnfreezePruneView() {
 	m.Lock()
+	m.frozenView = nil
+	m.Unlock()
+}
+
+// graphPruneView garbage collects any stale entries from the main view of
+// missionControl, and returns a new graphPruneView containing the remaining
+// entries.
+//
+// NOTE: This method MUST be called with the mission control mutex held.
+func (m *missionControl) graphPruneView() graphPruneView {
+	return m.pruneView(time.Now(), true)
+}
+
+// pruneView returns a new graphPruneView containing the entries of the main
+// view of missionControl which haven't gone stale as of the passed time. If
+// collectGarbage is true, then any stale entries are also removed from the
+// main view.
+//
+// NOTE: This method MUST be called with the mission control mutex held.
+func (m *missionControl) pruneView(now time.Time,
+	collectGarbage bool) graphPruneView {
 
 	// For each of the vertexes that have been added to the prune view, if
 	// it is now "stale", then we'll ignore it and avoid adding it to the
 	// view we'll return.
 	vertexes := make(map[Vertex]struct{})
-	for vertex, pruneTime := range m.failedVertexes {
-		if now.Sub(pruneTime) >= vertexDecay {
-			log.Tracef("Pruning decayed failure report for vertex %v "+
-				"from Mission Control", vertex)
+	for vertex, expiry := range m.failedVertexes {
+		if !now.Before(expiry) {
+			if collectGarbage {
+				log.Tracef("Pruning decayed failure report "+
+					"for vertex %v from Mission Control",
+					vertex)
 
-			delete(m.failedVertexes, vertex)
+				delete(m.failedVertexes, vertex)
+				delete(m.vertexFailCounts, vertex)
+				m.generation++
+				m.prunesCollected++
+			}
 			continue
 		}
 
 		vertexes[vertex] = struct{}{}
 	}
 
-	// We'll also do the same for edges, but use the edgeDecay this time
-	// rather than the decay for vertexes.
-	edges := make(map[uint64]struct{})
-	for edge, pruneTime := range m.failedEdges {
-		if now.Sub(pruneTime) >= edgeDecay {
-			log.Tracef("Pruning decayed failure report for edge %v "+
-				"from Mission Control", edge)
+	// Vertexes within the second generation are treated in the same way,
+	// though they take longer to decay.
+	secondGenDecay := m.vertexDecay * secondGenDecayFactor
+	for vertex, pruneTime := range m.secondGenVertexes {
+		if now.Sub(pruneTime) >= secondGenDecay {
+			if collectGarbage {
+				log.Tracef("Pruning decayed second generation "+
+					"failure report for vertex %v from "+
+					"Mission Control", vertex)
 
-			delete(m.failedEdges, edge)
+				delete(m.secondGenVertexes, vertex)
+				m.generation++
+				m.prunesCollected++
+			}
+			continue
+		}
+
+		vertexes[vertex] = struct{}{}
+	}
+
+	// Blacklisted vertexes never decay, so they're always included.
+	for vertex := range m.blacklist {
+		vertexes[vertex] = struct{}{}
+	}
+
+	// We'll also do the same for edges.
+	edges := make(map[directedEdge]struct{})
+	for edge, expiry := range m.failedEdges {
+		if !now.Before(expiry) {
+			if collectGarbage {
+				log.Tracef("Pruning decayed failure report "+
+					"for edge %v from Mission Control", edge)
+
+				delete(m.failedEdges, edge)
+				m.generation++
+				m.prunesCollected++
+			}
 			continue
 		}
 
 		edges[edge] = struct{}{}
 	}
 
+	// Finally, the edges which failed to carry a particular amount decay
+	// in the same way as those which failed outright.
+	edgeAmts := make(map[directedEdge]btcutil.Amount)
+	for edge, failure := range m.failedEdgeAmts {
+		if !now.Before(failure.Expiry) {
+			if collectGarbage {
+				log.Tracef("Pruning decayed failure report "+
+					"for edge %v amount %v from Mission "+
+					"Control", edge, failure.Amt)
+
+				delete(m.failedEdgeAmts, edge)
+				m.generation++
+				m.prunesCollected++
+			}
+			continue
+		}
+
+		edgeAmts[edge] = failure.Amt
+	}
+
+	return graphPruneView{
+		edges:    edges,
+		vertexes: vertexes,
+		edgeAmts: edgeAmts,
+	}
+}
+
+// InvalidateRouteCache evicts every path cached for payment sessions. This
+// should be called whenever the graph changes, as the cached paths carry the
+// channel policies from when they were found, and may route through channels
+// which have since closed. The generation is also bumped, such that any
+// searches still in flight at the time don't cache their paths for later
+// sessions.
+func (m *missionControl) InvalidateRouteCache() {
+	m.Lock()
+	m.generation++
 	m.Unlock()
 
-	log.Debugf("Mission Control returning prune view of %v edges, %v "+
-		"vertexes", len(edges), len(vertexes))
+	m.routeCache.purge()
+}
+
+// BlacklistVertex adds the vertex to the blacklist of mission control, such
+// that it's always ignored during path finding, until removed from the
+// blacklist by RemoveBlacklist. Unlike vertexes which have failed, the
+// blacklisted vertex never decays from the prune view.
+func (m *missionControl) BlacklistVertex(v Vertex) {
+	log.Infof("Blacklisting vertex %v within Mission Control", v)
+
+	m.Lock()
+	m.blacklist[v] = struct{}{}
+	m.generation++
+	m.Unlock()
+}
+
+// RemoveBlacklist removes the vertex from the blacklist of mission control.
+// Any failures of the vertex that haven't yet decayed will still cause it to
+// be ignored.
+func (m *missionControl) RemoveBlacklist(v Vertex) {
+	log.Infof("Removing vertex %v from Mission Control blacklist", v)
+
+	m.Lock()
+	delete(m.blacklist, v)
+	m.generation++
+	m.Unlock()
+}
+
+// PruneViewSnapshot returns the edges and vertexes that mission control is
+// currently ignoring during path finding, for introspection. Only the entries
+// which haven't yet decayed are returned, computed in the same way as
+// GraphPruneView, though without garbage collecting any stale entries. If the
+// prune view has been frozen, then the frozen snapshot is returned instead.
+//
+// The edges are returned as the sorted short channel IDs of the channels
+// which are ignored in at least one direction. Edges which have only failed
+// to carry a particular amount aren't included, as they're only ignored for
+// payments of at least that amount. The vertexes are sorted by their
+// serialized public keys.
+func (m *missionControl) PruneViewSnapshot() ([]uint64, []Vertex, error) {
+	m.Lock()
+	var view graphPruneView
+	if m.frozenView != nil {
+		view = m.frozenView.copy()
+	} else {
+		view = m.pruneView(time.Now(), false)
+	}
+	m.Unlock()
+
+	// As a channel may be ignored in both directions, we'll only include
+	// each channel once.
+	chanIDs := make(map[uint64]struct{}, len(view.edges))
+	for edge := range view.edges {
+		chanIDs[edge.channelID] = struct{}{}
+	}
+	edges := make([]uint64, 0, len(chanIDs))
+	for chanID := range chanIDs {
+		edges = append(edges, chanID)
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		return edges[i] < edges[j]
+	})
+
+	vertexes := make([]Vertex, 0, len(view.vertexes))
+	for vertex := range view.vertexes {
+		vertexes = append(vertexes, vertex)
+	}
+	sort.Slice(vertexes, func(i, j int) bool {
+		return bytes.Compare(vertexes[i][:], vertexes[j][:]) < 0
+	})
+
+	return edges, vertexes, nil
+}
+
+// MissionControlMetrics is a snapshot of the prune activity of mission
+// control, for export to a monitoring system.
+type MissionControlMetrics struct {
+	// PrunedEdges is the number of edges currently within the prune view,
+	// including those only pruned for payments of at least the amount
+	// they failed to carry.
+	PrunedEdges int
+
+	// PrunedVertexes is the number of vertexes currently within the prune
+	// view, including those which have been blacklisted.
+	PrunedVertexes int
+
+	// FailuresReported is the number of vertex and channel failures
+	// reported since mission control was created.
+	FailuresReported uint64
+
+	// PrunesCollected is the number of failures garbage collected from the
+	// prune view after decaying, since mission control was created.
+	PrunesCollected uint64
+
+	// RouteRequests is the number of calls to RequestRoute since mission
+	// control was created.
+	RouteRequests uint64
+}
+
+// Metrics returns a snapshot of the prune activity of mission control. The
+// current counts reflect the main prune view, regardless of whether it's
+// frozen, and no garbage collection takes place.
+func (m *missionControl) Metrics() MissionControlMetrics {
+	m.Lock()
+	defer m.Unlock()
+
+	view := m.pruneView(time.Now(), false)
+
+	return MissionControlMetrics{
+		PrunedEdges:      len(view.edges) + len(view.edgeAmts),
+		PrunedVertexes:   len(view.vertexes),
+		FailuresReported: m.failuresReported,
+		PrunesCollected:  m.prunesCollected,
+		RouteRequests:    m.routeRequests,
+	}
+}
+
+// successBias garbage collects any stale successes from missionControl, and
+// returns a successBias containing the remaining successes, which path finding
+// uses to favor edges and vertexes that have recently routed successfully.
+func (m *missionControl) successBias() *successBias {
+	m.Lock()
+	defer m.Unlock()
+
+	now := time.Now()
+
+	edges := make(map[uint64]struct{})
+	for edge, successTime := range m.succeededEdges {
+		if now.Sub(successTime) >= m.successDecay {
+			delete(m.succeededEdges, edge)
+			m.generation++
+			continue
+		}
+
+		edges[edge] = struct{}{}
+	}
+
+	vertexes := make(map[Vertex]struct{})
+	for vertex, successTime := range m.succeededVertexes {
+		if now.Sub(successTime) >= m.successDecay {
+			delete(m.succeededVertexes, vertex)
+			m.generation++
+			continue
+		}
+
+		vertexes[vertex] = struct{}{}
+	}
+
+	bias := &successBias{
+		edges:    edges,
+		vertexes: vertexes,
+		weight:   m.successWeight,
+	}
+	if !m.probabilityScoring {
+		return bias
+	}
+
+	// Edges which have failed recently enough to still have a lowered
+	// success probability are penalized accordingly, while all other
+	// edges receive the penalty of the apriori probability.
+	forgetAfter := m.probabilityHalfLife * probabilityForgetHalfLives
+	bias.penalties = make(map[directedEdge]int64)
+	for edge, prob := range m.edgeProbabilities {
+		if now.Sub(prob.lastFailure) >= forgetAfter {
+			delete(m.edgeProbabilities, edge)
+			m.generation++
+			continue
+		}
+
+		bias.penalties[edge] = m.probabilityPenalty(
+			m.edgeProbability(edge, now),
+		)
+	}
+	bias.basePenalty = m.probabilityPenalty(m.aprioriProbability)
+
+	return bias
+}
+
+// edgeProbability couples the estimated success probability of an edge with
+// the time of its latest failure.
+type edgeProbability struct {
+	// probability is the success probability of the edge immediately
+	// after its latest failure.
+	probability float64
+
+	// lastFailure is the time of the latest failure of the edge.
+	lastFailure time.Time
+}
+
+// edgeProbability returns the estimated success probability of the edge at
+// the passed time. After each failure, the probability of the edge recovers
+// toward the apriori probability, halving the difference between the two
+// every probability half-life.
+//
+// NOTE: This method MUST be called with the mission control mutex held.
+func (m *missionControl) edgeProbability(edge directedEdge,
+	now time.Time) float64 {
+
+	prob, ok := m.edgeProbabilities[edge]
+	if !ok {
+		return m.aprioriProbability
+	}
+
+	var halfLives float64
+	if m.probabilityHalfLife > 0 {
+		elapsed := now.Sub(prob.lastFailure)
+		halfLives = float64(elapsed) / float64(m.probabilityHalfLife)
+	}
+
+	recovered := m.aprioriProbability -
+		(m.aprioriProbability-prob.probability)*math.Exp2(-halfLives)
+	return math.Max(recovered, minProbability)
+}
+
+// probabilityPenalty returns the weight added to an edge with the passed
+// success probability during path finding.
+func (m *missionControl) probabilityPenalty(probability float64) int64 {
+	probability = math.Max(probability, minProbability)
+	return int64(-math.Log(probability) * float64(m.probabilityWeight))
+}
+
+// copy returns a deep copy of the prune view. This allows a payment session
+// to extend its own view without modifying the original.
+func (g *graphPruneView) copy() graphPruneView {
+	edges := make(map[directedEdge]struct{}, len(g.edges))
+	for edge := range g.edges {
+		edges[edge] = struct{}{}
+	}
+
+	vertexes := make(map[Vertex]struct{}, len(g.vertexes))
+	for vertex := range g.vertexes {
+		vertexes[vertex] = struct{}{}
+	}
+
+	edgeAmts := make(map[directedEdge]btcutil.Amount, len(g.edgeAmts))
+	for edge, failedAmt := range g.edgeAmts {
+		edgeAmts[edge] = failedAmt
+	}
 
 	return graphPruneView{
 		edges:    edges,
 		vertexes: vertexes,
+		edgeAmts: edgeAmts,
 	}
 }
 
@@ -152,57 +847,237 @@ func (m *missionControl) GraphPruneView() graphPruneView {
 type paymentSession struct {
 	pruneViewSnapshot graphPruneView
 
+	// generation is the generation of the prune view of mission control
+	// that the session's snapshot was taken from.
+	generation uint64
+
+	// cacheable is true if the session's snapshot matches the prune view
+	// of mission control at the generation it was taken from, allowing
+	// the session to share cached paths with other such sessions. This no
+	// longer holds once the session reports a failure, or if the snapshot
+	// was taken from a frozen prune view.
+	cacheable bool
+
 	mc *missionControl
 }
 
 // NewPaymentSession creates a new payment session backed by the latest prune
 // view from Mission Control.
 func (m *missionControl) NewPaymentSession() *paymentSession {
-	viewSnapshot := m.GraphPruneView()
+	// We'll note the generation of the prune view along with the snapshot
+	// itself, under the same lock, as taking the snapshot may garbage
+	// collect stale entries, bumping the generation.
+	m.Lock()
+	viewSnapshot := m.currentPruneView()
+	generation := m.generation
+	cacheable := m.frozenView == nil
+	m.Unlock()
 
 	return &paymentSession{
 		pruneViewSnapshot: viewSnapshot,
+		generation:        generation,
+		cacheable:         cacheable,
 		mc:                m,
 	}
 }
 
 // ReportVertexFailure adds a vertex to the graph prune view after a client
 // reports a routing failure localized to the vertex. The time the vertex was
-// added is noted, as it'll be pruned from the shared view after a period of
-// vertexDecay. However, the vertex will remain pruned for the *local* session.
-// This ensures we don't retry this vertex during the payment attempt.
+// added is noted, as it'll be pruned from the shared view after the vertex
+// decay period of mission control. However, the vertex will remain pruned for
+// the *local* session. This ensures we don't retry this vertex during the
+// payment attempt. If the vertex continually fails, then it's promoted to the
+// second generation of the prune view, extending the period it remains pruned
+// within the shared view.
 func (p *paymentSession) ReportVertexFailure(v Vertex) {
 	log.Debugf("Reporting vertex %v failure to Mission Control", v)
 
 	// First, we'll add the failed vertex to our local prune view snapshot.
 	p.pruneViewSnapshot.vertexes[v] = struct{}{}
+	p.cacheable = false
 
 	// With the vertex added, we'll now report back to the global prune
 	// view, with this new piece of information so it can be utilized for
 	// new payment sessions.
 	p.mc.Lock()
-	p.mc.failedVertexes[v] = time.Now()
+	p.mc.reportVertexFailure(v, time.Now())
+	p.mc.failuresReported++
 	p.mc.Unlock()
 }
 
+// reportVertexFailure records a failure of the vertex at the passed time
+// within the prune view, promoting the vertex to the second generation once
+// it has failed vertexPromotionFailures times in succession.
+//
+// NOTE: This method MUST be called with the mission control mutex held.
+func (m *missionControl) reportVertexFailure(v Vertex, now time.Time) {
+	// If the vertex has already been promoted, then we'll just refresh
+	// the time of its latest failure.
+	if _, ok := m.secondGenVertexes[v]; ok {
+		m.secondGenVertexes[v] = now
+		return
+	}
+
+	// Otherwise, this failure only counts toward promotion if the prior
+	// failure of the vertex hasn't yet decayed.
+	expiry, ok := m.failedVertexes[v]
+	if ok && now.Before(expiry) {
+		m.vertexFailCounts[v]++
+	} else {
+		m.vertexFailCounts[v] = 1
+	}
+
+	m.generation++
+
+	if m.vertexFailCounts[v] < vertexPromotionFailures {
+		m.failedVertexes[v] = m.expiry(now, m.vertexDecay)
+		return
+	}
+
+	log.Debugf("Promoting vertex %v to second generation of Mission "+
+		"Control after %v failures", v, m.vertexFailCounts[v])
+
+	delete(m.failedVertexes, v)
+	delete(m.vertexFailCounts, v)
+	m.secondGenVertexes[v] = now
+}
+
 // ReportChannelFailure adds a channel to the graph prune view. The time the
-// channel was added is noted, as it'll be pruned from the global view after a
-// period of edgeDecay. However, the edge will remain pruned for the duration
-// of the *local* session. This ensures that we don't flap by continually
-// retrying an edge after its pruning has expired.
+// channel was added is noted, as it'll be pruned from the global view after
+// the edge decay period of mission control. However, the edge will remain
+// pruned for the duration of the *local* session. This ensures that we don't
+// flap by continually retrying an edge after its pruning has expired.
 //
-// TODO(roasbeef): also add value attempted to send and capacity of channel
-func (p *paymentSession) ReportChannelFailure(e uint64) {
-	log.Debugf("Reporting edge %v failure to Mission Control", e)
+// The failure is only recorded in the direction toward the passed node, as a
+// channel may be unable to route in one direction while routing successfully
+// in the other. If towardNode is nil, then the edge is pruned in both
+// directions.
+func (p *paymentSession) ReportChannelFailure(e uint64, towardNode *Vertex) {
+	edge := directedEdge{channelID: e}
+	if towardNode != nil {
+		edge.towardNode = *towardNode
+	}
+
+	log.Debugf("Reporting edge %v failure to Mission Control", edge)
 
 	// First, we'll add the failed edge to our local prune view snapshot.
-	p.pruneViewSnapshot.edges[e] = struct{}{}
+	p.pruneViewSnapshot.edges[edge] = struct{}{}
+	p.cacheable = false
 
 	// With the edge added, we'll now report back to the global prune view,
 	// with this new piece of information so it can be utilized for new
-	// payment sessions.
+	// payment sessions. If we're scoring edges by probability, then we'll
+	// lower the edge's success probability instead of pruning it.
 	p.mc.Lock()
-	p.mc.failedEdges[e] = time.Now()
+	now := time.Now()
+	if p.mc.probabilityScoring {
+		p.mc.edgeProbabilities[edge] = edgeProbability{
+			probability: p.mc.edgeProbability(edge, now) *
+				probabilityFailureFactor,
+			lastFailure: now,
+		}
+	} else {
+		p.mc.failedEdges[edge] = p.mc.expiry(now, p.mc.edgeDecay)
+	}
+	p.mc.generation++
+	p.mc.failuresReported++
+	p.mc.Unlock()
+}
+
+// expiry returns the time at which a failure reported at the passed time
+// should expire from the prune view, given the decay period of the failure. A
+// random jitter of up to the decayJitter fraction of the decay period is
+// added, such that failures reported together don't all expire together.
+//
+// NOTE: This method MUST be called with the mission control mutex held.
+func (m *missionControl) expiry(now time.Time,
+	decay time.Duration) time.Time {
+
+	maxJitter := int64(float64(decay) * m.decayJitter)
+	if maxJitter <= 0 {
+		return now.Add(decay)
+	}
+
+	jitter := time.Duration(m.rand.Int63n(maxJitter))
+	return now.Add(decay + jitter)
+}
+
+// ReportChannelFailureAmt reports that a channel failed to carry the passed
+// amount, likely as it lacked the liquidity to do so. The channel is pruned
+// for the duration of the *local* session, as with ReportChannelFailure.
+// However, within the global view, the channel is only pruned for payments of
+// at least the smallest amount that has failed, allowing smaller payments to
+// still be routed through it.
+//
+// As with ReportChannelFailure, the failure is only recorded in the direction
+// toward the passed node, as a lack of liquidity in one direction typically
+// implies a surplus in the other. If towardNode is nil, then the edge is
+// pruned in both directions.
+func (p *paymentSession) ReportChannelFailureAmt(e uint64, towardNode *Vertex,
+	failedAmt btcutil.Amount) {
+
+	edge := directedEdge{channelID: e}
+	if towardNode != nil {
+		edge.towardNode = *towardNode
+	}
+
+	log.Debugf("Reporting edge %v failure for amount %v to Mission "+
+		"Control", edge, failedAmt)
+
+	// First, we'll add the failed edge to our local prune view snapshot.
+	p.pruneViewSnapshot.edges[edge] = struct{}{}
+	p.cacheable = false
+
+	// With the edge added, we'll now report back to the global prune view.
+	// If a smaller amount has already failed on this edge, and that
+	// failure hasn't yet decayed, then we'll keep that amount, but refresh
+	// the expiry of the failure. As with outright failures, the expiry is
+	// jittered.
+	p.mc.Lock()
+	now := time.Now()
+	failure, ok := p.mc.failedEdgeAmts[edge]
+	if ok && now.Before(failure.Expiry) && failure.Amt < failedAmt {
+		failedAmt = failure.Amt
+	}
+	p.mc.failedEdgeAmts[edge] = channeldb.EdgeAmtFailure{
+		Amt:    failedAmt,
+		Expiry: p.mc.expiry(now, p.mc.edgeDecay),
+	}
+	p.mc.generation++
+	p.mc.failuresReported++
+	p.mc.Unlock()
+}
+
+// ReportVertexSuccess notes that a vertex has successfully forwarded or
+// received a payment. Until the success decay period of mission control
+// passes, path finding will favor paths through the vertex over those of equal
+// cost.
+func (p *paymentSession) ReportVertexSuccess(v Vertex) {
+	log.Debugf("Reporting vertex %v success to Mission Control", v)
+
+	// A new success changes the bias applied to path finding, so cached
+	// paths may no longer be the most favored.
+	p.mc.Lock()
+	if _, ok := p.mc.succeededVertexes[v]; !ok {
+		p.mc.generation++
+	}
+	p.mc.succeededVertexes[v] = time.Now()
+	p.mc.Unlock()
+}
+
+// ReportChannelSuccess notes that a channel has successfully carried a
+// payment. Until the success decay period of mission control passes, path
+// finding will favor paths through the channel over those of equal cost.
+func (p *paymentSession) ReportChannelSuccess(e uint64) {
+	log.Debugf("Reporting edge %v success to Mission Control", e)
+
+	// A new success changes the bias applied to path finding, so cached
+	// paths may no longer be the most favored.
+	p.mc.Lock()
+	if _, ok := p.mc.succeededEdges[e]; !ok {
+		p.mc.generation++
+	}
+	p.mc.succeededEdges[e] = time.Now()
 	p.mc.Unlock()
 }
 
@@ -213,49 +1088,442 @@ func (p *paymentSession) ReportChannelFailure(e uint64) {
 // build an up to date view of the network itself. With each payment a new area
 // will be explored, which feeds into the recommendations made for routing.
 //
+// If another session with the same prune view has recently found a path for
+// a similar payment, then that path is reused, rather than repeating the same
+// path finding.
+//
 // NOTE: This function is safe for concurrent access.
 func (p *paymentSession) RequestRoute(payment *LightningPayment,
 	height uint32, finalCltvDelta uint16) (*Route, error) {
 
+	p.mc.Lock()
+	p.mc.routeRequests++
+	p.mc.Unlock()
+
+	var cacheKey routeCacheKey
+	if p.cacheable {
+		cacheKey = newRouteCacheKey(payment, p.generation)
+
+		path, ok := p.mc.routeCache.get(cacheKey)
+		if ok {
+			route, ok := p.cachedRoute(
+				path, payment, height, finalCltvDelta,
+			)
+			if ok {
+				log.Debugf("Mission Control session using "+
+					"cached path to %x", cacheKey.target)
+
+				return route, nil
+			}
+		}
+	}
+
+	routes, err := p.RequestRoutes(payment, height, finalCltvDelta, 1)
+	if err != nil {
+		return nil, err
+	}
+	route := routes[0]
+
+	if p.cacheable {
+		path := make([]*ChannelHop, len(route.Hops))
+		for i, hop := range route.Hops {
+			path[i] = hop.Channel
+		}
+		p.mc.routeCache.put(cacheKey, path)
+	}
+
+	return route, nil
+}
+
+// cachedRoute attempts to construct a route for the payment from a path found
+// within the route cache. As the path may have been found for a different
+// amount within the same bucket, the path is only used if it satisfies all
+// the constraints path finding would've applied to this payment, and the
+// resulting route is within the payment's limits. If not, then false is
+// returned.
+func (p *paymentSession) cachedRoute(path []*ChannelHop,
+	payment *LightningPayment, height uint32,
+	finalCltvDelta uint16) (*Route, bool) {
+
+	amt := payment.Amount
+	requiredCapacity := amt.ToSatoshis()
+	if payment.MinChannelCapacity > requiredCapacity {
+		requiredCapacity = payment.MinChannelCapacity
+	}
+
+	pruneView := p.pruneViewSnapshot
+	ignoredEdges := pruneView.ignoredEdges(amt.ToSatoshis())
+	for _, hop := range path {
+		v := Vertex(hop.Node.PubKeyBytes)
+		if _, ok := pruneView.vertexes[v]; ok {
+			return nil, false
+		}
+		edge := directedEdge{channelID: hop.ChannelID, towardNode: v}
+		if _, ok := ignoredEdges[edge]; ok {
+			return nil, false
+		}
+		edge = directedEdge{channelID: hop.ChannelID}
+		if _, ok := ignoredEdges[edge]; ok {
+			return nil, false
+		}
+
+		if hop.Capacity < requiredCapacity || amt < hop.MinHTLC {
+			return nil, false
+		}
+	}
+
+	sourceVertex := Vertex(p.mc.selfNode.PubKeyBytes)
+	route, err := newRoute(amt, sourceVertex, path, height, finalCltvDelta)
+	if err != nil {
+		return nil, false
+	}
+
+	if exceedsFeeLimit(route, payment) ||
+		exceedsCltvLimit(route, payment, height) {
+
+		return nil, false
+	}
+
+	return route, true
+}
+
+// withPathFindingSlot runs the passed path finding search once a slot is
+// free, such that no more than the configured maximum number of searches run
+// at once. Any further callers block until a running search completes.
+func (m *missionControl) withPathFindingSlot(search func() error) error {
+	if m.pathFindingSlots == nil {
+		return search()
+	}
+
+	m.pathFindingSlots <- struct{}{}
+	defer func() {
+		<-m.pathFindingSlots
+	}()
+
+	return search()
+}
+
+// exceedsFeeLimit returns true if the total fee of the route exceeds the fee
+// limit of the payment.
+func exceedsFeeLimit(route *Route, payment *LightningPayment) bool {
+	feeLimit := lnwire.NewMSatFromSatoshis(payment.FeeLimit)
+	return feeLimit != 0 && route.TotalFees > feeLimit
+}
+
+// costliestEdge returns the edge of the path which charges the highest fee
+// within the route constructed from it, in the direction it's traveled. As
+// the fee of each hop within the route is that charged to forward over the
+// next edge of the path, the first edge, which is our own, never charges a
+// fee.
+//
+// NOTE: The path MUST have more than a single edge.
+func costliestEdge(path []*ChannelHop, route *Route) directedEdge {
+	costliest := 1
+	for i := 2; i < len(path); i++ {
+		if route.Hops[i-1].Fee > route.Hops[costliest-1].Fee {
+			costliest = i
+		}
+	}
+
+	return directedEdge{
+		channelID:  path[costliest].ChannelID,
+		towardNode: Vertex(path[costliest].Node.PubKeyBytes),
+	}
+}
+
+// exceedsCltvLimit returns true if the total time-lock delta of the route, as
+// accumulated by newRoute, exceeds the CLTV limit of the payment.
+func exceedsCltvLimit(route *Route, payment *LightningPayment,
+	height uint32) bool {
+
+	timeLockDelta := route.TotalTimeLock - height
+	return payment.CltvLimit != 0 && timeLockDelta > payment.CltvLimit
+}
+
+// RequestRoutes returns up to maxPaths distinct routes which are likely to be
+// capable of successfully routing the specified HTLC payment to the target
+// node, in order of preference. This allows a caller to retry a payment over
+// a candidate route without requesting another. To force the routes to
+// diverge, each successive route begins with a different edge than the routes
+// returned before it. Routes whose total fee or time-lock delta exceeds the
+// fee or CLTV limit of the payment are skipped, as are paths which can't be
+// turned into a route. An error is only returned if not even a single route
+// can be found, in which case ErrFeeLimitExceeded or ErrCltvLimitExceeded is
+// returned if routes were found but all were over the respective limit, or
+// the error of the last path which couldn't be turned into a route.
+//
+// NOTE: This function is safe for concurrent access.
+func (p *paymentSession) RequestRoutes(payment *LightningPayment,
+	height uint32, finalCltvDelta uint16, maxPaths int) ([]*Route, error) {
+
 	// First, we'll obtain our current prune view snapshot. This view will
 	// only ever grow during the duration of this payment session, never
 	// shrinking.
 	pruneView := p.pruneViewSnapshot
 
+	// Edges which have only failed to carry larger amounts than this
+	// payment remain eligible to carry it. As this set is built anew for
+	// this request, we're free to extend it below without affecting the
+	// prune view.
+	ignoredEdges := pruneView.ignoredEdges(payment.Amount.ToSatoshis())
+
 	log.Debugf("Mission Control session using prune view of %v "+
-		"edges, %v vertexes", len(pruneView.edges),
+		"edges, %v vertexes", len(ignoredEdges),
 		len(pruneView.vertexes))
 
 	// TODO(roasbeef): sync logic amongst dist sys
 
-	// Taking into account this prune view, we'll attempt to locate a path
-	// to our destination, respecting the recommendations from
-	// missionControl.
-	path, err := findPath(nil, p.mc.graph, p.mc.selfNode, payment.Target,
-		pruneView.vertexes, pruneView.edges, payment.Amount)
-	if err != nil {
-		return nil, err
+	bias := p.mc.successBias()
+	sourceVertex := Vertex(p.mc.selfNode.PubKeyBytes)
+	feeLimit := lnwire.NewMSatFromSatoshis(payment.FeeLimit)
+
+	var (
+		routes            []*Route
+		overFeeLimit      int
+		cheapestOverLimit lnwire.MilliSatoshi
+		overCltvLimit     int
+		constructionErr   error
+	)
+	for len(routes) < maxPaths {
+		// Taking into account this prune view, we'll attempt to locate
+		// a path to our destination, respecting the recommendations
+		// from missionControl, and favoring those edges and vertexes
+		// which have recently routed payments successfully. If we've
+		// already found a route, then running out of paths simply
+		// means there are no more distinct routes to return.
+		var path []*ChannelHop
+		err := p.mc.withPathFindingSlot(func() error {
+			var err error
+			path, err = findPath(nil, p.mc.graph, p.mc.selfNode,
+				payment.Target, pruneView.vertexes,
+				ignoredEdges, bias, payment.Amount,
+				payment.MinChannelCapacity)
+			return err
+		})
+		switch {
+		case IsError(err, ErrNoPathFound) && len(routes) > 0:
+			return routes, nil
+
+		case IsError(err, ErrNoPathFound) && overFeeLimit > 0:
+			return nil, newErrf(ErrFeeLimitExceeded, "all %v "+
+				"routes found exceed fee limit of %v, cheapest "+
+				"requires fee of %v", overFeeLimit, feeLimit,
+				cheapestOverLimit)
+
+		case IsError(err, ErrNoPathFound) && overCltvLimit > 0:
+			return nil, newErrf(ErrCltvLimitExceeded, "all %v "+
+				"routes found exceed CLTV limit of %v",
+				overCltvLimit, payment.CltvLimit)
+
+		case IsError(err, ErrNoPathFound) && constructionErr != nil:
+			return nil, constructionErr
+
+		case err != nil:
+			return nil, err
+		}
+
+		// So that the next route diverges from this one, we'll ignore
+		// the first edge of this path, in the direction it's traveled,
+		// for the remainder of the search, unless the route turns out
+		// to be too expensive.
+		firstHop := path[0]
+		firstEdge := directedEdge{
+			channelID:  firstHop.ChannelID,
+			towardNode: Vertex(firstHop.Node.PubKeyBytes),
+		}
+
+		// With the next candidate path found, we'll attempt to turn
+		// this into a route by applying the time-lock and fee
+		// requirements. If this fails, then we'll move on to the next
+		// path, though should no route be found, the error identifying
+		// the hop which didn't work out is returned, so the caller can
+		// report it.
+		route, err := newRoute(payment.Amount, sourceVertex, path,
+			height, finalCltvDelta)
+		if err != nil {
+			log.Debugf("Skipping path which can't be turned into "+
+				"a route: %v", err)
+
+			ignoredEdges[firstEdge] = struct{}{}
+			constructionErr = err
+			continue
+		}
+
+		// If the route is too expensive, then we'll skip it. Rather
+		// than its first edge, which cheaper routes may share, we'll
+		// ignore the edge charging the highest fee, such that the
+		// search continues for a cheaper route. As the route charges a
+		// fee, it must have more than a single edge.
+		if exceedsFeeLimit(route, payment) {
+			log.Debugf("Skipping route with fee of %v, exceeding "+
+				"fee limit of %v", route.TotalFees, feeLimit)
+
+			ignoredEdges[costliestEdge(path, route)] = struct{}{}
+
+			if overFeeLimit == 0 ||
+				route.TotalFees < cheapestOverLimit {
+
+				cheapestOverLimit = route.TotalFees
+			}
+			overFeeLimit++
+			continue
+		}
+
+		ignoredEdges[firstEdge] = struct{}{}
+
+		// Similarly, we'll skip the route if it'd lock up the funds
+		// of the payment for too long should it fail. The time-lock
+		// delta of the route is that extended to its first hop.
+		if exceedsCltvLimit(route, payment, height) {
+			log.Debugf("Skipping route with time-lock delta of %v, "+
+				"exceeding CLTV limit of %v",
+				route.TotalTimeLock-height, payment.CltvLimit)
+
+			overCltvLimit++
+			continue
+		}
+
+		routes = append(routes, route)
 	}
 
-	// With the next candidate path found, we'll attempt to turn this into
-	// a route by applying the time-lock and fee requirements.
-	sourceVertex := Vertex(p.mc.selfNode.PubKeyBytes)
-	route, err := newRoute(payment.Amount, sourceVertex, path, height,
-		finalCltvDelta)
+	return routes, nil
+}
+
+// LoadHistory loads the failure history of missionControl from the graph's
+// database, merging it into the current history. Entries which have decayed
+// since they were flushed are discarded. If missionControl isn't backed by a
+// graph, then this method is a noop.
+func (m *missionControl) LoadHistory() error {
+	if m.graph == nil {
+		return nil
+	}
+
+	history, err := m.graph.Database().FetchMissionControlHistory()
 	if err != nil {
-		// TODO(roasbeef): return which edge/vertex didn't work
-		// out
-		return nil, err
+		return err
+	}
+
+	now := time.Now()
+
+	m.Lock()
+	defer m.Unlock()
+
+	m.generation++
+
+	for edge, expiry := range history.FailedEdges {
+		if !now.Before(expiry) {
+			continue
+		}
+
+		m.failedEdges[directedEdge{
+			channelID:  edge.ChannelID,
+			towardNode: Vertex(edge.ToNode),
+		}] = expiry
+	}
+	for vertex, expiry := range history.FailedVertexes {
+		if !now.Before(expiry) {
+			continue
+		}
+
+		m.failedVertexes[Vertex(vertex)] = expiry
+	}
+	secondGenDecay := m.vertexDecay * secondGenDecayFactor
+	for vertex, pruneTime := range history.PersistentVertexes {
+		if now.Sub(pruneTime) >= secondGenDecay {
+			continue
+		}
+
+		m.secondGenVertexes[Vertex(vertex)] = pruneTime
+	}
+	for vertex := range history.Blacklist {
+		m.blacklist[Vertex(vertex)] = struct{}{}
+	}
+	for edge, failure := range history.FailedEdgeAmts {
+		if !now.Before(failure.Expiry) {
+			continue
+		}
+
+		m.failedEdgeAmts[directedEdge{
+			channelID:  edge.ChannelID,
+			towardNode: Vertex(edge.ToNode),
+		}] = failure
+	}
+
+	log.Debugf("Mission Control loaded history of %v edges, %v vertexes, "+
+		"%v second generation vertexes, %v blacklisted vertexes, %v "+
+		"edge amounts", len(m.failedEdges), len(m.failedVertexes),
+		len(m.secondGenVertexes), len(m.blacklist),
+		len(m.failedEdgeAmts))
+
+	return nil
+}
+
+// FlushHistory writes the current failure history of missionControl to the
+// graph's database, replacing any history flushed previously. If
+// missionControl isn't backed by a graph, then this method is a noop.
+func (m *missionControl) FlushHistory() error {
+	if m.graph == nil {
+		return nil
+	}
+
+	// We'll copy the history while holding the mutex, so that failures
+	// can still be reported while the history is being written.
+	m.Lock()
+	history := &channeldb.MissionControlHistory{
+		FailedEdges: make(
+			map[channeldb.FailedEdge]time.Time, len(m.failedEdges),
+		),
+		FailedVertexes: make(
+			map[[33]byte]time.Time, len(m.failedVertexes),
+		),
+		PersistentVertexes: make(
+			map[[33]byte]time.Time, len(m.secondGenVertexes),
+		),
+		Blacklist: make(map[[33]byte]struct{}, len(m.blacklist)),
+		FailedEdgeAmts: make(
+			map[channeldb.FailedEdge]channeldb.EdgeAmtFailure,
+			len(m.failedEdgeAmts),
+		),
 	}
+	for edge, expiry := range m.failedEdges {
+		history.FailedEdges[channeldb.FailedEdge{
+			ChannelID: edge.channelID,
+			ToNode:    edge.towardNode,
+		}] = expiry
+	}
+	for vertex, expiry := range m.failedVertexes {
+		history.FailedVertexes[vertex] = expiry
+	}
+	for vertex, pruneTime := range m.secondGenVertexes {
+		history.PersistentVertexes[vertex] = pruneTime
+	}
+	for vertex := range m.blacklist {
+		history.Blacklist[vertex] = struct{}{}
+	}
+	for edge, failure := range m.failedEdgeAmts {
+		history.FailedEdgeAmts[channeldb.FailedEdge{
+			ChannelID: edge.channelID,
+			ToNode:    edge.towardNode,
+		}] = failure
+	}
+	m.Unlock()
 
-	return route, err
+	return m.graph.Database().PutMissionControlHistory(history)
 }
 
 // ResetHistory resets the history of missionControl returning it to a state as
-// if no payment attempts have been made.
+// if no payment attempts have been made. As the blacklist isn't a product of
+// past payment attempts, it's left intact.
 func (m *missionControl) ResetHistory() {
 	m.Lock()
-	m.failedEdges = make(map[uint64]time.Time)
+	m.failedEdges = make(map[directedEdge]time.Time)
 	m.failedVertexes = make(map[Vertex]time.Time)
+	m.vertexFailCounts = make(map[Vertex]uint32)
+	m.secondGenVertexes = make(map[Vertex]time.Time)
+	m.failedEdgeAmts = make(map[directedEdge]channeldb.EdgeAmtFailure)
+	m.succeededEdges = make(map[uint64]time.Time)
+	m.succeededVertexes = make(map[Vertex]time.Time)
+	m.edgeProbabilities = make(map[directedEdge]edgeProbability)
+	m.generation++
 	m.Unlock()
 }
@@ -0,0 +1,1390 @@
+package routing
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lightningnetwork/lnd/channeldb"
+	"github.com/lightningnetwork/lnd/lnwire"
+	"github.com/roasbeef/btcutil"
+)
+
+// TestMissionControlFreezePruneView tests that while the prune view is
+// frozen, GraphPruneView returns the same snapshot regardless of any newly
+// reported or decayed failures, and that normal behavior resumes once
+// unfrozen.
+func TestMissionControlFreezePruneView(t *testing.T) {
+	t.Parallel()
+
+	mc := newMissionControl(nil, nil, nil)
+
+	var staleVertex, freshVertex Vertex
+	staleVertex[0] = 1
+	freshVertex[0] = 2
+
+	// We'll start with a single stale vertex that has already decayed,
+	// and a single fresh edge failure.
+	mc.failedVertexes[staleVertex] = time.Now().Add(-vertexDecay)
+	mc.failedEdges[directedEdge{channelID: 1}] = time.Now().Add(edgeDecay)
+
+	mc.FreezePruneView()
+
+	// The stale vertex should've been garbage collected when the view was
+	// frozen.
+	view := mc.GraphPruneView()
+	if len(view.vertexes) != 0 || len(view.edges) != 1 {
+		t.Fatalf("unexpected frozen view: %v edges, %v vertexes",
+			len(view.edges), len(view.vertexes))
+	}
+
+	// Modifying the returned view, as a payment session would, shouldn't
+	// affect the frozen snapshot.
+	view.edges[directedEdge{channelID: 2}] = struct{}{}
+
+	// Report new failures while the view is frozen. These should be
+	// recorded, but not reflected in the view.
+	session := mc.NewPaymentSession()
+	session.ReportVertexFailure(freshVertex)
+	session.ReportChannelFailure(3, nil)
+
+	view = mc.GraphPruneView()
+	if len(view.vertexes) != 0 || len(view.edges) != 1 {
+		t.Fatalf("frozen view changed: %v edges, %v vertexes",
+			len(view.edges), len(view.vertexes))
+	}
+	if _, ok := view.edges[directedEdge{channelID: 1}]; !ok {
+		t.Fatalf("edge missing from frozen view")
+	}
+
+	// Once unfrozen, the failures reported in the meantime should be
+	// reflected in the view.
+	mc.UnfreezePruneView()
+
+	view = mc.GraphPruneView()
+	if len(view.vertexes) != 1 || len(view.edges) != 2 {
+		t.Fatalf("unexpected view after unfreeze: %v edges, %v "+
+			"vertexes", len(view.edges), len(view.vertexes))
+	}
+	if _, ok := view.vertexes[freshVertex]; !ok {
+		t.Fatalf("vertex reported while frozen missing from view")
+	}
+	if _, ok := view.edges[directedEdge{channelID: 3}]; !ok {
+		t.Fatalf("edge reported while frozen missing from view")
+	}
+}
+
+// TestMissionControlHistoryRestore tests that the failure history flushed by
+// missionControl is restored by a new instance backed by the same graph, with
+// any entries that have since decayed discarded.
+func TestMissionControlHistoryRestore(t *testing.T) {
+	t.Parallel()
+
+	graph, cleanUp, err := makeTestGraph()
+	if err != nil {
+		t.Fatalf("unable to create test graph: %v", err)
+	}
+	defer cleanUp()
+
+	mc := newMissionControl(graph, nil, nil)
+
+	var staleVertex, freshVertex Vertex
+	staleVertex[0] = 1
+	freshVertex[0] = 2
+
+	// We'll report a fresh failure for both a vertex and an edge, and add
+	// a failure for each which will have decayed by the time the history
+	// is loaded.
+	session := mc.NewPaymentSession()
+	session.ReportVertexFailure(freshVertex)
+	session.ReportChannelFailure(1, nil)
+	session.ReportChannelFailureAmt(3, &freshVertex, 1000)
+
+	mc.Lock()
+	mc.failedVertexes[staleVertex] = time.Now().Add(-vertexDecay)
+	mc.failedEdges[directedEdge{channelID: 2}] = time.Now().Add(-edgeDecay)
+	mc.Unlock()
+
+	if err := mc.FlushHistory(); err != nil {
+		t.Fatalf("unable to flush history: %v", err)
+	}
+
+	// A new instance of mission control should start out with an empty
+	// history, only restoring the flushed history once loaded.
+	mc = newMissionControl(graph, nil, nil)
+	view := mc.GraphPruneView()
+	if len(view.vertexes) != 0 || len(view.edges) != 0 {
+		t.Fatalf("expected empty view before loading history: %v "+
+			"edges, %v vertexes", len(view.edges),
+			len(view.vertexes))
+	}
+
+	if err := mc.LoadHistory(); err != nil {
+		t.Fatalf("unable to load history: %v", err)
+	}
+
+	view = mc.GraphPruneView()
+	if len(view.vertexes) != 1 || len(view.edges) != 1 {
+		t.Fatalf("unexpected restored view: %v edges, %v vertexes",
+			len(view.edges), len(view.vertexes))
+	}
+	if _, ok := view.vertexes[freshVertex]; !ok {
+		t.Fatalf("fresh vertex missing from restored view")
+	}
+	if _, ok := view.edges[directedEdge{channelID: 1}]; !ok {
+		t.Fatalf("fresh edge missing from restored view")
+	}
+	amtEdge := directedEdge{channelID: 3, towardNode: freshVertex}
+	if view.edgeAmts[amtEdge] != 1000 {
+		t.Fatalf("expected failed amount of %v for edge, got %v",
+			btcutil.Amount(1000), view.edgeAmts[amtEdge])
+	}
+}
+
+// TestMissionControlConfigDecay tests that failures reported to
+// missionControl expire after the decay periods of its config, rather than the
+// default decay periods.
+func TestMissionControlConfigDecay(t *testing.T) {
+	t.Parallel()
+
+	cfg := &MissionControlConfig{
+		VertexDecay: time.Second * 2,
+		EdgeDecay:   time.Second,
+	}
+	mc := newMissionControl(nil, nil, cfg)
+
+	var vertex Vertex
+	vertex[0] = 1
+	edge := directedEdge{channelID: 1}
+	amtEdge := directedEdge{channelID: 2}
+
+	// As the config has no decay jitter, each failure should expire after
+	// exactly the configured decay period.
+	session := mc.NewPaymentSession()
+	before := time.Now()
+	session.ReportVertexFailure(vertex)
+	session.ReportChannelFailure(edge.channelID, nil)
+	session.ReportChannelFailureAmt(amtEdge.channelID, nil, 1000)
+	after := time.Now()
+
+	checkExpiry := func(expiry time.Time, minDecay,
+		maxDecay time.Duration) {
+
+		if expiry.Before(before.Add(minDecay)) ||
+			expiry.After(after.Add(maxDecay)) {
+
+			t.Fatalf("expected expiry between %v and %v, got %v",
+				before.Add(minDecay), after.Add(maxDecay),
+				expiry)
+		}
+	}
+	checkExpiry(
+		mc.failedVertexes[vertex], cfg.VertexDecay, cfg.VertexDecay,
+	)
+	checkExpiry(mc.failedEdges[edge], cfg.EdgeDecay, cfg.EdgeDecay)
+	checkExpiry(
+		mc.failedEdgeAmts[amtEdge].Expiry, cfg.EdgeDecay,
+		cfg.EdgeDecay,
+	)
+
+	// With the default config, the failures should instead expire after
+	// the default decay periods, plus up to the default jitter.
+	mc = newMissionControl(nil, nil, nil)
+	session = mc.NewPaymentSession()
+	before = time.Now()
+	session.ReportVertexFailure(vertex)
+	session.ReportChannelFailure(edge.channelID, nil)
+	session.ReportChannelFailureAmt(amtEdge.channelID, nil, 1000)
+	after = time.Now()
+
+	checkExpiry(
+		mc.failedVertexes[vertex], vertexDecay,
+		vertexDecay+time.Duration(float64(vertexDecay)*decayJitter),
+	)
+	checkExpiry(
+		mc.failedEdges[edge], edgeDecay,
+		edgeDecay+time.Duration(float64(edgeDecay)*decayJitter),
+	)
+	checkExpiry(
+		mc.failedEdgeAmts[amtEdge].Expiry, edgeDecay,
+		edgeDecay+time.Duration(float64(edgeDecay)*decayJitter),
+	)
+}
+
+// TestMissionControlEdgeAmtFailure tests that an edge which failed to carry a
+// particular amount is only ignored for payments of at least the smallest
+// amount which failed, while edges which failed outright are ignored for all
+// payments.
+func TestMissionControlEdgeAmtFailure(t *testing.T) {
+	t.Parallel()
+
+	mc := newMissionControl(nil, nil, nil)
+
+	const (
+		amtEdge  = 1
+		failEdge = 2
+	)
+
+	// We'll report that the first edge failed to carry a payment, and
+	// that the second failed outright.
+	session := mc.NewPaymentSession()
+	session.ReportChannelFailureAmt(amtEdge, nil, 1000)
+	session.ReportChannelFailure(failEdge, nil)
+
+	// The session reporting the failures should ignore both edges,
+	// regardless of the amount, to ensure it doesn't retry them.
+	ignored := session.pruneViewSnapshot.ignoredEdges(1)
+	if len(ignored) != 2 {
+		t.Fatalf("expected session to ignore %v edges, got %v", 2,
+			len(ignored))
+	}
+
+	assertIgnored := func(amt btcutil.Amount, expected bool) {
+		view := mc.GraphPruneView()
+		ignored := view.ignoredEdges(amt)
+
+		_, ok := ignored[directedEdge{channelID: failEdge}]
+		if !ok {
+			t.Fatalf("failed edge not ignored for amount %v", amt)
+		}
+		_, ok = ignored[directedEdge{channelID: amtEdge}]
+		if ok != expected {
+			t.Fatalf("expected edge to be ignored for amount %v: "+
+				"%v, was: %v", amt, expected, ok)
+		}
+	}
+
+	// Payments smaller than the failed amount may still use the edge,
+	// while payments at least as large may not.
+	assertIgnored(999, false)
+	assertIgnored(1000, true)
+	assertIgnored(5000, true)
+
+	// If a smaller amount later fails, then the edge should be ignored
+	// for payments of that amount too.
+	session = mc.NewPaymentSession()
+	session.ReportChannelFailureAmt(amtEdge, nil, 500)
+	assertIgnored(499, false)
+	assertIgnored(500, true)
+
+	// However, a larger amount failing shouldn't allow payments between
+	// the two amounts to use the edge.
+	session = mc.NewPaymentSession()
+	session.ReportChannelFailureAmt(amtEdge, nil, 2000)
+	assertIgnored(499, false)
+	assertIgnored(750, true)
+}
+
+// TestMissionControlEdgeAmtFailureDirection tests that an edge which failed to
+// carry a particular amount toward a node is only ignored in that direction,
+// leaving the opposite direction usable for payments of any amount.
+func TestMissionControlEdgeAmtFailureDirection(t *testing.T) {
+	t.Parallel()
+
+	mc := newMissionControl(nil, nil, nil)
+
+	const chanID = 1
+
+	var nodeA, nodeB Vertex
+	nodeA[0] = 1
+	nodeB[0] = 2
+
+	// We'll report that the channel failed to carry a payment toward B.
+	session := mc.NewPaymentSession()
+	session.ReportChannelFailureAmt(chanID, &nodeB, 1000)
+
+	towardA := directedEdge{channelID: chanID, towardNode: nodeA}
+	towardB := directedEdge{channelID: chanID, towardNode: nodeB}
+
+	// The reporting session should only ignore the direction toward B.
+	ignored := session.pruneViewSnapshot.ignoredEdges(1)
+	if _, ok := ignored[towardB]; !ok {
+		t.Fatalf("session didn't ignore edge toward B")
+	}
+	if _, ok := ignored[towardA]; ok {
+		t.Fatalf("session ignored edge toward A")
+	}
+
+	// Likewise, new sessions should ignore the direction toward B for
+	// payments of at least the failed amount, but never the direction
+	// toward A, nor the channel in both directions.
+	view := mc.GraphPruneView()
+	ignored = view.ignoredEdges(5000)
+	if _, ok := ignored[towardB]; !ok {
+		t.Fatalf("edge toward B not ignored for larger amount")
+	}
+	if _, ok := ignored[towardA]; ok {
+		t.Fatalf("edge toward A ignored for larger amount")
+	}
+	if _, ok := ignored[directedEdge{channelID: chanID}]; ok {
+		t.Fatalf("edge ignored in both directions")
+	}
+}
+
+// TestMissionControlSuccessBias tests that given two paths of equal cost, the
+// route requested from mission control favors the path whose channels or
+// nodes have recently routed payments successfully.
+func TestMissionControlSuccessBias(t *testing.T) {
+	t.Parallel()
+
+	graph, cleanUp, aliases, err := parseTestGraph(equalCostGraphFilePath)
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to create graph: %v", err)
+	}
+
+	sourceNode, err := graph.SourceNode()
+	if err != nil {
+		t.Fatalf("unable to fetch source node: %v", err)
+	}
+
+	mc := newMissionControl(graph, sourceNode, nil)
+
+	payment := &LightningPayment{
+		Target: aliases["sophon"],
+		Amount: lnwire.NewMSatFromSatoshis(100),
+	}
+
+	// requestFirstHop requests a route to sophon, returning the channel
+	// ID of its first hop, which identifies the path taken.
+	requestFirstHop := func() uint64 {
+		session := mc.NewPaymentSession()
+		route, err := session.RequestRoute(payment, 100, 9)
+		if err != nil {
+			t.Fatalf("unable to request route: %v", err)
+		}
+		if len(route.Hops) != 2 {
+			t.Fatalf("expected route of %v hops, got %v", 2,
+				len(route.Hops))
+		}
+
+		return route.Hops[0].Channel.ChannelID
+	}
+
+	// The path via songoku begins with channel 12345, while the path via
+	// satoshi begins with channel 23456. We'll first report successes for
+	// the channels along the path via songoku, which should then be
+	// favored.
+	session := mc.NewPaymentSession()
+	session.ReportChannelSuccess(12345)
+	session.ReportChannelSuccess(34567)
+
+	if chanID := requestFirstHop(); chanID != 12345 {
+		t.Fatalf("expected path via channel %v, got %v", 12345, chanID)
+	}
+
+	// Next, we'll instead report a success for satoshi, after which the
+	// path through it should be favored.
+	mc.ResetHistory()
+	session = mc.NewPaymentSession()
+	session.ReportVertexSuccess(NewVertex(aliases["satoshi"]))
+
+	if chanID := requestFirstHop(); chanID != 23456 {
+		t.Fatalf("expected path via channel %v, got %v", 23456, chanID)
+	}
+
+	// Finally, once the success has decayed, it should no longer have any
+	// influence on path finding.
+	mc.Lock()
+	mc.succeededVertexes[NewVertex(aliases["satoshi"])] = time.Now().Add(
+		-successDecay,
+	)
+	mc.Unlock()
+
+	if bias := mc.successBias(); len(bias.vertexes) != 0 {
+		t.Fatalf("expected decayed success to be garbage collected")
+	}
+}
+
+// TestMissionControlRequestRoutes tests that RequestRoutes returns distinct
+// routes up to the requested limit, while respecting the prune view.
+func TestMissionControlRequestRoutes(t *testing.T) {
+	t.Parallel()
+
+	graph, cleanUp, aliases, err := parseTestGraph(equalCostGraphFilePath)
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to create graph: %v", err)
+	}
+
+	sourceNode, err := graph.SourceNode()
+	if err != nil {
+		t.Fatalf("unable to fetch source node: %v", err)
+	}
+
+	mc := newMissionControl(graph, sourceNode, nil)
+
+	payment := &LightningPayment{
+		Target: aliases["sophon"],
+		Amount: lnwire.NewMSatFromSatoshis(100),
+	}
+
+	// There are only two paths to sophon, via songoku and via satoshi, so
+	// asking for more should return just those two, each beginning with a
+	// different edge.
+	session := mc.NewPaymentSession()
+	routes, err := session.RequestRoutes(payment, 100, 9, 3)
+	if err != nil {
+		t.Fatalf("unable to request routes: %v", err)
+	}
+	if len(routes) != 2 {
+		t.Fatalf("expected %v routes, got %v", 2, len(routes))
+	}
+	firstHops := make(map[uint64]struct{})
+	for _, route := range routes {
+		if len(route.Hops) != 2 {
+			t.Fatalf("expected route of %v hops, got %v", 2,
+				len(route.Hops))
+		}
+
+		firstHops[route.Hops[0].Channel.ChannelID] = struct{}{}
+	}
+	if len(firstHops) != 2 {
+		t.Fatalf("expected routes to be distinct")
+	}
+
+	// The number of routes returned should be limited to maxPaths.
+	routes, err = session.RequestRoutes(payment, 100, 9, 1)
+	if err != nil {
+		t.Fatalf("unable to request routes: %v", err)
+	}
+	if len(routes) != 1 {
+		t.Fatalf("expected %v routes, got %v", 1, len(routes))
+	}
+
+	// Once satoshi has failed, only the route via songoku should remain.
+	session.ReportVertexFailure(NewVertex(aliases["satoshi"]))
+	routes, err = session.RequestRoutes(payment, 100, 9, 3)
+	if err != nil {
+		t.Fatalf("unable to request routes: %v", err)
+	}
+	if len(routes) != 1 || routes[0].Hops[0].Channel.ChannelID != 12345 {
+		t.Fatalf("expected single route via songoku")
+	}
+
+	// Finally, with songoku also failed, no routes remain.
+	session.ReportVertexFailure(NewVertex(aliases["songoku"]))
+	_, err = session.RequestRoutes(payment, 100, 9, 3)
+	if !IsError(err, ErrNoPathFound) {
+		t.Fatalf("expected no path to be found, got %v", err)
+	}
+}
+
+// TestMissionControlRequestRoutesConstructionError tests that if a path can't
+// be turned into a route, then RequestRoutes skips it, still returning the
+// routes found before it.
+func TestMissionControlRequestRoutesConstructionError(t *testing.T) {
+	t.Parallel()
+
+	graph, cleanUp, aliases, err := parseTestGraph(equalCostGraphFilePath)
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to create graph: %v", err)
+	}
+
+	sourceNode, err := graph.SourceNode()
+	if err != nil {
+		t.Fatalf("unable to fetch source node: %v", err)
+	}
+
+	// We'll raise the fee of the channel between satoshi and sophon, such
+	// that the path via satoshi is found after that via songoku, and can't
+	// carry the payment once the fee is added to its first hop.
+	_, policy1, policy2, err := graph.FetchChannelEdgesByID(45678)
+	if err != nil {
+		t.Fatalf("unable to fetch edge: %v", err)
+	}
+	for _, policy := range []*channeldb.ChannelEdgePolicy{policy1, policy2} {
+		policy.FeeProportionalMillionths = 100000
+		if err := graph.UpdateEdgePolicy(policy); err != nil {
+			t.Fatalf("unable to update edge: %v", err)
+		}
+	}
+
+	mc := newMissionControl(graph, sourceNode, nil)
+
+	// Each channel has a capacity of 100k satoshis, so a payment of 99k
+	// satoshis can afford a fee of 1%, but not the 10% charged on the way
+	// to sophon via satoshi.
+	payment := &LightningPayment{
+		Target: aliases["sophon"],
+		Amount: lnwire.NewMSatFromSatoshis(99000),
+	}
+
+	session := mc.NewPaymentSession()
+	routes, err := session.RequestRoutes(payment, 100, 9, 3)
+	if err != nil {
+		t.Fatalf("unable to request routes: %v", err)
+	}
+	if len(routes) != 1 || routes[0].Hops[0].Channel.ChannelID != 12345 {
+		t.Fatalf("expected single route via songoku")
+	}
+
+	// Once songoku has failed, the only path left can't be turned into a
+	// route, so its construction error should be returned.
+	session.ReportVertexFailure(NewVertex(aliases["songoku"]))
+	_, err = session.RequestRoutes(payment, 100, 9, 3)
+	if !IsError(err, ErrInsufficientCapacity) {
+		t.Fatalf("expected insufficient capacity, got %v", err)
+	}
+}
+
+// TestMissionControlFeeLimit tests that routes whose total fee exceeds the fee
+// limit of a payment are rejected, in favor of a cheaper route if one exists.
+func TestMissionControlFeeLimit(t *testing.T) {
+	t.Parallel()
+
+	graph, cleanUp, aliases, err := parseTestGraph(basicGraphFilePath)
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to create graph: %v", err)
+	}
+
+	sourceNode, err := graph.SourceNode()
+	if err != nil {
+		t.Fatalf("unable to fetch source node: %v", err)
+	}
+
+	// We'll bias path finding heavily toward any successes, such that we
+	// can force an expensive route to be found first.
+	mc := newMissionControl(graph, sourceNode, &MissionControlConfig{
+		VertexDecay:   vertexDecay,
+		EdgeDecay:     edgeDecay,
+		SuccessDecay:  successDecay,
+		SuccessWeight: 1 << 40,
+	})
+	session := mc.NewPaymentSession()
+
+	// The only route to sophon able to carry 1000 satoshis is via pham
+	// nuwen, which charges over 1000 satoshis in fees. Without a fee
+	// limit, this route should be returned.
+	payment := &LightningPayment{
+		Target: aliases["sophon"],
+		Amount: lnwire.NewMSatFromSatoshis(1000),
+	}
+	route, err := session.RequestRoute(payment, 100, 9)
+	if err != nil {
+		t.Fatalf("unable to request route: %v", err)
+	}
+	if route.TotalFees <= lnwire.NewMSatFromSatoshis(1000) {
+		t.Fatalf("expected route fee above %v, got %v",
+			lnwire.NewMSatFromSatoshis(1000), route.TotalFees)
+	}
+
+	// With a fee limit below the fee of that route, there's no route
+	// within budget.
+	payment.FeeLimit = 100
+	_, err = session.RequestRoute(payment, 100, 9)
+	if !IsError(err, ErrFeeLimitExceeded) {
+		t.Fatalf("expected fee limit to be exceeded, got %v", err)
+	}
+
+	// A smaller payment can also be routed via songoku, at a much lower
+	// fee. We'll report successes along the route via pham nuwen so that
+	// it's found first, ensuring that it's then skipped in favor of the
+	// cheaper route.
+	session.ReportChannelSuccess(999991)
+	session.ReportChannelSuccess(99999)
+
+	payment = &LightningPayment{
+		Target:   aliases["sophon"],
+		Amount:   lnwire.NewMSatFromSatoshis(100),
+		FeeLimit: 1,
+	}
+	route, err = session.RequestRoute(payment, 100, 9)
+	if err != nil {
+		t.Fatalf("unable to request route: %v", err)
+	}
+	if route.TotalFees > lnwire.NewMSatFromSatoshis(payment.FeeLimit) {
+		t.Fatalf("route fee of %v exceeds fee limit of %v",
+			route.TotalFees, payment.FeeLimit)
+	}
+	if route.Hops[0].Channel.ChannelID != 12345 {
+		t.Fatalf("expected route via songoku, got first hop %v",
+			route.Hops[0].Channel.ChannelID)
+	}
+}
+
+// TestMissionControlFeeLimitSharedFirstHop tests that when a route exceeds the
+// fee limit of a payment, a cheaper route sharing its first hop is still
+// found.
+func TestMissionControlFeeLimitSharedFirstHop(t *testing.T) {
+	t.Parallel()
+
+	graph, cleanUp, aliases, err := parseTestGraph(basicGraphFilePath)
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to create graph: %v", err)
+	}
+
+	// We'll route from songoku, whose only channel able to carry the
+	// payment is that to roasbeef. From there, satoshi can be reached
+	// either directly, or at roughly twice the fee via luo ji.
+	sourceNode, err := graph.FetchLightningNode(aliases["songoku"])
+	if err != nil {
+		t.Fatalf("unable to fetch source node: %v", err)
+	}
+
+	// We'll bias path finding heavily toward any successes, such that we
+	// can force the route via luo ji to be found first.
+	mc := newMissionControl(graph, sourceNode, &MissionControlConfig{
+		VertexDecay:   vertexDecay,
+		EdgeDecay:     edgeDecay,
+		SuccessDecay:  successDecay,
+		SuccessWeight: 1 << 40,
+	})
+	session := mc.NewPaymentSession()
+	session.ReportChannelSuccess(689530843)
+	session.ReportChannelSuccess(523452362)
+
+	// The route via luo ji charges a fee of just over 2 satoshis, while
+	// the direct route charges just over 1 satoshi, so only the latter is
+	// within the fee limit. As both share the same first hop, skipping the
+	// route via luo ji mustn't rule out the direct route.
+	payment := &LightningPayment{
+		Target:   aliases["satoshi"],
+		Amount:   lnwire.NewMSatFromSatoshis(1000),
+		FeeLimit: 2,
+	}
+	routes, err := session.RequestRoutes(payment, 100, 9, 1)
+	if err != nil {
+		t.Fatalf("unable to request routes: %v", err)
+	}
+	if len(routes) != 1 {
+		t.Fatalf("expected %v routes, got %v", 1, len(routes))
+	}
+
+	route := routes[0]
+	if route.TotalFees > lnwire.NewMSatFromSatoshis(payment.FeeLimit) {
+		t.Fatalf("route fee of %v exceeds fee limit of %v",
+			route.TotalFees, payment.FeeLimit)
+	}
+	if len(route.Hops) != 2 ||
+		route.Hops[1].Channel.ChannelID != 2340213491 {
+
+		t.Fatalf("expected direct route from roasbeef to satoshi")
+	}
+}
+
+// TestMissionControlCltvLimit tests that routes whose total time-lock delta
+// exceeds the CLTV limit of a payment are rejected, while shorter routes
+// within the limit are returned.
+func TestMissionControlCltvLimit(t *testing.T) {
+	t.Parallel()
+
+	graph, cleanUp, aliases, err := parseTestGraph(equalCostGraphFilePath)
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to create graph: %v", err)
+	}
+
+	sourceNode, err := graph.SourceNode()
+	if err != nil {
+		t.Fatalf("unable to fetch source node: %v", err)
+	}
+
+	mc := newMissionControl(graph, sourceNode, nil)
+	session := mc.NewPaymentSession()
+
+	const (
+		height         = 100
+		finalCltvDelta = 9
+	)
+
+	// Each route to sophon spans two hops, and as each channel has a
+	// time-lock delta of 10, each route requires a total delta of 19. A
+	// CLTV limit just below this should reject every route.
+	payment := &LightningPayment{
+		Target:    aliases["sophon"],
+		Amount:    lnwire.NewMSatFromSatoshis(100),
+		CltvLimit: 18,
+	}
+	_, err = session.RequestRoute(payment, height, finalCltvDelta)
+	if !IsError(err, ErrCltvLimitExceeded) {
+		t.Fatalf("expected CLTV limit to be exceeded, got %v", err)
+	}
+
+	// The direct route to songoku only requires the final delta, so it
+	// should pass the same limit.
+	payment.Target = aliases["songoku"]
+	route, err := session.RequestRoute(payment, height, finalCltvDelta)
+	if err != nil {
+		t.Fatalf("unable to request route: %v", err)
+	}
+	if route.TotalTimeLock != height+finalCltvDelta {
+		t.Fatalf("expected total time-lock of %v, got %v",
+			height+finalCltvDelta, route.TotalTimeLock)
+	}
+
+	// Finally, a limit exactly matching the delta of the routes to sophon
+	// should allow them to be found.
+	payment.Target = aliases["sophon"]
+	payment.CltvLimit = 19
+	route, err = session.RequestRoute(payment, height, finalCltvDelta)
+	if err != nil {
+		t.Fatalf("unable to request route: %v", err)
+	}
+	if route.TotalTimeLock-height != payment.CltvLimit {
+		t.Fatalf("expected time-lock delta of %v, got %v",
+			payment.CltvLimit, route.TotalTimeLock-height)
+	}
+}
+
+// TestMissionControlVertexGenerations tests that a vertex which fails
+// repeatedly, with each failure reported before the prior one has decayed, is
+// promoted to the second generation of the prune view, extending its decay.
+func TestMissionControlVertexGenerations(t *testing.T) {
+	t.Parallel()
+
+	graph, cleanUp, err := makeTestGraph()
+	if err != nil {
+		t.Fatalf("unable to create test graph: %v", err)
+	}
+	defer cleanUp()
+
+	// We'll disable the decay jitter, such that failures decay after
+	// exactly the vertex decay period.
+	cfg := &MissionControlConfig{
+		VertexDecay: vertexDecay,
+		EdgeDecay:   edgeDecay,
+	}
+	mc := newMissionControl(graph, nil, cfg)
+
+	var flakyVertex, downVertex Vertex
+	flakyVertex[0] = 1
+	downVertex[0] = 2
+
+	// backdate moves the latest failure of each vertex back by the passed
+	// duration, regardless of the generation it's within.
+	backdate := func(d time.Duration) {
+		mc.Lock()
+		defer mc.Unlock()
+
+		for v, pruneTime := range mc.failedVertexes {
+			mc.failedVertexes[v] = pruneTime.Add(-d)
+		}
+		for v, pruneTime := range mc.secondGenVertexes {
+			mc.secondGenVertexes[v] = pruneTime.Add(-d)
+		}
+	}
+
+	// The flaky vertex fails as often as the down vertex, but each of its
+	// failures is reported after the prior one has decayed, so it should
+	// never be promoted.
+	session := mc.NewPaymentSession()
+	for i := 0; i < vertexPromotionFailures; i++ {
+		session.ReportVertexFailure(flakyVertex)
+		backdate(vertexDecay)
+	}
+	for i := 0; i < vertexPromotionFailures; i++ {
+		session.ReportVertexFailure(downVertex)
+	}
+
+	if _, ok := mc.secondGenVertexes[flakyVertex]; ok {
+		t.Fatalf("flaky vertex promoted to second generation")
+	}
+	if _, ok := mc.secondGenVertexes[downVertex]; !ok {
+		t.Fatalf("down vertex not promoted to second generation")
+	}
+
+	// Once the vertex decay has passed, the flaky vertex should be pruned
+	// from the view, while the down vertex should remain.
+	backdate(vertexDecay)
+	view := mc.GraphPruneView()
+	if _, ok := view.vertexes[flakyVertex]; ok {
+		t.Fatalf("flaky vertex should have decayed")
+	}
+	if _, ok := view.vertexes[downVertex]; !ok {
+		t.Fatalf("down vertex should not have decayed")
+	}
+
+	// The second generation should survive a restart.
+	if err := mc.FlushHistory(); err != nil {
+		t.Fatalf("unable to flush history: %v", err)
+	}
+	mc = newMissionControl(graph, nil, cfg)
+	if err := mc.LoadHistory(); err != nil {
+		t.Fatalf("unable to load history: %v", err)
+	}
+	view = mc.GraphPruneView()
+	if _, ok := view.vertexes[downVertex]; !ok {
+		t.Fatalf("down vertex missing from restored view")
+	}
+
+	// Only once the extended decay has passed should the down vertex be
+	// pruned from the view.
+	backdate(vertexDecay * (secondGenDecayFactor - 1))
+	view = mc.GraphPruneView()
+	if _, ok := view.vertexes[downVertex]; ok {
+		t.Fatalf("down vertex should have decayed")
+	}
+
+	// Finally, resetting the history should clear both generations.
+	session = mc.NewPaymentSession()
+	for i := 0; i < vertexPromotionFailures; i++ {
+		session.ReportVertexFailure(downVertex)
+	}
+	session.ReportVertexFailure(flakyVertex)
+	mc.ResetHistory()
+	if len(mc.failedVertexes) != 0 || len(mc.secondGenVertexes) != 0 {
+		t.Fatalf("expected history to be cleared")
+	}
+}
+
+// TestMissionControlPruneViewSnapshot tests that the snapshot of the prune
+// view excludes decayed entries, is sorted, and doesn't garbage collect the
+// decayed entries from mission control.
+func TestMissionControlPruneViewSnapshot(t *testing.T) {
+	t.Parallel()
+
+	mc := newMissionControl(nil, nil, nil)
+
+	var staleVertex, vertexA, vertexB Vertex
+	staleVertex[0] = 1
+	vertexA[0] = 2
+	vertexB[0] = 3
+
+	now := time.Now()
+	mc.failedVertexes[staleVertex] = now.Add(-vertexDecay)
+	mc.failedVertexes[vertexB] = now.Add(vertexDecay)
+	mc.secondGenVertexes[vertexA] = now.Add(-vertexDecay)
+
+	// Channel 5 has failed in both directions, which should only be
+	// reflected once within the snapshot.
+	expiry := now.Add(edgeDecay)
+	mc.failedEdges[directedEdge{channelID: 1}] = now.Add(-edgeDecay)
+	mc.failedEdges[directedEdge{channelID: 5, towardNode: vertexA}] = expiry
+	mc.failedEdges[directedEdge{channelID: 5, towardNode: vertexB}] = expiry
+	mc.failedEdges[directedEdge{channelID: 2}] = expiry
+
+	edges, vertexes, err := mc.PruneViewSnapshot()
+	if err != nil {
+		t.Fatalf("unable to take snapshot: %v", err)
+	}
+
+	expectedEdges := []uint64{2, 5}
+	if !reflect.DeepEqual(edges, expectedEdges) {
+		t.Fatalf("expected edges %v, got %v", expectedEdges, edges)
+	}
+	expectedVertexes := []Vertex{vertexA, vertexB}
+	if !reflect.DeepEqual(vertexes, expectedVertexes) {
+		t.Fatalf("expected vertexes %v, got %v", expectedVertexes,
+			vertexes)
+	}
+
+	// The decayed entries should still be present within mission control,
+	// as only GraphPruneView garbage collects them.
+	if _, ok := mc.failedVertexes[staleVertex]; !ok {
+		t.Fatalf("stale vertex garbage collected by snapshot")
+	}
+	if _, ok := mc.failedEdges[directedEdge{channelID: 1}]; !ok {
+		t.Fatalf("stale edge garbage collected by snapshot")
+	}
+}
+
+// TestMissionControlDecayJitter tests that edge failures reported together
+// expire from the prune view at different times, due to the random jitter
+// added to their decay periods.
+func TestMissionControlDecayJitter(t *testing.T) {
+	t.Parallel()
+
+	mc := newMissionControl(nil, nil, &MissionControlConfig{
+		VertexDecay: vertexDecay,
+		EdgeDecay:   edgeDecay,
+		DecayJitter: 0.5,
+	})
+
+	// We'll seed the source of the jitter, such that the test is
+	// deterministic.
+	mc.rand = rand.New(rand.NewSource(1))
+
+	// We'll report the failure of two edges back to back, noting the
+	// window within which they were reported.
+	session := mc.NewPaymentSession()
+	firstEdge := directedEdge{channelID: 1}
+	secondEdge := directedEdge{channelID: 2}
+
+	reportStart := time.Now()
+	session.ReportChannelFailure(firstEdge.channelID, nil)
+	session.ReportChannelFailure(secondEdge.channelID, nil)
+	reportEnd := time.Now()
+
+	mc.Lock()
+	first := mc.failedEdges[firstEdge]
+	second := mc.failedEdges[secondEdge]
+	mc.Unlock()
+
+	// Without jitter, the expiries could differ by no more than the time
+	// taken to report the failures.
+	earlier, later := first, second
+	if later.Before(earlier) {
+		earlier, later = later, earlier
+	}
+	if later.Sub(earlier) <= reportEnd.Sub(reportStart) {
+		t.Fatalf("expected edges to expire at different times, "+
+			"expire at %v and %v", first, second)
+	}
+
+	// Each expiry should lie within the configured jitter of the decay
+	// period.
+	minExpiry := reportStart.Add(edgeDecay)
+	maxExpiry := reportEnd.Add(edgeDecay + edgeDecay/2)
+	for _, expiry := range []time.Time{first, second} {
+		if expiry.Before(minExpiry) || !expiry.Before(maxExpiry) {
+			t.Fatalf("expected expiry between %v and %v, got %v",
+				minExpiry, maxExpiry, expiry)
+		}
+	}
+
+	// Once the earlier of the two has expired, only the later should
+	// remain within the prune view.
+	mc.Lock()
+	view := mc.pruneView(earlier, false)
+	mc.Unlock()
+	if len(view.edges) != 1 {
+		t.Fatalf("expected %v edge within view, got %v", 1,
+			len(view.edges))
+	}
+}
+
+// TestMissionControlMinChannelCapacity tests that channels with a capacity
+// below the minimum channel capacity of a payment are excluded from its route.
+func TestMissionControlMinChannelCapacity(t *testing.T) {
+	t.Parallel()
+
+	graph, cleanUp, aliases, err := parseTestGraph(basicGraphFilePath)
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to create graph: %v", err)
+	}
+
+	sourceNode, err := graph.SourceNode()
+	if err != nil {
+		t.Fatalf("unable to fetch source node: %v", err)
+	}
+
+	mc := newMissionControl(graph, sourceNode, nil)
+	session := mc.NewPaymentSession()
+
+	// The cheapest route to sophon is via songoku, though the channel
+	// between songoku and sophon only has a capacity of 500 satoshis. As
+	// this is enough to carry the payment, it should be used by default.
+	const undersizedChan = 3495345
+	payment := &LightningPayment{
+		Target: aliases["sophon"],
+		Amount: lnwire.NewMSatFromSatoshis(100),
+	}
+	route, err := session.RequestRoute(payment, 100, 9)
+	if err != nil {
+		t.Fatalf("unable to request route: %v", err)
+	}
+	if route.Hops[len(route.Hops)-1].Channel.ChannelID != undersizedChan {
+		t.Fatalf("expected route via undersized channel")
+	}
+
+	// With a minimum channel capacity above that of the channel, the
+	// route should instead go via pham nuwen.
+	payment.MinChannelCapacity = 1000
+	route, err = session.RequestRoute(payment, 100, 9)
+	if err != nil {
+		t.Fatalf("unable to request route: %v", err)
+	}
+	for _, hop := range route.Hops {
+		if hop.Channel.ChannelID == undersizedChan {
+			t.Fatalf("undersized channel included in route")
+		}
+		if hop.Channel.Capacity < payment.MinChannelCapacity {
+			t.Fatalf("channel %v with capacity %v included in "+
+				"route", hop.Channel.ChannelID,
+				hop.Channel.Capacity)
+		}
+	}
+}
+
+// TestMissionControlBlacklist tests that a blacklisted vertex remains within
+// the prune view long after the vertex decay period, across restarts, until
+// it's removed from the blacklist.
+func TestMissionControlBlacklist(t *testing.T) {
+	t.Parallel()
+
+	graph, cleanUp, err := makeTestGraph()
+	if err != nil {
+		t.Fatalf("unable to create test graph: %v", err)
+	}
+	defer cleanUp()
+
+	mc := newMissionControl(graph, nil, nil)
+
+	var blacklistedVertex, failedVertex Vertex
+	blacklistedVertex[0] = 1
+	failedVertex[0] = 2
+
+	mc.BlacklistVertex(blacklistedVertex)
+	mc.NewPaymentSession().ReportVertexFailure(failedVertex)
+
+	// Well past the decay period of the failed vertex, and that of the
+	// second generation, the blacklisted vertex should remain pruned,
+	// despite the decayed failure being garbage collected.
+	future := time.Now().Add(vertexDecay * secondGenDecayFactor * 10)
+	mc.Lock()
+	view := mc.pruneView(future, true)
+	mc.Unlock()
+	if _, ok := view.vertexes[failedVertex]; ok {
+		t.Fatalf("failed vertex should have decayed")
+	}
+	if _, ok := view.vertexes[blacklistedVertex]; !ok {
+		t.Fatalf("blacklisted vertex missing from view")
+	}
+
+	// Resetting the history shouldn't affect the blacklist.
+	mc.ResetHistory()
+	view = mc.GraphPruneView()
+	if _, ok := view.vertexes[blacklistedVertex]; !ok {
+		t.Fatalf("blacklisted vertex missing from view after reset")
+	}
+
+	// The blacklist should also survive a restart.
+	if err := mc.FlushHistory(); err != nil {
+		t.Fatalf("unable to flush history: %v", err)
+	}
+	mc = newMissionControl(graph, nil, nil)
+	if err := mc.LoadHistory(); err != nil {
+		t.Fatalf("unable to load history: %v", err)
+	}
+	view = mc.GraphPruneView()
+	if _, ok := view.vertexes[blacklistedVertex]; !ok {
+		t.Fatalf("blacklisted vertex missing from restored view")
+	}
+
+	// Finally, once removed from the blacklist, the vertex should no
+	// longer be pruned.
+	mc.RemoveBlacklist(blacklistedVertex)
+	view = mc.GraphPruneView()
+	if _, ok := view.vertexes[blacklistedVertex]; ok {
+		t.Fatalf("vertex still pruned after removal from blacklist")
+	}
+}
+
+// TestMissionControlRouteCache tests that payment sessions sharing the same
+// prune view reuse the paths found for one another, and that a reported
+// failure causes new sessions to find a fresh path.
+func TestMissionControlRouteCache(t *testing.T) {
+	t.Parallel()
+
+	graph, cleanUp, aliases, err := parseTestGraph(basicGraphFilePath)
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to create graph: %v", err)
+	}
+
+	sourceNode, err := graph.SourceNode()
+	if err != nil {
+		t.Fatalf("unable to fetch source node: %v", err)
+	}
+
+	mc := newMissionControl(graph, sourceNode, nil)
+
+	payment := &LightningPayment{
+		Target: aliases["sophon"],
+		Amount: lnwire.NewMSatFromSatoshis(100),
+	}
+	first, err := mc.NewPaymentSession().RequestRoute(payment, 100, 9)
+	if err != nil {
+		t.Fatalf("unable to request route: %v", err)
+	}
+
+	// A second session requesting a route for an amount within the same
+	// bucket should be handed the cached path, sharing the same hops.
+	payment.Amount += 1000
+	second, err := mc.NewPaymentSession().RequestRoute(payment, 100, 9)
+	if err != nil {
+		t.Fatalf("unable to request route: %v", err)
+	}
+	if len(first.Hops) != len(second.Hops) {
+		t.Fatalf("expected cached route of %v hops, got %v",
+			len(first.Hops), len(second.Hops))
+	}
+	for i := range first.Hops {
+		if first.Hops[i].Channel != second.Hops[i].Channel {
+			t.Fatalf("hop %v not taken from cached path", i)
+		}
+	}
+	if second.TotalAmount <= first.TotalAmount {
+		t.Fatalf("cached route not built for new amount")
+	}
+
+	// Once a failure is reported, the prune view has changed, so a new
+	// session should find a path of its own, avoiding the failed vertex.
+	failedVertex := Vertex(first.Hops[0].Channel.Node.PubKeyBytes)
+	mc.NewPaymentSession().ReportVertexFailure(failedVertex)
+
+	third, err := mc.NewPaymentSession().RequestRoute(payment, 100, 9)
+	if err != nil {
+		t.Fatalf("unable to request route: %v", err)
+	}
+	for i, hop := range third.Hops {
+		if hop.Channel.Node.PubKeyBytes == failedVertex {
+			t.Fatalf("hop %v routes through failed vertex", i)
+		}
+	}
+}
+
+// TestMissionControlPathFindingLimit tests that no more than the configured
+// maximum number of path finding searches run at once, with any further
+// searches queued until a slot is free.
+func TestMissionControlPathFindingLimit(t *testing.T) {
+	t.Parallel()
+
+	const maxSearches = 3
+	mc := newMissionControl(nil, nil, &MissionControlConfig{
+		VertexDecay:              vertexDecay,
+		EdgeDecay:                edgeDecay,
+		MaxConcurrentPathFinding: maxSearches,
+	})
+
+	// We'll launch many more searches than the limit at once, each
+	// noting the number of searches in flight while it runs.
+	var (
+		inFlight    int32
+		maxInFlight int32
+		completed   int32
+		wg          sync.WaitGroup
+	)
+	for i := 0; i < maxSearches*5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := mc.withPathFindingSlot(func() error {
+				n := atomic.AddInt32(&inFlight, 1)
+				defer atomic.AddInt32(&inFlight, -1)
+
+				for {
+					max := atomic.LoadInt32(&maxInFlight)
+					if n <= max || atomic.CompareAndSwapInt32(
+						&maxInFlight, max, n,
+					) {
+						break
+					}
+				}
+
+				time.Sleep(time.Millisecond * 10)
+				atomic.AddInt32(&completed, 1)
+				return nil
+			})
+			if err != nil {
+				t.Errorf("unexpected search error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if completed != maxSearches*5 {
+		t.Fatalf("expected %v searches to complete, got %v",
+			maxSearches*5, completed)
+	}
+	if maxInFlight > maxSearches {
+		t.Fatalf("expected at most %v searches in flight, got %v",
+			maxSearches, maxInFlight)
+	}
+	if maxInFlight != maxSearches {
+		t.Fatalf("expected searches to use all %v slots, got %v",
+			maxSearches, maxInFlight)
+	}
+
+	// The errors returned by searches should be passed through to the
+	// caller, and release the slot held.
+	for i := 0; i < maxSearches+1; i++ {
+		err := mc.withPathFindingSlot(func() error {
+			return newErr(ErrNoPathFound, "no path")
+		})
+		if !IsError(err, ErrNoPathFound) {
+			t.Fatalf("expected ErrNoPathFound, got %v", err)
+		}
+	}
+}
+
+// TestMissionControlMetrics tests that the metrics of mission control advance
+// as failures are reported, decay and are garbage collected, and routes are
+// requested.
+func TestMissionControlMetrics(t *testing.T) {
+	t.Parallel()
+
+	graph, cleanUp, aliases, err := parseTestGraph(basicGraphFilePath)
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to create graph: %v", err)
+	}
+
+	sourceNode, err := graph.SourceNode()
+	if err != nil {
+		t.Fatalf("unable to fetch source node: %v", err)
+	}
+
+	// Edges will decay almost immediately, while vertexes will remain
+	// pruned for the duration of the test.
+	mc := newMissionControl(graph, sourceNode, &MissionControlConfig{
+		VertexDecay: vertexDecay,
+		EdgeDecay:   time.Nanosecond,
+	})
+
+	assertMetrics := func(expected MissionControlMetrics) {
+		if metrics := mc.Metrics(); metrics != expected {
+			t.Fatalf("expected metrics %+v, got %+v", expected,
+				metrics)
+		}
+	}
+	assertMetrics(MissionControlMetrics{})
+
+	var vertex Vertex
+	vertex[0] = 1
+
+	session := mc.NewPaymentSession()
+	session.ReportVertexFailure(vertex)
+	session.ReportChannelFailure(1, nil)
+	session.ReportChannelFailureAmt(2, nil, 100)
+
+	// Each failure should be counted, though only the vertex should remain
+	// pruned, as the edges have already decayed.
+	time.Sleep(time.Millisecond)
+	assertMetrics(MissionControlMetrics{
+		PrunedVertexes:   1,
+		FailuresReported: 3,
+	})
+
+	// Requesting routes from new sessions should garbage collect both of
+	// the decayed edges, and count each request.
+	payment := &LightningPayment{
+		Target: aliases["sophon"],
+		Amount: lnwire.NewMSatFromSatoshis(100),
+	}
+	for i := 0; i < 2; i++ {
+		_, err := mc.NewPaymentSession().RequestRoute(payment, 100, 9)
+		if err != nil {
+			t.Fatalf("unable to request route: %v", err)
+		}
+	}
+	assertMetrics(MissionControlMetrics{
+		PrunedVertexes:   1,
+		FailuresReported: 3,
+		PrunesCollected:  2,
+		RouteRequests:    2,
+	})
+}
+
+// TestMissionControlProbabilityScoring tests that when scoring edges by their
+// success probability, an edge which fails repeatedly accumulates a high
+// penalty, steering path finding away from it without pruning it, while an
+// untested edge keeps the penalty of the apriori probability.
+func TestMissionControlProbabilityScoring(t *testing.T) {
+	t.Parallel()
+
+	graph, cleanUp, aliases, err := parseTestGraph(equalCostGraphFilePath)
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to create graph: %v", err)
+	}
+
+	sourceNode, err := graph.SourceNode()
+	if err != nil {
+		t.Fatalf("unable to fetch source node: %v", err)
+	}
+
+	mc := newMissionControl(graph, sourceNode, &MissionControlConfig{
+		VertexDecay:         vertexDecay,
+		EdgeDecay:           edgeDecay,
+		ProbabilityScoring:  true,
+		AprioriProbability:  aprioriProbability,
+		ProbabilityHalfLife: probabilityHalfLife,
+		ProbabilityWeight:   probabilityWeight,
+	})
+
+	// The path via songoku begins with channel 12345, while the path via
+	// satoshi begins with channel 23456. We'll report repeated failures of
+	// the former.
+	const (
+		failingChan  = 12345
+		untestedChan = 23456
+	)
+	session := mc.NewPaymentSession()
+	for i := 0; i < 10; i++ {
+		session.ReportChannelFailure(failingChan, nil)
+	}
+
+	// The failing channel shouldn't have been pruned from the shared view,
+	// but should carry a far greater penalty than the untested channel.
+	view := mc.GraphPruneView()
+	if len(view.edges) != 0 {
+		t.Fatalf("expected no pruned edges, got %v", len(view.edges))
+	}
+
+	bias := mc.successBias()
+	songoku := NewVertex(aliases["songoku"])
+	satoshi := NewVertex(aliases["satoshi"])
+	failingWeight := bias.apply(1, failingChan, songoku)
+	untestedWeight := bias.apply(1, untestedChan, satoshi)
+
+	basePenalty := mc.probabilityPenalty(aprioriProbability)
+	if untestedWeight != basePenalty+1 {
+		t.Fatalf("expected untested edge weight of %v, got %v",
+			basePenalty+1, untestedWeight)
+	}
+	maxPenalty := mc.probabilityPenalty(minProbability)
+	if failingWeight != maxPenalty+1 {
+		t.Fatalf("expected failing edge weight of %v, got %v",
+			maxPenalty+1, failingWeight)
+	}
+
+	// As a result, a new session should route via satoshi, despite the
+	// channel via songoku never having been pruned.
+	payment := &LightningPayment{
+		Target: aliases["sophon"],
+		Amount: lnwire.NewMSatFromSatoshis(100),
+	}
+	route, err := mc.NewPaymentSession().RequestRoute(payment, 100, 9)
+	if err != nil {
+		t.Fatalf("unable to request route: %v", err)
+	}
+	if route.Hops[0].Channel.ChannelID != untestedChan {
+		t.Fatalf("expected path via channel %v, got %v", untestedChan,
+			route.Hops[0].Channel.ChannelID)
+	}
+
+	// After a single half-life, the probability of a channel which failed
+	// once should have recovered halfway toward the apriori probability.
+	edge := directedEdge{channelID: untestedChan}
+	now := time.Now()
+	mc.Lock()
+	mc.edgeProbabilities[edge] = edgeProbability{
+		probability: aprioriProbability / 2,
+		lastFailure: now.Add(-probabilityHalfLife),
+	}
+	prob := mc.edgeProbability(edge, now)
+	mc.Unlock()
+
+	expectedProb := aprioriProbability * 3 / 4
+	if math.Abs(prob-expectedProb) > 1e-9 {
+		t.Fatalf("expected probability of %v, got %v", expectedProb,
+			prob)
+	}
+
+	// Once enough half-lives have passed, the failures should be
+	// forgotten entirely.
+	mc.Lock()
+	for e, failedProb := range mc.edgeProbabilities {
+		failedProb.lastFailure = now.Add(
+			-probabilityHalfLife * probabilityForgetHalfLives,
+		)
+		mc.edgeProbabilities[e] = failedProb
+	}
+	mc.Unlock()
+
+	if bias := mc.successBias(); len(bias.penalties) != 0 {
+		t.Fatalf("expected %v penalized edges, got %v", 0,
+			len(bias.penalties))
+	}
+}
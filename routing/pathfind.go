@@ -222,7 +222,9 @@ func (r *Route) ToHopPayloads() []sphinx.HopData {
 // newRoute returns a fully valid route between the source and target that's
 // capable of supporting a payment of `amtToSend` after fees are fully
 // computed. If the route is too long, or the selected path cannot support the
-// fully payment including fees, then a non-nil error is returned.
+// fully payment including fees, then a non-nil error is returned. If a
+// particular hop within the path can't support the payment, then the error is
+// a *RouteConstructionError identifying the hop.
 //
 // NOTE: The passed slice of ChannelHops MUST be sorted in forward order: from
 // the source to the target node of the path finding attempt.
@@ -323,13 +325,20 @@ func newRoute(amtToSend lnwire.MilliSatoshi, sourceVertex Vertex,
 		// As a sanity check, we ensure that the selected channel has
 		// enough capacity to forward the required amount which
 		// includes the fee dictated at each hop.
+		// If not, then we'll note the offending hop, such that the
+		// caller can report it.
 		if nextHop.AmtToForward.ToSatoshis() > nextHop.Channel.Capacity {
 			err := fmt.Sprintf("channel graph has insufficient "+
 				"capacity for the payment: need %v, have %v",
 				nextHop.AmtToForward.ToSatoshis(),
 				nextHop.Channel.Capacity)
 
-			return nil, newErrf(ErrInsufficientCapacity, err)
+			return nil, &RouteConstructionError{
+				HopIndex:  i,
+				Vertex:    v,
+				ChannelID: edge.ChannelID,
+				Err:       newErrf(ErrInsufficientCapacity, err),
+			}
 		}
 
 		// If this is the last hop, then for verification purposes, the
@@ -391,6 +400,95 @@ func (v Vertex) String() string {
 	return fmt.Sprintf("%x", v[:])
 }
 
+// directedEdge identifies a channel in a single direction of travel, namely
+// toward one of the two nodes of the channel. A directedEdge with a zero
+// towardNode instead matches the channel in both directions.
+type directedEdge struct {
+	channelID  uint64
+	towardNode Vertex
+}
+
+// String returns a human readable version of the directedEdge.
+func (e directedEdge) String() string {
+	if e.towardNode == (Vertex{}) {
+		return fmt.Sprintf("%v", e.channelID)
+	}
+
+	return fmt.Sprintf("%v->%v", e.channelID, e.towardNode)
+}
+
+// successBias biases path finding toward the edges and vertexes which have
+// recently carried payments successfully. The weight of an edge is reduced by
+// the bias weight if the edge itself has recently succeeded, and again if the
+// vertex it leads to has recently succeeded. If mission control scores edges
+// by their estimated success probability, then the weight of each edge is also
+// increased by a penalty derived from its probability.
+type successBias struct {
+	// edges is the set of short channel IDs of the edges which have
+	// recently succeeded.
+	edges map[uint64]struct{}
+
+	// vertexes is the set of vertexes which have recently succeeded.
+	vertexes map[Vertex]struct{}
+
+	// weight is the amount by which the weight of an edge is reduced for
+	// each recent success. A weight of zero disables the bias.
+	weight int64
+
+	// penalties maps each edge with an estimated success probability
+	// below the apriori probability to the weight added to the edge. If
+	// nil, then no penalties are applied.
+	penalties map[directedEdge]int64
+
+	// basePenalty is the weight added to each edge without an entry
+	// within penalties, derived from the apriori success probability.
+	basePenalty int64
+}
+
+// apply returns the passed weight of the edge with the target channel ID,
+// leading to the target vertex, increased by the edge's probability penalty,
+// and reduced according to the recent successes of the edge and vertex. The
+// returned weight is never less than one, such that edge weights remain
+// positive. If the bias is nil, then the weight is returned unmodified.
+func (b *successBias) apply(weight int64, chanID uint64, v Vertex) int64 {
+	if b == nil {
+		return weight
+	}
+
+	// A penalty recorded in the direction we're traveling in takes
+	// precedence over one recorded for both directions.
+	if b.penalties != nil {
+		penalty, ok := b.penalties[directedEdge{
+			channelID:  chanID,
+			towardNode: v,
+		}]
+		if !ok {
+			penalty, ok = b.penalties[directedEdge{channelID: chanID}]
+		}
+		if !ok {
+			penalty = b.basePenalty
+		}
+
+		weight += penalty
+	}
+
+	if b.weight == 0 {
+		return weight
+	}
+
+	if _, ok := b.edges[chanID]; ok {
+		weight -= b.weight
+	}
+	if _, ok := b.vertexes[v]; ok {
+		weight -= b.weight
+	}
+
+	if weight < 1 {
+		return 1
+	}
+	return weight
+}
+
 // edgeWithPrev is a helper struct used in path finding that couples an
 // directional edge with the node's ID in the opposite direction.
 type edgeWithPrev struct {
@@ -431,11 +529,15 @@ func edgeWeight(amt lnwire.MilliSatoshi, e *channeldb.ChannelEdgePolicy) int64 {
 // and the destination. The distance metric used for edges is related to the
 // time-lock+fee costs along a particular edge. If a path is found, this
 // function returns a slice of ChannelHop structs which encoded the chosen path
-// from the target to the source.
+// from the target to the source. If bias is non-nil, then edges and vertexes
+// which have recently succeeded are favored over those of equal cost, and
+// edges are penalized according to their success probability, if any. Edges
+// with a capacity below either the payment amount or minCapacity are skipped.
 func findPath(tx *bolt.Tx, graph *channeldb.ChannelGraph,
 	sourceNode *channeldb.LightningNode, target *btcec.PublicKey,
-	ignoredNodes map[Vertex]struct{}, ignoredEdges map[uint64]struct{},
-	amt lnwire.MilliSatoshi) ([]*ChannelHop, error) {
+	ignoredNodes map[Vertex]struct{}, ignoredEdges map[directedEdge]struct{},
+	bias *successBias, amt lnwire.MilliSatoshi,
+	minCapacity btcutil.Amount) ([]*ChannelHop, error) {
 
 	var err error
 	if tx == nil {
@@ -485,6 +587,14 @@ func findPath(tx *bolt.Tx, graph *channeldb.ChannelGraph,
 
 	targetBytes := target.SerializeCompressed()
 
+	// Any edge without the capacity to carry the payment can't be used,
+	// though the caller may demand a larger capacity still, so as to skip
+	// edges which are unlikely to have the liquidity to carry it.
+	requiredCapacity := amt.ToSatoshis()
+	if minCapacity > requiredCapacity {
+		requiredCapacity = minCapacity
+	}
+
 	// We'll use this map as a series of "previous" hop pointers. So to get
 	// to `Vertex` we'll take the edge that it's mapped to within `prev`.
 	prev := make(map[Vertex]edgeWithPrev)
@@ -525,14 +635,28 @@ func findPath(tx *bolt.Tx, graph *channeldb.ChannelGraph,
 			if _, ok := ignoredNodes[v]; ok {
 				return nil
 			}
-			if _, ok := ignoredEdges[outEdge.ChannelID]; ok {
+			// An edge may be ignored either in the direction
+			// we're traveling in, or in both directions.
+			edge := directedEdge{
+				channelID:  outEdge.ChannelID,
+				towardNode: v,
+			}
+			if _, ok := ignoredEdges[edge]; ok {
+				return nil
+			}
+			edge = directedEdge{channelID: outEdge.ChannelID}
+			if _, ok := ignoredEdges[edge]; ok {
 				return nil
 			}
 
 			// Compute the tentative distance to this new
 			// channel/edge which is the distance to our current
-			// pivot node plus the weight of this edge.
-			tempDist := distance[pivot].dist + edgeWeight(amt, outEdge)
+			// pivot node plus the weight of this edge, biased
+			// toward recent successes.
+			weight := bias.apply(
+				edgeWeight(amt, outEdge), outEdge.ChannelID, v,
+			)
+			tempDist := distance[pivot].dist + weight
 
 			// If this new tentative distance is better than the
 			// current best known distance to this node, then we
@@ -542,7 +666,7 @@ func findPath(tx *bolt.Tx, graph *channeldb.ChannelGraph,
 			// capacity of an edge and clearing their min-htlc
 			// amount to our relaxation condition.
 			if tempDist < distance[v].dist &&
-				edgeInfo.Capacity >= amt.ToSatoshis() &&
+				edgeInfo.Capacity >= requiredCapacity &&
 				amt >= outEdge.MinHTLC &&
 				outEdge.TimeLockDelta != 0 {
 
@@ -633,7 +757,7 @@ func findPaths(tx *bolt.Tx, graph *channeldb.ChannelGraph,
 	source *channeldb.LightningNode, target *btcec.PublicKey,
 	amt lnwire.MilliSatoshi, numPaths uint32) ([][]*ChannelHop, error) {
 
-	ignoredEdges := make(map[uint64]struct{})
+	ignoredEdges := make(map[directedEdge]struct{})
 	ignoredVertexes := make(map[Vertex]struct{})
 
 	// TODO(roasbeef): modifying ordering within heap to eliminate final
@@ -647,7 +771,8 @@ func findPaths(tx *bolt.Tx, graph *channeldb.ChannelGraph,
 	// selfNode) to the target destination that's capable of carrying amt
 	// satoshis along the path before fees are calculated.
 	startingPath, err := findPath(
-		tx, graph, source, target, ignoredVertexes, ignoredEdges, amt,
+		tx, graph, source, target, ignoredVertexes, ignoredEdges, nil,
+		amt, 0,
 	)
 	if err != nil {
 		log.Errorf("Unable to find path: %v", err)
@@ -680,7 +805,7 @@ func findPaths(tx *bolt.Tx, graph *channeldb.ChannelGraph,
 			// we'll exclude from the next path finding attempt.
 			// These are required to ensure the paths are unique
 			// and loopless.
-			ignoredEdges = make(map[uint64]struct{})
+			ignoredEdges = make(map[directedEdge]struct{})
 			ignoredVertexes = make(map[Vertex]struct{})
 
 			// Our spur node is the i-th node in the prior shortest
@@ -699,7 +824,13 @@ func findPaths(tx *bolt.Tx, graph *channeldb.ChannelGraph,
 				// directly _after_ our spur node from the
 				// graph so we don't repeat paths.
 				if len(path) > i+1 && isSamePath(rootPath, path[:i+1]) {
-					ignoredEdges[path[i+1].ChannelID] = struct{}{}
+					edge := directedEdge{
+						channelID: path[i+1].ChannelID,
+						towardNode: Vertex(
+							path[i+1].Node.PubKeyBytes,
+						),
+					}
+					ignoredEdges[edge] = struct{}{}
 				}
 			}
 
@@ -721,7 +852,7 @@ func findPaths(tx *bolt.Tx, graph *channeldb.ChannelGraph,
 			// shortest path from the spur node to the destination.
 			spurPath, err := findPath(
 				tx, graph, spurNode, target, ignoredVertexes,
-				ignoredEdges, amt,
+				ignoredEdges, nil, amt, 0,
 			)
 
 			// If we weren't able to find a path, we'll continue to
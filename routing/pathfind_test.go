@@ -40,6 +40,10 @@ const (
 	// implementations will use in order to ensure that they're calculating
 	// the payload for each hop in path properly.
 	specExampleFilePath = "testdata/spec_example.json"
+
+	// equalCostGraphFilePath is a file path which stores a graph with two
+	// paths of equal cost between a pair of nodes.
+	equalCostGraphFilePath = "testdata/equal_cost_graph.json"
 )
 
 var (
@@ -297,7 +301,7 @@ func TestBasicGraphPathFinding(t *testing.T) {
 	}
 	sourceVertex := Vertex(sourceNode.PubKeyBytes)
 
-	ignoredEdges := make(map[uint64]struct{})
+	ignoredEdges := make(map[directedEdge]struct{})
 	ignoredVertexes := make(map[Vertex]struct{})
 
 	// With the test graph loaded, we'll test some basic path finding using
@@ -312,7 +316,7 @@ func TestBasicGraphPathFinding(t *testing.T) {
 	paymentAmt := lnwire.NewMSatFromSatoshis(100)
 	target := aliases["sophon"]
 	path, err := findPath(nil, graph, sourceNode, target, ignoredVertexes,
-		ignoredEdges, paymentAmt)
+		ignoredEdges, nil, paymentAmt, 0)
 	if err != nil {
 		t.Fatalf("unable to find path: %v", err)
 	}
@@ -452,7 +456,7 @@ func TestBasicGraphPathFinding(t *testing.T) {
 	// should be selected.
 	target = aliases["luoji"]
 	path, err = findPath(nil, graph, sourceNode, target, ignoredVertexes,
-		ignoredEdges, paymentAmt)
+		ignoredEdges, nil, paymentAmt, 0)
 	if err != nil {
 		t.Fatalf("unable to find route: %v", err)
 	}
@@ -564,7 +568,7 @@ func TestNewRoutePathTooLong(t *testing.T) {
 		t.Fatalf("unable to fetch source node: %v", err)
 	}
 
-	ignoredEdges := make(map[uint64]struct{})
+	ignoredEdges := make(map[directedEdge]struct{})
 	ignoredVertexes := make(map[Vertex]struct{})
 
 	paymentAmt := lnwire.NewMSatFromSatoshis(100)
@@ -573,7 +577,7 @@ func TestNewRoutePathTooLong(t *testing.T) {
 	// Alice should be able to find a valid route to ursula.
 	target := aliases["ursula"]
 	_, err = findPath(nil, graph, sourceNode, target, ignoredVertexes,
-		ignoredEdges, paymentAmt)
+		ignoredEdges, nil, paymentAmt, 0)
 	if err != nil {
 		t.Fatalf("path should have been found")
 	}
@@ -582,7 +586,7 @@ func TestNewRoutePathTooLong(t *testing.T) {
 	// presented to Alice.
 	target = aliases["vincent"]
 	path, err := findPath(nil, graph, sourceNode, target, ignoredVertexes,
-		ignoredEdges, paymentAmt)
+		ignoredEdges, nil, paymentAmt, 0)
 	if err == nil {
 		t.Fatalf("should not have been able to find path, supposed to be "+
 			"greater than 20 hops, found route with %v hops",
@@ -605,7 +609,7 @@ func TestPathNotAvailable(t *testing.T) {
 		t.Fatalf("unable to fetch source node: %v", err)
 	}
 
-	ignoredEdges := make(map[uint64]struct{})
+	ignoredEdges := make(map[directedEdge]struct{})
 	ignoredVertexes := make(map[Vertex]struct{})
 
 	// With the test graph loaded, we'll test that queries for target that
@@ -622,7 +626,7 @@ func TestPathNotAvailable(t *testing.T) {
 	}
 
 	_, err = findPath(nil, graph, sourceNode, unknownNode, ignoredVertexes,
-		ignoredEdges, 100)
+		ignoredEdges, nil, 100, 0)
 	if !IsError(err, ErrNoPathFound) {
 		t.Fatalf("path shouldn't have been found: %v", err)
 	}
@@ -641,7 +645,7 @@ func TestPathInsufficientCapacity(t *testing.T) {
 	if err != nil {
 		t.Fatalf("unable to fetch source node: %v", err)
 	}
-	ignoredEdges := make(map[uint64]struct{})
+	ignoredEdges := make(map[directedEdge]struct{})
 	ignoredVertexes := make(map[Vertex]struct{})
 
 	// Next, test that attempting to find a path in which the current
@@ -656,7 +660,7 @@ func TestPathInsufficientCapacity(t *testing.T) {
 
 	payAmt := lnwire.NewMSatFromSatoshis(btcutil.SatoshiPerBitcoin)
 	_, err = findPath(nil, graph, sourceNode, target, ignoredVertexes,
-		ignoredEdges, payAmt)
+		ignoredEdges, nil, payAmt, 0)
 	if !IsError(err, ErrNoPathFound) {
 		t.Fatalf("graph shouldn't be able to support payment: %v", err)
 	}
@@ -675,7 +679,7 @@ func TestRouteFailMinHTLC(t *testing.T) {
 	if err != nil {
 		t.Fatalf("unable to fetch source node: %v", err)
 	}
-	ignoredEdges := make(map[uint64]struct{})
+	ignoredEdges := make(map[directedEdge]struct{})
 	ignoredVertexes := make(map[Vertex]struct{})
 
 	// We'll not attempt to route an HTLC of 10 SAT from roasbeef to Son
@@ -684,7 +688,7 @@ func TestRouteFailMinHTLC(t *testing.T) {
 	target := aliases["songoku"]
 	payAmt := lnwire.MilliSatoshi(10)
 	_, err = findPath(nil, graph, sourceNode, target, ignoredVertexes,
-		ignoredEdges, payAmt)
+		ignoredEdges, nil, payAmt, 0)
 	if !IsError(err, ErrNoPathFound) {
 		t.Fatalf("graph shouldn't be able to support payment: %v", err)
 	}
@@ -704,7 +708,7 @@ func TestRouteFailDisabledEdge(t *testing.T) {
 	if err != nil {
 		t.Fatalf("unable to fetch source node: %v", err)
 	}
-	ignoredEdges := make(map[uint64]struct{})
+	ignoredEdges := make(map[directedEdge]struct{})
 	ignoredVertexes := make(map[Vertex]struct{})
 
 	// First, we'll try to route from roasbeef -> songoku. This should
@@ -712,7 +716,7 @@ func TestRouteFailDisabledEdge(t *testing.T) {
 	target := aliases["songoku"]
 	payAmt := lnwire.NewMSatFromSatoshis(10000)
 	_, err = findPath(nil, graph, sourceNode, target, ignoredVertexes,
-		ignoredEdges, payAmt)
+		ignoredEdges, nil, payAmt, 0)
 	if err != nil {
 		t.Fatalf("unable to find path: %v", err)
 	}
@@ -731,7 +735,7 @@ func TestRouteFailDisabledEdge(t *testing.T) {
 	// Now, if we attempt to route through that edge, we should get a
 	// failure as it is no longer eligible.
 	_, err = findPath(nil, graph, sourceNode, target, ignoredVertexes,
-		ignoredEdges, payAmt)
+		ignoredEdges, nil, payAmt, 0)
 	if !IsError(err, ErrNoPathFound) {
 		t.Fatalf("graph shouldn't be able to support payment: %v", err)
 	}
@@ -967,3 +971,140 @@ func TestPathFindSpecExample(t *testing.T) {
 			startingHeight+DefaultFinalCLTVDelta)
 	}
 }
+
+// TestPathFindingDirectedEdge tests that ignoring an edge in the direction
+// toward one of its nodes doesn't prevent the edge from being used in the
+// opposite direction, while ignoring the edge without a direction prevents it
+// from being used in either direction.
+func TestPathFindingDirectedEdge(t *testing.T) {
+	t.Parallel()
+
+	graph, cleanUp, aliases, err := parseTestGraph(basicGraphFilePath)
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to create graph: %v", err)
+	}
+
+	roasbeef, err := graph.SourceNode()
+	if err != nil {
+		t.Fatalf("unable to fetch source node: %v", err)
+	}
+	luoji, err := graph.FetchLightningNode(aliases["luoji"])
+	if err != nil {
+		t.Fatalf("unable to fetch node: %v", err)
+	}
+
+	// The channel between roasbeef and luoji is the shortest path in
+	// either direction, though an alternative path via satoshi exists.
+	const chanID = 689530843
+	paymentAmt := lnwire.NewMSatFromSatoshis(100)
+	ignoredVertexes := make(map[Vertex]struct{})
+
+	usesChannel := func(source *channeldb.LightningNode,
+		target *btcec.PublicKey,
+		ignoredEdges map[directedEdge]struct{}) bool {
+
+		path, err := findPath(nil, graph, source, target,
+			ignoredVertexes, ignoredEdges, nil, paymentAmt, 0)
+		if err != nil {
+			t.Fatalf("unable to find path: %v", err)
+		}
+
+		for _, hop := range path {
+			if hop.ChannelID == chanID {
+				return true
+			}
+		}
+		return false
+	}
+
+	ignoredEdges := make(map[directedEdge]struct{})
+	if !usesChannel(roasbeef, aliases["luoji"], ignoredEdges) ||
+		!usesChannel(luoji, aliases["roasbeef"], ignoredEdges) {
+
+		t.Fatalf("expected channel to be used in both directions")
+	}
+
+	// We'll now ignore the channel in the direction toward luoji. Paths
+	// toward luoji should now route via satoshi, while paths from luoji
+	// should still use the channel.
+	ignoredEdges[directedEdge{
+		channelID:  chanID,
+		towardNode: NewVertex(aliases["luoji"]),
+	}] = struct{}{}
+
+	if usesChannel(roasbeef, aliases["luoji"], ignoredEdges) {
+		t.Fatalf("channel used in ignored direction")
+	}
+	if !usesChannel(luoji, aliases["roasbeef"], ignoredEdges) {
+		t.Fatalf("channel not used in direction that isn't ignored")
+	}
+
+	// Finally, ignoring the channel without a direction should prevent it
+	// from being used in either direction.
+	ignoredEdges = map[directedEdge]struct{}{
+		{channelID: chanID}: {},
+	}
+	if usesChannel(roasbeef, aliases["luoji"], ignoredEdges) ||
+		usesChannel(luoji, aliases["roasbeef"], ignoredEdges) {
+
+		t.Fatalf("channel used despite being ignored in both " +
+			"directions")
+	}
+}
+
+// TestNewRouteConstructionError tests that when a path can't be turned into a
+// route due to a particular hop, the error returned identifies that hop.
+func TestNewRouteConstructionError(t *testing.T) {
+	t.Parallel()
+
+	// We'll construct a path of four hops, each with ample capacity,
+	// other than the hop at index 2.
+	const (
+		numHops   = 4
+		failedHop = 2
+	)
+	paymentAmt := lnwire.NewMSatFromSatoshis(1000)
+
+	path := make([]*ChannelHop, numHops)
+	for i := range path {
+		node := &channeldb.LightningNode{}
+		node.PubKeyBytes[0] = byte(i + 1)
+
+		path[i] = &ChannelHop{
+			Capacity: 100000,
+			ChannelEdgePolicy: &channeldb.ChannelEdgePolicy{
+				ChannelID:                 uint64(i + 100),
+				TimeLockDelta:             10,
+				FeeBaseMSat:               1000,
+				FeeProportionalMillionths: 1000,
+				Node:                      node,
+			},
+		}
+	}
+	path[failedHop].Capacity = 500
+
+	var sourceVertex Vertex
+	_, err := newRoute(paymentAmt, sourceVertex, path, 100, 9)
+	if !IsError(err, ErrInsufficientCapacity) {
+		t.Fatalf("expected ErrInsufficientCapacity, got %v", err)
+	}
+
+	constructionErr, ok := err.(*RouteConstructionError)
+	if !ok {
+		t.Fatalf("expected RouteConstructionError, got %T", err)
+	}
+	if constructionErr.HopIndex != failedHop {
+		t.Fatalf("expected failure at hop %v, got %v", failedHop,
+			constructionErr.HopIndex)
+	}
+	if constructionErr.ChannelID != path[failedHop].ChannelID {
+		t.Fatalf("expected failure of channel %v, got %v",
+			path[failedHop].ChannelID, constructionErr.ChannelID)
+	}
+	failedVertex := Vertex(path[failedHop].Node.PubKeyBytes)
+	if constructionErr.Vertex != failedVertex {
+		t.Fatalf("expected failure at vertex %v, got %v",
+			failedVertex, constructionErr.Vertex)
+	}
+}
@@ -0,0 +1,138 @@
+package routing
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/lightningnetwork/lnd/lnwire"
+	"github.com/roasbeef/btcutil"
+)
+
+const (
+	// routeCacheSize is the maximum number of paths held within the route
+	// cache of missionControl. Once full, the least recently used path is
+	// evicted to make room for a new one.
+	routeCacheSize = 100
+
+	// routeCacheAmtBucket is the granularity with which payment amounts
+	// are bucketed within the route cache. Payments to the same target
+	// with amounts within the same bucket may share a cached path.
+	routeCacheAmtBucket = lnwire.MilliSatoshi(1000 * 1000)
+)
+
+// routeCacheKey identifies the paths held within the route cache. As a path
+// is only valid for the prune view it was found with, the key includes the
+// generation of the prune view within missionControl.
+type routeCacheKey struct {
+	// target is the node the path leads to.
+	target Vertex
+
+	// amtBucket is the payment amount the path was found for, divided by
+	// routeCacheAmtBucket.
+	amtBucket uint64
+
+	// minCapacity is the minimum capacity of each channel within the
+	// path, as demanded by the payment the path was found for.
+	minCapacity btcutil.Amount
+
+	// generation is the generation of the prune view of missionControl
+	// that the path was found with.
+	generation uint64
+}
+
+// newRouteCacheKey returns the key of the route cache for paths which may be
+// used by the payment, given the generation of the prune view.
+func newRouteCacheKey(payment *LightningPayment,
+	generation uint64) routeCacheKey {
+
+	return routeCacheKey{
+		target:      NewVertex(payment.Target),
+		amtBucket:   uint64(payment.Amount / routeCacheAmtBucket),
+		minCapacity: payment.MinChannelCapacity,
+		generation:  generation,
+	}
+}
+
+// routeCacheEntry is an entry within the route cache, coupling a path with
+// the key it's cached under.
+type routeCacheEntry struct {
+	key  routeCacheKey
+	path []*ChannelHop
+}
+
+// routeCache is a bounded, least recently used cache of the paths recently
+// found by missionControl. It allows a burst of identical route requests to
+// avoid repeating the same path finding.
+//
+// NOTE: This struct is safe for concurrent access.
+type routeCache struct {
+	// size is the maximum number of paths held within the cache.
+	size int
+
+	// entries maps each key to its element within the order list.
+	entries map[routeCacheKey]*list.Element
+
+	// order is the list of cache entries, from most to least recently
+	// used.
+	order *list.List
+
+	sync.Mutex
+}
+
+// newRouteCache returns a new, empty route cache which holds up to size
+// paths.
+func newRouteCache(size int) *routeCache {
+	return &routeCache{
+		size:    size,
+		entries: make(map[routeCacheKey]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// get returns the path cached under the passed key, if any, marking it as the
+// most recently used.
+func (c *routeCache) get(key routeCacheKey) ([]*ChannelHop, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	c.order.MoveToFront(elem)
+	return elem.Value.(*routeCacheEntry).path, true
+}
+
+// put caches the path under the passed key, evicting the least recently used
+// path if the cache is full.
+func (c *routeCache) put(key routeCacheKey, path []*ChannelHop) {
+	c.Lock()
+	defer c.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		elem.Value.(*routeCacheEntry).path = path
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&routeCacheEntry{
+		key:  key,
+		path: path,
+	})
+
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*routeCacheEntry).key)
+	}
+}
+
+// purge evicts every path held within the cache.
+func (c *routeCache) purge() {
+	c.Lock()
+	defer c.Unlock()
+
+	c.entries = make(map[routeCacheKey]*list.Element)
+	c.order.Init()
+}
@@ -0,0 +1,51 @@
+package routing
+
+import "testing"
+
+// TestRouteCacheEviction tests that the route cache holds no more than its
+// size, evicting the least recently used path once full.
+func TestRouteCacheEviction(t *testing.T) {
+	t.Parallel()
+
+	cache := newRouteCache(2)
+
+	keys := []routeCacheKey{
+		{amtBucket: 1},
+		{amtBucket: 2},
+		{amtBucket: 3},
+	}
+	paths := [][]*ChannelHop{
+		{{}},
+		{{}, {}},
+		{{}, {}, {}},
+	}
+
+	cache.put(keys[0], paths[0])
+	cache.put(keys[1], paths[1])
+
+	// Using the first path should make the second the least recently
+	// used, so it's the one evicted once the third path is added.
+	if _, ok := cache.get(keys[0]); !ok {
+		t.Fatalf("expected first path to be cached")
+	}
+	cache.put(keys[2], paths[2])
+
+	if _, ok := cache.get(keys[1]); ok {
+		t.Fatalf("expected second path to be evicted")
+	}
+	for _, i := range []int{0, 2} {
+		path, ok := cache.get(keys[i])
+		if !ok {
+			t.Fatalf("expected path %v to be cached", i)
+		}
+		if len(path) != len(paths[i]) {
+			t.Fatalf("expected path %v of %v hops, got %v", i,
+				len(paths[i]), len(path))
+		}
+	}
+
+	if cache.order.Len() != 2 || len(cache.entries) != 2 {
+		t.Fatalf("expected cache of 2 paths, got %v",
+			cache.order.Len())
+	}
+}
@@ -163,6 +163,12 @@ type Config struct {
 	// GraphPruneInterval is used as an interval to determine how often we
 	// should examine the channel graph to garbage collect zombie channels.
 	GraphPruneInterval time.Duration
+
+	// MissionControl, if non-nil, tunes how quickly mission control
+	// forgets the routing failures and successes reported to it, and how
+	// strongly successes bias path finding. If nil, the defaults are
+	// used.
+	MissionControl *MissionControlConfig
 }
 
 // routeTuple is an entry within the ChannelRouter's route cache. We cache
@@ -283,12 +289,19 @@ func New(cfg Config) (*ChannelRouter, error) {
 		return nil, err
 	}
 
+	// We'll restore the failure history of mission control from the
+	// database, so we don't re-probe edges known to be bad.
+	mc := newMissionControl(cfg.Graph, selfNode, cfg.MissionControl)
+	if err := mc.LoadHistory(); err != nil {
+		return nil, err
+	}
+
 	return &ChannelRouter{
 		cfg:               &cfg,
 		networkUpdates:    make(chan *routingMsg),
 		topologyClients:   make(map[uint64]*topologyClient),
 		ntfnClientUpdates: make(chan *topologyClientUpdate),
-		missionControl:    newMissionControl(cfg.Graph, selfNode),
+		missionControl:    mc,
 		channelEdgeMtx:    multimutex.NewMutex(),
 		selfNode:          selfNode,
 		routeCache:        make(map[routeTuple][]*Route),
@@ -392,6 +405,12 @@ func (r *ChannelRouter) Stop() error {
 	close(r.quit)
 	r.wg.Wait()
 
+	// With all goroutines exited, we'll flush the failure history of
+	// mission control so it can be restored on restart.
+	if err := r.missionControl.FlushHistory(); err != nil {
+		log.Errorf("unable to flush mission control history: %v", err)
+	}
+
 	return nil
 }
 
@@ -628,6 +647,9 @@ func (r *ChannelRouter) networkHandler() {
 	graphPruneTicker := time.NewTicker(r.cfg.GraphPruneInterval)
 	defer graphPruneTicker.Stop()
 
+	historyFlushTicker := time.NewTicker(historyFlushInterval)
+	defer historyFlushTicker.Stop()
+
 	// We'll use this validation barrier to ensure that we process all jobs
 	// in the proper order during parallel validation.
 	validationBarrier := NewValidationBarrier(runtime.NumCPU()*4, r.quit)
@@ -712,6 +734,7 @@ func (r *ChannelRouter) networkHandler() {
 			r.routeCacheMtx.Lock()
 			r.routeCache = make(map[routeTuple][]*Route)
 			r.routeCacheMtx.Unlock()
+			r.missionControl.InvalidateRouteCache()
 
 			// TODO(halseth): notify client about the reorg?
 
@@ -781,6 +804,7 @@ func (r *ChannelRouter) networkHandler() {
 			r.routeCacheMtx.Lock()
 			r.routeCache = make(map[routeTuple][]*Route)
 			r.routeCacheMtx.Unlock()
+			r.missionControl.InvalidateRouteCache()
 
 			if len(chansClosed) == 0 {
 				continue
@@ -832,6 +856,15 @@ func (r *ChannelRouter) networkHandler() {
 				log.Errorf("unable to prune zombies: %v", err)
 			}
 
+		// The history flush ticker has ticked, so we'll persist the
+		// failure history of mission control.
+		case <-historyFlushTicker.C:
+			err := r.missionControl.FlushHistory()
+			if err != nil {
+				log.Errorf("unable to flush mission control "+
+					"history: %v", err)
+			}
+
 		// The router has been signalled to exit, to we exit our main
 		// loop so the wait group can be decremented.
 		case <-r.quit:
@@ -1139,6 +1172,7 @@ func (r *ChannelRouter) processUpdate(msg interface{}) error {
 		r.routeCacheMtx.Lock()
 		r.routeCache = make(map[routeTuple][]*Route)
 		r.routeCacheMtx.Unlock()
+		r.missionControl.InvalidateRouteCache()
 	}
 
 	return nil
@@ -1244,7 +1278,8 @@ func pathsToFeeSortedRoutes(source Vertex, paths [][]*ChannelHop, finalCLTVDelta
 			amt, source, path[1:], currentHeight, finalCLTVDelta,
 		)
 		if err != nil {
-			// TODO(roasbeef): report straw breaking edge?
+			log.Debugf("Dropping path unable to carry payment: %v",
+				err)
 			continue
 		}
 
@@ -1469,6 +1504,25 @@ type LightningPayment struct {
 	// the first hop.
 	PaymentHash [32]byte
 
+	// FeeLimit is the maximum total fee that the payment may pay to the
+	// nodes along its route. Routes which would require a larger fee are
+	// rejected. A value of zero indicates that there's no limit.
+	FeeLimit btcutil.Amount
+
+	// CltvLimit is the maximum total time-lock delta of the payment's
+	// route, bounding how long funds may be locked up should the payment
+	// fail. Routes which would require a larger delta are rejected. A
+	// value of zero indicates that there's no limit.
+	CltvLimit uint32
+
+	// MinChannelCapacity is the minimum capacity of each channel within
+	// the payment's route. Channels with a capacity barely above the
+	// payment amount are unlikely to have the liquidity to carry it, so
+	// this allows them to be skipped, rather than discovered via failure.
+	// Channels with a capacity below the payment amount are always
+	// skipped.
+	MinChannelCapacity btcutil.Amount
+
 	// FinalCLTVDelta is the CTLV expiry delta to use for the _final_ hop
 	// in the route. This means that the final hop will have a CLTV delta
 	// of at least: currentHeight + FinalCLTVDelta. If this value is
@@ -1770,7 +1824,8 @@ func (r *ChannelRouter) SendPayment(payment *LightningPayment) ([32]byte, *Route
 
 			// It's likely that the outgoing channel didn't have
 			// sufficient capacity, so we'll prune this edge for
-			// now, and continue onwards with our path finding.
+			// payments of at least this amount for now, and
+			// continue onwards with our path finding.
 			case *lnwire.FailTemporaryChannelFailure:
 				update := onionErr.Update
 				if err := r.applyChannelUpdate(update); err != nil {
@@ -1778,7 +1833,7 @@ func (r *ChannelRouter) SendPayment(payment *LightningPayment) ([32]byte, *Route
 						"update for onion error: %v", err)
 				}
 
-				pruneEdgeFailure(paySession, route, errSource)
+				pruneEdgeAmtFailure(paySession, route, errSource)
 				continue
 
 			// If the send fail due to a node not having the
@@ -1835,6 +1890,16 @@ func (r *ChannelRouter) SendPayment(payment *LightningPayment) ([32]byte, *Route
 			}
 		}
 
+		// As the payment succeeded, we'll report each channel and node
+		// along the route to mission control, such that later
+		// payments favor them.
+		for _, hop := range route.Hops {
+			paySession.ReportChannelSuccess(hop.Channel.ChannelID)
+			paySession.ReportVertexSuccess(
+				Vertex(hop.Channel.Node.PubKeyBytes),
+			)
+		}
+
 		return preImage, route, nil
 	}
 }
@@ -1871,6 +1936,56 @@ func pruneVertexFailure(paySession *paymentSession, route *Route,
 func pruneEdgeFailure(paySession *paymentSession, route *Route,
 	errSource *btcec.PublicKey) {
 
+	badChan, ok := failedChannel(route, errSource)
+	if !ok {
+		return
+	}
+
+	// If the channel was found, then we'll inform mission control of this
+	// failure so future attempts avoid this link, in the direction of the
+	// failure, temporarily.
+	towardNode := Vertex(badChan.Node.PubKeyBytes)
+	paySession.ReportChannelFailure(badChan.ChannelID, &towardNode)
+}
+
+// pruneEdgeAmtFailure will attempt to prune an edge from the current available
+// edges of the target payment session, in response to an encountered routing
+// error indicating that the edge couldn't carry the amount of the HTLC. Other
+// payment sessions will only avoid the edge for payments of at least that
+// amount.
+func pruneEdgeAmtFailure(paySession *paymentSession, route *Route,
+	errSource *btcec.PublicKey) {
+
+	badChan, ok := failedChannel(route, errSource)
+	if !ok {
+		return
+	}
+
+	// We'll locate the hop which carried the HTLC over the channel, so we
+	// can report the amount which failed in the direction it was sent.
+	towardNode := Vertex(badChan.Node.PubKeyBytes)
+	for _, hop := range route.Hops {
+		if hop.Channel.ChannelID != badChan.ChannelID {
+			continue
+		}
+
+		paySession.ReportChannelFailureAmt(
+			badChan.ChannelID, &towardNode,
+			hop.AmtToForward.ToSatoshis(),
+		)
+		return
+	}
+
+	// If the hop couldn't be found, then we'll fall back to pruning the
+	// edge regardless of the amount.
+	paySession.ReportChannelFailure(badChan.ChannelID, &towardNode)
+}
+
+// failedChannel returns the channel within the route that was unable to carry
+// an HTLC, given the source of the routing error.
+func failedChannel(route *Route, errSource *btcec.PublicKey) (*ChannelHop,
+	bool) {
+
 	// As this error indicates that the target channel was unable to carry
 	// this HTLC (for w/e reason), we'll query the index to find the
 	// _outgoing_ channel the source of the error was meant to pass the
@@ -1884,15 +1999,13 @@ func pruneEdgeFailure(paySession *paymentSession, route *Route,
 		)
 
 		if !ok {
-			return
+			return nil, false
 		}
 
 		badChan = prevChan
 	}
 
-	// If the channel was found, then we'll inform mission control of this
-	// failure so future attempts avoid this link temporarily.
-	paySession.ReportChannelFailure(badChan.ChannelID)
+	return badChan, true
 }
 
 // applyChannelUpdate applies a channel update directly to the database,
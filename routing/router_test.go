@@ -1592,7 +1592,7 @@ func TestFindPathFeeWeighting(t *testing.T) {
 	}
 
 	ignoreVertex := make(map[Vertex]struct{})
-	ignoreEdge := make(map[uint64]struct{})
+	ignoreEdge := make(map[directedEdge]struct{})
 
 	amt := lnwire.MilliSatoshi(100)
 
@@ -1606,7 +1606,7 @@ func TestFindPathFeeWeighting(t *testing.T) {
 	// path even though the direct path has a higher potential time lock.
 	path, err := findPath(
 		nil, ctx.graph, sourceNode, target, ignoreVertex, ignoreEdge,
-		amt,
+		nil, amt, 0,
 	)
 	if err != nil {
 		t.Fatalf("unable to find path: %v", err)
@@ -1860,3 +1860,62 @@ func TestIsStaleEdgePolicy(t *testing.T) {
 		t.Fatalf("router failed to detect fresh edge policy")
 	}
 }
+
+// TestChannelUpdateInvalidatesMissionControl tests that applying a channel
+// update to the graph evicts the paths cached by mission control, such that
+// later payment sessions don't route using stale channel policies.
+func TestChannelUpdateInvalidatesMissionControl(t *testing.T) {
+	t.Parallel()
+
+	const startingBlockHeight = 101
+	ctx, cleanUp, err := createTestCtx(startingBlockHeight, basicGraphFilePath)
+	defer cleanUp()
+	if err != nil {
+		t.Fatalf("unable to create router: %v", err)
+	}
+
+	mc := ctx.router.missionControl
+
+	// Requesting a route for a fresh session should result in its path
+	// being cached.
+	payment := &LightningPayment{
+		Target: ctx.aliases["sophon"],
+		Amount: lnwire.NewMSatFromSatoshis(100),
+	}
+	route, err := mc.NewPaymentSession().RequestRoute(
+		payment, startingBlockHeight, 9,
+	)
+	if err != nil {
+		t.Fatalf("unable to request route: %v", err)
+	}
+	if mc.routeCache.order.Len() != 1 {
+		t.Fatalf("expected 1 cached path, got %v",
+			mc.routeCache.order.Len())
+	}
+
+	mc.Lock()
+	generation := mc.generation
+	mc.Unlock()
+
+	// We'll now apply a fresh update to the policy of the first hop of the
+	// route, raising its fee.
+	update := *route.Hops[0].Channel.ChannelEdgePolicy
+	update.LastUpdate = update.LastUpdate.Add(time.Second)
+	update.FeeBaseMSat += 1000
+	if err := ctx.router.UpdateEdge(&update); err != nil {
+		t.Fatalf("unable to update edge policy: %v", err)
+	}
+
+	// As the cached path carries the prior policy, it should have been
+	// evicted, and the generation bumped such that any searches in flight
+	// can't cache their paths for new sessions.
+	if mc.routeCache.order.Len() != 0 {
+		t.Fatalf("expected route cache to be purged, found %v paths",
+			mc.routeCache.order.Len())
+	}
+	mc.Lock()
+	defer mc.Unlock()
+	if mc.generation == generation {
+		t.Fatalf("expected generation to be bumped on graph update")
+	}
+}
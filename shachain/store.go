@@ -74,6 +74,13 @@ func NewRevocationStoreFromBytes(r io.Reader) (*RevocationStore, error) {
 		return nil, err
 	}
 
+	// As the buckets are stored within a fixed size array, we'll ensure a
+	// corrupted length can't cause us to index past its end.
+	if store.lenBuckets > maxHeight {
+		return nil, errors.Errorf("number of buckets %v exceeds max "+
+			"height %v", store.lenBuckets, maxHeight)
+	}
+
 	for i := uint8(0); i < store.lenBuckets; i++ {
 		var hashIndex index
 		err := binary.Read(r, binary.BigEndian, &hashIndex)
@@ -471,3 +471,14 @@ func TestShaChainStore(t *testing.T) {
 		}
 	}
 }
+
+// TestShaChainStoreCorruptLength checks that a store whose encoded number of
+// buckets exceeds the maximum height fails to decode rather than panicking.
+func TestShaChainStoreCorruptLength(t *testing.T) {
+	t.Parallel()
+
+	b := bytes.NewReader([]byte{maxHeight + 1})
+	if _, err := NewRevocationStoreFromBytes(b); err == nil {
+		t.Fatal("store with too many buckets should fail to decode")
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/lightningnetwork/lnd/channeldb"
 	"github.com/lightningnetwork/lnd/lnwallet"
 	"github.com/roasbeef/btcd/blockchain"
+	"github.com/roasbeef/btcd/chaincfg/chainhash"
 	"github.com/roasbeef/btcd/txscript"
 	"github.com/roasbeef/btcd/wire"
 	"github.com/roasbeef/btcutil"
@@ -1155,7 +1156,7 @@ func (u *utxoNursery) registerSweepConf(finalTx *wire.MsgTx,
 		finalTxID, heightHint)
 
 	u.wg.Add(1)
-	go u.waitForSweepConf(heightHint, kgtnOutputs, confChan)
+	go u.waitForSweepConf(heightHint, kgtnOutputs, finalTxID, confChan)
 
 	return nil
 }
@@ -1166,7 +1167,8 @@ func (u *utxoNursery) registerSweepConf(finalTx *wire.MsgTx,
 // to mark any mature channels as fully closed in channeldb.
 // NOTE(conner): this method MUST be called as a go routine.
 func (u *utxoNursery) waitForSweepConf(classHeight uint32,
-	kgtnOutputs []kidOutput, confChan *chainntnfs.ConfirmationEvent) {
+	kgtnOutputs []kidOutput, sweepTxid chainhash.Hash,
+	confChan *chainntnfs.ConfirmationEvent) {
 
 	defer u.wg.Done()
 
@@ -1188,8 +1190,10 @@ func (u *utxoNursery) waitForSweepConf(classHeight uint32,
 
 	// TODO(conner): add retry logic?
 
-	// Mark the confirmed kindergarten outputs as graduated.
-	if err := u.cfg.Store.GraduateKinder(classHeight); err != nil {
+	// Mark the confirmed kindergarten outputs as graduated, recording the
+	// sweep txn that consumed them.
+	_, err := u.cfg.Store.GraduateKinderWithSweep(classHeight, sweepTxid)
+	if err != nil {
 		utxnLog.Errorf("Unable to graduate %v kindergarten outputs: "+
 			"%v", len(kgtnOutputs), err)
 		return
@@ -1705,6 +1709,40 @@ func (bo *babyOutput) Decode(r io.Reader) error {
 	return bo.kidOutput.Decode(r)
 }
 
+// kidOutputOrigin records the path through which a kidOutput entered the
+// kindergarten bucket. Outputs may arrive either directly from the commitment
+// transaction via the preschool bucket, or as the output of a confirmed
+// second-stage HTLC transaction.
+type kidOutputOrigin uint8
+
+const (
+	// kidOriginUnknown is the origin of any kidOutput that was serialized
+	// before origins were tracked, or that has not yet reached the
+	// kindergarten bucket. The origin of such outputs can be inferred from
+	// their witness type.
+	kidOriginUnknown kidOutputOrigin = 0
+
+	// kidOriginCommitment denotes an output that was moved to kindergarten
+	// directly from the commitment transaction, via PreschoolToKinder.
+	kidOriginCommitment kidOutputOrigin = 1
+
+	// kidOriginHtlcSecondStage denotes an output produced by a confirmed
+	// second-stage HTLC transaction.
+	kidOriginHtlcSecondStage kidOutputOrigin = 2
+)
+
+// String returns a human readable description of the origin.
+func (o kidOutputOrigin) String() string {
+	switch o {
+	case kidOriginCommitment:
+		return "Commitment"
+	case kidOriginHtlcSecondStage:
+		return "HtlcSecondStage"
+	default:
+		return "Unknown"
+	}
+}
+
 // kidOutput represents an output that's waiting for a required blockheight
 // before its funds will be available to be moved into the user's wallet.  The
 // struct includes a WitnessGenerator closure which will be used to generate
@@ -1738,6 +1776,20 @@ type kidOutput struct {
 	absoluteMaturity uint32
 
 	confHeight uint32
+
+	// origin records whether this output reached the kindergarten bucket
+	// from the commitment transaction, or from a second-stage HTLC
+	// transaction. Legacy outputs will have an unknown origin.
+	origin kidOutputOrigin
+
+	// sweepFeeRate is the fee rate, in sat/kb, last used to sweep this
+	// output. This will be zero if the output has not yet been swept, or
+	// was persisted before the fee rate was tracked.
+	sweepFeeRate btcutil.Amount
+
+	// broadcastAttempts is the number of times a sweep of this output has
+	// been broadcast with a bumped fee rate.
+	broadcastAttempts uint32
 }
 
 func makeKidOutput(outpoint, originChanPoint *wire.OutPoint,
@@ -1778,6 +1830,42 @@ func (k *kidOutput) ConfHeight() uint32 {
 	return k.confHeight
 }
 
+// SweepFeeRate returns the fee rate, in sat/kb, last used to sweep this
+// output.
+func (k *kidOutput) SweepFeeRate() btcutil.Amount {
+	return k.sweepFeeRate
+}
+
+// BroadcastAttempts returns the number of times a sweep of this output has
+// been broadcast with a bumped fee rate.
+func (k *kidOutput) BroadcastAttempts() uint32 {
+	return k.broadcastAttempts
+}
+
+// Origin returns the path through which this output entered the kindergarten
+// bucket. If the origin was never recorded, as is the case for legacy
+// outputs, it is inferred from the output's witness type.
+func (k *kidOutput) Origin() kidOutputOrigin {
+	if k.origin != kidOriginUnknown {
+		return k.origin
+	}
+
+	switch k.WitnessType() {
+	case lnwallet.HtlcAcceptedSuccessSecondLevel,
+		lnwallet.HtlcOfferedTimeoutSecondLevel:
+
+		return kidOriginHtlcSecondStage
+
+	case lnwallet.CommitmentTimeLock,
+		lnwallet.HtlcOfferedRemoteTimeout:
+
+		return kidOriginCommitment
+
+	default:
+		return kidOriginUnknown
+	}
+}
+
 // Encode converts a KidOutput struct into a form suitable for on-disk database
 // storage. Note that the signDescriptor struct field is included so that the
 // output's witness can be generated by createSweepTx() when the output becomes
@@ -1820,7 +1908,23 @@ func (k *kidOutput) Encode(w io.Writer) error {
 		return err
 	}
 
-	return lnwallet.WriteSignDescriptor(w, k.SignDesc())
+	if err := lnwallet.WriteSignDescriptor(w, k.SignDesc()); err != nil {
+		return err
+	}
+
+	scratch[0] = byte(k.origin)
+	if _, err := w.Write(scratch[:1]); err != nil {
+		return err
+	}
+
+	byteOrder.PutUint64(scratch[:], uint64(k.sweepFeeRate))
+	if _, err := w.Write(scratch[:]); err != nil {
+		return err
+	}
+
+	byteOrder.PutUint32(scratch[:4], k.broadcastAttempts)
+	_, err := w.Write(scratch[:4])
+	return err
 }
 
 // Decode takes a byte array representation of a kidOutput and converts it to an
@@ -1867,7 +1971,36 @@ func (k *kidOutput) Decode(r io.Reader) error {
 	}
 	k.witnessType = lnwallet.WitnessType(byteOrder.Uint16(scratch[:2]))
 
-	return lnwallet.ReadSignDescriptor(r, &k.signDesc)
+	if err := lnwallet.ReadSignDescriptor(r, &k.signDesc); err != nil {
+		return err
+	}
+
+	// Outputs serialized before the origin was tracked will not have a
+	// trailing origin byte, in which case we leave it as unknown.
+	if _, err := r.Read(scratch[:1]); err == io.EOF {
+		k.origin = kidOriginUnknown
+		return nil
+	} else if err != nil {
+		return err
+	}
+	k.origin = kidOutputOrigin(scratch[0])
+
+	// Similarly, outputs serialized before fee bumping was tracked will
+	// not have a trailing fee rate or broadcast count, in which case both
+	// are left as zero.
+	if _, err := io.ReadFull(r, scratch[:]); err == io.EOF {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	k.sweepFeeRate = btcutil.Amount(byteOrder.Uint64(scratch[:]))
+
+	if _, err := io.ReadFull(r, scratch[:4]); err != nil {
+		return err
+	}
+	k.broadcastAttempts = byteOrder.Uint32(scratch[:4])
+
+	return nil
 }
 
 // TODO(bvu): copied from channeldb, remove repetition
@@ -1877,6 +2010,12 @@ func writeOutpoint(w io.Writer, o *wire.OutPoint) error {
 
 	// TODO(roasbeef): write raw 32 bytes instead of wasting the extra
 	// byte.
+	//
+	// NOTE: Unlike the channeldb variant, this encoding is persisted within
+	// both the keys and values of the nursery store, the retribution store
+	// and the funding manager's channel opening state. Switching to the
+	// raw encoding therefore requires a migration of each of those stores
+	// in lock step, as channeldb is unable to decode their values.
 	if err := wire.WriteVarBytes(w, 0, o.Hash[:]); err != nil {
 		return err
 	}
@@ -379,3 +379,88 @@ func TestBabyOutputSerialization(t *testing.T) {
 
 	}
 }
+
+// TestKidOutputLegacyFeeRate asserts that kid outputs serialized before the
+// sweep fee rate and broadcast attempts were tracked can still be decoded,
+// with both fields left as zero.
+func TestKidOutputLegacyFeeRate(t *testing.T) {
+	for i, kid := range kidOutputs {
+		kid.sweepFeeRate = 5000
+		kid.broadcastAttempts = 3
+
+		var b bytes.Buffer
+		if err := kid.Encode(&b); err != nil {
+			t.Fatalf("Encode #%d: unable to serialize "+
+				"kid output: %v", i, err)
+		}
+
+		// Strip the trailing fee rate and broadcast count to mimic
+		// the legacy serialization format.
+		legacyBytes := b.Bytes()[:b.Len()-12]
+
+		var deserializedKid kidOutput
+		err := deserializedKid.Decode(bytes.NewReader(legacyBytes))
+		if err != nil {
+			t.Fatalf("Decode #%d: unable to deserialize "+
+				"legacy kid output: %v", i, err)
+		}
+
+		if deserializedKid.origin != kid.origin {
+			t.Fatalf("Decode #%d: expected origin %v, got %v", i,
+				kid.origin, deserializedKid.origin)
+		}
+		if deserializedKid.SweepFeeRate() != 0 ||
+			deserializedKid.BroadcastAttempts() != 0 {
+
+			t.Fatalf("Decode #%d: expected zero fee rate and "+
+				"attempts, got %v and %v", i,
+				deserializedKid.SweepFeeRate(),
+				deserializedKid.BroadcastAttempts())
+		}
+	}
+}
+
+// TestKidOutputLegacyOrigin asserts that kid outputs serialized before the
+// origin was tracked can still be decoded, and that their origin is inferred
+// from the witness type.
+func TestKidOutputLegacyOrigin(t *testing.T) {
+	for i, kid := range kidOutputs {
+		var b bytes.Buffer
+		if err := kid.Encode(&b); err != nil {
+			t.Fatalf("Encode #%d: unable to serialize "+
+				"kid output: %v", i, err)
+		}
+
+		// Strip the trailing origin byte, along with the fee rate
+		// and broadcast count that follow it, to mimic the legacy
+		// serialization format.
+		legacyBytes := b.Bytes()[:b.Len()-13]
+
+		var deserializedKid kidOutput
+		err := deserializedKid.Decode(bytes.NewReader(legacyBytes))
+		if err != nil {
+			t.Fatalf("Decode #%d: unable to deserialize "+
+				"legacy kid output: %v", i, err)
+		}
+
+		if deserializedKid.origin != kidOriginUnknown {
+			t.Fatalf("Decode #%d: expected unknown origin, got %v",
+				i, deserializedKid.origin)
+		}
+
+		var expOrigin kidOutputOrigin
+		switch kid.WitnessType() {
+		case lnwallet.HtlcAcceptedSuccessSecondLevel,
+			lnwallet.HtlcOfferedTimeoutSecondLevel:
+			expOrigin = kidOriginHtlcSecondStage
+		case lnwallet.CommitmentTimeLock,
+			lnwallet.HtlcOfferedRemoteTimeout:
+			expOrigin = kidOriginCommitment
+		}
+
+		if deserializedKid.Origin() != expOrigin {
+			t.Fatalf("Origin #%d: expected %v, got %v", i,
+				expOrigin, deserializedKid.Origin())
+		}
+	}
+}